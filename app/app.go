@@ -8,7 +8,13 @@ import (
 	"github.com/urfave/cli/v2"
 
 	"github.com/ipld/go-ipldtool/app/basic"
+	"github.com/ipld/go-ipldtool/app/cids"
+	"github.com/ipld/go-ipldtool/app/codecs"
+	"github.com/ipld/go-ipldtool/app/graph"
 	"github.com/ipld/go-ipldtool/app/schema"
+	"github.com/ipld/go-ipldtool/app/shell"
+	"github.com/ipld/go-ipldtool/app/stat"
+	"github.com/ipld/go-ipldtool/app/unixfs"
 	"github.com/ipld/go-ipldtool/app/workspace"
 )
 
@@ -20,9 +26,19 @@ func Main(args []string, stdin io.Reader, stdout, stderr io.Writer) (int, error)
 		ErrWriter: stderr,
 		Commands: []*cli.Command{
 			basic.Cmd_Put,
+			basic.Cmd_Hash,
 			basic.Cmd_Read,
+			basic.Cmd_Ls,
+			shell.Cmd_Shell,
 			workspace.Cmd_Workspace,
 			schema.Cmd_Schema,
+			schema.Cmd_Validate,
+			codecs.Cmd_Codecs,
+			codecs.Cmd_Canon,
+			cids.Cmd_Cid,
+			graph.Cmd_Graph,
+			stat.Cmd_Stat,
+			unixfs.Cmd_Fs,
 		},
 	}
 
@@ -0,0 +1,229 @@
+package basic
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/schema"
+	mh "github.com/multiformats/go-multihash"
+
+	"github.com/ipld/go-ipldtool/app/shared"
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+var Cmd_Hash = &cli.Command{
+	Name:     "hash",
+	Category: "Basic",
+	Usage:    "Compute the CID for some data, without storing it.",
+	UsageText: `Hash is for finding out what CID some data would have, without putting it anywhere.` + "\n" +
+		"\n" +
+		`   ### Synopsis` + "\n" +
+		"\n" +
+		`   ipld [...global args...] hash <filename|"-">` + "\n" +
+		`           [--input="codec:"<multicodec-name-or-hex>]` + "\n" +
+		`           [--codec=<multicodec-name>|"codec:"<multicodec-name-or-hex>]` + "\n" +
+		`           [--hash=<multihash-name>|"0x"<multihash-indicator-hex>]` + "\n" +
+		`           [--cid-version=<0|1>]` + "\n" +
+		`           [--raw]` + "\n" +
+		"\n" +
+		`   The data is read from the file (or stdin, if the argument is a dash ("-")), decoded, and then encoded again using the codec given by the "--codec" flag (dag-cbor, by default), exactly as the put command would; then it's hashed, and the CID is printed.  Nothing is stored, and no workspace is needed.  With the default flags, the CID is the same one that put would give.` + "\n" +
+		"\n" +
+		`   When the "--input" flag is not given, the same heuristic as in the read command is used to guess the input codec.  (As in put, when the codec is raw, the input is taken as raw bytes, unless otherwise specified.)` + "\n" +
+		"\n" +
+		`   With the "--raw" flag, the input isn't decoded at all: its bytes are hashed exactly as they are.  The CID says the data is raw, unless the "--codec" flag says otherwise; this is useful for finding the CID of a block that's already encoded.` + "\n" +
+		"\n" +
+		`   Any multihash function that's registered in go-multihash can be used, such as sha2-256, sha2-512, sha3-384, blake3, or any of the blake2b and blake2s sizes (like blake2b-256).` + "\n" +
+		"\n" +
+		`   CIDv0s are always dag-pb and sha2-256, so "--cid-version=0" only works with "--codec=dag-pb" and "--hash=sha2-256".` + "\n",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "input",
+			Usage: `Defines what format the input should be expected to be in.  Valid arguments must start with "codec:" followed by a multicodec name, or "codec:0x" followed by a multicodec indicator number in hexidecimal.`,
+		},
+		&cli.StringFlag{
+			Name:        "codec",
+			Usage:       `Defines what codec the data should be encoded in before hashing (or, with "--raw", what codec the CID should say it's in).  Valid arguments are a multicodec name, or "codec:" followed by a multicodec name, or "codec:0x" followed by a multicodec indicator number in hexidecimal.`,
+			DefaultText: `dag-cbor, or raw with "--raw"`,
+		},
+		&cli.StringFlag{
+			Name:        "hash",
+			Usage:       `Defines what multihash function to use.  Valid arguments are a multihash name, or "0x" followed by a multihash indicator number in hexidecimal.`,
+			DefaultText: "sha3-384",
+		},
+		&cli.StringFlag{
+			Name:        "cid-version",
+			Usage:       `The CID version to make: "0" or "1".`,
+			DefaultText: "1",
+		},
+		&cli.BoolFlag{
+			Name:  "raw",
+			Usage: `Hash the input bytes exactly as they are, without decoding them.`,
+		},
+	},
+	Action: Action_Hash,
+}
+
+// Action_Hash is the function that implements the `ipld hash` command's behaviors.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- for incomprehensible or invalid arguments (including multihashes with no hash function available, and impossible CIDv0s).
+//   - ipldtool-error-codec-unknown -- if no input codec was given, and none could be guessed.
+//   - ipldtool-error-data-invalid -- if the data couldn't be decoded, or can't be encoded in the requested codec.
+//   - ipldtool-error-io -- if the input couldn't be read (when hashing raw bytes).
+func Action_Hash(args *cli.Context) error {
+	// Parse positional args.
+	if args.Args().Len() != 1 {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'hash' command needs exactly one positional argument")
+	}
+	raw := args.Bool("raw")
+	if raw && args.IsSet("input") {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "the input argument can't be used with the raw argument; raw input isn't decoded")
+	}
+
+	// Figure out the codec.
+	//  Bare names are accepted here (as well as the usual "codec:" forms), as with put.
+	codecArg := args.String("codec")
+	switch {
+	case codecArg == "" && raw:
+		codecArg = "codec:raw"
+	case codecArg == "":
+		codecArg = "codec:dag-cbor"
+	case !strings.HasPrefix(codecArg, "codec:"):
+		codecArg = "codec:" + codecArg
+	}
+	code, err := shared.ParseCodecArg(codecArg, "codec")
+	if err != nil {
+		return err
+	}
+	outputCodec, _ := shared.LookupCodec(code)
+	if !raw && outputCodec.Encoder == nil {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "codec argument not recognized: %q is not a supported codec for encoding", outputCodec.Name)
+	}
+
+	// Figure out the rest of the CID prefix.
+	prefix, err := parseHashPrefix(args.String("hash"), args.String("cid-version"), outputCodec)
+	if err != nil {
+		return err
+	}
+	lp := cidlink.LinkPrototype{Prefix: prefix}
+
+	// Let's get some data!
+	reader, link, err := shared.ParseDataSourceArg(args.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	if link != nil {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'hash' command needs a filename or \"-\" as its argument; %s is already a CID", link)
+	}
+
+	// Raw input just goes straight into the hasher.
+	if raw {
+		hasher, _ := mh.GetHasher(prefix.MhType) // Already checked by parseHashPrefix.
+		if _, err := io.Copy(hasher, reader); err != nil {
+			return ipldtoolerr.Newf("ipldtool-error-io", "could not read input: %s", err)
+		}
+		fmt.Fprintf(args.App.Writer, "%s\n", lp.BuildLink(hasher.Sum(nil)))
+		return nil
+	}
+
+	// Determine the input codec, the same way put does.
+	var inputCodec shared.CodecInfo
+	switch {
+	case args.IsSet("input"):
+		inputCodec, err = shared.ParseDecoderArg(args.String("input"), "input")
+	case outputCodec.Code == 0x55:
+		inputCodec = outputCodec
+	default:
+		inputCodec, err = shared.SniffCodec(reader)
+	}
+	if err != nil {
+		return err
+	}
+	var np datamodel.NodePrototype = basicnode.Prototype.Any
+	if inputCodec.Prototype != nil {
+		np = inputCodec.Prototype
+	}
+	n, err := ipld.DecodeStreamingUsingPrototype(reader, inputCodec.Decoder, np)
+	if err != nil {
+		return ipldtoolerr.Newf(shared.ErrCode_DataInvalid, "could not decode input as %s: %s", inputCodec.Name, err)
+	}
+	n, err = outputCodec.Conform(n)
+	if err != nil {
+		return err
+	}
+	if tn, ok := n.(schema.TypedNode); ok {
+		n = tn.Representation()
+	}
+
+	// Hash!
+	//  The LinkSystem has no storage at all: ComputeLink only encodes and hashes.
+	lsys := cidlink.DefaultLinkSystem()
+	lnk, err := lsys.ComputeLink(lp, n)
+	if err != nil {
+		return ipldtoolerr.Newf(shared.ErrCode_DataInvalid, "could not encode data as %s: %s", outputCodec.Name, err)
+	}
+	fmt.Fprintf(args.App.Writer, "%s\n", lnk)
+	return nil
+}
+
+// parseHashPrefix puts together the CID prefix for the "--hash" and "--cid-version" flags, and the codec.
+// An empty hash argument means the same hash that put uses; an empty version means version 1.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- if the hash is unknown or has no hash function available, the version is unknown, or a CIDv0 can't be made with this codec and hash.
+func parseHashPrefix(hashArg string, versionArg string, outputCodec shared.CodecInfo) (cid.Prefix, error) {
+	hashCode := uint64(mh.SHA3_384) // The same as put, so that the CIDs match.
+	switch {
+	case hashArg == "":
+	case strings.HasPrefix(hashArg, "0x"):
+		var err error
+		hashCode, err = strconv.ParseUint(hashArg[2:], 16, 64)
+		if err != nil {
+			return cid.Prefix{}, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "hash argument not recognized: %q is not a valid hexidecimal number", hashArg)
+		}
+	default:
+		var known bool
+		hashCode, known = mh.Names[hashArg]
+		if !known {
+			return cid.Prefix{}, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "hash argument not recognized: %q is not a known multihash name (for example: sha2-256, sha3-384, blake3, blake2b-256)", hashArg)
+		}
+	}
+	if _, err := mh.GetHasher(hashCode); err != nil {
+		name := mh.Codes[hashCode]
+		if name == "" {
+			name = fmt.Sprintf("0x%x", hashCode)
+		}
+		return cid.Prefix{}, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "hash argument not recognized: %s has no hash function available", name)
+	}
+
+	var version uint64
+	switch versionArg {
+	case "", "1":
+		version = 1
+	case "0":
+		if outputCodec.Code != cid.DagProtobuf || hashCode != mh.SHA2_256 {
+			return cid.Prefix{}, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "can't make a CIDv0 with %s and %s: those can only be dag-pb and sha2-256", outputCodec.Name, mh.Codes[hashCode])
+		}
+		version = 0
+	default:
+		return cid.Prefix{}, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "cid-version argument not recognized: must be either 0 or 1")
+	}
+
+	return cid.Prefix{
+		Version:  version,
+		Codec:    outputCodec.Code,
+		MhType:   hashCode,
+		MhLength: -1, // The hash function's own length.
+	}, nil
+}
@@ -0,0 +1,15 @@
+package basic_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/ipld/go-ipldtool/app/testutil"
+)
+
+func TestHash(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+	testutil.TestExecSpec(t, "../../docs/hash.md")
+}
@@ -0,0 +1,255 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+
+	"github.com/ipld/go-ipldtool/app/shared"
+	"github.com/ipld/go-ipldtool/app/workspace"
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+var Cmd_Ls = &cli.Command{
+	Name:     "ls",
+	Category: "Basic",
+	Usage:    "List the links in a block of data (or in a whole DAG), and whether the blocks they point to are in storage.",
+	UsageText: `Ls is for seeing where data links to, without printing all of it.` + "\n" +
+		"\n" +
+		`   ### Synopsis` + "\n" +
+		"\n" +
+		`   ipld [...global args...] ls <CID|filename|"-">` + "\n" +
+		`           [--input="codec:"<multicodec-name-or-hex>]` + "\n" +
+		`           [--output=<"text"|"codec:"<multicodec-name-or-hex>>]` + "\n" +
+		`           [--recursive]` + "\n" +
+		`           [--missing]` + "\n" +
+		"\n" +
+		`   The data is given the same way as for the read command: a CID to load from storage, a filename (which must start with "./" or "/"), or "-" for stdin.  When it's not a CID, the input codec can be given with the "--input" flag, or else it's guessed, as in the read command.` + "\n" +
+		"\n" +
+		`   Every link in the data is listed, one per line, with its data model path, the CID it points to, the codec that CID says the data is in, and whether the block it points to is in the workspace storage ("present") or not ("missing").` + "\n" +
+		"\n" +
+		`   With the "--recursive" flag, the blocks that are present are loaded too, and their links are listed, and so on, all the way down.  Paths then start from the top of the data, going through links, the same as paths given to the read command do.  Each block is only looked into once, even if many links point to it; its links are listed under the path it was first reached by (the walk is breadth-first, so that's the shortest).` + "\n" +
+		"\n" +
+		`   With the "--missing" flag, only the links to blocks that aren't in storage are listed.  Together with "--recursive", this finds all the holes in a DAG that's only partly there.` + "\n" +
+		"\n" +
+		`   With "--output=codec:dag-json" (or any other codec), each link is printed as a map instead, on its own line.` + "\n",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "input",
+			Usage: `Defines what format the input should be expected to be in.  Only relevant if the input is from a file or stdin; if the data source is a CID, that already implies a codec.  Valid arguments must start with "codec:" followed by a multicodec name, or "codec:0x" followed by a multicodec indicator number in hexidecimal.`,
+		},
+		&cli.StringFlag{
+			Name:        "output",
+			Usage:       `Defines what format the links should be printed in.  Valid arguments are "text", or the word "codec:" followed by a multicodec name, or "codec:0x" followed by a multicodec indicator number in hexidecimal.  With a codec, each link is a map, printed on its own line.`,
+			DefaultText: "text",
+		},
+		&cli.BoolFlag{
+			Name:  "recursive",
+			Usage: `Also list the links in the blocks that are linked to, and so on, as far as the blocks are in storage.`,
+		},
+		&cli.BoolFlag{
+			Name:  "missing",
+			Usage: `Only list links to blocks that aren't in storage.`,
+		},
+	},
+	Action: Action_Ls,
+}
+
+// Action_Ls is the function that implements the `ipld ls` command's behaviors.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- for incomprehensible or invalid arguments.
+//   - ipldtool-error-codec-unknown -- if no input codec was given, and none could be guessed.
+//   - ipldtool-error-data-invalid -- if the data (or, when recursing, any block that's in storage) couldn't be decoded.
+//   - ipldtool-error-load-failed -- if the data source is a CID, and it couldn't be loaded.
+//   - ipldtool-workspace-not-found -- if there's no workspace to check for blocks in.
+func Action_Ls(args *cli.Context) error {
+	// Parse positional args.
+	if args.Args().Len() != 1 {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'ls' command needs exactly one positional argument")
+	}
+	reader, link, err := shared.ParseDataSourceArg(args.Args().Get(0))
+	if err != nil {
+		return err
+	}
+
+	// Parse the rest of the flags.
+	var encoder codec.Encoder
+	if arg := args.String("output"); arg != "" && arg != "text" {
+		encoder, err = shared.ParseEncoderArg(arg, "text", "output")
+		if err != nil {
+			return err
+		}
+	}
+	if link != nil && args.IsSet("input") {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "the input argument can't be used with a CID; the CID already states the codec")
+	}
+
+	// Get the first block.
+	ctx := context.Background()
+	store := &workspace.LazyStorage{}
+	defer store.Close()
+	var n datamodel.Node
+	if link != nil {
+		n, err = loadBlock(ctx, store, link)
+		if err != nil {
+			return err
+		}
+		if n == nil {
+			return ipldtoolerr.Newf(shared.ErrCode_CodecUnknown, "%s is in codec %s, which has no decoder available", link, codecName(link))
+		}
+	} else {
+		var inputCodec shared.CodecInfo
+		if args.IsSet("input") {
+			inputCodec, err = shared.ParseDecoderArg(args.String("input"), "input")
+		} else {
+			inputCodec, err = shared.SniffCodec(reader)
+		}
+		if err != nil {
+			return err
+		}
+		var np datamodel.NodePrototype = basicnode.Prototype.Any
+		if inputCodec.Prototype != nil {
+			np = inputCodec.Prototype
+		}
+		n, err = ipld.DecodeStreamingUsingPrototype(reader, inputCodec.Decoder, np)
+		if err != nil {
+			return ipldtoolerr.Newf(shared.ErrCode_DataInvalid, "could not decode input as %s: %s", inputCodec.Name, err)
+		}
+	}
+
+	// Set up the printing.
+	tw := tabwriter.NewWriter(args.App.Writer, 0, 4, 2, ' ', 0)
+	defer tw.Flush()
+	printLink := func(at datamodel.Path, lnk datamodel.Link, present bool) error {
+		if encoder == nil {
+			state := "present"
+			if !present {
+				state = "missing"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", at, lnk, codecName(lnk), state)
+			return nil
+		}
+		return printLinkMap(args.App.Writer, encoder, at, lnk, present)
+	}
+
+	// Walk the links, breadth-first, looking into each block only once.
+	//  Whether a block is present is remembered too, since many links might point to it.
+	type step struct {
+		node datamodel.Node
+		at   datamodel.Path
+	}
+	queue := []step{{n, datamodel.Path{}}}
+	presence := map[string]bool{}
+	if link != nil {
+		presence[link.Binary()] = true
+	}
+	for len(queue) > 0 {
+		here := queue[0]
+		queue = queue[1:]
+		var next []step
+		err := shared.WalkLinks(here.node, nil, func(at datamodel.Path, lnk datamodel.Link, _ selector.Selector) error {
+			at = here.at.Join(at)
+			present, seen := presence[lnk.Binary()]
+			if !seen {
+				var err error
+				present, err = store.Has(ctx, lnk.Binary())
+				if _, coded := err.(*ipldtoolerr.Error); coded {
+					return err // Errors from opening the storage already say what went wrong.
+				} else if err != nil {
+					return ipldtoolerr.Newf(shared.ErrCode_LoadFailed, "could not check for %s: %s", lnk, err)
+				}
+				presence[lnk.Binary()] = present
+			}
+			if !present || !args.Bool("missing") {
+				if err := printLink(at, lnk, present); err != nil {
+					return err
+				}
+			}
+			if seen || !present || !args.Bool("recursive") {
+				return nil
+			}
+			n, err := loadBlock(ctx, store, lnk)
+			if err != nil {
+				return err
+			}
+			if n != nil {
+				next = append(next, step{n, at})
+			}
+			return nil
+		})
+		if _, coded := err.(*ipldtoolerr.Error); coded {
+			return err
+		} else if err != nil {
+			return ipldtoolerr.Newf(shared.ErrCode_DataInvalid, "could not walk the links in the data: %s", err)
+		}
+		queue = append(queue, next...)
+	}
+	return nil
+}
+
+// loadBlock loads a block from storage, and decodes it.
+// If the block's codec has no decoder, there's no error, but the node is nil.
+//
+// Errors:
+//
+//   - ipldtool-error-load-failed -- if the block couldn't be loaded.
+//   - ipldtool-error-data-invalid -- if the block couldn't be decoded.
+//   - any error from opening the storage.
+func loadBlock(ctx context.Context, store *workspace.LazyStorage, lnk datamodel.Link) (datamodel.Node, error) {
+	info, _ := shared.LookupCodec(lnk.(cidlink.Link).Prefix().Codec)
+	if info.Decoder == nil {
+		return nil, nil
+	}
+	bs, err := store.Get(ctx, lnk.Binary())
+	if _, coded := err.(*ipldtoolerr.Error); coded {
+		return nil, err
+	} else if err != nil {
+		return nil, ipldtoolerr.Newf(shared.ErrCode_LoadFailed, "could not load %s: %s", lnk, err)
+	}
+	var np datamodel.NodePrototype = basicnode.Prototype.Any
+	if info.Prototype != nil {
+		np = info.Prototype
+	}
+	n, err := ipld.DecodeUsingPrototype(bs, info.Decoder, np)
+	if err != nil {
+		return nil, ipldtoolerr.Newf(shared.ErrCode_DataInvalid, "could not decode %s as %s: %s", lnk, info.Name, err)
+	}
+	return n, nil
+}
+
+// codecName returns the name of the codec a link says its data is in.
+func codecName(lnk datamodel.Link) string {
+	info, _ := shared.LookupCodec(lnk.(cidlink.Link).Prefix().Codec)
+	return info.Name
+}
+
+// printLinkMap prints a description of a link as a map, encoded with the given codec, on its own line.
+func printLinkMap(w io.Writer, encoder codec.Encoder, at datamodel.Path, lnk datamodel.Link, present bool) error {
+	n, err := qp.BuildMap(basicnode.Prototype.Map, 4, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "path", qp.String(at.String()))
+		qp.MapEntry(ma, "cid", qp.Link(lnk))
+		qp.MapEntry(ma, "codec", qp.String(codecName(lnk)))
+		qp.MapEntry(ma, "present", qp.Bool(present))
+	})
+	if err != nil {
+		return err
+	}
+	if err := ipld.EncodeStreaming(w, n, encoder); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w)
+	return err
+}
@@ -2,47 +2,133 @@ package basic
 
 import (
 	"context"
-	"encoding/base32"
 	"fmt"
+	"io"
+	"strings"
 
 	"github.com/ipfs/go-cid"
-	flatfs "github.com/ipfs/go-ds-flatfs"
 	"github.com/urfave/cli/v2"
 
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/datamodel"
 	"github.com/ipld/go-ipld-prime/linking"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	"github.com/ipld/go-ipld-prime/node/basicnode"
-	"github.com/ipld/go-ipld-prime/storage/dsadapter"
+	"github.com/ipld/go-ipld-prime/schema"
+
+	"github.com/ipld/go-ipldtool/app/shared"
+	"github.com/ipld/go-ipldtool/app/workspace"
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
 )
 
 var Cmd_Put = &cli.Command{
 	Name:     "put",
 	Category: "Basic",
-	Usage:    "Put a single block of data into storage.",
-	Action:   Action_Put,
+	Usage:    "Put a single block of data into storage (or a stream of them).",
+	UsageText: `Put is for storing data, and getting a CID for it.` + "\n" +
+		"\n" +
+		`   ### Synopsis` + "\n" +
+		"\n" +
+		`   ipld [...global args...] put <filename|"-">` + "\n" +
+		`           [--input="codec:"<multicodec-name-or-hex>]` + "\n" +
+		`           [--codec=<multicodec-name>|"codec:"<multicodec-name-or-hex>]` + "\n" +
+		`           [--input-stream]` + "\n" +
+		"\n" +
+		`   The data is read from the file (or stdin, if the argument is a dash ("-")), decoded, and then encoded again using the codec given by the "--codec" flag (dag-cbor, by default), and stored in the workspace (see "ipld workspace --help").  The CID of the stored data is printed.` + "\n" +
+		"\n" +
+		`   When the "--input" flag is not given, the same heuristic as in the read command is used to guess the input codec.  (As a special case, when storing with the raw codec, the input is taken as raw bytes, unless otherwise specified.)` + "\n" +
+		"\n" +
+		`   Some codecs can only encode data of a specific shape; for example, dag-pb requires data matching its PBNode schema.  The data is checked against that shape before being stored.` + "\n" +
+		"\n" +
+		`   With the "--input-stream" flag, the input can hold many documents, rather than just one: for json and dag-json, one per line (as in "JSON lines"), and for cbor and dag-cbor, one after another (as in a CBOR sequence).  Each document is stored as a block of its own, as soon as it's decoded, and its CID is printed on its own line.  If a document can't be decoded or stored, put stops there, and the error says which document it was (counting from zero); the documents before it have already been stored.` + "\n",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "input",
+			Usage: `Defines what format the input should be expected to be in.  Valid arguments must start with "codec:" followed by a multicodec name, or "codec:0x" followed by a multicodec indicator number in hexidecimal.`,
+		},
+		&cli.StringFlag{
+			Name:        "codec",
+			Usage:       `Defines what codec the data should be stored in.  Valid arguments are a multicodec name, or "codec:" followed by a multicodec name, or "codec:0x" followed by a multicodec indicator number in hexidecimal.`,
+			DefaultText: "dag-cbor",
+		},
+		&cli.BoolFlag{
+			Name:  "input-stream",
+			Usage: `Read many documents from the input, rather than one, and store each of them.  Works with json and dag-json (one document per line), and cbor and dag-cbor (one document after another).`,
+		},
+	},
+	Action: Action_Put,
 }
 
+// Action_Put is the function that implements the `ipld put` command's behaviors.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- for incomprehensible or invalid arguments (including asking for a stream in a codec that can't be streamed).
+//   - ipldtool-error-codec-unknown -- if no input codec was given, and none could be guessed.
+//   - ipldtool-error-data-invalid -- if the data couldn't be decoded, or can't be encoded in the requested codec.  (When streaming, the message and details say which document.)
+//   - ipldtool-workspace-not-found -- if there's no workspace to store the data in.
+//   - ipldtool-error-io -- if the storage couldn't be opened.
 func Action_Put(args *cli.Context) error {
-	// Create the datastore backend.
-	//  (This uses a bunch of legacy code and will probably be replaced someday.)
-	shardFn, err := flatfs.ParseShardFunc("/repo/flatfs/shard/v1/next-to-last/3")
+	// Parse positional args.
+	var sourceArg string
+	switch args.Args().Len() {
+	case 1:
+		sourceArg = args.Args().Get(0)
+	default:
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'put' command needs exactly one positional argument")
+	}
+
+	// Figure out the storage codec.
+	//  Bare names are accepted here (as well as the usual "codec:" forms), since this flag can't mean anything but a codec.
+	codecArg := args.String("codec")
+	switch {
+	case codecArg == "":
+		codecArg = "codec:dag-cbor"
+	case !strings.HasPrefix(codecArg, "codec:"):
+		codecArg = "codec:" + codecArg
+	}
+	code, err := shared.ParseCodecArg(codecArg, "codec")
+	if err != nil {
+		return err
+	}
+	outputCodec, _ := shared.LookupCodec(code)
+	if outputCodec.Encoder == nil {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "codec argument not recognized: %q is not a supported codec for encoding", outputCodec.Name)
+	}
+
+	// Let's get some data!
+	reader, link, err := shared.ParseDataSourceArg(sourceArg)
 	if err != nil {
 		return err
 	}
-	ds, err := flatfs.CreateOrOpen("/tmp/foobar", shardFn, false)
+	if link != nil {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'put' command needs a filename or \"-\" as its argument; %s is already stored", link)
+	}
+
+	// Determine the input codec.
+	//  Same as in the read command, except: if we're storing raw, the input is raw too, unless stated otherwise.
+	var inputCodec shared.CodecInfo
+	switch {
+	case args.IsSet("input"):
+		inputCodec, err = shared.ParseDecoderArg(args.String("input"), "input")
+	case outputCodec.Code == 0x55:
+		inputCodec = outputCodec
+	default:
+		inputCodec, err = shared.SniffCodec(reader)
+	}
 	if err != nil {
 		return err
 	}
-	defer ds.Close()
-	// Wrap it in the modern storage APIs so it's ready to use with go-ipld-prime.
-	//  Use an escaping function with it, because the flatfs datastore doesn't allow arbitrary keys.
-	store := &dsadapter.Adapter{
-		Wrapped: ds,
-		EscapingFunc: func(raw string) string {
-			return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte(raw))
-		},
+	var np datamodel.NodePrototype = basicnode.Prototype.Any
+	if inputCodec.Prototype != nil {
+		np = inputCodec.Prototype
 	}
 
+	// Open the storage.
+	//  It's opened lazily, so that if the data is no good, that can be said, without first needing a workspace to be found.
+	store := &workspace.LazyStorage{}
+	defer store.Close()
+
 	// Set up a LinkSystem.
 	//  A LinkSystem is the controller that puts together all the components needed to do an end-to-end job like "take this data, hash it, and store it keyed by CID".
 	//  Using the cidlink.DefaultLinkSystem means it'll use the global multicodec registry and global multihash registry.
@@ -50,22 +136,56 @@ func Action_Put(args *cli.Context) error {
 	lsys := cidlink.DefaultLinkSystem()
 	lsys.SetWriteStorage(store)
 
-	// Demo write.
-	//  FIXME: still just fixed placeholder content.  More needed here.
+	// Decode, and store!
+	//  In stream mode, each document is stored (and its CID printed) as soon as it's decoded, before moving on to the next one.
+	decode := func(r io.Reader) (datamodel.Node, error) {
+		n, err := ipld.DecodeStreamingUsingPrototype(r, inputCodec.Decoder, np)
+		if err != nil {
+			return nil, ipldtoolerr.Newf(shared.ErrCode_DataInvalid, "could not decode input as %s: %s", inputCodec.Name, err)
+		}
+		return n, nil
+	}
+	if args.Bool("input-stream") {
+		return shared.DecodeStream(reader, inputCodec, decode, func(_ int, n datamodel.Node) error {
+			return putNode(args.App.Writer, &lsys, outputCodec, n)
+		})
+	}
+	n, err := decode(reader)
+	if err != nil {
+		return err
+	}
+	return putNode(args.App.Writer, &lsys, outputCodec, n)
+}
+
+// putNode stores one node, encoded with the given codec, and prints its CID.
+func putNode(w io.Writer, lsys *linking.LinkSystem, outputCodec shared.CodecInfo, n datamodel.Node) error {
+	// If the storage codec only works on data of a certain shape, check that now.
+	//  This gives much better errors than the codec would.
+	n, err := outputCodec.Conform(n)
+	if err != nil {
+		return err
+	}
+	if tn, ok := n.(schema.TypedNode); ok {
+		n = tn.Representation()
+	}
+
+	// Write!
 	lnk, err := lsys.Store(
 		linking.LinkContext{Ctx: context.Background()},
 		cidlink.LinkPrototype{Prefix: cid.Prefix{
-			Version:  1,    // Usually '1'.
-			Codec:    0x71, // dag-cbor as per multicodec table.
+			Version:  1, // Usually '1'.
+			Codec:    outputCodec.Code,
 			MhType:   0x15, // please switch this to 0x20 as soon as go-multihash#149 is merged.
 			MhLength: 48,
 		}},
-		basicnode.NewString("hello there"),
+		n,
 	)
-	if err != nil {
-		return err
+	if _, coded := err.(*ipldtoolerr.Error); coded {
+		return err // Errors from opening the storage already say what went wrong.
+	} else if err != nil {
+		return ipldtoolerr.Newf(shared.ErrCode_DataInvalid, "could not encode data as %s: %s", outputCodec.Name, err)
 	}
-	fmt.Fprintf(args.App.Writer, "%s\n", lnk)
+	fmt.Fprintf(w, "%s\n", lnk)
 
 	return nil
 }
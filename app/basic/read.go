@@ -1,20 +1,28 @@
 package basic
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/urfave/cli/v2"
 
 	"github.com/ipld/go-ipld-prime"
 	"github.com/ipld/go-ipld-prime/codec"
-	"github.com/ipld/go-ipld-prime/codec/dagjson"
 	"github.com/ipld/go-ipld-prime/datamodel"
-	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	"github.com/ipld/go-ipld-prime/schema"
 	"github.com/ipld/go-ipld-prime/traversal"
 
+	"github.com/ipld/go-ipldtool/app/query"
+	toolschema "github.com/ipld/go-ipldtool/app/schema"
 	"github.com/ipld/go-ipldtool/app/shared"
+	"github.com/ipld/go-ipldtool/app/workspace"
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
 )
 
 var Cmd_Read = &cli.Command{
@@ -30,6 +38,8 @@ var Cmd_Read = &cli.Command{
 		`           [--input="codec:"<multicodec-name-or-hex>]` + "\n" +
 		`           [--schema=<filename>|--schema-cid=<CID> --type=<starting-typename> [--schema-lens=<"representation"|"typed">] [--path-mode=<"representation"|"typed">]]` + "\n" +
 		`           [--ADL=<adlhook>]` + "\n" +
+		`           [--query=<query>]` + "\n" +
+		`           [--input-stream]` + "\n" +
 		"\n" +
 		`   ### Data Sources` + "\n" +
 		"\n" +
@@ -40,6 +50,8 @@ var Cmd_Read = &cli.Command{
 		"\n" +
 		`   When the input is from stdin or a file, the codec can be specified with the "--input" flag.  If it is not specified, a very simple heuristic will be used.  (This heuristic may change over time, and you should not rely on its behavior for noninteractive scripts.)` + "\n" +
 		"\n" +
+		`   When the input is from stdin or a file, it can also hold many documents, rather than just one, if the "--input-stream" flag is used: for json and dag-json, one per line (as in "JSON lines"), and for cbor and dag-cbor, one after another (as in a CBOR sequence).  Each document is handled on its own -- validated, pathed, queried, and printed -- as soon as it's decoded, before moving on to the next one.  If any document fails, read stops there, and the error says which document it was (counting from zero).` + "\n" +
+		"\n" +
 		`   ### Output Formats` + "\n" +
 		"\n" +
 		`   The default output format is a diagnostic printout format, meant for human readability.  Other formats and codecs can be specified (you'll probably want to do this if constructing some data pipeline; the diagnostic format is not meant to be parsed).` + "\n" +
@@ -58,13 +70,17 @@ var Cmd_Read = &cli.Command{
 		"\n" +
 		`   If a schema is provided (either as a document in another file, or as a CID to be loaded from storage), it will be used to validate the data.  The name of the type in the schema that we expect to see at the root of the document must also be provided.  The output will default to the typed view, as with the pathing mode if is path parameter was provided, but both can be switched back to representation mode if desired by use of additional flags.` + "\n" +
 		"\n" +
-		`   Specifying a single ADL transformation to use will be supported in the future.  The API for this is not yet finalized.` + "\n" +
+		`   When pathing in representation mode, the output can still be in the typed view: the type at the position the path reaches is worked out from the schema, as the path is followed.  This isn't always possible -- for example, if the path crosses a link whose type doesn't say what type it points to, the data beyond it can't be typed -- and in that case, an error is returned.` + "\n" +
+		"\n" +
+		`   An ADL (Advanced Data Layout) can be applied with the "--ADL" flag.  ADLs present a different view of the data that's been loaded; for example, the "unixfs" ADL makes UnixFS files look like bytes, and makes UnixFS directories (even sharded ones) look like maps from filenames to links.  The ADL is applied before pathing, and also to any blocks that pathing loads, so a path can step through directories by name.` + "\n" +
+		"\n" +
+		`   A query can be given with the "--query" flag, to pick out and reshape parts of the data, in a language much like jq's: for example, "--query='.entries[] | select(.size > 10) | .name'".  The query is applied last, after pathing and the schema lens; each of its results is printed in the output format, one per line, as soon as it's found.  Unlike jq, queries work on the IPLD data model, so bytes and links are kept as bytes and links, and the "type" function tells them apart.  Looking something up inside a link (or iterating over it) loads the block it points to from storage, so a query can reach across blocks; the "load" function does this explicitly.  See the "Queries" section of the docs for the whole language.` + "\n" +
 		"\n" +
 		`   ### Multiple Blocks` + "\n" +
 		"\n" +
 		`   The read command is for handling one block of data at a time.  The read command does not support compositing a view of data taken from across multiple blocks.` + "\n" +
 		"\n" +
-		`   However, do note two features of the read command may still trigger block loading in the course of their work: Pathing may traverse links, and ADLs may also produce views of data which has involved link loading.` + "\n",
+		`   However, do note three features of the read command may still trigger block loading in the course of their work: Pathing may traverse links, queries may too, and ADLs may also produce views of data which has involved link loading.` + "\n",
 	Flags: []cli.Flag{
 		&cli.StringFlag{
 			Name:        "output",
@@ -75,7 +91,36 @@ var Cmd_Read = &cli.Command{
 			Name:  "input",
 			Usage: `Defines what format the input should be expected to be in.  Only relevant in the input is from a file or stdin; if the data source is a CID, that already implies a codec.  Valid arguments must start with "codec:" followed by a multicodec name, or "codec:0x" followed by a multicodec indicator number in hexidecimal.`,
 		},
-		// TODO more
+		&cli.StringFlag{
+			Name:  "ADL",
+			Usage: `Names an ADL to apply to the data after it's loaded (and to any more blocks loaded while pathing).  The ADLs available are "unixfs" (which handles any kind of UnixFS node), "unixfs-file", "unixfs-dir", and "hamt" (which handles only UnixFS sharded directories).`,
+		},
+		&cli.StringFlag{
+			Name:  "schema",
+			Usage: `Names a file containing a schema (in the schema DSL) to apply to the data.  The "--type" flag must also be used.`,
+		},
+		&cli.StringFlag{
+			Name:  "type",
+			Usage: `Names the type in the schema that the data should match at its root.`,
+		},
+		&cli.StringFlag{
+			Name:        "schema-lens",
+			Usage:       `When a schema is used, says whether the output should be the typed view of the data, or its representation.  Valid arguments are "typed" or "representation".`,
+			DefaultText: "typed",
+		},
+		&cli.StringFlag{
+			Name:        "path-mode",
+			Usage:       `When a schema is used, says whether the path should be applied to the typed view of the data, or its representation.  Valid arguments are "typed" or "representation".`,
+			DefaultText: "typed",
+		},
+		&cli.StringFlag{
+			Name:  "query",
+			Usage: `A query to pick out and reshape parts of the data, in a jq-like language.  Each result is printed on its own line.  Can't be used with "--output=raw".`,
+		},
+		&cli.BoolFlag{
+			Name:  "input-stream",
+			Usage: `Read many documents from the input, rather than one, and handle each of them in turn.  Works with json and dag-json (one document per line), and cbor and dag-cbor (one document after another).  Can't be used with "--output=raw", nor with a CID.`,
+		},
 	},
 	Action: func(args *cli.Context) error {
 		// Parse positional args.
@@ -91,15 +136,45 @@ var Cmd_Read = &cli.Command{
 			return fmt.Errorf("read command needs one or two positional arguments")
 		}
 
+		// Parse the query, if there is one, now: there's no point loading anything if it's no good.
+		var q *query.Query
+		if args.IsSet("query") {
+			if args.String("output") == "raw" {
+				return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "the query argument can't be used with raw output")
+			}
+			var err error
+			q, err = query.Parse(args.String("query"))
+			if err != nil {
+				return err
+			}
+		}
+
 		// Let's get some data!
+		//  If the data source is a CID, that means we need storage to get it from.
+		//  We might need storage later, too, if pathing crosses links, so that's set up regardless; but it's not opened until used.
+		store := &workspace.LazyStorage{}
+		defer store.Close()
 		reader, link, err := shared.ParseDataSourceArg(sourceArg)
 		if err != nil {
 			return err
 		}
+		if link != nil && args.Bool("input-stream") {
+			return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "the input-stream argument can only be used when reading from a file or stdin")
+		}
+		if link != nil {
+			bs, err := store.Get(context.Background(), link.Binary())
+			if err != nil {
+				return ipldtoolerr.Newf(shared.ErrCode_LoadFailed, "could not load %s: %s", link, err)
+			}
+			reader = bufio.NewReader(bytes.NewReader(bs))
+		}
 
 		// Early exit: if "raw" mode is requested, pass the data through direction.  Skip *everything* else.  (No need to determine codec, nothing.)
 		//  (Future: maybe we can path.  However, it would only work as long as the lands on a block edge.  Unclear how useful this would be; PRs welcome.)
 		if args.String("output") == "raw" {
+			if args.Bool("input-stream") {
+				return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "the input-stream argument can't be used with raw output")
+			}
 			_, err := io.Copy(args.App.Writer, reader)
 			return err
 		}
@@ -111,31 +186,54 @@ var Cmd_Read = &cli.Command{
 		//  2. Listen to the CID, if that was the data source.
 		//  3. Peek and guess as a last resort.
 		//  4. If we can't guess usefully, give up and error.
-		var decoder codec.Decoder
+		var inputCodec shared.CodecInfo
 		switch {
 		case args.IsSet("input"):
-			panic("todo")
+			inputCodec, err = shared.ParseDecoderArg(args.String("input"), "input")
+			if err != nil {
+				return err
+			}
 		case link != nil:
-			panic("todo")
+			var known bool
+			inputCodec, known = shared.LookupCodec(link.(cidlink.Link).Prefix().Codec)
+			if !known || inputCodec.Decoder == nil {
+				return ipldtoolerr.Newf(shared.ErrCode_CodecUnknown, "%s is in codec %s, which has no decoder available", link, inputCodec.Name)
+			}
 		default:
-			peeked, err := reader.Peek(1)
+			inputCodec, err = shared.SniffCodec(reader)
 			if err != nil {
 				return err
 			}
-			switch peeked[0] {
-			case '{': // it's probably json.  we'll assume dag-json.
-				decoder = dagjson.Decode
-			default:
-				return fmt.Errorf("no input codec specified by args, and gave up trying to guess one from the content")
-			}
 		}
 
-		// Was there a schema?  Load that, compile it, and get a NodePrototype from that.
+		// Was there a schema?  Load that, compile it, and find the type; the data will be decoded as that type.
+		// Otherwise?  If the codec insists on a particular shape of data (e.g. dag-pb does), that's used.
 		// Otherwise?  Basicnode will do.
-		np := basicnode.Prototype.Any
+		ds, err := toolschema.ParseDataSchemaArgs(args, "path-mode")
+		if err != nil {
+			return err
+		}
+		pathMode, err := toolschema.ParseLensArg(args, "path-mode")
+		if err != nil {
+			return err
+		}
+		schemaLens := ds.Lens
+
+		// Was there an ADL hint?
+		var reifier linking.NodeReifier
+		if args.IsSet("ADL") {
+			reifier = shared.LookupADL(args.String("ADL"))
+			if reifier == nil {
+				return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "ADL argument not recognized: %q is not a known ADL (known ADLs are: %s)", args.String("ADL"), strings.Join(shared.ListADLs(), ", "))
+			}
+		}
 
-		// Was there an ADL hint?  Haven't implemented that yet,
-		//  but we'd probably at least parse it here.
+		// Set up a LinkSystem, in case we need to load more blocks.
+		//  (ADLs may need to, and so may pathing.)
+		//  The ADL, if any, is applied to every block it loads.
+		lsys := cidlink.DefaultLinkSystem()
+		lsys.SetReadStorage(store)
+		lsys.NodeReifier = reifier
 
 		// Figure out the output format too.
 		//  We don't need this yet, but it's good practice to at make sure all the args are sane and we know what to do with them before starting real work.
@@ -155,29 +253,86 @@ var Cmd_Read = &cli.Command{
 		// Finally, we have the codec, the input stream, and the NodePrototype.
 		// And all the other args-parsing we'll need by the end is done too.
 		// Let's go!
-		n, err := ipld.DecodeStreamingUsingPrototype(reader, decoder, np)
-		if err != nil {
-			return err
+		//  In stream mode, there can be many documents; each one goes through all the rest of the work, and is printed, before the next one is decoded.
+		decodeOne := func(r io.Reader) (datamodel.Node, error) {
+			return ds.Decode(r, inputCodec)
 		}
+		handle := func(n datamodel.Node) error {
+			var err error
+			// Apply the ADL, if there is one.
+			if reifier != nil {
+				n, err = reifier(linking.LinkContext{Ctx: context.Background()}, n, &lsys)
+				if err != nil {
+					return ipldtoolerr.Newf(shared.ErrCode_DataInvalid, "could not apply ADL %q: %s", args.String("ADL"), err)
+				}
+			}
+
+			// Pathing time!
+			//  If we had types, and the flag requesting representation-level pathing, the path is applied to the representation.
+			//  If the typed view is still wanted for output, we keep track of the types as we go, so we can come back up to the typed view at the end.
+			//  Links are followed as they're encountered, loading from storage.
+			tn, typed := n.(schema.TypedNode)
+			typed = typed && !shared.IsADLNode(n)
+			switch {
+			case typed && pathMode == "representation" && schemaLens == "typed":
+				n, err = toolschema.ReprPathLift(tn, datamodel.ParsePath(pathArg), &lsys)
+			case typed && pathMode == "representation":
+				n, err = traverse(tn.Representation(), pathArg, lsys)
+			default:
+				n, err = traverse(n, pathArg, lsys)
+			}
+			if err != nil {
+				return err
+			}
+			n = toolschema.LensView(n, schemaLens)
+
+			// Finally: print back out whatever we've read (and possibly transformed, and pathed to).
+			//  The debug format gets handed the node as-is, so that it can show type info, if there is any.
+			//  Real codecs need the representation, which is what ipld.EncodeStreaming takes care of for us.
+			//  Except for ADLs: those are handed over as-is too, because their representation is the substrate they were built from, not the view we were asked for.
+			//  And except for representation nodes, which the debug format gets a plain copy of, because the printer can't handle all of bindnode's (tuple structs have no list iterator, for example).
+			//  Each is followed by a trailing linebreak, because that's considered a normative ending thing in most CLI composition.
+			reprView := typed && schemaLens == "representation"
+			printNode := func(n datamodel.Node) error {
+				var err error
+				switch {
+				case (args.String("output") == "" || args.String("output") == "debug") && reprView:
+					if n, err = shared.PlainCopy(n); err == nil {
+						err = encoder(n, args.App.Writer)
+					}
+				case args.String("output") == "" || args.String("output") == "debug" || shared.IsADLNode(n):
+					err = encoder(n, args.App.Writer)
+				default:
+					err = ipld.EncodeStreaming(args.App.Writer, n, encoder)
+				}
+				args.App.Writer.Write([]byte{'\n'})
+				return err
+			}
 
-		// Pathing time!
-		//  Drop back down to representation level first, too, if we had types, and also the flag requesting representation-level pathing.
-		if tn, ok := n.(schema.TypedNode); ok && args.String("path-mode") == "representation" {
-			n = tn.Representation()
+			// If there's a query, each of its results is printed as soon as it's found; otherwise, there's just the one thing to print.
+			if q != nil {
+				return q.Run(n, &lsys, printNode)
+			}
+			return printNode(n)
+		}
+		if args.Bool("input-stream") {
+			return shared.DecodeStream(reader, inputCodec, decodeOne, func(_ int, n datamodel.Node) error {
+				return handle(n)
+			})
 		}
-		n, err = traversal.Get(n, datamodel.ParsePath(pathArg))
+		n, err := decodeOne(reader)
 		if err != nil {
 			return err
 		}
-
-		// TODO: can we... actually readily switch back up to type-view after pathing at repr level?  I feel like that should be possible (at least in some cases; not all).
-
-		// Finally: print back out whatever we've read (and possibly transformed, and pathed to).
-		err = ipld.EncodeStreaming(args.App.Writer, n, encoder)
-
-		// And push one last trailing linebreak out, because that's considered a normative ending thing in most CLI composition.
-		args.App.Writer.Write([]byte{'\n'})
-
-		return err
+		return handle(n)
 	},
 }
+
+// traverse follows a path, loading links as they're encountered.
+func traverse(n datamodel.Node, pathArg string, lsys linking.LinkSystem) (datamodel.Node, error) {
+	return traversal.Progress{Cfg: &traversal.Config{
+		Ctx:                            context.Background(),
+		LinkSystem:                     lsys,
+		LinkTargetNodePrototypeChooser: shared.ChoosePrototype,
+	}}.Get(n, datamodel.ParsePath(pathArg))
+}
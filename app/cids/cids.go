@@ -0,0 +1,272 @@
+package cids
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	mbase "github.com/multiformats/go-multibase"
+	mc "github.com/multiformats/go-multicodec"
+	mh "github.com/multiformats/go-multihash"
+
+	"github.com/ipld/go-ipldtool/app/shared"
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+var outputFlag = &cli.StringFlag{
+	Name:        "output",
+	Usage:       `Defines what format the results should be printed in.  Valid arguments are "text", or the word "codec:" followed by a multicodec name, or "codec:0x" followed by a multicodec indicator number in hexidecimal.  With a codec, each result is a map describing a CID (the same as "inspect" gives), printed on its own line.`,
+	DefaultText: "text",
+}
+
+var Cmd_Cid = &cli.Command{
+	Name:     "cid",
+	Category: "Advanced",
+	Usage:    "Take CIDs apart, and convert them between versions, multibases, and codecs.",
+	Subcommands: []*cli.Command{{
+		Name:  "inspect",
+		Usage: "Show what a CID is made of: its version, multibase, codec, and multihash.",
+		UsageText: `ipld cid inspect [--output=<"text"|"codec:"<multicodec-name-or-hex>>] <CID>...` + "\n" +
+			"\n" +
+			`   Each CID is taken apart, and its version, multibase, codec (name and code), multihash function (name and code), digest length, and digest (in hex) are printed.` + "\n" +
+			`   With "--output=codec:dag-json" (or any other codec), each is printed as a map instead, on its own line; the digest is bytes.`,
+		Flags:  []cli.Flag{outputFlag},
+		Action: Action_CidInspect,
+	}, {
+		Name:  "convert",
+		Usage: "Change a CID's version, multibase, or codec, keeping its hash.",
+		UsageText: `ipld cid convert [--version=<0|1>] [--multibase=<multibase-name>] [--codec=<multicodec-name>|"codec:"<multicodec-name-or-hex>]` + "\n" +
+			`           [--output=<"text"|"codec:"<multicodec-name-or-hex>>] <CID>...` + "\n" +
+			"\n" +
+			`   Each CID is converted, and the result is printed.  Anything that isn't asked to change stays the same, as far as it can:` + "\n" +
+			`   a CIDv0 becomes a CIDv1 if its codec or multibase is changed; and a CIDv1 that's made from a CIDv0 is in base32, unless another multibase is asked for.` + "\n" +
+			"\n" +
+			`   CIDv0s are always dag-pb, sha2-256, and base58btc, so converting to version 0 only works for CIDs that are dag-pb and sha2-256, and can't be combined with any other multibase.` + "\n" +
+			"\n" +
+			`   Changing the codec keeps the same hash, so the new CID won't point to anything unless there's data that hashes the same in that codec.  (This is mostly useful for switching between codecs that share a format, like raw and dag-pb for files, or between cbor and dag-cbor.)`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "version",
+				Usage: `The CID version to convert to: "0" or "1".`,
+			},
+			&cli.StringFlag{
+				Name:  "multibase",
+				Usage: `The multibase to write the CID in: for example, "base32", "base36", or "base58btc".  (Any multibase name, or prefix character, is accepted.)`,
+			},
+			&cli.StringFlag{
+				Name:  "codec",
+				Usage: `The codec the CID should say the data is in.  Valid arguments are a multicodec name, or "codec:" followed by a multicodec name, or "codec:0x" followed by a multicodec indicator number in hexidecimal.`,
+			},
+			outputFlag,
+		},
+		Action: Action_CidConvert,
+	}},
+}
+
+// Action_CidInspect is the 'ipld cid inspect' command.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- for incomprehensible or invalid arguments, including strings that aren't CIDs.
+func Action_CidInspect(args *cli.Context) error {
+	if args.Args().Len() == 0 {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'cid inspect' command needs at least one CID")
+	}
+	encoder, err := parseOutputArg(args.String("output"))
+	if err != nil {
+		return err
+	}
+	for i, arg := range args.Args().Slice() {
+		c, err := parseCid(arg)
+		if err != nil {
+			return err
+		}
+		if encoder == nil && i > 0 {
+			fmt.Fprintln(args.App.Writer)
+		}
+		if err := printCid(args.App.Writer, encoder, arg, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Action_CidConvert is the 'ipld cid convert' command.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- for incomprehensible or invalid arguments, including strings that aren't CIDs, and conversions that aren't possible.
+func Action_CidConvert(args *cli.Context) error {
+	if args.Args().Len() == 0 {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'cid convert' command needs at least one CID")
+	}
+	encoder, err := parseOutputArg(args.String("output"))
+	if err != nil {
+		return err
+	}
+
+	// Parse the flags for what's to be changed, before looking at any of the CIDs.
+	version := -1
+	switch args.String("version") {
+	case "":
+	case "0", "1":
+		version, _ = strconv.Atoi(args.String("version"))
+	default:
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "version argument not recognized: must be either 0 or 1")
+	}
+	base := mbase.Encoding(-1)
+	if args.IsSet("multibase") {
+		enc, err := mbase.EncoderByName(args.String("multibase"))
+		if err != nil {
+			return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "multibase argument not recognized: %q is not a known multibase", args.String("multibase"))
+		}
+		base = enc.Encoding()
+	}
+	codecCode := uint64(0)
+	if args.IsSet("codec") {
+		codecArg := args.String("codec")
+		if !strings.HasPrefix(codecArg, "codec:") {
+			codecArg = "codec:" + codecArg
+		}
+		codecCode, err = shared.ParseCodecArg(codecArg, "codec")
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, arg := range args.Args().Slice() {
+		c, err := parseCid(arg)
+		if err != nil {
+			return err
+		}
+		str, converted, err := convert(arg, c, version, base, codecCode, args.IsSet("codec"))
+		if err != nil {
+			return err
+		}
+		if encoder == nil {
+			fmt.Fprintln(args.App.Writer, str)
+			continue
+		}
+		if err := printCid(args.App.Writer, encoder, str, converted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// convert makes the conversion asked for, returning the new CID, and its string form.
+// A version of -1, or a base of -1, means that the version or base should stay as it is (as far as possible).
+func convert(arg string, c cid.Cid, version int, base mbase.Encoding, codecCode uint64, changeCodec bool) (string, cid.Cid, error) {
+	prefix := c.Prefix()
+	if changeCodec {
+		prefix.Codec = codecCode
+	}
+	switch {
+	case version != -1:
+	case prefix.Codec != cid.DagProtobuf, base != -1 && base != mbase.Base58BTC:
+		// Version 0 can't say what the codec is, and is always in base58btc, so changing either of those means going to version 1.
+		version = 1
+	default:
+		version = int(prefix.Version)
+	}
+
+	if version == 0 {
+		if prefix.Codec != cid.DagProtobuf || prefix.MhType != mh.SHA2_256 || prefix.MhLength != 32 {
+			return "", cid.Undef, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "%s can't be converted to a CIDv0: those can only be dag-pb and sha2-256", arg)
+		}
+		if base != -1 && base != mbase.Base58BTC {
+			return "", cid.Undef, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "CIDv0s are always in base58btc, so can't be in %s", mbase.EncodingToStr[base])
+		}
+		converted := cid.NewCidV0(c.Hash())
+		return converted.String(), converted, nil
+	}
+
+	if base == -1 {
+		base = mbase.Base32
+		if c.Version() == 1 {
+			base, _ = cid.ExtractEncoding(arg)
+		}
+	}
+	converted := cid.NewCidV1(prefix.Codec, c.Hash())
+	str, err := converted.StringOfBase(base)
+	if err != nil {
+		return "", cid.Undef, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "can't write a CID in %s: %s", mbase.EncodingToStr[base], err)
+	}
+	return str, converted, nil
+}
+
+// parseCid parses a CID from a command line argument.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- if it's not a CID.
+func parseCid(arg string) (cid.Cid, error) {
+	c, err := cid.Decode(arg)
+	if err != nil {
+		return cid.Undef, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "%q is not a valid CID: %s", arg, err)
+	}
+	return c, nil
+}
+
+// parseOutputArg parses the "--output" flag: it returns nil for text, or an encoder.
+func parseOutputArg(arg string) (codec.Encoder, error) {
+	if arg == "" || arg == "text" {
+		return nil, nil
+	}
+	encoder, err := shared.ParseEncoderArg(arg, "text", "output")
+	if err != nil {
+		return nil, err
+	}
+	return encoder, nil
+}
+
+// printCid prints a description of a CID: as a table if encoder is nil, or else encoded as a map.
+// The string is how the CID is written, which says what its multibase is.
+func printCid(w io.Writer, encoder codec.Encoder, str string, c cid.Cid) error {
+	// The multihash was already checked when the CID was parsed, so this can't fail.
+	hash, _ := mh.Decode(c.Hash())
+	base, _ := cid.ExtractEncoding(str)
+	codecInfo, _ := shared.LookupCodec(c.Prefix().Codec)
+
+	if encoder == nil {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(tw, "cid:\t%s\n", str)
+		fmt.Fprintf(tw, "version:\t%d\n", c.Version())
+		fmt.Fprintf(tw, "multibase:\t%s\n", mbase.EncodingToStr[base])
+		fmt.Fprintf(tw, "codec:\t%s (0x%x)\n", codecInfo.Name, codecInfo.Code)
+		fmt.Fprintf(tw, "multihash:\t%s (0x%x)\n", mc.Code(hash.Code), hash.Code)
+		fmt.Fprintf(tw, "length:\t%d\n", hash.Length)
+		fmt.Fprintf(tw, "digest:\t%x\n", hash.Digest)
+		return tw.Flush()
+	}
+
+	n, err := qp.BuildMap(basicnode.Prototype.Map, 9, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "cid", qp.String(str))
+		qp.MapEntry(ma, "version", qp.Int(int64(c.Version())))
+		qp.MapEntry(ma, "multibase", qp.String(mbase.EncodingToStr[base]))
+		qp.MapEntry(ma, "codec", qp.String(codecInfo.Name))
+		qp.MapEntry(ma, "codecCode", qp.Int(int64(codecInfo.Code)))
+		qp.MapEntry(ma, "multihash", qp.String(mc.Code(hash.Code).String()))
+		qp.MapEntry(ma, "multihashCode", qp.Int(int64(hash.Code)))
+		qp.MapEntry(ma, "length", qp.Int(int64(hash.Length)))
+		qp.MapEntry(ma, "digest", qp.Bytes(hash.Digest))
+	})
+	if err != nil {
+		return err
+	}
+	if err := ipld.EncodeStreaming(w, n, encoder); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w)
+	return err
+}
@@ -0,0 +1,15 @@
+package cids_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/ipld/go-ipldtool/app/testutil"
+)
+
+func TestCid(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+	testutil.TestExecSpec(t, "../../docs/cid.md")
+}
@@ -0,0 +1,179 @@
+package codecs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/schema"
+
+	"github.com/ipld/go-ipldtool/app/shared"
+	"github.com/ipld/go-ipldtool/app/workspace"
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+var Cmd_Canon = &cli.Command{
+	Name:     "canon",
+	Category: "Advanced",
+	Usage:    "Re-encode data in the canonical form for its codec, or check if it already is.",
+	UsageText: `Canon is for making sure data is encoded deterministically.` + "\n" +
+		"\n" +
+		`   ### Synopsis` + "\n" +
+		"\n" +
+		`   ipld [...global args...] canon <CID|filename|"-">` + "\n" +
+		`           [--input="codec:"<multicodec-name-or-hex>]` + "\n" +
+		`           [--codec=<multicodec-name>|"codec:"<multicodec-name-or-hex>]` + "\n" +
+		`           [--check]` + "\n" +
+		"\n" +
+		`   The data is decoded, and then encoded again, in the canonical form for the codec given by the "--codec" flag (or, by default, the codec it was decoded with).  The canonical form is what this tool's encoder for that codec produces: for dag-json and dag-cbor, that means map keys are sorted, numbers are as short as they can be, and there's no whitespace.  The re-encoded data is printed, exactly as it is, with nothing added.` + "\n" +
+		"\n" +
+		`   The data is given the same way as for the read command: a CID to load from storage, a filename (which must start with "./" or "/"), or "-" for stdin.  When it's not a CID, the input codec can be given with the "--input" flag, or else it's guessed, as in the read command.` + "\n" +
+		"\n" +
+		`   With the "--check" flag, nothing is re-encoded; instead, canon says whether the input is already canonical.  If it is, it says so, and exits zero.  If it isn't, it explains the differences, and exits with an error.  The explanation has two parts: where the bytes first differ, with a little of each around that point; and then, for dag-json, json, dag-cbor, and cbor, each path in the data where something is written differently, and how (for example, map keys that are out of order, or a number that's written in a longer form than it needs).  When the input is a CID, the CID that the canonical form would have is shown too.` + "\n",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "input",
+			Usage: `Defines what format the input should be expected to be in.  Only relevant if the input is from a file or stdin; if the data source is a CID, that already implies a codec.  Valid arguments must start with "codec:" followed by a multicodec name, or "codec:0x" followed by a multicodec indicator number in hexidecimal.`,
+		},
+		&cli.StringFlag{
+			Name:        "codec",
+			Usage:       `Defines what codec's canonical form the data should be encoded in.  Valid arguments are a multicodec name, or "codec:" followed by a multicodec name, or "codec:0x" followed by a multicodec indicator number in hexidecimal.`,
+			DefaultText: "the input codec",
+		},
+		&cli.BoolFlag{
+			Name:  "check",
+			Usage: `Don't print the canonical form; instead, check if the input is already canonical, and explain what's different if it isn't.`,
+		},
+	},
+	Action: Action_Canon,
+}
+
+// Action_Canon is the function that implements the `ipld canon` command's behaviors.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- for incomprehensible or invalid arguments.
+//   - ipldtool-error-codec-unknown -- if no input codec was given, and none could be guessed.
+//   - ipldtool-error-data-invalid -- if the data couldn't be decoded, or can't be encoded in the requested codec.
+//   - ipldtool-error-load-failed -- if the data source is a CID, and it couldn't be loaded.
+//   - ipldtool-canon-not-canonical -- if checking, and the input isn't canonical.
+func Action_Canon(args *cli.Context) error {
+	// Parse positional args.
+	if args.Args().Len() != 1 {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'canon' command needs exactly one positional argument")
+	}
+	reader, link, err := shared.ParseDataSourceArg(args.Args().Get(0))
+	if err != nil {
+		return err
+	}
+
+	// Get all the input bytes: we need to keep them, to compare with.
+	if link != nil {
+		if args.IsSet("input") {
+			return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "the input argument can't be used with a CID; the CID already states the codec")
+		}
+		store := &workspace.LazyStorage{}
+		defer store.Close()
+		bs, err := store.Get(context.Background(), link.Binary())
+		if err != nil {
+			return ipldtoolerr.Newf(shared.ErrCode_LoadFailed, "could not load %s: %s", link, err)
+		}
+		reader = bufio.NewReader(bytes.NewReader(bs))
+	}
+	input, err := io.ReadAll(reader)
+	if err != nil {
+		return ipldtoolerr.Newf("ipldtool-error-io", "could not read input: %s", err)
+	}
+
+	// Determine the input codec, the same way the read command does.
+	var inputCodec shared.CodecInfo
+	switch {
+	case args.IsSet("input"):
+		inputCodec, err = shared.ParseDecoderArg(args.String("input"), "input")
+	case link != nil:
+		var known bool
+		inputCodec, known = shared.LookupCodec(link.(cidlink.Link).Prefix().Codec)
+		if !known || inputCodec.Decoder == nil {
+			return ipldtoolerr.Newf(shared.ErrCode_CodecUnknown, "%s is in codec %s, which has no decoder available", link, inputCodec.Name)
+		}
+	default:
+		inputCodec, err = shared.SniffCodec(bufio.NewReader(bytes.NewReader(input)))
+	}
+	if err != nil {
+		return err
+	}
+
+	// Figure out the canonical codec.
+	//  Bare names are accepted here (as well as the usual "codec:" forms), as with put.
+	outputCodec := inputCodec
+	if codecArg := args.String("codec"); codecArg != "" {
+		if !strings.HasPrefix(codecArg, "codec:") {
+			codecArg = "codec:" + codecArg
+		}
+		code, err := shared.ParseCodecArg(codecArg, "codec")
+		if err != nil {
+			return err
+		}
+		outputCodec, _ = shared.LookupCodec(code)
+	}
+	if outputCodec.Encoder == nil {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "codec argument not recognized: %q is not a supported codec for encoding", outputCodec.Name)
+	}
+	if args.Bool("check") && outputCodec.Code != inputCodec.Code {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "the check argument compares the input with the canonical form of its own codec (%s), so the codec argument can't name a different one", inputCodec.Name)
+	}
+
+	// Decode, and re-encode.
+	var np datamodel.NodePrototype = basicnode.Prototype.Any
+	if inputCodec.Prototype != nil {
+		np = inputCodec.Prototype
+	}
+	n, err := ipld.DecodeUsingPrototype(input, inputCodec.Decoder, np)
+	if err != nil {
+		return ipldtoolerr.Newf(shared.ErrCode_DataInvalid, "could not decode input as %s: %s", inputCodec.Name, err)
+	}
+	n, err = outputCodec.Conform(n)
+	if err != nil {
+		return err
+	}
+	if tn, ok := n.(schema.TypedNode); ok {
+		n = tn.Representation()
+	}
+	canonical, err := ipld.Encode(n, outputCodec.Encoder)
+	if err != nil {
+		return ipldtoolerr.Newf(shared.ErrCode_DataInvalid, "could not encode data as %s: %s", outputCodec.Name, err)
+	}
+
+	// If we're not checking, that's it: out it goes.
+	if !args.Bool("check") {
+		_, err := args.App.Writer.Write(canonical)
+		return err
+	}
+
+	// Checking: say if it's canonical, and if not, why not.
+	subject := "the input"
+	if link != nil {
+		subject = link.String()
+	}
+	if bytes.Equal(input, canonical) {
+		fmt.Fprintf(args.App.Writer, "%s is canonical %s\n", subject, inputCodec.Name)
+		return nil
+	}
+	explainCanon(args.App.Writer, inputCodec, input, canonical)
+	if link != nil {
+		canonicalCid, err := link.(cidlink.Link).Prefix().Sum(canonical)
+		if err == nil {
+			fmt.Fprintf(args.App.Writer, "cid: the canonical form would be %s\n", canonicalCid)
+		}
+	}
+	return ipldtoolerr.Newf(ErrCode_NotCanonical, "%s is not canonical %s", subject, inputCodec.Name)
+}
@@ -0,0 +1,447 @@
+package codecs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+
+	"github.com/ipld/go-ipldtool/app/shared"
+)
+
+// explainCanon writes an explanation of how the input differs from its canonical form:
+// first, where the bytes first differ; and then, for the codecs we know how to take apart, what's different at each path.
+func explainCanon(w io.Writer, info shared.CodecInfo, input, canonical []byte) {
+	text := info.Code == 0x0129 || info.Code == 0x0200 // dag-json, json
+
+	// Byte level: where's the first difference?
+	at := 0
+	for at < len(input) && at < len(canonical) && input[at] == canonical[at] {
+		at++
+	}
+	fmt.Fprintf(w, "bytes: the input is %d bytes, and its canonical form is %d bytes; they first differ at byte %d:\n", len(input), len(canonical), at)
+	window := func(b []byte) []byte {
+		start, end := at-8, at+24
+		if start < 0 {
+			start = 0
+		}
+		if end > len(b) {
+			end = len(b)
+		}
+		if start > end {
+			start = end
+		}
+		return b[start:end]
+	}
+	if text {
+		fmt.Fprintf(w, "\tinput:     %q\n", window(input))
+		fmt.Fprintf(w, "\tcanonical: %q\n", window(canonical))
+	} else {
+		fmt.Fprintf(w, "\tinput:     %x\n", window(input))
+		fmt.Fprintf(w, "\tcanonical: %x\n", window(canonical))
+	}
+
+	// Path level: take both apart, and compare them piece by piece.
+	var scan func([]byte) (*span, error)
+	switch info.Code {
+	case 0x0129, 0x0200: // dag-json, json
+		scan = scanJSON
+	case 0x71, 0x51: // dag-cbor, cbor
+		scan = scanCBOR
+	default:
+		return // We don't know how to take this codec apart; the bytes will have to do.
+	}
+	in, err := scan(input)
+	if err != nil {
+		fmt.Fprintf(w, "paths: can't explain any further: %s\n", err)
+		return
+	}
+	canon, err := scan(canonical)
+	if err != nil {
+		fmt.Fprintf(w, "paths: can't explain any further: %s\n", err)
+		return
+	}
+	if in.whitespace > 0 {
+		fmt.Fprintf(w, "whitespace: %d bytes of whitespace between tokens (there's none in canonical %s)\n", in.whitespace, info.Name)
+	}
+	d := differ{w: w, text: text, input: input, canonical: canonical}
+	d.compare(datamodel.Path{}, in, canon)
+	if in.end < len(input) && !text {
+		fmt.Fprintf(w, "/: %d more bytes after the end of the data\n", len(input)-in.end)
+	}
+}
+
+// span is where one value is in some encoded data.
+// Maps and lists also have spans for each of their entries, and their "frame":
+// all their bytes except for those of their entries (and, for JSON, except for whitespace) --
+// so for a map, that's the brackets and the keys, and for CBOR, the header saying how many entries there are.
+//
+// Links and bytes, which are maps in dag-json, are treated as single values, since the map is just how they're written.
+type span struct {
+	start, end int
+	kind       byte     // 'm' for maps, 'l' for lists, 'v' for everything else.
+	keys       []string // For maps, the keys, in order.
+	children   []*span  // For maps and lists, the entries, in order.
+	frame      []byte
+
+	whitespace int // For the root span of JSON, how many bytes of whitespace there were outside of strings.
+}
+
+type differ struct {
+	w                io.Writer
+	text             bool
+	input, canonical []byte
+}
+
+// compare explains the differences between two spans, of the same data, in the input and in its canonical form.
+func (d *differ) compare(path datamodel.Path, in, canon *span) {
+	if in.kind != canon.kind || in.kind == 'v' || len(in.children) != len(canon.children) {
+		a, b := d.input[in.start:in.end], d.canonical[canon.start:canon.end]
+		if d.text {
+			a = stripWhitespace(a) // Whitespace has already been mentioned; it doesn't need saying again here.
+		}
+		if !bytes.Equal(a, b) {
+			d.report(path, "written as %s, canonically %s", d.show(a), d.show(b))
+		}
+		return
+	}
+	switch in.kind {
+	case 'l':
+		if !bytes.Equal(in.frame, canon.frame) {
+			d.report(path, "the list itself is written differently: %s, canonically %s", d.show(in.frame), d.show(canon.frame))
+		}
+		for i := range in.children {
+			d.compare(path.AppendSegment(datamodel.PathSegmentOfInt(int64(i))), in.children[i], canon.children[i])
+		}
+	case 'm':
+		if strings.Join(in.keys, "\x00") != strings.Join(canon.keys, "\x00") {
+			d.report(path, "keys aren't in canonical order: got %s; canonically %s", quoteAll(in.keys), quoteAll(canon.keys))
+		} else if !bytes.Equal(in.frame, canon.frame) {
+			d.report(path, "the map itself is written differently: %s, canonically %s", d.show(in.frame), d.show(canon.frame))
+		}
+		// The entries are compared in canonical order, so that the explanation comes out in the same order as the canonical form.
+		for i, k := range canon.keys {
+			for j, k2 := range in.keys {
+				if k == k2 {
+					d.compare(path.AppendSegment(datamodel.PathSegmentOfString(k)), in.children[j], canon.children[i])
+					break
+				}
+			}
+		}
+	}
+}
+
+func (d *differ) report(path datamodel.Path, format string, args ...interface{}) {
+	fmt.Fprintf(d.w, "/%s: %s\n", path, fmt.Sprintf(format, args...))
+}
+
+// show formats some bytes for an explanation: for text codecs, as text (in backticks, or quoted if that'd be ambiguous), and otherwise, as hex.
+// Long stretches are cut short.
+func (d *differ) show(b []byte) string {
+	const max = 40
+	cut := ""
+	if len(b) > max {
+		b, cut = b[:max], "..."
+	}
+	if !d.text {
+		return hex.EncodeToString(b) + cut
+	}
+	if bytes.ContainsAny(b, "`\n\r\t") {
+		return strconv.Quote(string(b)) + cut
+	}
+	return "`" + string(b) + "`" + cut
+}
+
+func quoteAll(strs []string) string {
+	quoted := make([]string, len(strs))
+	for i, s := range strs {
+		quoted[i] = strconv.Quote(s)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// scanJSON finds the spans of the values in some JSON.
+func scanJSON(b []byte) (*span, error) {
+	s := &jsonScanner{b: b}
+	s.skipWhitespace()
+	root, err := s.value()
+	if err != nil {
+		return nil, err
+	}
+	s.skipWhitespace()
+	if s.pos < len(b) {
+		return nil, fmt.Errorf("unexpected content at byte %d", s.pos)
+	}
+	root.whitespace = s.whitespace
+	return root, nil
+}
+
+type jsonScanner struct {
+	b          []byte
+	pos        int
+	whitespace int
+}
+
+func (s *jsonScanner) skipWhitespace() {
+	for s.pos < len(s.b) && strings.IndexByte(" \t\r\n", s.b[s.pos]) >= 0 {
+		s.pos++
+		s.whitespace++
+	}
+}
+
+// expect consumes one byte of syntax (skipping any whitespace before it), and adds it to the frame.
+func (s *jsonScanner) expect(sp *span, c byte) error {
+	s.skipWhitespace()
+	if s.pos >= len(s.b) || s.b[s.pos] != c {
+		return fmt.Errorf("expected %q at byte %d", c, s.pos)
+	}
+	sp.frame = append(sp.frame, c)
+	s.pos++
+	return nil
+}
+
+func (s *jsonScanner) peek() byte {
+	s.skipWhitespace()
+	if s.pos >= len(s.b) {
+		return 0
+	}
+	return s.b[s.pos]
+}
+
+func (s *jsonScanner) value() (*span, error) {
+	sp := &span{start: s.pos, kind: 'v'}
+	if s.pos >= len(s.b) {
+		return nil, fmt.Errorf("unexpected end of data at byte %d", s.pos)
+	}
+	switch s.b[s.pos] {
+	case '{':
+		sp.kind = 'm'
+		sp.frame = append(sp.frame, '{')
+		s.pos++
+		for s.peek() != '}' {
+			if len(sp.keys) > 0 {
+				if err := s.expect(sp, ','); err != nil {
+					return nil, err
+				}
+				s.skipWhitespace()
+			}
+			keyStart := s.pos
+			if err := s.string(); err != nil {
+				return nil, err
+			}
+			var key string
+			if err := json.Unmarshal(s.b[keyStart:s.pos], &key); err != nil {
+				return nil, fmt.Errorf("bad map key at byte %d: %s", keyStart, err)
+			}
+			sp.frame = append(sp.frame, s.b[keyStart:s.pos]...)
+			if err := s.expect(sp, ':'); err != nil {
+				return nil, err
+			}
+			s.skipWhitespace()
+			child, err := s.value()
+			if err != nil {
+				return nil, err
+			}
+			sp.keys = append(sp.keys, key)
+			sp.children = append(sp.children, child)
+		}
+		if err := s.expect(sp, '}'); err != nil {
+			return nil, err
+		}
+		// A map with just a "/" key is how dag-json writes links and bytes, so it's really just one value.
+		if len(sp.keys) == 1 && sp.keys[0] == "/" {
+			sp.kind, sp.keys, sp.children = 'v', nil, nil
+		}
+	case '[':
+		sp.kind = 'l'
+		sp.frame = append(sp.frame, '[')
+		s.pos++
+		for s.peek() != ']' {
+			if len(sp.children) > 0 {
+				if err := s.expect(sp, ','); err != nil {
+					return nil, err
+				}
+				s.skipWhitespace()
+			}
+			child, err := s.value()
+			if err != nil {
+				return nil, err
+			}
+			sp.children = append(sp.children, child)
+		}
+		if err := s.expect(sp, ']'); err != nil {
+			return nil, err
+		}
+	case '"':
+		if err := s.string(); err != nil {
+			return nil, err
+		}
+	default: // Numbers, and true, false, and null.
+		for s.pos < len(s.b) && strings.IndexByte(",:]} \t\r\n", s.b[s.pos]) < 0 {
+			s.pos++
+		}
+		if s.pos == sp.start {
+			return nil, fmt.Errorf("expected a value at byte %d", s.pos)
+		}
+	}
+	sp.end = s.pos
+	return sp, nil
+}
+
+func (s *jsonScanner) string() error {
+	start := s.pos
+	if s.pos >= len(s.b) || s.b[s.pos] != '"' {
+		return fmt.Errorf("expected a string at byte %d", s.pos)
+	}
+	for s.pos++; s.pos < len(s.b); s.pos++ {
+		switch s.b[s.pos] {
+		case '\\':
+			s.pos++
+		case '"':
+			s.pos++
+			return nil
+		}
+	}
+	return fmt.Errorf("unterminated string starting at byte %d", start)
+}
+
+// stripWhitespace returns some JSON without any whitespace outside of strings.
+func stripWhitespace(b []byte) []byte {
+	var out []byte
+	inString := false
+	for i := 0; i < len(b); i++ {
+		switch c := b[i]; {
+		case inString && c == '\\' && i+1 < len(b):
+			out = append(out, c, b[i+1])
+			i++
+			continue
+		case c == '"':
+			inString = !inString
+		case !inString && strings.IndexByte(" \t\r\n", c) >= 0:
+			continue
+		}
+		out = append(out, b[i])
+	}
+	return out
+}
+
+// scanCBOR finds the spans of the values in some CBOR.
+// Only definite-length items are understood (which is all that dag-cbor allows).
+// Anything after the first item is left alone: the caller can see where the root span ends.
+func scanCBOR(b []byte) (*span, error) {
+	s := &cborScanner{b: b}
+	return s.value()
+}
+
+type cborScanner struct {
+	b   []byte
+	pos int
+}
+
+// header reads an item's header, returning its major type, and its argument (which is its length, for strings and containers).
+func (s *cborScanner) header() (major byte, arg uint64, err error) {
+	if s.pos >= len(s.b) {
+		return 0, 0, fmt.Errorf("unexpected end of data at byte %d", s.pos)
+	}
+	major, info := s.b[s.pos]>>5, s.b[s.pos]&0x1f
+	s.pos++
+	size := 0
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	case info == 31:
+		return 0, 0, fmt.Errorf("indefinite-length item at byte %d", s.pos-1)
+	default:
+		return 0, 0, fmt.Errorf("malformed header at byte %d", s.pos-1)
+	}
+	if s.pos+size > len(s.b) {
+		return 0, 0, fmt.Errorf("unexpected end of data at byte %d", s.pos)
+	}
+	var buf [8]byte
+	copy(buf[8-size:], s.b[s.pos:s.pos+size])
+	s.pos += size
+	return major, binary.BigEndian.Uint64(buf[:]), nil
+}
+
+func (s *cborScanner) value() (*span, error) {
+	sp := &span{start: s.pos, kind: 'v'}
+	major, arg, err := s.header()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case 2, 3: // Bytes, and strings.
+		if arg > uint64(len(s.b)-s.pos) {
+			return nil, fmt.Errorf("unexpected end of data at byte %d", s.pos)
+		}
+		s.pos += int(arg)
+	case 4: // Lists.
+		sp.kind = 'l'
+		sp.frame = append(sp.frame, s.b[sp.start:s.pos]...)
+		for i := uint64(0); i < arg; i++ {
+			child, err := s.value()
+			if err != nil {
+				return nil, err
+			}
+			sp.children = append(sp.children, child)
+		}
+	case 5: // Maps.
+		sp.kind = 'm'
+		sp.frame = append(sp.frame, s.b[sp.start:s.pos]...)
+		for i := uint64(0); i < arg; i++ {
+			keySpan, err := s.value()
+			if err != nil {
+				return nil, err
+			}
+			keyBytes := s.b[keySpan.start:keySpan.end]
+			sp.frame = append(sp.frame, keyBytes...)
+			key := hex.EncodeToString(keyBytes)
+			if keyBytes[0]>>5 == 3 { // Strings (which are all that dag-cbor allows) are shown as themselves; anything else, as hex.
+				key = string(keyBytes[headerLength(keyBytes):])
+			}
+			child, err := s.value()
+			if err != nil {
+				return nil, err
+			}
+			sp.keys = append(sp.keys, key)
+			sp.children = append(sp.children, child)
+		}
+	case 6: // Tags: the tag and the item it's on are treated as one value (this is how links are written).
+		if _, err := s.value(); err != nil {
+			return nil, err
+		}
+	case 7: // Floats, and simple values: the header is all there is (the argument holds a float's bits).
+	}
+	sp.end = s.pos
+	return sp, nil
+}
+
+// headerLength returns how many bytes long the header at the start of some CBOR is.
+func headerLength(b []byte) int {
+	switch b[0] & 0x1f {
+	case 24:
+		return 2
+	case 25:
+		return 3
+	case 26:
+		return 5
+	case 27:
+		return 9
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,47 @@
+package codecs
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/ipld/go-ipldtool/app/shared"
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+var Cmd_Codecs = &cli.Command{
+	Name:     "codecs",
+	Category: "Advanced",
+	Usage:    "Ask what codecs this build of the tool can use.",
+	Subcommands: []*cli.Command{{
+		Name:   "list",
+		Usage:  "List every available codec, with its multicodec code, and what it can do.",
+		Action: Action_CodecsList,
+	}},
+}
+
+// Action_CodecsList is the 'ipld codecs list' command.
+// It prints a table of codecs, sorted by multicodec code.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- for incomprehensible or invalid arguments.
+func Action_CodecsList(args *cli.Context) error {
+	if args.Args().Len() != 0 {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'codecs list' command takes no positional arguments")
+	}
+
+	yesno := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+	tw := tabwriter.NewWriter(args.App.Writer, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "NAME\tCODE\tENCODE\tDECODE\tLINKS\n")
+	for _, info := range shared.ListCodecs() {
+		fmt.Fprintf(tw, "%s\t0x%x\t%s\t%s\t%s\n", info.Name, info.Code, yesno(info.Encoder != nil), yesno(info.Decoder != nil), yesno(info.LinkCapable))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,22 @@
+package codecs_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/ipld/go-ipldtool/app/testutil"
+)
+
+func TestCodecs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+	testutil.TestExecSpec(t, "../../docs/codecs.md")
+}
+
+func TestCanon(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+	testutil.TestExecSpec(t, "../../docs/canon.md")
+}
@@ -0,0 +1,5 @@
+package codecs
+
+const (
+	ErrCode_NotCanonical = "ipldtool-canon-not-canonical"
+)
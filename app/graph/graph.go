@@ -0,0 +1,330 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+	selectorparse "github.com/ipld/go-ipld-prime/traversal/selector/parse"
+
+	"github.com/ipld/go-ipldtool/app/shared"
+	"github.com/ipld/go-ipldtool/app/workspace"
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+var Cmd_Graph = &cli.Command{
+	Name:     "graph",
+	Category: "Advanced",
+	Usage:    "Draw the blocks of a DAG, and the links between them, as a Graphviz (DOT) or Mermaid graph.",
+	UsageText: `Graph is for seeing the shape of data that's spread across many blocks.` + "\n" +
+		"\n" +
+		`   ### Synopsis` + "\n" +
+		"\n" +
+		`   ipld [...global args...] graph <CID>` + "\n" +
+		`           [--format=<"dot"|"mermaid">]` + "\n" +
+		`           [--depth=<number>]` + "\n" +
+		`           [--selector=<dag-json-selector>]` + "\n" +
+		`           [--collapse=<true|false>]` + "\n" +
+		"\n" +
+		`   Starting from the block the CID points to, every link is followed, loading blocks from the workspace storage, and the whole DAG is printed as a graph: in Graphviz's DOT language by default, or as a Mermaid flowchart with "--format=mermaid".  (For example, "ipld graph <CID> | dot -Tsvg > dag.svg" makes a picture of it.)` + "\n" +
+		"\n" +
+		`   Each block is a node in the graph, labeled with its CID, its codec, and its size in bytes.  Each link is an edge, labeled with the data model path of the link inside the block it's in.  Blocks that aren't in the storage are still drawn (with a dashed outline), and labeled as missing; nothing past them can be drawn.` + "\n" +
+		"\n" +
+		`   The walk is breadth-first.  With the "--depth" flag, links are only followed that many blocks away from the root; the blocks at the limit are drawn, with a count of how many links weren't followed from them.` + "\n" +
+		"\n" +
+		`   With the "--selector" flag, only the links the selector reaches are followed (see https://ipld.io/specs/selectors/ ).  The selector is given in dag-json, and is applied starting from the root block, across links, as a traversal would.` + "\n" +
+		"\n" +
+		`   By default, a block that's linked to from many places is drawn once, with an edge from each of them, so repeated subtrees are collapsed into one.  With "--collapse=false", each link gets its own copy of the block it points to (and everything beneath it), so the graph is drawn as a tree.` + "\n",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:        "format",
+			Usage:       `Defines what format the graph should be printed in.  Valid arguments are "dot" or "mermaid".`,
+			DefaultText: "dot",
+		},
+		&cli.IntFlag{
+			Name:        "depth",
+			Usage:       `The most links away from the root to follow.  Zero means only the root block is drawn.`,
+			DefaultText: "no limit",
+		},
+		&cli.StringFlag{
+			Name:  "selector",
+			Usage: `A selector, in dag-json, which says which links to follow.`,
+		},
+		&cli.BoolFlag{
+			Name:  "collapse",
+			Usage: `Draw each block once, even if it's linked to from many places.  Set to false to draw the graph as a tree instead.`,
+			Value: true,
+		},
+	},
+	Action: Action_Graph,
+}
+
+// Action_Graph is the function that implements the `ipld graph` command's behaviors.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- for incomprehensible or invalid arguments (including selectors that don't compile).
+//   - ipldtool-error-load-failed -- if the root block can't be loaded, or some other block is in storage but can't be loaded.
+//   - ipldtool-error-data-invalid -- if walking the links in a block fails (for example, if the selector can't be applied to it).
+//   - ipldtool-workspace-not-found -- if there's no workspace to load from.
+func Action_Graph(args *cli.Context) error {
+	// Parse positional args.
+	if args.Args().Len() != 1 {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'graph' command needs exactly one positional argument")
+	}
+	_, root, err := shared.ParseDataSourceArg(args.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	if root == nil {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'graph' command needs a CID as its argument, since it walks through storage")
+	}
+
+	// Parse the rest of the flags.
+	var printGraph func(io.Writer, *dag)
+	switch args.String("format") {
+	case "", "dot":
+		printGraph = printDot
+	case "mermaid":
+		printGraph = printMermaid
+	default:
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "format argument not recognized: must be either \"dot\" or \"mermaid\"")
+	}
+	depth := -1
+	if args.IsSet("depth") {
+		depth = args.Int("depth")
+		if depth < 0 {
+			return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "depth argument can't be negative")
+		}
+	}
+	var sel selector.Selector
+	if args.IsSet("selector") {
+		sel, err = selectorparse.ParseAndCompileJSONSelector(args.String("selector"))
+		if err != nil {
+			return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "selector argument not recognized: %s", err)
+		}
+	}
+
+	// Set up a LinkSystem to load blocks with.
+	store := &workspace.LazyStorage{}
+	defer store.Close()
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.SetReadStorage(store)
+
+	// Walk, and draw.
+	w := walker{lsys: &lsys, store: store, depth: depth, collapse: args.Bool("collapse"), seen: map[string]*block{}}
+	g, err := w.walk(root, sel)
+	if err != nil {
+		return err
+	}
+	printGraph(args.App.Writer, g)
+	return nil
+}
+
+// dag is the graph that's drawn: every block reached, and every link between them.
+type dag struct {
+	blocks []*block
+	edges  []edge
+}
+
+type block struct {
+	id      string // The name of the node in the graph: "n0", "n1", and so on.
+	link    datamodel.Link
+	codec   string
+	size    int
+	missing bool
+	more    int // How many links weren't followed from this block, because of the depth limit.
+}
+
+type edge struct {
+	from, to *block
+	path     datamodel.Path
+}
+
+// walker walks a DAG breadth-first, building up the graph.
+type walker struct {
+	lsys     *linking.LinkSystem
+	store    *workspace.LazyStorage
+	depth    int // -1 for no limit.
+	collapse bool
+	seen     map[string]*block // Blocks already in the graph, by the binary form of their link.  Only used when collapsing.
+
+	g dag
+}
+
+// step is a block waiting to be walked.
+type step struct {
+	block *block
+	node  datamodel.Node
+	sel   selector.Selector
+	depth int
+}
+
+func (w *walker) walk(root datamodel.Link, sel selector.Selector) (*dag, error) {
+	ctx := context.Background()
+	rootBlock, n, err := w.load(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	if rootBlock.missing {
+		return nil, ipldtoolerr.Newf(shared.ErrCode_LoadFailed, "could not load %s: it's not in the storage", root)
+	}
+
+	queue := []step{{rootBlock, n, sel, 0}}
+	for len(queue) > 0 {
+		here := queue[0]
+		queue = queue[1:]
+		if here.node == nil {
+			continue // Missing, or in a codec that can't be decoded.
+		}
+		err := shared.WalkLinks(here.node, here.sel, func(at datamodel.Path, lnk datamodel.Link, next selector.Selector) error {
+			if w.depth != -1 && here.depth >= w.depth {
+				here.block.more++
+				return nil
+			}
+			if w.collapse {
+				if seen, ok := w.seen[lnk.Binary()]; ok {
+					w.g.edges = append(w.g.edges, edge{here.block, seen, at})
+					return nil
+				}
+			}
+			b, n, err := w.load(ctx, lnk)
+			if err != nil {
+				return err
+			}
+			w.g.edges = append(w.g.edges, edge{here.block, b, at})
+			queue = append(queue, step{b, n, next, here.depth + 1})
+			return nil
+		})
+		if _, coded := err.(*ipldtoolerr.Error); coded {
+			return nil, err
+		} else if err != nil {
+			return nil, ipldtoolerr.Newf(shared.ErrCode_DataInvalid, "could not walk the links in %s: %s", here.block.link, err)
+		}
+	}
+	return &w.g, nil
+}
+
+// load adds a block to the graph, loading it from storage, and returns it, and its data (if it could be decoded).
+func (w *walker) load(ctx context.Context, lnk datamodel.Link) (*block, datamodel.Node, error) {
+	b := &block{id: fmt.Sprintf("n%d", len(w.g.blocks)), link: lnk}
+	w.g.blocks = append(w.g.blocks, b)
+	if w.collapse {
+		w.seen[lnk.Binary()] = b
+	}
+	info, _ := shared.LookupCodec(lnk.(cidlink.Link).Prefix().Codec)
+	b.codec = info.Name
+
+	has, err := w.store.Has(ctx, lnk.Binary())
+	if _, coded := err.(*ipldtoolerr.Error); coded {
+		return nil, nil, err // Errors from opening the storage already say what went wrong.
+	} else if err != nil {
+		return nil, nil, ipldtoolerr.Newf(shared.ErrCode_LoadFailed, "could not load %s: %s", lnk, err)
+	}
+	if !has {
+		b.missing = true
+		return b, nil, nil
+	}
+
+	lnkCtx := linking.LinkContext{Ctx: ctx}
+	if info.Decoder == nil {
+		// There's no way to see inside, but the block can still be drawn.
+		raw, err := w.lsys.LoadRaw(lnkCtx, lnk)
+		if err != nil {
+			return nil, nil, ipldtoolerr.Newf(shared.ErrCode_LoadFailed, "could not load %s: %s", lnk, err)
+		}
+		b.size = len(raw)
+		return b, nil, nil
+	}
+	np, err := shared.ChoosePrototype(lnk, lnkCtx)
+	if err != nil {
+		return nil, nil, err
+	}
+	n, raw, err := w.lsys.LoadPlusRaw(lnkCtx, lnk, np)
+	if err != nil {
+		return nil, nil, ipldtoolerr.Newf(shared.ErrCode_LoadFailed, "could not load %s: %s", lnk, err)
+	}
+	b.size = len(raw)
+	return b, n, nil
+}
+
+// label returns the lines of text a block is labeled with.
+func (b *block) label() []string {
+	lines := []string{b.link.String()}
+	if b.missing {
+		return append(lines, "missing")
+	}
+	lines = append(lines, fmt.Sprintf("%s, %d bytes", b.codec, b.size))
+	switch b.more {
+	case 0:
+	case 1:
+		lines = append(lines, "1 more link")
+	default:
+		lines = append(lines, fmt.Sprintf("%d more links", b.more))
+	}
+	return lines
+}
+
+// printDot prints the graph in Graphviz's DOT language.
+func printDot(w io.Writer, g *dag) {
+	quote := func(s string) string {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+	}
+	fmt.Fprintln(w, "digraph dag {")
+	fmt.Fprintln(w, "\tnode [shape=box];")
+	for _, b := range g.blocks {
+		label := quote(strings.Join(b.label(), "\n"))
+		if b.missing {
+			fmt.Fprintf(w, "\t%s [label=%s, style=dashed];\n", b.id, label)
+		} else {
+			fmt.Fprintf(w, "\t%s [label=%s];\n", b.id, label)
+		}
+	}
+	for _, e := range g.edges {
+		if e.path.Len() == 0 {
+			fmt.Fprintf(w, "\t%s -> %s;\n", e.from.id, e.to.id)
+		} else {
+			fmt.Fprintf(w, "\t%s -> %s [label=%s];\n", e.from.id, e.to.id, quote(e.path.String()))
+		}
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// printMermaid prints the graph as a Mermaid flowchart.
+func printMermaid(w io.Writer, g *dag) {
+	// Mermaid has no escapes with backslashes; quotes are written as an entity instead.
+	quote := func(s string) string {
+		return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+	}
+	fmt.Fprintln(w, "flowchart TD")
+	anyMissing := false
+	for _, b := range g.blocks {
+		lines := b.label()
+		for i := range lines {
+			lines[i] = strings.ReplaceAll(lines[i], `"`, "#quot;")
+		}
+		fmt.Fprintf(w, "\t%s[\"%s\"]", b.id, strings.Join(lines, "<br/>"))
+		if b.missing {
+			fmt.Fprint(w, ":::missing")
+			anyMissing = true
+		}
+		fmt.Fprintln(w)
+	}
+	for _, e := range g.edges {
+		if e.path.Len() == 0 {
+			fmt.Fprintf(w, "\t%s --> %s\n", e.from.id, e.to.id)
+		} else {
+			fmt.Fprintf(w, "\t%s -->|%s| %s\n", e.from.id, quote(e.path.String()), e.to.id)
+		}
+	}
+	if anyMissing {
+		fmt.Fprintln(w, "\tclassDef missing stroke-dasharray: 5 5")
+	}
+}
@@ -0,0 +1,6 @@
+package query
+
+const (
+	ErrCode_QueryInvalid = "ipldtool-query-invalid"
+	ErrCode_QueryFailed  = "ipldtool-query-failed"
+)
@@ -0,0 +1,909 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+
+	"github.com/ipld/go-ipldtool/app/shared"
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+// evaluator holds what's needed while running a query.
+type evaluator struct {
+	lsys *linking.LinkSystem
+}
+
+// emitFn is called with each result of an expression.
+type emitFn func(datamodel.Node) error
+
+// expr is a node in a parsed query.
+// Evaluating an expression on an input produces any number of results, each of which is passed to emit as soon as it's ready.
+type expr interface {
+	eval(ev *evaluator, in datamodel.Node, emit emitFn) error
+}
+
+type identityExpr struct{}
+
+func (identityExpr) eval(ev *evaluator, in datamodel.Node, emit emitFn) error {
+	return emit(in)
+}
+
+type literalExpr struct{ value datamodel.Node }
+
+func (e literalExpr) eval(ev *evaluator, in datamodel.Node, emit emitFn) error {
+	return emit(e.value)
+}
+
+type pipeExpr struct{ left, right expr }
+
+func (e pipeExpr) eval(ev *evaluator, in datamodel.Node, emit emitFn) error {
+	return e.left.eval(ev, in, func(v datamodel.Node) error {
+		return e.right.eval(ev, v, emit)
+	})
+}
+
+type commaExpr struct{ left, right expr }
+
+func (e commaExpr) eval(ev *evaluator, in datamodel.Node, emit emitFn) error {
+	if err := e.left.eval(ev, in, emit); err != nil {
+		return err
+	}
+	return e.right.eval(ev, in, emit)
+}
+
+// tryExpr is the "?" suffix: errors are dropped, along with any results after them.
+type tryExpr struct{ inner expr }
+
+func (e tryExpr) eval(ev *evaluator, in datamodel.Node, emit emitFn) error {
+	var emitErr error
+	err := e.inner.eval(ev, in, func(v datamodel.Node) error {
+		if emitErr = emit(v); emitErr != nil {
+			return emitErr
+		}
+		return nil
+	})
+	if err != nil && err == emitErr {
+		return err // Errors from further along the pipe aren't ours to drop.
+	}
+	return nil
+}
+
+type indexExpr struct{ target, index expr }
+
+func (e indexExpr) eval(ev *evaluator, in datamodel.Node, emit emitFn) error {
+	return e.index.eval(ev, in, func(idx datamodel.Node) error {
+		return e.target.eval(ev, in, func(v datamodel.Node) error {
+			result, err := ev.lookup(v, idx)
+			if err != nil {
+				return err
+			}
+			return emit(result)
+		})
+	})
+}
+
+type sliceExpr struct{ target, from, to expr }
+
+func (e sliceExpr) eval(ev *evaluator, in datamodel.Node, emit emitFn) error {
+	bounds := func(bound expr, then func(*int64) error) error {
+		if bound == nil {
+			return then(nil)
+		}
+		return bound.eval(ev, in, func(v datamodel.Node) error {
+			if v.Kind() == datamodel.Kind_Null {
+				return then(nil)
+			}
+			i, err := v.AsInt()
+			if err != nil {
+				return ev.errorf("slice bounds must be ints, not %s", describe(v))
+			}
+			return then(&i)
+		})
+	}
+	return bounds(e.to, func(to *int64) error {
+		return bounds(e.from, func(from *int64) error {
+			return e.target.eval(ev, in, func(v datamodel.Node) error {
+				result, err := ev.slice(v, from, to)
+				if err != nil {
+					return err
+				}
+				return emit(result)
+			})
+		})
+	})
+}
+
+type iterateExpr struct{ target expr }
+
+func (e iterateExpr) eval(ev *evaluator, in datamodel.Node, emit emitFn) error {
+	return e.target.eval(ev, in, func(v datamodel.Node) error {
+		v, err := ev.load(v)
+		if err != nil {
+			return err
+		}
+		switch v.Kind() {
+		case datamodel.Kind_Map:
+			for itr := v.MapIterator(); !itr.Done(); {
+				_, entry, err := itr.Next()
+				if err != nil {
+					return err
+				}
+				if !entry.IsAbsent() {
+					if err := emit(entry); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		case datamodel.Kind_List:
+			return eachListEntry(v, func(_ int64, entry datamodel.Node) error {
+				return emit(entry)
+			})
+		default:
+			return ev.errorf("cannot iterate over %s", describe(v))
+		}
+	})
+}
+
+// recurseExpr is "..": the input, and everything inside it, recursively (but not going into the blocks that links point to).
+type recurseExpr struct{}
+
+func (recurseExpr) eval(ev *evaluator, in datamodel.Node, emit emitFn) error {
+	if err := emit(in); err != nil {
+		return err
+	}
+	switch in.Kind() {
+	case datamodel.Kind_Map:
+		for itr := in.MapIterator(); !itr.Done(); {
+			_, v, err := itr.Next()
+			if err != nil {
+				return err
+			}
+			if !v.IsAbsent() {
+				if err := (recurseExpr{}).eval(ev, v, emit); err != nil {
+					return err
+				}
+			}
+		}
+	case datamodel.Kind_List:
+		return eachListEntry(in, func(_ int64, v datamodel.Node) error {
+			return recurseExpr{}.eval(ev, v, emit)
+		})
+	}
+	return nil
+}
+
+type arrayExpr struct{ inner expr } // inner is nil for "[]".
+
+func (e arrayExpr) eval(ev *evaluator, in datamodel.Node, emit emitFn) error {
+	var entries []datamodel.Node
+	if e.inner != nil {
+		err := e.inner.eval(ev, in, func(v datamodel.Node) error {
+			entries = append(entries, v)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	list, err := newList(entries)
+	if err != nil {
+		return err
+	}
+	return emit(list)
+}
+
+type objectEntry struct{ key, value expr }
+
+type objectExpr struct{ entries []objectEntry }
+
+func (e objectExpr) eval(ev *evaluator, in datamodel.Node, emit emitFn) error {
+	// Every combination of the keys' and values' results makes one object, as in jq.
+	var build func(i int, keys []string, values []datamodel.Node) error
+	build = func(i int, keys []string, values []datamodel.Node) error {
+		if i == len(e.entries) {
+			obj, err := newMap(keys, values)
+			if err != nil {
+				return err
+			}
+			return emit(obj)
+		}
+		return e.entries[i].key.eval(ev, in, func(k datamodel.Node) error {
+			key, err := k.AsString()
+			if err != nil {
+				return ev.errorf("object keys must be strings, not %s", describe(k))
+			}
+			return e.entries[i].value.eval(ev, in, func(v datamodel.Node) error {
+				return build(i+1, append(keys[:i:i], key), append(values[:i:i], v))
+			})
+		})
+	}
+	return build(0, nil, nil)
+}
+
+type binaryExpr struct {
+	op          string
+	left, right expr
+}
+
+func (e binaryExpr) eval(ev *evaluator, in datamodel.Node, emit emitFn) error {
+	switch e.op {
+	case "and", "or":
+		// These short-circuit: the right side is only evaluated if it matters.
+		return e.left.eval(ev, in, func(l datamodel.Node) error {
+			if truthy(l) == (e.op == "or") {
+				return emit(basicnode.NewBool(truthy(l)))
+			}
+			return e.right.eval(ev, in, func(r datamodel.Node) error {
+				return emit(basicnode.NewBool(truthy(r)))
+			})
+		})
+	}
+	return e.right.eval(ev, in, func(r datamodel.Node) error {
+		return e.left.eval(ev, in, func(l datamodel.Node) error {
+			result, err := ev.binary(e.op, l, r)
+			if err != nil {
+				return err
+			}
+			return emit(result)
+		})
+	})
+}
+
+type callExpr struct {
+	name string
+	fn   builtin
+	args []expr
+}
+
+func (e callExpr) eval(ev *evaluator, in datamodel.Node, emit emitFn) error {
+	return e.fn.impl(ev, in, e.args, emit)
+}
+
+// builtin is a function that can be called in a query.
+// The arguments are expressions, not values: it's up to each function how (and whether) to evaluate them.
+type builtin struct {
+	arity int
+	impl  func(ev *evaluator, in datamodel.Node, args []expr, emit emitFn) error
+}
+
+var builtins map[string]builtin
+
+func init() {
+	// (This is set up here, rather than in the var declaration, because "map" refers back to the evaluation functions, which refer to this.)
+	builtins = map[string]builtin{
+		"empty": {0, func(ev *evaluator, in datamodel.Node, args []expr, emit emitFn) error {
+			return nil
+		}},
+		"not": {0, func(ev *evaluator, in datamodel.Node, args []expr, emit emitFn) error {
+			return emit(basicnode.NewBool(!truthy(in)))
+		}},
+		"select": {1, func(ev *evaluator, in datamodel.Node, args []expr, emit emitFn) error {
+			return args[0].eval(ev, in, func(v datamodel.Node) error {
+				if truthy(v) {
+					return emit(in)
+				}
+				return nil
+			})
+		}},
+		"map": {1, func(ev *evaluator, in datamodel.Node, args []expr, emit emitFn) error {
+			return arrayExpr{pipeExpr{iterateExpr{identityExpr{}}, args[0]}}.eval(ev, in, emit)
+		}},
+		"type": {0, func(ev *evaluator, in datamodel.Node, args []expr, emit emitFn) error {
+			return emit(basicnode.NewString(kindName(in.Kind())))
+		}},
+		"length": {0, func(ev *evaluator, in datamodel.Node, args []expr, emit emitFn) error {
+			switch in.Kind() {
+			case datamodel.Kind_Null:
+				return emit(basicnode.NewInt(0))
+			case datamodel.Kind_Map, datamodel.Kind_List:
+				return emit(basicnode.NewInt(in.Length()))
+			case datamodel.Kind_String:
+				s, _ := in.AsString()
+				return emit(basicnode.NewInt(int64(utf8.RuneCountInString(s))))
+			case datamodel.Kind_Bytes:
+				b, _ := in.AsBytes()
+				return emit(basicnode.NewInt(int64(len(b))))
+			case datamodel.Kind_Int:
+				i, _ := in.AsInt()
+				if i < 0 {
+					i = -i
+				}
+				return emit(basicnode.NewInt(i))
+			case datamodel.Kind_Float:
+				f, _ := in.AsFloat()
+				return emit(basicnode.NewFloat(math.Abs(f)))
+			default:
+				return ev.errorf("%s has no length", describe(in))
+			}
+		}},
+		"keys": {0, func(ev *evaluator, in datamodel.Node, args []expr, emit emitFn) error {
+			in, err := ev.load(in)
+			if err != nil {
+				return err
+			}
+			var keys []datamodel.Node
+			switch in.Kind() {
+			case datamodel.Kind_Map:
+				var names []string
+				for itr := in.MapIterator(); !itr.Done(); {
+					k, v, err := itr.Next()
+					if err != nil {
+						return err
+					}
+					if !v.IsAbsent() {
+						name, _ := k.AsString()
+						names = append(names, name)
+					}
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					keys = append(keys, basicnode.NewString(name))
+				}
+			case datamodel.Kind_List:
+				for i := int64(0); i < in.Length(); i++ {
+					keys = append(keys, basicnode.NewInt(i))
+				}
+			default:
+				return ev.errorf("%s has no keys", describe(in))
+			}
+			list, err := newList(keys)
+			if err != nil {
+				return err
+			}
+			return emit(list)
+		}},
+		"has": {1, func(ev *evaluator, in datamodel.Node, args []expr, emit emitFn) error {
+			in, err := ev.load(in)
+			if err != nil {
+				return err
+			}
+			return args[0].eval(ev, in, func(k datamodel.Node) error {
+				if _, err := ev.lookup(in, k); err != nil {
+					return err
+				}
+				return emit(basicnode.NewBool(exists(in, k)))
+			})
+		}},
+		"load": {0, func(ev *evaluator, in datamodel.Node, args []expr, emit emitFn) error {
+			v, err := ev.load(in)
+			if err != nil {
+				return err
+			}
+			return emit(v)
+		}},
+		"tostring": {0, func(ev *evaluator, in datamodel.Node, args []expr, emit emitFn) error {
+			switch in.Kind() {
+			case datamodel.Kind_String:
+				return emit(in)
+			case datamodel.Kind_Link:
+				lnk, _ := in.AsLink()
+				return emit(basicnode.NewString(lnk.String()))
+			case datamodel.Kind_Null, datamodel.Kind_Bool, datamodel.Kind_Int, datamodel.Kind_Float:
+				return emit(basicnode.NewString(scalarString(in)))
+			default:
+				return ev.errorf("%s can't be made into a string", describe(in))
+			}
+		}},
+		"startswith": {1, func(ev *evaluator, in datamodel.Node, args []expr, emit emitFn) error {
+			return stringTest(ev, in, args[0], strings.HasPrefix, emit)
+		}},
+		"endswith": {1, func(ev *evaluator, in datamodel.Node, args []expr, emit emitFn) error {
+			return stringTest(ev, in, args[0], strings.HasSuffix, emit)
+		}},
+	}
+}
+
+// stringTest is the common part of startswith and endswith.
+func stringTest(ev *evaluator, in datamodel.Node, arg expr, test func(s, affix string) bool, emit emitFn) error {
+	s, err := in.AsString()
+	if err != nil {
+		return ev.errorf("%s is not a string", describe(in))
+	}
+	return arg.eval(ev, in, func(v datamodel.Node) error {
+		affix, err := v.AsString()
+		if err != nil {
+			return ev.errorf("%s is not a string", describe(v))
+		}
+		return emit(basicnode.NewBool(test(s, affix)))
+	})
+}
+
+// load returns the block a link points to, loaded from storage, if the node is a link; or the node itself, if it's not.
+func (ev *evaluator) load(n datamodel.Node) (datamodel.Node, error) {
+	if n.Kind() != datamodel.Kind_Link {
+		return n, nil
+	}
+	lnk, err := n.AsLink()
+	if err != nil {
+		return nil, err
+	}
+	if ev.lsys == nil {
+		return nil, ev.errorf("cannot load %s: there's no storage to load it from", lnk)
+	}
+	np, err := shared.ChoosePrototype(lnk, linking.LinkContext{})
+	if err != nil {
+		return nil, err
+	}
+	loaded, err := ev.lsys.Load(linking.LinkContext{Ctx: context.Background()}, lnk, np)
+	if err != nil {
+		return nil, ipldtoolerr.Newf(shared.ErrCode_LoadFailed, "could not load %s: %s", lnk, err)
+	}
+	return loaded, nil
+}
+
+// lookup is indexing: a map by a string key, or a list by an int index.
+// As in jq, things that aren't there are null, and so is anything looked up in null.
+// Links are loaded first, so indexing goes through them.
+func (ev *evaluator) lookup(n, idx datamodel.Node) (datamodel.Node, error) {
+	n, err := ev.load(n)
+	if err != nil {
+		return nil, err
+	}
+	var v datamodel.Node
+	switch {
+	case n.Kind() == datamodel.Kind_Null:
+		return datamodel.Null, nil
+	case n.Kind() == datamodel.Kind_Map && idx.Kind() == datamodel.Kind_String:
+		key, _ := idx.AsString()
+		v, err = n.LookupByString(key)
+	case n.Kind() == datamodel.Kind_List && idx.Kind() == datamodel.Kind_Int:
+		i, _ := idx.AsInt()
+		if i < 0 {
+			i += n.Length()
+		}
+		if i < 0 || i >= n.Length() {
+			return datamodel.Null, nil
+		}
+		v, err = n.LookupByIndex(i)
+	default:
+		return nil, ev.errorf("cannot index %s with %s", describe(n), describe(idx))
+	}
+	if errors.As(err, &datamodel.ErrNotExists{}) {
+		return datamodel.Null, nil
+	} else if err != nil {
+		return nil, ev.errorf("%s", err)
+	}
+	if v.IsAbsent() {
+		return datamodel.Null, nil
+	}
+	return v, nil
+}
+
+// exists says whether a map has a key, or a list has an index, for "has" to tell apart a null value from no value.
+func exists(n, idx datamodel.Node) bool {
+	switch n.Kind() {
+	case datamodel.Kind_Map:
+		key, _ := idx.AsString()
+		v, err := n.LookupByString(key)
+		return err == nil && !v.IsAbsent()
+	case datamodel.Kind_List:
+		i, _ := idx.AsInt()
+		return i >= 0 && i < n.Length()
+	}
+	return false
+}
+
+// slice takes part of a list, string, or bytes; as in Go, "to" is exclusive, and as in jq, negative bounds count from the end.
+func (ev *evaluator) slice(n datamodel.Node, from, to *int64) (datamodel.Node, error) {
+	n, err := ev.load(n)
+	if err != nil {
+		return nil, err
+	}
+	length := int64(0)
+	switch n.Kind() {
+	case datamodel.Kind_Null:
+		return datamodel.Null, nil
+	case datamodel.Kind_List:
+		length = n.Length()
+	case datamodel.Kind_String:
+		s, _ := n.AsString()
+		length = int64(len(s))
+	case datamodel.Kind_Bytes:
+		b, _ := n.AsBytes()
+		length = int64(len(b))
+	default:
+		return nil, ev.errorf("cannot slice %s", describe(n))
+	}
+	clamp := func(bound *int64, dflt int64) int64 {
+		if bound == nil {
+			return dflt
+		}
+		i := *bound
+		if i < 0 {
+			i += length
+		}
+		if i < 0 {
+			return 0
+		}
+		if i > length {
+			return length
+		}
+		return i
+	}
+	start, end := clamp(from, 0), clamp(to, length)
+	if end < start {
+		end = start
+	}
+	switch n.Kind() {
+	case datamodel.Kind_String:
+		s, _ := n.AsString()
+		return basicnode.NewString(s[start:end]), nil
+	case datamodel.Kind_Bytes:
+		b, _ := n.AsBytes()
+		return basicnode.NewBytes(b[start:end]), nil
+	default:
+		var entries []datamodel.Node
+		for i := start; i < end; i++ {
+			v, err := n.LookupByIndex(i)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, v)
+		}
+		return newList(entries)
+	}
+}
+
+// binary does the arithmetic and comparison operators.
+func (ev *evaluator) binary(op string, l, r datamodel.Node) (datamodel.Node, error) {
+	switch op {
+	case "==":
+		return basicnode.NewBool(compare(l, r) == 0), nil
+	case "!=":
+		return basicnode.NewBool(compare(l, r) != 0), nil
+	case "<":
+		return basicnode.NewBool(compare(l, r) < 0), nil
+	case "<=":
+		return basicnode.NewBool(compare(l, r) <= 0), nil
+	case ">":
+		return basicnode.NewBool(compare(l, r) > 0), nil
+	case ">=":
+		return basicnode.NewBool(compare(l, r) >= 0), nil
+	}
+
+	// As in jq, null is nothing, when adding.
+	if op == "+" && l.Kind() == datamodel.Kind_Null {
+		return r, nil
+	}
+	if op == "+" && r.Kind() == datamodel.Kind_Null {
+		return l, nil
+	}
+	if isNumber(l) && isNumber(r) {
+		return arithmetic(ev, op, l, r)
+	}
+	if op == "+" && l.Kind() == r.Kind() {
+		switch l.Kind() {
+		case datamodel.Kind_String:
+			ls, _ := l.AsString()
+			rs, _ := r.AsString()
+			return basicnode.NewString(ls + rs), nil
+		case datamodel.Kind_Bytes:
+			lb, _ := l.AsBytes()
+			rb, _ := r.AsBytes()
+			return basicnode.NewBytes(append(append([]byte{}, lb...), rb...)), nil
+		case datamodel.Kind_List:
+			var entries []datamodel.Node
+			for _, list := range []datamodel.Node{l, r} {
+				eachListEntry(list, func(_ int64, v datamodel.Node) error {
+					entries = append(entries, v)
+					return nil
+				})
+			}
+			return newList(entries)
+		case datamodel.Kind_Map:
+			// Keys from the right replace the same keys from the left.
+			var keys []string
+			values := map[string]datamodel.Node{}
+			for _, m := range []datamodel.Node{l, r} {
+				for itr := m.MapIterator(); !itr.Done(); {
+					k, v, err := itr.Next()
+					if err != nil {
+						return nil, err
+					}
+					key, _ := k.AsString()
+					if _, seen := values[key]; !seen {
+						keys = append(keys, key)
+					}
+					values[key] = v
+				}
+			}
+			ordered := make([]datamodel.Node, len(keys))
+			for i, key := range keys {
+				ordered[i] = values[key]
+			}
+			return newMap(keys, ordered)
+		}
+	}
+	return nil, ev.errorf("cannot use %q on %s and %s", op, describe(l), describe(r))
+}
+
+// arithmetic does the arithmetic operators on numbers.
+// Ints stay ints, unless they're mixed with floats, or divided unevenly.
+func arithmetic(ev *evaluator, op string, l, r datamodel.Node) (datamodel.Node, error) {
+	if l.Kind() == datamodel.Kind_Int && r.Kind() == datamodel.Kind_Int {
+		a, _ := l.AsInt()
+		b, _ := r.AsInt()
+		switch {
+		case op == "+":
+			return basicnode.NewInt(a + b), nil
+		case op == "-":
+			return basicnode.NewInt(a - b), nil
+		case op == "*":
+			return basicnode.NewInt(a * b), nil
+		case b == 0:
+			return nil, ev.errorf("cannot divide %d by zero", a)
+		case op == "%":
+			return basicnode.NewInt(a % b), nil
+		case a%b == 0:
+			return basicnode.NewInt(a / b), nil
+		}
+	}
+	a, b := toFloat(l), toFloat(r)
+	switch op {
+	case "+":
+		return basicnode.NewFloat(a + b), nil
+	case "-":
+		return basicnode.NewFloat(a - b), nil
+	case "*":
+		return basicnode.NewFloat(a * b), nil
+	case "/":
+		if b == 0 {
+			return nil, ev.errorf("cannot divide %g by zero", a)
+		}
+		return basicnode.NewFloat(a / b), nil
+	default:
+		return nil, ev.errorf("cannot use %q on floats", op)
+	}
+}
+
+func (ev *evaluator) errorf(format string, args ...interface{}) error {
+	return ipldtoolerr.Newf(ErrCode_QueryFailed, format, args...)
+}
+
+// kindRank orders the kinds, for comparing values of different kinds.
+var kindRank = map[datamodel.Kind]int{
+	datamodel.Kind_Null:   0,
+	datamodel.Kind_Bool:   1,
+	datamodel.Kind_Int:    2,
+	datamodel.Kind_Float:  2,
+	datamodel.Kind_String: 3,
+	datamodel.Kind_Bytes:  4,
+	datamodel.Kind_List:   5,
+	datamodel.Kind_Map:    6,
+	datamodel.Kind_Link:   7,
+}
+
+// compare orders any two values: first by kind (see kindRank), and then by value.
+// Ints and floats are compared as numbers; maps are compared by their sorted keys, and then by the values for those keys, as in jq.
+func compare(l, r datamodel.Node) int {
+	if rl, rr := kindRank[l.Kind()], kindRank[r.Kind()]; rl != rr {
+		return rl - rr
+	}
+	switch l.Kind() {
+	case datamodel.Kind_Bool:
+		a, _ := l.AsBool()
+		b, _ := r.AsBool()
+		switch {
+		case a == b:
+			return 0
+		case b:
+			return -1
+		default:
+			return 1
+		}
+	case datamodel.Kind_Int, datamodel.Kind_Float:
+		if l.Kind() == datamodel.Kind_Int && r.Kind() == datamodel.Kind_Int {
+			a, _ := l.AsInt()
+			b, _ := r.AsInt()
+			return compareOrdered(a, b)
+		}
+		return compareOrdered(toFloat(l), toFloat(r))
+	case datamodel.Kind_String:
+		a, _ := l.AsString()
+		b, _ := r.AsString()
+		return strings.Compare(a, b)
+	case datamodel.Kind_Bytes:
+		a, _ := l.AsBytes()
+		b, _ := r.AsBytes()
+		return bytes.Compare(a, b)
+	case datamodel.Kind_Link:
+		a, _ := l.AsLink()
+		b, _ := r.AsLink()
+		return strings.Compare(a.Binary(), b.Binary())
+	case datamodel.Kind_List:
+		for i := int64(0); i < l.Length() && i < r.Length(); i++ {
+			a, _ := l.LookupByIndex(i)
+			b, _ := r.LookupByIndex(i)
+			if c := compare(a, b); c != 0 {
+				return c
+			}
+		}
+		return compareOrdered(l.Length(), r.Length())
+	case datamodel.Kind_Map:
+		lk, rk := sortedKeys(l), sortedKeys(r)
+		for i := 0; i < len(lk) && i < len(rk); i++ {
+			if c := strings.Compare(lk[i], rk[i]); c != 0 {
+				return c
+			}
+		}
+		if c := compareOrdered(len(lk), len(rk)); c != 0 {
+			return c
+		}
+		for _, k := range lk {
+			a, _ := l.LookupByString(k)
+			b, _ := r.LookupByString(k)
+			if c := compare(a, b); c != 0 {
+				return c
+			}
+		}
+	}
+	return 0
+}
+
+func compareOrdered[T int | int64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func sortedKeys(n datamodel.Node) []string {
+	var keys []string
+	for itr := n.MapIterator(); !itr.Done(); {
+		k, v, err := itr.Next()
+		if err != nil {
+			break
+		}
+		if !v.IsAbsent() {
+			key, _ := k.AsString()
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// truthy is false for false and null, and true for everything else, as in jq.
+func truthy(n datamodel.Node) bool {
+	if n.Kind() == datamodel.Kind_Bool {
+		b, _ := n.AsBool()
+		return b
+	}
+	return n.Kind() != datamodel.Kind_Null
+}
+
+func isNumber(n datamodel.Node) bool {
+	return n.Kind() == datamodel.Kind_Int || n.Kind() == datamodel.Kind_Float
+}
+
+func toFloat(n datamodel.Node) float64 {
+	if n.Kind() == datamodel.Kind_Int {
+		i, _ := n.AsInt()
+		return float64(i)
+	}
+	f, _ := n.AsFloat()
+	return f
+}
+
+// kindName is what the "type" function returns: the data model kind, in lower case.
+// (Unlike jq's, these tell ints from floats, and bytes and links from everything else.)
+func kindName(k datamodel.Kind) string {
+	return strings.ToLower(k.String())
+}
+
+// describe says what a value is, for error messages: its kind, and for scalars, its value.
+func describe(n datamodel.Node) string {
+	switch n.Kind() {
+	case datamodel.Kind_Map, datamodel.Kind_List, datamodel.Kind_Bytes:
+		return "a " + kindName(n.Kind())
+	case datamodel.Kind_Null:
+		return "null"
+	default:
+		return kindName(n.Kind()) + " " + scalarString(n)
+	}
+}
+
+// scalarString formats a scalar the way it'd be written in a query.
+func scalarString(n datamodel.Node) string {
+	switch n.Kind() {
+	case datamodel.Kind_Null:
+		return "null"
+	case datamodel.Kind_Bool:
+		b, _ := n.AsBool()
+		return strconv.FormatBool(b)
+	case datamodel.Kind_Int:
+		i, _ := n.AsInt()
+		return strconv.FormatInt(i, 10)
+	case datamodel.Kind_Float:
+		f, _ := n.AsFloat()
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	case datamodel.Kind_String:
+		s, _ := n.AsString()
+		return strconv.Quote(s)
+	case datamodel.Kind_Link:
+		lnk, _ := n.AsLink()
+		return lnk.String()
+	default:
+		return kindName(n.Kind())
+	}
+}
+
+// eachListEntry calls fn for each entry in a list.
+// It looks the entries up by index, rather than using a ListIterator, because bindnode doesn't have iterators for the representations of every type.
+func eachListEntry(n datamodel.Node, fn func(int64, datamodel.Node) error) error {
+	for i := int64(0); i < n.Length(); i++ {
+		v, err := n.LookupByIndex(i)
+		if err != nil {
+			return err
+		}
+		if err := fn(i, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newList(entries []datamodel.Node) (datamodel.Node, error) {
+	nb := basicnode.Prototype.List.NewBuilder()
+	la, err := nb.BeginList(int64(len(entries)))
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range entries {
+		if err := la.AssembleValue().AssignNode(v); err != nil {
+			return nil, err
+		}
+	}
+	if err := la.Finish(); err != nil {
+		return nil, err
+	}
+	return nb.Build(), nil
+}
+
+func newMap(keys []string, values []datamodel.Node) (datamodel.Node, error) {
+	nb := basicnode.Prototype.Map.NewBuilder()
+	ma, err := nb.BeginMap(int64(len(keys)))
+	if err != nil {
+		return nil, err
+	}
+	for i, k := range keys {
+		// A key that's given twice keeps the last value, as in jq.
+		if i < len(keys)-1 && indexOf(keys[i+1:], k) >= 0 {
+			continue
+		}
+		if err := ma.AssembleKey().AssignString(k); err != nil {
+			return nil, err
+		}
+		if err := ma.AssembleValue().AssignNode(values[i]); err != nil {
+			return nil, err
+		}
+	}
+	if err := ma.Finish(); err != nil {
+		return nil, err
+	}
+	return nb.Build(), nil
+}
+
+func indexOf(strs []string, s string) int {
+	for i, x := range strs {
+		if x == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,482 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+// tokenKind says what sort of thing a token is.
+type tokenKind int
+
+const (
+	tokEOF    tokenKind = iota
+	tokField            // ".name" (the text is the name)
+	tokDot              // "."
+	tokDotDot           // ".."
+	tokIdent            // a bare word, like "select" or "and"
+	tokString           // a quoted string (the text is the string, unescaped)
+	tokNumber           // a number (the text is as written)
+	tokPunct            // anything else: "|", ",", "(", "==", and so on
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// lex splits a query into tokens.
+func lex(src string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '.' && i+1 < len(src) && src[i+1] == '.':
+			toks = append(toks, token{tokDotDot, "..", i})
+			i += 2
+		case c == '.' && i+1 < len(src) && isIdentStart(src[i+1]):
+			j := i + 1
+			for j < len(src) && isIdentChar(src[j]) {
+				j++
+			}
+			toks = append(toks, token{tokField, src[i+1 : j], i})
+			i = j
+		case c == '.':
+			toks = append(toks, token{tokDot, ".", i})
+			i++
+		case isIdentStart(c):
+			j := i
+			for j < len(src) && isIdentChar(src[j]) {
+				j++
+			}
+			toks = append(toks, token{tokIdent, src[i:j], i})
+			i = j
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.' || src[j] == 'e' || src[j] == 'E' ||
+				(src[j] == '-' || src[j] == '+') && (src[j-1] == 'e' || src[j-1] == 'E')) {
+				j++
+			}
+			toks = append(toks, token{tokNumber, src[i:j], i})
+			i = j
+		case c == '"':
+			j := i + 1
+			for j < len(src) && src[j] != '"' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, ipldtoolerr.Newf(ErrCode_QueryInvalid, "at offset %d: string is never closed", i)
+			}
+			var s string
+			if err := json.Unmarshal([]byte(src[i:j+1]), &s); err != nil {
+				return nil, ipldtoolerr.Newf(ErrCode_QueryInvalid, "at offset %d: invalid string: %s", i, err)
+			}
+			toks = append(toks, token{tokString, s, i})
+			i = j + 1
+		default:
+			n := 1
+			if i+1 < len(src) {
+				switch src[i : i+2] {
+				case "==", "!=", "<=", ">=":
+					n = 2
+				}
+			}
+			if !strings.ContainsRune("|,()[]{}:;?<>+-*/%=!", rune(c)) || src[i:i+n] == "=" || src[i:i+n] == "!" {
+				return nil, ipldtoolerr.Newf(ErrCode_QueryInvalid, "at offset %d: unexpected character %q", i, src[i:i+n])
+			}
+			toks = append(toks, token{tokPunct, src[i : i+n], i})
+			i += n
+		}
+	}
+	return append(toks, token{tokEOF, "", len(src)}), nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c < 0x80 && unicode.IsLetter(rune(c))
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9'
+}
+
+// parser turns tokens into an expression tree, by recursive descent.
+// Each method parses one level of precedence, from the loosest ("|") to the tightest (postfix indexing).
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it's the given punctuation or keyword.
+func (p *parser) accept(text string) bool {
+	if t := p.peek(); (t.kind == tokPunct || t.kind == tokIdent) && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return p.errorf("expected %q", text)
+	}
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	t := p.peek()
+	found := strconv.Quote(t.text)
+	if t.kind == tokEOF {
+		found = "the end of the query"
+	}
+	return ipldtoolerr.Newf(ErrCode_QueryInvalid, "at offset %d: %s, but found %s", t.pos, fmt.Sprintf(format, args...), found)
+}
+
+func (p *parser) parsePipe() (expr, error) {
+	left, err := p.parseComma()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("|") {
+		right, err := p.parseComma()
+		if err != nil {
+			return nil, err
+		}
+		left = pipeExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseComma() (expr, error) {
+	left, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(",") {
+		right, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		left = commaExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{"or", left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseCompare()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and") {
+		right, err := p.parseCompare()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{"and", left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseCompare() (expr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.accept(op) {
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			return binaryExpr{op, left, right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAdditive() (expr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek().text
+		if !(op == "+" || op == "-") || !p.accept(op) {
+			return left, nil
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op, left, right}
+	}
+}
+
+func (p *parser) parseMultiplicative() (expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek().text
+		if !(op == "*" || op == "/" || op == "%") || !p.accept(op) {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op, left, right}
+	}
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	if p.accept("-") {
+		e, err := p.parsePostfix()
+		if err != nil {
+			return nil, err
+		}
+		return binaryExpr{"-", literalExpr{basicnode.NewInt(0)}, e}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (expr, error) {
+	e, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch t := p.peek(); {
+		case t.kind == tokField:
+			p.next()
+			e = indexExpr{e, literalExpr{basicnode.NewString(t.text)}}
+		case t.kind == tokDot && p.toks[p.pos+1].kind == tokString:
+			p.next()
+			e = indexExpr{e, literalExpr{basicnode.NewString(p.next().text)}}
+		case t.kind == tokDot && p.toks[p.pos+1].text == "[":
+			p.next() // The dot is optional before a bracket, as in jq.
+		case t.kind == tokPunct && t.text == "[":
+			if e, err = p.parseBracket(e); err != nil {
+				return nil, err
+			}
+		case t.kind == tokPunct && t.text == "?":
+			p.next()
+			e = tryExpr{e}
+		default:
+			return e, nil
+		}
+	}
+}
+
+// parseBracket parses what's in brackets after an expression: "[]", "[index]", or "[from:to]".
+func (p *parser) parseBracket(target expr) (expr, error) {
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+	if p.accept("]") {
+		return iterateExpr{target}, nil
+	}
+	var from, to expr
+	var err error
+	if p.peek().text != ":" {
+		if from, err = p.parsePipe(); err != nil {
+			return nil, err
+		}
+		if p.accept("]") {
+			return indexExpr{target, from}, nil
+		}
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	if p.peek().text != "]" {
+		if to, err = p.parsePipe(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect("]"); err != nil {
+		return nil, err
+	}
+	return sliceExpr{target, from, to}, nil
+}
+
+func (p *parser) parsePrimary() (expr, error) {
+	switch t := p.peek(); t.kind {
+	case tokDot:
+		p.next()
+		if p.peek().kind == tokString {
+			return indexExpr{identityExpr{}, literalExpr{basicnode.NewString(p.next().text)}}, nil
+		}
+		return identityExpr{}, nil
+	case tokField:
+		p.next()
+		return indexExpr{identityExpr{}, literalExpr{basicnode.NewString(t.text)}}, nil
+	case tokDotDot:
+		p.next()
+		return recurseExpr{}, nil
+	case tokString:
+		p.next()
+		return literalExpr{basicnode.NewString(t.text)}, nil
+	case tokNumber:
+		p.next()
+		if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return literalExpr{basicnode.NewInt(i)}, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, ipldtoolerr.Newf(ErrCode_QueryInvalid, "at offset %d: invalid number %q", t.pos, t.text)
+		}
+		return literalExpr{basicnode.NewFloat(f)}, nil
+	case tokIdent:
+		return p.parseCall()
+	case tokPunct:
+		switch t.text {
+		case "(":
+			p.next()
+			e, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			return e, p.expect(")")
+		case "[":
+			p.next()
+			if p.accept("]") {
+				return arrayExpr{nil}, nil
+			}
+			e, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			return arrayExpr{e}, p.expect("]")
+		case "{":
+			return p.parseObject()
+		}
+	}
+	return nil, p.errorf("expected an expression")
+}
+
+// parseCall parses the keywords that are values ("true", "false", and "null"), and function calls.
+func (p *parser) parseCall() (expr, error) {
+	t := p.next()
+	switch t.text {
+	case "true":
+		return literalExpr{basicnode.NewBool(true)}, nil
+	case "false":
+		return literalExpr{basicnode.NewBool(false)}, nil
+	case "null":
+		return literalExpr{datamodel.Null}, nil
+	}
+	fn, exists := builtins[t.text]
+	if !exists {
+		return nil, ipldtoolerr.Newf(ErrCode_QueryInvalid, "at offset %d: there's no function named %q", t.pos, t.text)
+	}
+	var args []expr
+	if p.accept("(") {
+		for {
+			arg, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if !p.accept(";") {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	if len(args) != fn.arity {
+		return nil, ipldtoolerr.Newf(ErrCode_QueryInvalid, "at offset %d: function %q takes %d arguments, not %d", t.pos, t.text, fn.arity, len(args))
+	}
+	return callExpr{t.text, fn, args}, nil
+}
+
+// parseObject parses an object construction, like `{name: .n, size}`.
+func (p *parser) parseObject() (expr, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var entries []objectEntry
+	for !p.accept("}") {
+		if len(entries) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		var key expr
+		var name string
+		switch t := p.peek(); {
+		case t.kind == tokIdent || t.kind == tokString:
+			p.next()
+			name = t.text
+			key = literalExpr{basicnode.NewString(name)}
+		case t.kind == tokPunct && t.text == "(":
+			p.next()
+			var err error
+			if key, err = p.parsePipe(); err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, p.errorf("expected a key")
+		}
+		if !p.accept(":") {
+			if name == "" {
+				return nil, p.errorf("expected %q", ":")
+			}
+			// The shorthand `{name}` means `{name: .name}`.
+			entries = append(entries, objectEntry{key, indexExpr{identityExpr{}, key}})
+			continue
+		}
+		// Values are parsed at the level below ",", so that the comma can separate entries.
+		value, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, objectEntry{key, value})
+	}
+	return objectExpr{entries}, nil
+}
@@ -0,0 +1,61 @@
+// Package query implements a small jq-like language for picking out and reshaping parts of IPLD data.
+//
+// The syntax is a subset of jq's:
+//
+//   - "." is the input; ".name" or `."name"` looks up a map key; ".[0]" looks up a list index (negative indexes count from the end);
+//     ".[]" produces every value in a map or list; ".[1:3]" slices a list, string, or bytes; and ".." produces the input and everything inside it.
+//   - "a | b" runs b on each result of a; "a, b" produces the results of a, then the results of b.
+//   - Literals: numbers, "strings", true, false, and null; "[...]" collects results into a list; "{key: ..., other}" builds a map.
+//   - Operators: "==", "!=", "<", "<=", ">", ">=", "and", "or", "+", "-", "*", "/", and "%".
+//   - A "?" after an expression drops any error it has (and any results after it).
+//   - Functions: select(f), map(f), has(key), startswith(s), endswith(s), not, empty, length, keys, type, tostring, and load.
+//
+// Unlike jq, which only knows about JSON, this works on the IPLD data model:
+// bytes and links stay bytes and links, rather than being turned into strings or maps,
+// "type" gives the data model kind ("int", "float", "bytes", "link", and so on),
+// and looking something up in a link (or iterating over it, or using "keys" or "has" on it) loads the block that the link points to,
+// so a query can go across blocks.  "load" loads a link on its own.
+package query
+
+import (
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+)
+
+// Query is a parsed query, ready to run.
+type Query struct {
+	root expr
+}
+
+// Parse parses a query.
+//
+// Errors:
+//
+//   - ipldtool-query-invalid -- if the query isn't valid syntax, or uses a function that doesn't exist.
+func Parse(src string) (*Query, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	root, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, p.errorf("expected the end of the query")
+	}
+	return &Query{root}, nil
+}
+
+// Run runs the query on a node, calling emit with each result, as soon as it's found.
+// If emit returns an error, the query stops, and Run returns that error.
+// Links are loaded with the LinkSystem, when the query goes through them; it can be nil, in which case, trying to load a link is an error.
+//
+// Errors:
+//
+//   - ipldtool-query-failed -- if the query does something that doesn't work on the data, like indexing a string.
+//   - ipldtool-error-load-failed -- if a link can't be loaded.
+func (q *Query) Run(n datamodel.Node, lsys *linking.LinkSystem, emit func(datamodel.Node) error) error {
+	return q.root.eval(&evaluator{lsys}, n, emit)
+}
@@ -0,0 +1,38 @@
+package app
+
+import (
+	"github.com/ipld/go-ipld-prime/linking"
+
+	"github.com/ipld/go-ipldtool/app/shared"
+)
+
+// The functions in this file are the hooks for building an extended version of the tool.
+// A custom `main` package can call any of them before calling Main,
+// and the registered features will then be available to every command.
+//
+// For example:
+//
+//	func main() {
+//		app.RegisterCodec(shared.CodecInfo{Name: "my-codec", Code: 0x300001, Encoder: mycodec.Encode, Decoder: mycodec.Decode})
+//		code, _ := app.Main(os.Args, os.Stdin, os.Stdout, os.Stderr)
+//		os.Exit(code)
+//	}
+//
+// None of these are safe to call concurrently with Main.
+
+// RegisterCodec makes a codec available by name in any "codec:" argument,
+// and to LinkSystems (so it's used when loading data by CID, too).
+func RegisterCodec(info shared.CodecInfo) {
+	shared.RegisterCodec(info)
+}
+
+// RegisterADL makes an ADL available by name (e.g. for the read command's "--ADL" flag).
+// The reifier should return any node it doesn't apply to unchanged, because it's also applied to every block loaded while pathing.
+func RegisterADL(name string, reifier linking.NodeReifier) {
+	shared.RegisterADL(name, reifier)
+}
+
+// RegisterStorageEngine makes a storage engine available by name.
+func RegisterStorageEngine(name string, opener shared.StorageOpener) {
+	shared.RegisterStorageEngine(name, opener)
+}
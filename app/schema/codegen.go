@@ -0,0 +1,183 @@
+package schema
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ipld/go-ipld-prime/schema"
+	gengo "github.com/ipld/go-ipld-prime/schema/gen/go"
+
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+// Generators lists the names of the code generators that Generate supports.
+var Generators = []string{"go-gengo", "go-bindnode", "typescript", "rust-serde"}
+
+// GeneratorConfig holds the options for Generate.
+type GeneratorConfig struct {
+	// Generator says what kind of code to generate: one of the names in Generators.
+	Generator string
+
+	// PackageName is the name of the package the code is generated for, for the Go generators.
+	PackageName string
+
+	// SchemaFileName and SchemaSource are the name and contents of the schema document,
+	// for generators that put a copy of it next to the code they generate (only go-bindnode does, so far).
+	SchemaFileName string
+	SchemaSource   []byte
+
+	// GoBindnode holds the options that only the go-bindnode generator uses.
+	GoBindnode GoBindnodeConfig
+}
+
+// Generate produces code for working with the types in the TypeSystem, returning the contents of each file, by filename.
+// Nothing is written anywhere; that's up to the caller.
+//
+// The files produced depend on the generator:
+//
+//   - go-gengo -- "ipldsch_minima.go", "ipldsch_satisfaction.go", and "ipldsch_types.go", made by go-ipld-prime's gengo package.
+//   - go-bindnode -- "types.go", "schema.go", and a copy of the schema document (see generateGoBindnode).
+//   - typescript -- "types.ts" (see writeTypeScript).
+//   - rust-serde -- "types.rs" (see writeRustSerde).
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- if the generator isn't known, or its options aren't usable.
+//   - schema-codegen-unsupported -- if the schema uses something the generator can't handle.
+func Generate(ts *schema.TypeSystem, cfg GeneratorConfig) (map[string][]byte, error) {
+	switch cfg.Generator {
+	case "go-gengo":
+		return generateGoGengo(ts, cfg.PackageName)
+	case "go-bindnode":
+		return generateGoBindnode(ts, cfg)
+	case "typescript":
+		var buf bytes.Buffer
+		if err := writeTypeScript(&buf, ts); err != nil {
+			return nil, err
+		}
+		return map[string][]byte{"types.ts": buf.Bytes()}, nil
+	case "rust-serde":
+		var buf bytes.Buffer
+		if err := writeRustSerde(&buf, ts); err != nil {
+			return nil, err
+		}
+		return map[string][]byte{"types.rs": buf.Bytes()}, nil
+	default:
+		return nil, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "generator not recognized: %q is not one of %s", cfg.Generator, strings.Join(Generators, ", "))
+	}
+}
+
+// generateGoGengo runs go-ipld-prime's gengo generator.
+// It can only write into a directory, so it's given a temporary one, and the files are read back from there.
+// (That also means that it can't see any types already declared elsewhere in the package, so it'll generate all of them.)
+func generateGoGengo(ts *schema.TypeSystem, pkgName string) (_ map[string][]byte, err error) {
+	dir, err := os.MkdirTemp("", "ipld-codegen-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	defer func() {
+		if r := recover(); r != nil {
+			err = ipldtoolerr.Newf(ErrCode_CodegenUnsupported, "go-gengo generator failed: %v", r)
+		}
+	}()
+	gengo.Generate(dir, pkgName, *ts, &gengo.AdjunctCfg{})
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{}
+	for _, entry := range entries {
+		if files[entry.Name()], err = os.ReadFile(filepath.Join(dir, entry.Name())); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// codeBuf accumulates generated code, a line at a time.
+type codeBuf struct {
+	bytes.Buffer
+}
+
+func (b *codeBuf) line(format string, args ...interface{}) {
+	fmt.Fprintf(b, format, args...)
+	b.WriteByte('\n')
+}
+
+// sortedFilenames returns the names of generated files, sorted.
+func sortedFilenames(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeGeneratedFiles writes generated files into the output dir, making it if necessary.
+func writeGeneratedFiles(outputDir string, files map[string][]byte) error {
+	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+		return err
+	}
+	for _, name := range sortedFilenames(files) {
+		if err := os.WriteFile(filepath.Join(outputDir, name), files[name], 0666); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeGeneratedTar writes generated files as a tar archive, in order of their names.
+// The entries have no timestamps or owners, so the same files always make the same archive.
+func writeGeneratedTar(w io.Writer, files map[string][]byte) error {
+	tw := tar.NewWriter(w)
+	for _, name := range sortedFilenames(files) {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), Typeflag: tar.TypeReg, Format: tar.FormatPAX}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// checkGeneratedFiles checks that the output dir already contains exactly the generated files.
+// Other files in the dir are ignored.
+// If w isn't nil, a unified diff from each existing file to what it should be is written to it.
+//
+// Errors:
+//
+//   - schema-codegen-stale -- if any of the files are missing or different.
+func checkGeneratedFiles(w io.Writer, outputDir string, files map[string][]byte) error {
+	var stale []string
+	for _, name := range sortedFilenames(files) {
+		existing, err := os.ReadFile(filepath.Join(outputDir, name))
+		if err == nil && bytes.Equal(existing, files[name]) {
+			continue
+		}
+		stale = append(stale, name)
+		if w != nil {
+			oldName := filepath.Join(outputDir, name)
+			if err != nil {
+				oldName = "/dev/null"
+			}
+			if _, err := io.WriteString(w, unifiedDiff(oldName, filepath.Join(outputDir, name), existing, files[name])); err != nil {
+				return err
+			}
+		}
+	}
+	if len(stale) > 0 {
+		return ipldtoolerr.Newf(ErrCode_CodegenStale, "generated files in %s are out of date: %s", outputDir, strings.Join(stale, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,421 @@
+package schema
+
+import (
+	"fmt"
+	"go/format"
+	"go/token"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/ipld/go-ipld-prime/schema"
+
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+// GoBindnodeConfig holds the options that only the go-bindnode generator uses.
+type GoBindnodeConfig struct {
+	// TypeNames maps schema type names to the Go types they should become.
+	// A plain name (like "Person") renames the Go type that's declared for the schema type.
+	// A qualified name (like "cid.Cid") means an existing type from another package is used instead, and nothing is declared;
+	// the package must be one of Imports.
+	// Types that aren't in the map are declared with the same name as in the schema, unless they're scalars or links,
+	// which are just written as the Go type bindnode uses for them (like "string" or "datamodel.Link") by default.
+	TypeNames map[string]string
+
+	// OptionalFields says how optional struct fields are written: "pointer" (the default), or "value".
+	// bindnode (as of v0.14.4) can only tell an absent field from a zero value by a nil pointer,
+	// so with "value", any struct that's declared and has an optional field is refused.
+	OptionalFields string
+
+	// Imports are extra Go packages which the generated code may refer to, each as an import path, or "name:path".
+	// Anything named by a qualified name in TypeNames must be imported here.
+	// Imports which nothing generated refers to are kept anyway (as blank imports in types.go), for their side effects.
+	Imports []string
+}
+
+// goImport is an import in generated Go code.
+type goImport struct {
+	Name  string // The name the package is referred to by.
+	Path  string
+	Used  bool // Whether any generated code refers to it.
+	Extra bool // Whether it's one of the extra imports from the config (rather than one the generator always knows about).
+}
+
+// generateGoBindnode produces Go code for working with the types in the TypeSystem using bindnode,
+// returning the contents of each file to write, by filename.
+//
+// Two files are produced: "types.go", with a Go type declaration for each type declared in the schema,
+// and "schema.go", which embeds the schema document (which is the third file) and has a bindnode prototype for each of those types.
+// Prelude types (like "String") don't get declarations; they're written out as the Go types bindnode uses for them.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- if a Go type name or import in the config isn't usable.
+//   - schema-codegen-unsupported -- if the config asks for something bindnode can't handle.
+func generateGoBindnode(ts *schema.TypeSystem, genCfg GeneratorConfig) (map[string][]byte, error) {
+	if genCfg.SchemaSource == nil || genCfg.SchemaFileName == "" {
+		return nil, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "the go-bindnode generator needs the schema document, and a name for it")
+	}
+	cfg := genCfg.GoBindnode
+	g := &goBindnodeGen{cfg: cfg, ts: ts, imports: map[string]*goImport{}}
+	if err := g.init(); err != nil {
+		return nil, err
+	}
+
+	// Declare the types.
+	var decls codeBuf
+	var names []string
+	for _, name := range ts.Names() {
+		t := ts.TypeByName(name)
+		if IsPreludeType(t) {
+			continue
+		}
+		names = append(names, name)
+		if g.isDeclared(t) {
+			src, err := g.declaration(t)
+			if err != nil {
+				return nil, err
+			}
+			decls.line("type %s %s", g.goName(t), src)
+			decls.line("")
+		}
+	}
+	typesUsed := g.takeUsedImports()
+
+	// Make a prototype for each of them.
+	var prototypes []goBindnodePrototype
+	for _, name := range names {
+		t := ts.TypeByName(name)
+		prototypes = append(prototypes, goBindnodePrototype{Field: g.fieldName(t), GoType: g.goType(t), TypeName: name})
+	}
+	schemaUsed := g.takeUsedImports()
+
+	// Imports that haven't been used by anything still go in types.go.
+	for _, imp := range g.importList() {
+		if imp.Extra && !imp.Used {
+			typesUsed = append(typesUsed, goImport{Name: "_", Path: imp.Path})
+		}
+	}
+	sort.Slice(typesUsed, func(i, j int) bool { return typesUsed[i].Path < typesUsed[j].Path })
+
+	var types codeBuf
+	types.line(`// Code generated by "ipld schema codegen --generator=go-bindnode". DO NOT EDIT.`)
+	types.line("")
+	types.line("package %s", genCfg.PackageName)
+	types.line("")
+	if len(typesUsed) > 0 {
+		types.line("import (")
+		for _, imp := range typesUsed {
+			types.line("\t%s", imp.Spec())
+		}
+		types.line(")")
+		types.line("")
+	}
+	types.Write(decls.Bytes())
+	typesSrc, err := format.Source(types.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated code for types.go is invalid: %w", err)
+	}
+
+	var schemaBuf codeBuf
+	if err := goBindnodeSchemaTemplate.Execute(&schemaBuf, map[string]interface{}{
+		"PkgName":         genCfg.PackageName,
+		"SchemaEmbedPath": genCfg.SchemaFileName,
+		"Imports":         schemaUsed,
+		"Prototypes":      prototypes,
+	}); err != nil {
+		return nil, err
+	}
+	schemaSrc, err := format.Source(schemaBuf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated code for schema.go is invalid: %w", err)
+	}
+
+	return map[string][]byte{
+		"types.go":            typesSrc,
+		"schema.go":           schemaSrc,
+		genCfg.SchemaFileName: genCfg.SchemaSource,
+	}, nil
+}
+
+type goBindnodePrototype struct {
+	Field    string // The name of the field in the Prototypes struct.
+	GoType   string
+	TypeName string // The name of the type in the schema.
+}
+
+var goBindnodeSchemaTemplate = template.Must(template.New("schema.go").Parse(`// Code generated by "ipld schema codegen --generator=go-bindnode". DO NOT EDIT.
+
+package {{.PkgName}}
+
+import (
+	_ "embed"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/node/bindnode"
+	"github.com/ipld/go-ipld-prime/schema"
+{{- range .Imports}}
+	{{.Spec}}
+{{- end}}
+)
+
+//go:embed {{.SchemaEmbedPath}}
+var embeddedSchema []byte
+
+// Prototypes has a bindnode prototype for each type in the schema, which can be used to build or decode data of that type.
+var Prototypes schemaSlab
+
+type schemaSlab struct {
+{{- range .Prototypes}}
+	{{.Field}} schema.TypedPrototype
+{{- end}}
+}
+
+func init() {
+	ts, err := ipld.LoadSchemaBytes(embeddedSchema)
+	if err != nil {
+		panic(err)
+	}
+{{range .Prototypes}}
+	Prototypes.{{.Field}} = bindnode.Prototype(
+		(*{{.GoType}})(nil),
+		ts.TypeByName("{{.TypeName}}"),
+	)
+{{- end}}
+}
+`))
+
+type goBindnodeGen struct {
+	cfg     GoBindnodeConfig
+	ts      *schema.TypeSystem
+	imports map[string]*goImport // By name.
+	used    map[string]bool      // Names of imports used since the last takeUsedImports.
+}
+
+// Spec returns the import as it's written in an import declaration.
+func (imp goImport) Spec() string {
+	if imp.Name == path.Base(imp.Path) {
+		return fmt.Sprintf("%q", imp.Path)
+	}
+	return fmt.Sprintf("%s %q", imp.Name, imp.Path)
+}
+
+// init checks the config, and sets up the imports.
+func (g *goBindnodeGen) init() error {
+	switch g.cfg.OptionalFields {
+	case "", "pointer":
+	case "value":
+		// Checked for each struct, as it's declared.
+	default:
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "optional fields setting not recognized: %q is not one of pointer or value", g.cfg.OptionalFields)
+	}
+
+	g.imports["datamodel"] = &goImport{Name: "datamodel", Path: "github.com/ipld/go-ipld-prime/datamodel"}
+	for _, spec := range g.cfg.Imports {
+		name, importPath, ok := strings.Cut(spec, ":")
+		if !ok {
+			name, importPath = path.Base(spec), spec
+		}
+		if !token.IsIdentifier(name) || importPath == "" {
+			return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "import not recognized: %q should be an import path, or of the form \"name:path\"", spec)
+		}
+		g.imports[name] = &goImport{Name: name, Path: importPath, Extra: true}
+	}
+
+	for schemaName, goName := range g.cfg.TypeNames {
+		t := g.ts.TypeByName(schemaName)
+		if t == nil {
+			return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "cannot name Go type for %s: there's no type by that name in the schema", schemaName)
+		}
+		qualifier, ident, qualified := strings.Cut(goName, ".")
+		if !qualified {
+			ident = goName
+		}
+		if !token.IsIdentifier(ident) || (qualified && !token.IsIdentifier(qualifier)) {
+			return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "cannot name Go type for %s: %q isn't a Go type name", schemaName, goName)
+		}
+		if qualified {
+			if _, ok := g.imports[qualifier]; !ok {
+				return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "cannot use Go type %s for %s: there's no import for package %q", goName, schemaName, qualifier)
+			}
+		}
+		switch t.(type) {
+		case *schema.TypeLink, *schema.TypeAny:
+			if !qualified {
+				return ipldtoolerr.Newf(ErrCode_CodegenUnsupported, "cannot declare Go type %s for %s: bindnode needs links to be datamodel.Link, cidlink.Link, or cid.Cid, and Any to be datamodel.Node", goName, schemaName)
+			}
+		}
+	}
+	g.used = map[string]bool{}
+	return nil
+}
+
+// isDeclared returns true if the type gets a declaration of its own in the generated code.
+func (g *goBindnodeGen) isDeclared(t schema.Type) bool {
+	if IsPreludeType(t) {
+		return false
+	}
+	if goName, ok := g.cfg.TypeNames[t.Name()]; ok {
+		return !strings.Contains(goName, ".")
+	}
+	switch t.(type) {
+	case *schema.TypeStruct, *schema.TypeUnion, *schema.TypeMap, *schema.TypeList, *schema.TypeEnum:
+		return true
+	default:
+		return false
+	}
+}
+
+// goName returns the name of the Go type that's declared for a schema type.
+func (g *goBindnodeGen) goName(t schema.Type) string {
+	if goName, ok := g.cfg.TypeNames[t.Name()]; ok {
+		return goName
+	}
+	return t.Name()
+}
+
+// fieldName returns the name of a Go struct field that holds a type (like a union member, or a prototype):
+// the name of its Go type, if it's declared here, or else the name of the schema type.
+func (g *goBindnodeGen) fieldName(t schema.Type) string {
+	if g.isDeclared(t) {
+		return g.goName(t)
+	}
+	return goExported(t.Name())
+}
+
+// goType returns how to refer to the Go type for a schema type: its name, if it has one, or else its structure.
+func (g *goBindnodeGen) goType(t schema.Type) string {
+	if goName, ok := g.cfg.TypeNames[t.Name()]; ok {
+		g.noteQualifier(goName)
+		return goName
+	}
+	if g.isDeclared(t) {
+		return g.goName(t)
+	}
+	if scalar, ok := g.goScalarType(t); ok {
+		return scalar
+	}
+	switch t.(type) {
+	default: // Maps and lists from the prelude.
+		src, _ := g.declaration(t)
+		return src
+	}
+}
+
+// declaration returns the Go type that a declared type is defined as.
+func (g *goBindnodeGen) declaration(t schema.Type) (string, error) {
+	switch t := t.(type) {
+	case *schema.TypeStruct:
+		var b strings.Builder
+		b.WriteString("struct {\n")
+		for _, f := range t.Fields() {
+			ptr := ""
+			if f.IsNullable() {
+				ptr += "*"
+			}
+			if f.IsOptional() {
+				// bindnode needs a pointer for each optional field, so that absence can be told apart from a zero value.
+				if g.cfg.OptionalFields == "value" {
+					return "", ipldtoolerr.Newf(ErrCode_CodegenUnsupported, "optional field %s in type %s can't be a value: bindnode requires optional fields to be pointers", f.Name(), t.Name())
+				}
+				ptr += "*"
+			}
+			fmt.Fprintf(&b, "%s %s%s\n", goExported(f.Name()), ptr, g.goType(f.Type()))
+		}
+		b.WriteString("}")
+		return b.String(), nil
+	case *schema.TypeUnion:
+		var b strings.Builder
+		b.WriteString("struct {\n")
+		for _, m := range t.Members() {
+			fmt.Fprintf(&b, "%s *%s\n", g.fieldName(m), g.goType(m))
+		}
+		b.WriteString("}")
+		return b.String(), nil
+	case *schema.TypeMap:
+		// bindnode panics on maps with pointer values, so there's no way to write a map with nullable values that it can use.
+		if t.ValueIsNullable() {
+			return "", ipldtoolerr.Newf(ErrCode_CodegenUnsupported, "map type %s can't have nullable values: bindnode doesn't support maps with pointer values", t.Name())
+		}
+		k, v := g.goType(t.KeyType()), g.goType(t.ValueType())
+		return fmt.Sprintf("struct {\nKeys []%s\nValues map[%s]%s\n}", k, k, v), nil
+	case *schema.TypeList:
+		v := g.goType(t.ValueType())
+		if t.ValueIsNullable() {
+			v = "*" + v
+		}
+		return "[]" + v, nil
+	default:
+		// Enums and scalars are only declared if a name was asked for; bindnode's fine with a named type, as long as it's the right kind.
+		if scalar, ok := g.goScalarType(t); ok {
+			return scalar, nil
+		}
+		return "", ipldtoolerr.Newf(ErrCode_CodegenUnsupported, "type %s can't be declared as a Go type", t.Name())
+	}
+}
+
+// goScalarType returns the Go type bindnode uses for scalars (including enums), and false for anything else.
+func (g *goBindnodeGen) goScalarType(t schema.Type) (string, bool) {
+	switch t.(type) {
+	case *schema.TypeBool:
+		return "bool", true
+	case *schema.TypeInt:
+		return "int", true
+	case *schema.TypeFloat:
+		return "float64", true
+	case *schema.TypeString, *schema.TypeEnum:
+		return "string", true
+	case *schema.TypeBytes:
+		return "[]byte", true
+	case *schema.TypeLink:
+		g.noteQualifier("datamodel.Link")
+		return "datamodel.Link", true
+	case *schema.TypeAny:
+		g.noteQualifier("datamodel.Node")
+		return "datamodel.Node", true
+	default:
+		return "", false
+	}
+}
+
+// noteQualifier marks the import a qualified Go type name refers to (if it does) as used.
+func (g *goBindnodeGen) noteQualifier(goType string) {
+	goType = strings.TrimLeft(goType, "*[]")
+	if qualifier, _, ok := strings.Cut(goType, "."); ok {
+		if imp, ok := g.imports[qualifier]; ok {
+			imp.Used = true
+			g.used[qualifier] = true
+		}
+	}
+}
+
+// takeUsedImports returns the imports used since it was last called, sorted by path.
+func (g *goBindnodeGen) takeUsedImports() []goImport {
+	var result []goImport
+	for name := range g.used {
+		result = append(result, *g.imports[name])
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	g.used = map[string]bool{}
+	return result
+}
+
+// importList returns all the imports, sorted by path.
+func (g *goBindnodeGen) importList() []*goImport {
+	var result []*goImport
+	for _, imp := range g.imports {
+		result = append(result, imp)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result
+}
+
+// goExported makes a name from a schema into an exported Go identifier, the same way bindnode does for struct fields.
+func goExported(name string) string {
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
@@ -0,0 +1,392 @@
+package schema
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/ipld/go-ipld-prime/schema"
+
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+// writeRustSerde produces Rust code for the types in the TypeSystem,
+// with serde attributes that make their serialized form match their IPLD representation.
+//
+// Structs become Rust structs, with their fields in snake_case (and renamed to their representation keys as needed).
+// Optional fields are Options which are skipped when serializing if they're None;
+// nullable fields are Options too (and fields which are both are an Option of an Option).
+// Structs with tuple representations use the serde_tuple crate.
+// Enums become Rust enums, using the serde_repr crate if they're represented as ints.
+// Unions become Rust enums with a variant for each member:
+// keyed unions use serde's default (externally tagged) enum representation, and kinded unions are untagged.
+// Prelude types (like "String") are written out as the matching Rust types wherever they're used:
+// Links are cid::Cid, Bytes are serde_bytes::ByteBuf, and Any is ipld_core::ipld::Ipld.
+//
+// Errors:
+//
+//   - schema-codegen-unsupported -- if a type uses a representation strategy that the generator can't handle.
+func writeRustSerde(w io.Writer, ts *schema.TypeSystem) error {
+	g := &rsGen{}
+	// Work out what we'll need before writing anything, so the imports can be right.
+	for _, name := range ts.Names() {
+		if err := g.check(ts.TypeByName(name)); err != nil {
+			return err
+		}
+	}
+	g.line(`// Code generated by "ipld schema codegen --generator=rust-serde". DO NOT EDIT.`)
+	g.line(``)
+	g.line(`#![allow(dead_code, non_camel_case_types)]`)
+	g.line(``)
+	g.line(`use serde::{Deserialize, Serialize};`)
+	if g.needTuple {
+		g.line(`use serde_tuple::{Deserialize_tuple, Serialize_tuple};`)
+	}
+	if g.needRepr {
+		g.line(`use serde_repr::{Deserialize_repr, Serialize_repr};`)
+	}
+	if g.needSome {
+		g.line(``)
+		g.line(`// Distinguishes a field being present and null (Some(None)) from being absent (None).`)
+		g.line(`fn deserialize_some<'de, T, D>(d: D) -> Result<Option<T>, D::Error>`)
+		g.line(`where`)
+		g.line(`    T: Deserialize<'de>,`)
+		g.line(`    D: serde::Deserializer<'de>,`)
+		g.line(`{`)
+		g.line(`    T::deserialize(d).map(Some)`)
+		g.line(`}`)
+	}
+	for _, name := range ts.Names() {
+		g.genType(ts.TypeByName(name))
+	}
+	_, err := w.Write(g.Bytes())
+	return err
+}
+
+type rsGen struct {
+	codeBuf
+	needTuple bool // set if any struct has a tuple representation.
+	needRepr  bool // set if any enum has an int representation.
+	needSome  bool // set if any field is both optional and nullable.
+}
+
+// check rejects types we can't generate code for, and notes what support code will be needed for the rest.
+func (g *rsGen) check(t schema.Type) error {
+	switch t := t.(type) {
+	case *schema.TypeStruct:
+		switch stg := t.RepresentationStrategy().(type) {
+		case schema.StructRepresentation_Map:
+			for _, f := range t.Fields() {
+				if f.IsOptional() && f.IsNullable() {
+					g.needSome = true
+				}
+				if implicit := stg.FieldImplicit(f); implicit != nil {
+					switch implicit.(type) {
+					case schema.ImplicitValue_EmptyList, schema.ImplicitValue_EmptyMap:
+					default:
+						if f.IsNullable() {
+							return ipldtoolerr.Newf(ErrCode_CodegenUnsupported, "struct %s has an implicit value for field %q, which is nullable; the rust-serde generator doesn't support that", t.Name(), f.Name())
+						}
+						switch f.Type().TypeKind() {
+						case schema.TypeKind_String, schema.TypeKind_Int, schema.TypeKind_Bool:
+						default:
+							return ipldtoolerr.Newf(ErrCode_CodegenUnsupported, "struct %s has an implicit value for field %q, which is of kind %s; the rust-serde generator only supports implicits for strings, ints, and bools (and empty lists and maps)", t.Name(), f.Name(), f.Type().TypeKind())
+						}
+					}
+				}
+			}
+		case schema.StructRepresentation_Tuple:
+			g.needTuple = true
+			for _, f := range t.Fields() {
+				if f.IsOptional() {
+					return ipldtoolerr.Newf(ErrCode_CodegenUnsupported, "struct %s has a tuple representation and an optional field %q, which the rust-serde generator doesn't support", t.Name(), f.Name())
+				}
+			}
+		default:
+			return ipldtoolerr.Newf(ErrCode_CodegenUnsupported, "struct %s has a %s representation, which the rust-serde generator doesn't support", t.Name(), reprStrategyName(stg))
+		}
+	case *schema.TypeEnum:
+		if _, ok := t.RepresentationStrategy().(schema.EnumRepresentation_Int); ok {
+			g.needRepr = true
+		}
+	case *schema.TypeUnion:
+		switch stg := t.RepresentationStrategy().(type) {
+		case schema.UnionRepresentation_Keyed, schema.UnionRepresentation_Kinded:
+		default:
+			return ipldtoolerr.Newf(ErrCode_CodegenUnsupported, "union %s has a %s representation, which the rust-serde generator doesn't support", t.Name(), reprStrategyName(stg))
+		}
+	}
+	return nil
+}
+
+// typeExpr returns the Rust type to use when referring to a schema type.
+func (g *rsGen) typeExpr(t schema.Type) string {
+	if !IsPreludeType(t) {
+		return t.Name()
+	}
+	switch t := t.(type) {
+	case *schema.TypeMap:
+		return fmt.Sprintf("std::collections::BTreeMap<%s, %s>", g.typeExpr(t.KeyType()), g.nullableTypeExpr(t.ValueType(), t.ValueIsNullable()))
+	case *schema.TypeList:
+		return fmt.Sprintf("Vec<%s>", g.nullableTypeExpr(t.ValueType(), t.ValueIsNullable()))
+	}
+	return g.scalarTypeExpr(t)
+}
+
+func (g *rsGen) nullableTypeExpr(t schema.Type, nullable bool) string {
+	if nullable {
+		return "Option<" + g.typeExpr(t) + ">"
+	}
+	return g.typeExpr(t)
+}
+
+func (g *rsGen) scalarTypeExpr(t schema.Type) string {
+	switch t.TypeKind() {
+	case schema.TypeKind_Bool:
+		return "bool"
+	case schema.TypeKind_Int:
+		return "i64"
+	case schema.TypeKind_Float:
+		return "f64"
+	case schema.TypeKind_String:
+		return "String"
+	case schema.TypeKind_Bytes:
+		return "serde_bytes::ByteBuf"
+	case schema.TypeKind_Link:
+		return "cid::Cid"
+	default:
+		return "ipld_core::ipld::Ipld"
+	}
+}
+
+func (g *rsGen) genType(t schema.Type) {
+	if IsPreludeType(t) {
+		return
+	}
+	name := t.Name()
+	g.line(``)
+	switch t := t.(type) {
+	case *schema.TypeMap:
+		g.line(`/// %s is a map.`, name)
+		g.line(`pub type %s = std::collections::BTreeMap<%s, %s>;`, name, g.typeExpr(t.KeyType()), g.nullableTypeExpr(t.ValueType(), t.ValueIsNullable()))
+	case *schema.TypeList:
+		g.line(`/// %s is a list.`, name)
+		g.line(`pub type %s = Vec<%s>;`, name, g.nullableTypeExpr(t.ValueType(), t.ValueIsNullable()))
+	case *schema.TypeLink:
+		if t.HasReferencedType() {
+			g.line(`/// %s is a link to %s.`, name, t.ReferencedType().Name())
+		} else {
+			g.line(`/// %s is a link.`, name)
+		}
+		g.line(`pub type %s = cid::Cid;`, name)
+	case *schema.TypeStruct:
+		g.genStruct(t)
+	case *schema.TypeEnum:
+		g.genEnum(t)
+	case *schema.TypeUnion:
+		g.genUnion(t)
+	default:
+		g.line(`/// %s is a %s.`, name, t.TypeKind())
+		g.line(`pub type %s = %s;`, name, g.scalarTypeExpr(t))
+	}
+}
+
+func (g *rsGen) genStruct(t *schema.TypeStruct) {
+	name := t.Name()
+	switch stg := t.RepresentationStrategy().(type) {
+	case schema.StructRepresentation_Map:
+		g.line(`/// %s is a struct, represented as a map.`, name)
+		g.line(`#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]`)
+		g.line(`#[serde(deny_unknown_fields)]`)
+		g.line(`pub struct %s {`, name)
+		var helpers []func()
+		for _, f := range t.Fields() {
+			field := rsIdent(rsSnake(f.Name()))
+			var attrs []string
+			if key := stg.GetFieldKey(f); key != strings.TrimPrefix(field, "r#") {
+				attrs = append(attrs, fmt.Sprintf("rename = %s", rsString(key)))
+			}
+			typ := g.nullableTypeExpr(f.Type(), f.IsNullable())
+			switch implicit := stg.FieldImplicit(f); {
+			case implicit != nil:
+				switch implicit := implicit.(type) {
+				case schema.ImplicitValue_EmptyList:
+					attrs = append(attrs, `default`, `skip_serializing_if = "Vec::is_empty"`)
+				case schema.ImplicitValue_EmptyMap:
+					attrs = append(attrs, `default`, `skip_serializing_if = "std::collections::BTreeMap::is_empty"`)
+				default:
+					fnBase := rsSnake(name) + "_" + strings.TrimPrefix(field, "r#")
+					attrs = append(attrs, fmt.Sprintf(`default = "%s_default"`, fnBase), fmt.Sprintf(`skip_serializing_if = "%s_is_default"`, fnBase))
+					lit, cmp := rsImplicitLiteral(implicit)
+					helpers = append(helpers, func() {
+						g.line(``)
+						g.line(`fn %s_default() -> %s {`, fnBase, typ)
+						g.line(`    %s`, lit)
+						g.line(`}`)
+						g.line(``)
+						g.line(`fn %s_is_default(v: &%s) -> bool {`, fnBase, typ)
+						g.line(`    *v == %s`, cmp)
+						g.line(`}`)
+					})
+				}
+			case f.IsOptional() && f.IsNullable():
+				attrs = append(attrs, `default`, `deserialize_with = "deserialize_some"`, `skip_serializing_if = "Option::is_none"`)
+				typ = "Option<" + typ + ">"
+			case f.IsOptional():
+				attrs = append(attrs, `default`, `skip_serializing_if = "Option::is_none"`)
+				typ = "Option<" + typ + ">"
+			}
+			if len(attrs) > 0 {
+				g.line(`    #[serde(%s)]`, strings.Join(attrs, ", "))
+			}
+			g.line(`    pub %s: %s,`, field, typ)
+		}
+		g.line(`}`)
+		for _, h := range helpers {
+			h()
+		}
+	case schema.StructRepresentation_Tuple:
+		g.line(`/// %s is a struct, represented as a tuple.`, name)
+		g.line(`#[derive(Debug, Clone, PartialEq, Serialize_tuple, Deserialize_tuple)]`)
+		g.line(`pub struct %s {`, name)
+		for _, f := range t.Fields() {
+			g.line(`    pub %s: %s,`, rsIdent(rsSnake(f.Name())), g.nullableTypeExpr(f.Type(), f.IsNullable()))
+		}
+		g.line(`}`)
+	}
+}
+
+func (g *rsGen) genEnum(t *schema.TypeEnum) {
+	name := t.Name()
+	switch stg := t.RepresentationStrategy().(type) {
+	case schema.EnumRepresentation_String:
+		g.line(`/// %s is an enum, represented as strings.`, name)
+		g.line(`#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Hash, Serialize, Deserialize)]`)
+		g.line(`pub enum %s {`, name)
+		for _, m := range t.Members() {
+			if s, ok := stg[m]; ok && s != m {
+				g.line(`    #[serde(rename = %s)]`, rsString(s))
+			}
+			g.line(`    %s,`, rsIdent(m))
+		}
+		g.line(`}`)
+	case schema.EnumRepresentation_Int:
+		g.line(`/// %s is an enum, represented as ints.`, name)
+		g.line(`#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Hash, Serialize_repr, Deserialize_repr)]`)
+		g.line(`#[repr(i64)]`)
+		g.line(`pub enum %s {`, name)
+		for _, m := range t.Members() {
+			g.line(`    %s = %d,`, rsIdent(m), stg[m])
+		}
+		g.line(`}`)
+	}
+}
+
+func (g *rsGen) genUnion(t *schema.TypeUnion) {
+	name := t.Name()
+	switch stg := t.RepresentationStrategy().(type) {
+	case schema.UnionRepresentation_Keyed:
+		g.line(`/// %s is a union, with a keyed representation.`, name)
+		g.line(`#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]`)
+		g.line(`pub enum %s {`, name)
+		for _, m := range t.Members() {
+			if key := stg.GetDiscriminant(m); key != m.Name() {
+				g.line(`    #[serde(rename = %s)]`, rsString(key))
+			}
+			g.line(`    %s(%s),`, rsIdent(m.Name()), g.typeExpr(m))
+		}
+		g.line(`}`)
+	case schema.UnionRepresentation_Kinded:
+		g.line(`/// %s is a union, with a kinded representation.`, name)
+		g.line(`#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]`)
+		g.line(`#[serde(untagged)]`)
+		g.line(`pub enum %s {`, name)
+		for _, m := range t.Members() {
+			g.line(`    %s(%s),`, rsIdent(m.Name()), g.typeExpr(m))
+		}
+		g.line(`}`)
+	}
+}
+
+// rsImplicitLiteral returns a Rust expression for an implicit value, and another one for comparing a value to it.
+// (Only scalars are handled; the others are handled with serde's own defaults.)
+func rsImplicitLiteral(v schema.ImplicitValue) (string, string) {
+	switch v := v.(type) {
+	case schema.ImplicitValue_String:
+		return rsString(string(v)) + ".to_string()", rsString(string(v))
+	case schema.ImplicitValue_Int:
+		return fmt.Sprintf("%d", int(v)), fmt.Sprintf("%d", int(v))
+	case schema.ImplicitValue_Bool:
+		return fmt.Sprintf("%t", bool(v)), fmt.Sprintf("%t", bool(v))
+	default:
+		panic(fmt.Errorf("unreachable: implicit value %T isn't a scalar", v))
+	}
+}
+
+// rsString returns a Rust string literal.
+func rsString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\t':
+			sb.WriteString(`\t`)
+		case r == '\r':
+			sb.WriteString(`\r`)
+		case !unicode.IsPrint(r):
+			fmt.Fprintf(&sb, `\u{%x}`, r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// rsSnake converts a name to snake_case, which is how Rust names struct fields.
+func rsSnake(s string) string {
+	var sb strings.Builder
+	runes := []rune(s)
+	for i, r := range runes {
+		switch {
+		case unicode.IsUpper(r):
+			// Start a new word at a lower-to-upper change, or at the last capital of an acronym ("HTTPServer" -> "http_server").
+			if i > 0 && runes[i-1] != '_' && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				sb.WriteByte('_')
+			}
+			sb.WriteRune(unicode.ToLower(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			sb.WriteRune(r)
+		default:
+			sb.WriteByte('_')
+		}
+	}
+	if len(runes) == 0 || unicode.IsDigit(runes[0]) {
+		return "_" + sb.String()
+	}
+	return sb.String()
+}
+
+var rsKeywords = map[string]bool{
+	"as": true, "async": true, "await": true, "break": true, "const": true, "continue": true, "dyn": true, "else": true,
+	"enum": true, "extern": true, "false": true, "fn": true, "for": true, "if": true, "impl": true, "in": true,
+	"let": true, "loop": true, "match": true, "mod": true, "move": true, "mut": true, "pub": true, "ref": true,
+	"return": true, "static": true, "struct": true, "trait": true, "true": true, "type": true, "unsafe": true,
+	"use": true, "where": true, "while": true, "abstract": true, "become": true, "box": true, "do": true,
+	"final": true, "macro": true, "override": true, "priv": true, "try": true, "typeof": true, "unsized": true,
+	"virtual": true, "yield": true,
+}
+
+// rsIdent makes a name usable as a Rust identifier, by using a raw identifier if it's a keyword.
+func rsIdent(s string) string {
+	if rsKeywords[s] {
+		return "r#" + s
+	}
+	return s
+}
@@ -0,0 +1,646 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/schema"
+
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+// writeTypeScript produces TypeScript code for working with the types in the TypeSystem.
+//
+// Each type declared in the schema gets a TypeScript type describing its typed view:
+// structs become interfaces, enums become unions of string literals,
+// and unions become discriminated unions, with a "type" property holding the name of the member type and a "value" property holding the value.
+// Prelude types (like "String") don't get declarations; they're written out structurally wherever they're used, instead.
+//
+// Every type (including those) also gets an "encode<TypeName>" function, which turns the typed view into data model values
+// (the kind of plain objects that the JavaScript IPLD codecs read and write),
+// and a "decode<TypeName>" function, which does the reverse, checking the data matches the type on the way.
+// These follow the type's representation strategy.
+// Links are typed as the CID class from the "multiformats" package.
+//
+// Errors:
+//
+//   - schema-codegen-unsupported -- if a type uses a representation strategy that the generator can't handle.
+func writeTypeScript(w io.Writer, ts *schema.TypeSystem) error {
+	g := &tsGen{}
+	g.line(`// Code generated by "ipld schema codegen --generator=typescript". DO NOT EDIT.`)
+	g.line(``)
+	g.line(`import { CID } from 'multiformats/cid'`)
+	g.line(``)
+	g.line(`function kindOf (d: unknown): string {`)
+	g.line(`  if (d === null) return 'null'`)
+	g.line(`  if (typeof d === 'boolean') return 'bool'`)
+	g.line(`  if (typeof d === 'number') return Number.isInteger(d) ? 'int' : 'float'`)
+	g.line(`  if (typeof d === 'string') return 'string'`)
+	g.line(`  if (d instanceof Uint8Array) return 'bytes'`)
+	g.line(`  if (Array.isArray(d)) return 'list'`)
+	g.line(`  if (CID.asCID(d) !== null) return 'link'`)
+	g.line(`  if (typeof d === 'object') return 'map'`)
+	g.line(`  return 'invalid'`)
+	g.line(`}`)
+	g.line(``)
+	g.line(`function fail (typeName: string, expected: string, d: unknown): never {`)
+	g.line(`  throw new TypeError(typeName + ': expected ' + expected + ', got ' + kindOf(d))`)
+	g.line(`}`)
+	g.line(``)
+	g.line(`function invalid (typeName: string, problem: string): never {`)
+	g.line(`  throw new TypeError(typeName + ': ' + problem)`)
+	g.line(`}`)
+	for _, name := range ts.Names() {
+		if err := g.genType(ts.TypeByName(name)); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(g.Bytes())
+	return err
+}
+
+type tsGen struct {
+	codeBuf
+}
+
+// declared returns true if the type gets a TypeScript type declaration of its own.
+func (g *tsGen) declared(t schema.Type) bool {
+	if IsPreludeType(t) {
+		return false
+	}
+	switch t := t.(type) {
+	case *schema.TypeMap:
+		return !t.IsAnonymous()
+	case *schema.TypeList:
+		return !t.IsAnonymous()
+	}
+	return true
+}
+
+// typeExpr returns the TypeScript type to use when referring to a schema type.
+func (g *tsGen) typeExpr(t schema.Type) string {
+	if g.declared(t) {
+		return t.Name()
+	}
+	switch t := t.(type) {
+	case *schema.TypeMap:
+		return fmt.Sprintf("{ [key: string]: %s }", g.nullableTypeExpr(t.ValueType(), t.ValueIsNullable()))
+	case *schema.TypeList:
+		return fmt.Sprintf("Array<%s>", g.nullableTypeExpr(t.ValueType(), t.ValueIsNullable()))
+	}
+	return g.scalarTypeExpr(t)
+}
+
+func (g *tsGen) nullableTypeExpr(t schema.Type, nullable bool) string {
+	if nullable {
+		return g.typeExpr(t) + " | null"
+	}
+	return g.typeExpr(t)
+}
+
+func (g *tsGen) scalarTypeExpr(t schema.Type) string {
+	switch t.TypeKind() {
+	case schema.TypeKind_Bool:
+		return "boolean"
+	case schema.TypeKind_Int, schema.TypeKind_Float:
+		return "number"
+	case schema.TypeKind_String:
+		return "string"
+	case schema.TypeKind_Bytes:
+		return "Uint8Array"
+	case schema.TypeKind_Link:
+		return "CID"
+	default:
+		return "unknown"
+	}
+}
+
+// encodeCall and decodeCall return expressions which call the encode or decode function for a type, handling null if it's allowed.
+func (g *tsGen) encodeCall(t schema.Type, expr string, nullable bool) string {
+	if nullable {
+		return fmt.Sprintf("%s === null ? null : encode%s(%s)", expr, t.Name(), expr)
+	}
+	return fmt.Sprintf("encode%s(%s)", t.Name(), expr)
+}
+
+func (g *tsGen) decodeCall(t schema.Type, expr string, nullable bool) string {
+	if nullable {
+		return fmt.Sprintf("%s === null ? null : decode%s(%s)", expr, t.Name(), expr)
+	}
+	return fmt.Sprintf("decode%s(%s)", t.Name(), expr)
+}
+
+func (g *tsGen) genType(t schema.Type) error {
+	name := t.Name()
+	g.line(``)
+	switch t := t.(type) {
+	case *schema.TypeBool, *schema.TypeInt, *schema.TypeFloat, *schema.TypeString, *schema.TypeBytes:
+		if g.declared(t) {
+			g.line(`// %s is a %s.`, name, t.TypeKind())
+			g.line(`export type %s = %s`, name, g.scalarTypeExpr(t))
+			g.line(``)
+		}
+		g.line(`export function encode%s (v: %s): unknown {`, name, g.typeExpr(t))
+		g.line(`  return v`)
+		g.line(`}`)
+		g.line(``)
+		g.line(`export function decode%s (d: unknown): %s {`, name, g.typeExpr(t))
+		switch t.TypeKind() {
+		case schema.TypeKind_Float:
+			g.line(`  if (kindOf(d) !== 'float' && kindOf(d) !== 'int') return fail(%s, 'float', d)`, jsString(name))
+		default:
+			g.line(`  if (kindOf(d) !== %s) return fail(%s, %s, d)`, jsString(t.RepresentationBehavior().String()), jsString(name), jsString(t.RepresentationBehavior().String()))
+		}
+		g.line(`  return d as %s`, g.typeExpr(t))
+		g.line(`}`)
+
+	case *schema.TypeAny:
+		g.line(`export function encode%s (v: unknown): unknown {`, name)
+		g.line(`  return v`)
+		g.line(`}`)
+		g.line(``)
+		g.line(`export function decode%s (d: unknown): unknown {`, name)
+		g.line(`  return d`)
+		g.line(`}`)
+
+	case *schema.TypeLink:
+		if g.declared(t) {
+			if t.HasReferencedType() {
+				g.line(`// %s is a link to %s.`, name, t.ReferencedType().Name())
+			} else {
+				g.line(`// %s is a link.`, name)
+			}
+			g.line(`export type %s = CID`, name)
+			g.line(``)
+		}
+		g.line(`export function encode%s (v: %s): unknown {`, name, g.typeExpr(t))
+		g.line(`  return v`)
+		g.line(`}`)
+		g.line(``)
+		g.line(`export function decode%s (d: unknown): %s {`, name, g.typeExpr(t))
+		g.line(`  const cid = CID.asCID(d)`)
+		g.line(`  if (cid === null) return fail(%s, 'link', d)`, jsString(name))
+		g.line(`  return cid`)
+		g.line(`}`)
+
+	case *schema.TypeMap:
+		if g.declared(t) {
+			g.line(`// %s is a map.`, name)
+			g.line(`export type %s = { [key: string]: %s }`, name, g.nullableTypeExpr(t.ValueType(), t.ValueIsNullable()))
+			g.line(``)
+		}
+		g.line(`export function encode%s (v: %s): unknown {`, name, g.typeExpr(t))
+		g.line(`  const out: { [key: string]: unknown } = {}`)
+		g.line(`  for (const [k, x] of Object.entries(v)) {`)
+		g.line(`    out[%s as string] = %s`, g.encodeCall(t.KeyType(), "k", false), g.encodeCall(t.ValueType(), "x", t.ValueIsNullable()))
+		g.line(`  }`)
+		g.line(`  return out`)
+		g.line(`}`)
+		g.line(``)
+		g.line(`export function decode%s (d: unknown): %s {`, name, g.typeExpr(t))
+		g.line(`  if (kindOf(d) !== 'map') return fail(%s, 'map', d)`, jsString(name))
+		g.line(`  const out: %s = {}`, g.typeExpr(t))
+		g.line(`  for (const [k, x] of Object.entries(d as { [key: string]: unknown })) {`)
+		g.line(`    out[%s] = %s`, g.decodeCall(t.KeyType(), "k", false), g.decodeCall(t.ValueType(), "x", t.ValueIsNullable()))
+		g.line(`  }`)
+		g.line(`  return out`)
+		g.line(`}`)
+
+	case *schema.TypeList:
+		if g.declared(t) {
+			g.line(`// %s is a list.`, name)
+			g.line(`export type %s = Array<%s>`, name, g.nullableTypeExpr(t.ValueType(), t.ValueIsNullable()))
+			g.line(``)
+		}
+		g.line(`export function encode%s (v: %s): unknown {`, name, g.typeExpr(t))
+		g.line(`  return v.map(x => %s)`, g.encodeCall(t.ValueType(), "x", t.ValueIsNullable()))
+		g.line(`}`)
+		g.line(``)
+		g.line(`export function decode%s (d: unknown): %s {`, name, g.typeExpr(t))
+		g.line(`  if (kindOf(d) !== 'list') return fail(%s, 'list', d)`, jsString(name))
+		g.line(`  return (d as unknown[]).map(x => %s)`, g.decodeCall(t.ValueType(), "x", t.ValueIsNullable()))
+		g.line(`}`)
+
+	case *schema.TypeStruct:
+		return g.genStruct(t)
+
+	case *schema.TypeEnum:
+		return g.genEnum(t)
+
+	case *schema.TypeUnion:
+		return g.genUnion(t)
+
+	default:
+		return ipldtoolerr.Newf(ErrCode_CodegenUnsupported, "type %s is of kind %s, which the typescript generator doesn't support", name, t.TypeKind())
+	}
+	return nil
+}
+
+func (g *tsGen) genStruct(t *schema.TypeStruct) error {
+	name := t.Name()
+	fields := t.Fields()
+	stg := t.RepresentationStrategy()
+
+	// Check we can handle the representation before emitting anything.
+	var stgName string
+	switch stg.(type) {
+	case schema.StructRepresentation_Map:
+		stgName = "map"
+	case schema.StructRepresentation_Tuple:
+		stgName = "tuple"
+	case schema.StructRepresentation_Stringjoin:
+		stgName = "stringjoin"
+	default:
+		return ipldtoolerr.Newf(ErrCode_CodegenUnsupported, "struct %s has a %s representation, which the typescript generator doesn't support", name, reprStrategyName(stg))
+	}
+
+	g.line(`// %s is a struct, represented as a %s.`, name, stgName)
+	g.line(`export interface %s {`, name)
+	for _, f := range fields {
+		opt := ""
+		if f.IsOptional() {
+			opt = "?"
+		}
+		g.line(`  %s%s: %s`, jsProp(f.Name()), opt, g.nullableTypeExpr(f.Type(), f.IsNullable()))
+	}
+	g.line(`}`)
+	g.line(``)
+
+	switch stg := stg.(type) {
+	case schema.StructRepresentation_Map:
+		g.line(`export function encode%s (v: %s): unknown {`, name, name)
+		g.line(`  const out: { [key: string]: unknown } = {}`)
+		for _, f := range fields {
+			key := jsString(stg.GetFieldKey(f))
+			val := "v" + jsAccess(f.Name())
+			enc := g.encodeCall(f.Type(), val, f.IsNullable())
+			switch implicit := stg.FieldImplicit(f); {
+			case implicit != nil:
+				g.line(`  const %s = %s`, jsLocal(f.Name()), enc)
+				g.line(`  if (!(%s)) out[%s] = %s`, implicitCheck(jsLocal(f.Name()), implicit), key, jsLocal(f.Name()))
+			case f.IsOptional():
+				g.line(`  if (%s !== undefined) out[%s] = %s`, val, key, enc)
+			default:
+				g.line(`  out[%s] = %s`, key, enc)
+			}
+		}
+		g.line(`  return out`)
+		g.line(`}`)
+		g.line(``)
+		g.line(`export function decode%s (d: unknown): %s {`, name, name)
+		g.line(`  if (kindOf(d) !== 'map') return fail(%s, 'map', d)`, jsString(name))
+		g.line(`  const m = d as { [key: string]: unknown }`)
+		keys := make([]string, len(fields))
+		for i, f := range fields {
+			keys[i] = jsString(stg.GetFieldKey(f))
+		}
+		g.line(`  for (const k of Object.keys(m)) {`)
+		g.line(`    if (![%s].includes(k)) return invalid(%s, 'unexpected key ' + JSON.stringify(k))`, strings.Join(keys, ", "), jsString(name))
+		g.line(`  }`)
+		for i, f := range fields {
+			if !f.IsOptional() && stg.FieldImplicit(f) == nil {
+				g.line(`  if (!(%s in m)) return invalid(%s, 'missing key ' + JSON.stringify(%s))`, keys[i], jsString(name), keys[i])
+			}
+		}
+		g.line(`  const out: %s = {`, name)
+		for i, f := range fields {
+			switch implicit := stg.FieldImplicit(f); {
+			case implicit != nil:
+				g.line(`    %s: %s,`, jsProp(f.Name()), g.decodeCall(f.Type(), fmt.Sprintf("(%s in m ? m[%s] : %s)", keys[i], keys[i], implicitLiteral(implicit)), f.IsNullable()))
+			case !f.IsOptional():
+				g.line(`    %s: %s,`, jsProp(f.Name()), g.decodeCall(f.Type(), fmt.Sprintf("m[%s]", keys[i]), f.IsNullable()))
+			}
+		}
+		g.line(`  }`)
+		for i, f := range fields {
+			if f.IsOptional() && stg.FieldImplicit(f) == nil {
+				g.line(`  if (%s in m) out%s = %s`, keys[i], jsAccess(f.Name()), g.decodeCall(f.Type(), fmt.Sprintf("m[%s]", keys[i]), f.IsNullable()))
+			}
+		}
+		g.line(`  return out`)
+		g.line(`}`)
+
+	case schema.StructRepresentation_Tuple:
+		// Optional fields can only be left off the end of the list.
+		required := 0
+		for i, f := range fields {
+			if !f.IsOptional() {
+				required = i + 1
+			}
+		}
+		g.line(`export function encode%s (v: %s): unknown {`, name, name)
+		encs := make([]string, len(fields))
+		for i, f := range fields {
+			encs[i] = g.encodeCall(f.Type(), "v"+jsAccess(f.Name()), f.IsNullable())
+			if f.IsOptional() {
+				encs[i] = fmt.Sprintf("v%s === undefined ? undefined : %s", jsAccess(f.Name()), encs[i])
+			}
+		}
+		if required < len(fields) {
+			g.line(`  const out: unknown[] = [`)
+			for _, enc := range encs {
+				g.line(`    %s,`, enc)
+			}
+			g.line(`  ]`)
+			g.line(`  while (out.length > 0 && out[out.length - 1] === undefined) out.pop()`)
+			g.line(`  return out`)
+		} else {
+			g.line(`  return [`)
+			for _, enc := range encs {
+				g.line(`    %s,`, enc)
+			}
+			g.line(`  ]`)
+		}
+		g.line(`}`)
+		g.line(``)
+		g.line(`export function decode%s (d: unknown): %s {`, name, name)
+		g.line(`  if (kindOf(d) !== 'list') return fail(%s, 'list', d)`, jsString(name))
+		g.line(`  const l = d as unknown[]`)
+		if required == len(fields) {
+			g.line(`  if (l.length !== %d) return invalid(%s, 'expected %d entries, got ' + l.length)`, len(fields), jsString(name), len(fields))
+		} else {
+			g.line(`  if (l.length < %d || l.length > %d) return invalid(%s, 'expected %d to %d entries, got ' + l.length)`, required, len(fields), jsString(name), required, len(fields))
+		}
+		g.line(`  const out: %s = {`, name)
+		for i, f := range fields {
+			if !f.IsOptional() {
+				g.line(`    %s: %s,`, jsProp(f.Name()), g.decodeCall(f.Type(), fmt.Sprintf("l[%d]", i), f.IsNullable()))
+			}
+		}
+		g.line(`  }`)
+		for i, f := range fields {
+			if f.IsOptional() {
+				g.line(`  if (l.length > %d) out%s = %s`, i, jsAccess(f.Name()), g.decodeCall(f.Type(), fmt.Sprintf("l[%d]", i), f.IsNullable()))
+			}
+		}
+		g.line(`  return out`)
+		g.line(`}`)
+
+	case schema.StructRepresentation_Stringjoin:
+		delim := jsString(stg.GetDelim())
+		g.line(`export function encode%s (v: %s): unknown {`, name, name)
+		g.line(`  return [`)
+		for _, f := range fields {
+			g.line(`    %s as string,`, g.encodeCall(f.Type(), "v"+jsAccess(f.Name()), false))
+		}
+		g.line(`  ].join(%s)`, delim)
+		g.line(`}`)
+		g.line(``)
+		g.line(`export function decode%s (d: unknown): %s {`, name, name)
+		g.line(`  if (kindOf(d) !== 'string') return fail(%s, 'string', d)`, jsString(name))
+		g.line(`  const parts = (d as string).split(%s)`, delim)
+		g.line(`  if (parts.length !== %d) return invalid(%s, 'expected %d parts, got ' + parts.length)`, len(fields), jsString(name), len(fields))
+		g.line(`  return {`)
+		for i, f := range fields {
+			g.line(`    %s: %s,`, jsProp(f.Name()), g.decodeCall(f.Type(), fmt.Sprintf("parts[%d]", i), false))
+		}
+		g.line(`  }`)
+		g.line(`}`)
+	}
+	return nil
+}
+
+func (g *tsGen) genEnum(t *schema.TypeEnum) error {
+	name := t.Name()
+	members := t.Members()
+
+	// Work out the serial value of each member.
+	serial := make([]string, len(members))
+	switch stg := t.RepresentationStrategy().(type) {
+	case schema.EnumRepresentation_String:
+		for i, m := range members {
+			serial[i] = jsString(m)
+			if s, ok := stg[m]; ok {
+				serial[i] = jsString(s)
+			}
+		}
+	case schema.EnumRepresentation_Int:
+		for i, m := range members {
+			serial[i] = fmt.Sprintf("%d", stg[m])
+		}
+	default:
+		return ipldtoolerr.Newf(ErrCode_CodegenUnsupported, "enum %s has a representation which the typescript generator doesn't support", name)
+	}
+
+	g.line(`// %s is an enum, represented as %s.`, name, enumReprKindWord(t))
+	lits := make([]string, len(members))
+	for i, m := range members {
+		lits[i] = jsString(m)
+	}
+	g.line(`export type %s = %s`, name, strings.Join(lits, " | "))
+	g.line(``)
+	g.line(`export function encode%s (v: %s): unknown {`, name, name)
+	g.line(`  switch (v) {`)
+	for i := range members {
+		g.line(`    case %s: return %s`, lits[i], serial[i])
+	}
+	g.line(`  }`)
+	g.line(`  return invalid(%s, 'unknown member ' + JSON.stringify(v))`, jsString(name))
+	g.line(`}`)
+	g.line(``)
+	g.line(`export function decode%s (d: unknown): %s {`, name, name)
+	g.line(`  switch (d) {`)
+	for i := range members {
+		g.line(`    case %s: return %s`, serial[i], lits[i])
+	}
+	g.line(`  }`)
+	g.line(`  return invalid(%s, 'unknown value ' + JSON.stringify(d))`, jsString(name))
+	g.line(`}`)
+	return nil
+}
+
+func enumReprKindWord(t *schema.TypeEnum) string {
+	if _, ok := t.RepresentationStrategy().(schema.EnumRepresentation_Int); ok {
+		return "ints"
+	}
+	return "strings"
+}
+
+func (g *tsGen) genUnion(t *schema.TypeUnion) error {
+	name := t.Name()
+	members := t.Members()
+
+	var stgName string
+	switch stg := t.RepresentationStrategy().(type) {
+	case schema.UnionRepresentation_Keyed:
+		stgName = "keyed"
+	case schema.UnionRepresentation_Kinded:
+		stgName = "kinded"
+	case schema.UnionRepresentation_Stringprefix:
+		stgName = "stringprefix"
+	default:
+		return ipldtoolerr.Newf(ErrCode_CodegenUnsupported, "union %s has a %s representation, which the typescript generator doesn't support", name, reprStrategyName(stg))
+	}
+
+	g.line(`// %s is a union, with a %s representation.`, name, stgName)
+	g.line(`// The "type" property says which member type the value is.`)
+	g.line(`export type %s =`, name)
+	for _, m := range members {
+		g.line(`  | { type: %s, value: %s }`, jsString(m.Name()), g.typeExpr(m))
+	}
+	g.line(``)
+
+	switch stg := t.RepresentationStrategy().(type) {
+	case schema.UnionRepresentation_Keyed:
+		g.line(`export function encode%s (v: %s): unknown {`, name, name)
+		g.line(`  switch (v.type) {`)
+		for _, m := range members {
+			g.line(`    case %s: return { %s: %s }`, jsString(m.Name()), jsString(stg.GetDiscriminant(m)), g.encodeCall(m, "v.value", false))
+		}
+		g.line(`  }`)
+		g.line(`}`)
+		g.line(``)
+		g.line(`export function decode%s (d: unknown): %s {`, name, name)
+		g.line(`  if (kindOf(d) !== 'map') return fail(%s, 'map', d)`, jsString(name))
+		g.line(`  const m = d as { [key: string]: unknown }`)
+		g.line(`  const keys = Object.keys(m)`)
+		g.line(`  if (keys.length !== 1) return invalid(%s, 'expected a map with exactly one key, got ' + keys.length)`, jsString(name))
+		g.line(`  switch (keys[0]) {`)
+		for _, m := range members {
+			key := jsString(stg.GetDiscriminant(m))
+			g.line(`    case %s: return { type: %s, value: %s }`, key, jsString(m.Name()), g.decodeCall(m, fmt.Sprintf("m[%s]", key), false))
+		}
+		g.line(`  }`)
+		g.line(`  return invalid(%s, 'unknown key ' + JSON.stringify(keys[0]))`, jsString(name))
+		g.line(`}`)
+
+	case schema.UnionRepresentation_Kinded:
+		g.line(`export function encode%s (v: %s): unknown {`, name, name)
+		g.line(`  switch (v.type) {`)
+		for _, m := range members {
+			g.line(`    case %s: return %s`, jsString(m.Name()), g.encodeCall(m, "v.value", false))
+		}
+		g.line(`  }`)
+		g.line(`}`)
+		g.line(``)
+		g.line(`export function decode%s (d: unknown): %s {`, name, name)
+		g.line(`  switch (kindOf(d)) {`)
+		var kinds []string
+		for _, k := range allKinds {
+			member := stg.GetMember(k)
+			if member == "" {
+				continue
+			}
+			kinds = append(kinds, k.String())
+			cases := []string{k.String()}
+			if k == datamodel.Kind_Float && stg.GetMember(datamodel.Kind_Int) == "" {
+				cases = append(cases, "int") // Floats which happen to be whole numbers look like ints.
+			}
+			for _, c := range cases[1:] {
+				g.line(`    case %s:`, jsString(c))
+			}
+			g.line(`    case %s: return { type: %s, value: %s }`, jsString(cases[0]), jsString(member), g.decodeCall(t.TypeSystem().TypeByName(member), "d", false))
+		}
+		g.line(`  }`)
+		g.line(`  return fail(%s, %s, d)`, jsString(name), jsString(strings.Join(kinds, " or ")))
+		g.line(`}`)
+
+	case schema.UnionRepresentation_Stringprefix:
+		g.line(`export function encode%s (v: %s): unknown {`, name, name)
+		g.line(`  switch (v.type) {`)
+		for _, m := range members {
+			g.line(`    case %s: return %s + (%s as string)`, jsString(m.Name()), jsString(stg.GetDiscriminant(m)+stg.GetDelim()), g.encodeCall(m, "v.value", false))
+		}
+		g.line(`  }`)
+		g.line(`}`)
+		g.line(``)
+		g.line(`export function decode%s (d: unknown): %s {`, name, name)
+		g.line(`  if (kindOf(d) !== 'string') return fail(%s, 'string', d)`, jsString(name))
+		g.line(`  const s = d as string`)
+		// Check longer prefixes first, in case one prefix is the start of another.
+		sorted := append([]schema.Type(nil), members...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return len(stg.GetDiscriminant(sorted[i])) > len(stg.GetDiscriminant(sorted[j]))
+		})
+		for _, m := range sorted {
+			prefix := jsString(stg.GetDiscriminant(m) + stg.GetDelim())
+			g.line(`  if (s.startsWith(%s)) return { type: %s, value: %s }`, prefix, jsString(m.Name()), g.decodeCall(m, fmt.Sprintf("s.slice(%s.length)", prefix), false))
+		}
+		g.line(`  return invalid(%s, 'no known prefix on ' + JSON.stringify(s))`, jsString(name))
+		g.line(`}`)
+	}
+	return nil
+}
+
+var allKinds = []datamodel.Kind{
+	datamodel.Kind_Null,
+	datamodel.Kind_Bool,
+	datamodel.Kind_Int,
+	datamodel.Kind_Float,
+	datamodel.Kind_String,
+	datamodel.Kind_Bytes,
+	datamodel.Kind_List,
+	datamodel.Kind_Map,
+	datamodel.Kind_Link,
+}
+
+// implicitLiteral returns a JavaScript literal for an implicit value (in its representation form).
+func implicitLiteral(v schema.ImplicitValue) string {
+	switch v := v.(type) {
+	case schema.ImplicitValue_String:
+		return jsString(string(v))
+	case schema.ImplicitValue_Int:
+		return fmt.Sprintf("%d", int(v))
+	case schema.ImplicitValue_Bool:
+		return fmt.Sprintf("%t", bool(v))
+	case schema.ImplicitValue_EmptyList:
+		return "[]"
+	case schema.ImplicitValue_EmptyMap:
+		return "{}"
+	default:
+		panic(fmt.Errorf("unreachable: unknown implicit value %T", v))
+	}
+}
+
+// implicitCheck returns a JavaScript expression checking whether the (encoded) value in the variable is equal to an implicit value.
+func implicitCheck(varName string, v schema.ImplicitValue) string {
+	switch v.(type) {
+	case schema.ImplicitValue_EmptyList:
+		return fmt.Sprintf("Array.isArray(%s) && %s.length === 0", varName, varName)
+	case schema.ImplicitValue_EmptyMap:
+		return fmt.Sprintf("kindOf(%s) === 'map' && Object.keys(%s as object).length === 0", varName, varName)
+	default:
+		return fmt.Sprintf("%s === %s", varName, implicitLiteral(v))
+	}
+}
+
+var (
+	jsIdentifier   = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+	jsNonIdentChar = regexp.MustCompile(`[^A-Za-z0-9_$]`)
+)
+
+// jsString returns a single-quoted JavaScript string literal.
+// (It starts from a JSON string, since those are also valid JavaScript, and then swaps the quotes.)
+func jsString(s string) string {
+	bs, _ := json.Marshal(s)
+	inner := string(bs[1 : len(bs)-1])
+	inner = strings.ReplaceAll(inner, `\"`, `"`)
+	inner = strings.ReplaceAll(inner, `'`, `\'`)
+	return "'" + inner + "'"
+}
+
+// jsProp returns a property name for use in an object literal or interface, quoting it if necessary.
+func jsProp(s string) string {
+	if jsIdentifier.MatchString(s) {
+		return s
+	}
+	return jsString(s)
+}
+
+// jsAccess returns a property access expression suffix, like ".foo" or `["foo-bar"]`.
+func jsAccess(s string) string {
+	if jsIdentifier.MatchString(s) {
+		return "." + s
+	}
+	return "[" + jsString(s) + "]"
+}
+
+// jsLocal returns a local variable name for holding the encoded value of a field.
+func jsLocal(s string) string {
+	return "enc_" + jsNonIdentChar.ReplaceAllString(s, "_")
+}
@@ -0,0 +1,619 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/schema"
+)
+
+// CompatChange describes one difference between two versions of a schema,
+// and whether data still works across it, in each direction.
+type CompatChange struct {
+	TypeName string
+	Change   string // Describes what changed.
+
+	OldDataNewSchema bool // True if data that matched the old schema will still match the new one (i.e., the change is backward compatible).
+	NewDataOldSchema bool // True if data that matches the new schema would also have matched the old one (i.e., the change is forward compatible).
+}
+
+// CompatReport lists the differences between two versions of a schema.
+type CompatReport struct {
+	Changes []CompatChange
+}
+
+// CompareSchemas finds the differences between two versions of a schema, and works out whether each one is compatible in each direction.
+//
+// Compatibility is about data, so it's the representations of types that are compared:
+// for example, renaming a struct field is compatible if its key in the representation stays the same,
+// and changing what type a field refers to is compatible if the data for the old type is also valid for the new type.
+// Struct fields are matched up by their representation keys (or positions, for tuples);
+// union members by their discriminants (or kinds, for kinded unions); and enum members by their representation values.
+//
+// Types are compared by name: types in both versions are compared with each other,
+// and types in only one version are reported as added or removed.
+// (A type that's been removed can't be used to read old data, so that's reported as incompatible for old data;
+// and likewise, a type that's been added is incompatible for new data.)
+// The types that are made for inline definitions (like "List__String") aren't reported as added or removed;
+// changes to them are reported where they're used.
+func CompareSchemas(old, new *schema.TypeSystem) *CompatReport {
+	c := &compatChecker{fitsMemo: map[[2]schema.Type]bool{}}
+	for _, name := range old.Names() {
+		oldT := old.TypeByName(name)
+		if IsPreludeType(oldT) {
+			continue
+		}
+		newT := new.TypeByName(name)
+		switch {
+		case newT != nil:
+			c.diffType(string(name), oldT, newT)
+		case !isInlineTypeName(string(name)):
+			c.add(string(name), false, true, "type removed")
+		}
+	}
+	for _, name := range new.Names() {
+		newT := new.TypeByName(name)
+		if IsPreludeType(newT) || old.TypeByName(name) != nil || isInlineTypeName(string(name)) {
+			continue
+		}
+		c.add(string(name), true, false, "type added")
+	}
+	return &CompatReport{c.changes}
+}
+
+// Breaking returns the changes that aren't compatible in the given directions.
+func (r *CompatReport) Breaking(oldDataNewSchema, newDataOldSchema bool) []CompatChange {
+	var result []CompatChange
+	for _, ch := range r.Changes {
+		if (oldDataNewSchema && !ch.OldDataNewSchema) || (newDataOldSchema && !ch.NewDataOldSchema) {
+			result = append(result, ch)
+		}
+	}
+	return result
+}
+
+// Node returns the report as data, for printing.
+func (r *CompatReport) Node() datamodel.Node {
+	changes := []interface{}{}
+	oldDataBreaks, newDataBreaks := 0, 0
+	for _, ch := range r.Changes {
+		changes = append(changes, newJSONObj().
+			set("type", ch.TypeName).
+			set("change", ch.Change).
+			set("oldDataNewSchema", ch.OldDataNewSchema).
+			set("newDataOldSchema", ch.NewDataOldSchema))
+		if !ch.OldDataNewSchema {
+			oldDataBreaks++
+		}
+		if !ch.NewDataOldSchema {
+			newDataBreaks++
+		}
+	}
+	return newJSONObj().
+		set("changes", changes).
+		set("oldDataNewSchema", oldDataBreaks == 0).
+		set("newDataOldSchema", newDataBreaks == 0).
+		node()
+}
+
+// isInlineTypeName returns true for the names schemadmt.Compile makes up for inline type definitions.
+func isInlineTypeName(name string) bool {
+	return strings.HasPrefix(name, "List__") || strings.HasPrefix(name, "Map__")
+}
+
+type compatChecker struct {
+	changes  []CompatChange
+	fitsMemo map[[2]schema.Type]bool
+}
+
+func (c *compatChecker) add(typeName string, oldDataNewSchema, newDataOldSchema bool, format string, args ...interface{}) {
+	c.changes = append(c.changes, CompatChange{typeName, fmt.Sprintf(format, args...), oldDataNewSchema, newDataOldSchema})
+}
+
+// addFits adds a change whose compatibility is whether the data for each version of a type fits the other.
+func (c *compatChecker) addFits(typeName string, oldT, newT schema.Type, format string, args ...interface{}) {
+	c.add(typeName, c.fits(oldT, newT), c.fits(newT, oldT), format, args...)
+}
+
+// addTypeRef compares the types used at some position (like a field), and adds a change if they're different types.
+// If they're the same type (by name), any changes to it are reported for that type itself.
+func (c *compatChecker) addTypeRef(typeName string, oldT, newT schema.Type, where string) {
+	if oldT.Name() != newT.Name() {
+		c.addFits(typeName, oldT, newT, "%s: type changed from %s to %s", where, oldT.Name(), newT.Name())
+	}
+}
+
+// addFlag reports a change to something like optional or nullable: things which, when turned on, allow more data.
+func (c *compatChecker) addFlag(typeName string, oldFlag, newFlag bool, where, flag string) {
+	switch {
+	case !oldFlag && newFlag:
+		c.add(typeName, true, false, "%s: became %s", where, flag)
+	case oldFlag && !newFlag:
+		c.add(typeName, false, true, "%s: is no longer %s", where, flag)
+	}
+}
+
+func (c *compatChecker) diffType(name string, oldT, newT schema.Type) {
+	if oldT.TypeKind() != newT.TypeKind() {
+		c.addFits(name, oldT, newT, "kind changed from %s to %s", strings.ToLower(oldT.TypeKind().String()), strings.ToLower(newT.TypeKind().String()))
+		return
+	}
+	switch oldT := oldT.(type) {
+	case *schema.TypeMap:
+		newT := newT.(*schema.TypeMap)
+		c.addTypeRef(name, oldT.KeyType(), newT.KeyType(), "keys")
+		c.addTypeRef(name, oldT.ValueType(), newT.ValueType(), "values")
+		c.addFlag(name, oldT.ValueIsNullable(), newT.ValueIsNullable(), "values", "nullable")
+	case *schema.TypeList:
+		newT := newT.(*schema.TypeList)
+		c.addTypeRef(name, oldT.ValueType(), newT.ValueType(), "values")
+		c.addFlag(name, oldT.ValueIsNullable(), newT.ValueIsNullable(), "values", "nullable")
+	case *schema.TypeLink:
+		newT := newT.(*schema.TypeLink)
+		oldTarget, newTarget := "any type", "any type"
+		if oldT.HasReferencedType() {
+			oldTarget = string(oldT.ReferencedType().Name())
+		}
+		if newT.HasReferencedType() {
+			newTarget = string(newT.ReferencedType().Name())
+		}
+		if oldTarget != newTarget {
+			c.addFits(name, oldT, newT, "link target changed from %s to %s", oldTarget, newTarget)
+		}
+	case *schema.TypeStruct:
+		c.diffStruct(name, oldT, newT.(*schema.TypeStruct))
+	case *schema.TypeUnion:
+		c.diffUnion(name, oldT, newT.(*schema.TypeUnion))
+	case *schema.TypeEnum:
+		c.diffEnum(name, oldT, newT.(*schema.TypeEnum))
+	}
+}
+
+func (c *compatChecker) diffStruct(name string, oldT, newT *schema.TypeStruct) {
+	if reflect.TypeOf(oldT.RepresentationStrategy()) != reflect.TypeOf(newT.RepresentationStrategy()) {
+		c.addFits(name, oldT, newT, "representation changed from %s to %s", reprStrategyName(oldT.RepresentationStrategy()), reprStrategyName(newT.RepresentationStrategy()))
+		return
+	}
+	switch oldStg := oldT.RepresentationStrategy().(type) {
+	case schema.StructRepresentation_Map:
+		newStg := newT.RepresentationStrategy().(schema.StructRepresentation_Map)
+		mayBeAbsent := func(stg schema.StructRepresentation_Map, f schema.StructField) bool {
+			return f.IsOptional() || stg.FieldImplicit(f) != nil
+		}
+
+		// Match fields up by their keys; then a field whose key changed is one with the same name left over on both sides.
+		newByKey := map[string]schema.StructField{}
+		for _, f := range newT.Fields() {
+			newByKey[newStg.GetFieldKey(f)] = f
+		}
+		var removed []schema.StructField
+		matched := map[string]bool{}
+		for _, oldF := range oldT.Fields() {
+			key := oldStg.GetFieldKey(oldF)
+			newF, ok := newByKey[key]
+			if !ok {
+				removed = append(removed, oldF)
+				continue
+			}
+			matched[newF.Name()] = true
+			where := fmt.Sprintf("field %q", oldF.Name())
+			if newF.Name() != oldF.Name() {
+				c.add(name, true, true, "%s renamed to %q (its key is still %q)", where, newF.Name(), key)
+				where = fmt.Sprintf("field %q", newF.Name())
+			}
+			c.addTypeRef(name, oldF.Type(), newF.Type(), where)
+			c.addFlag(name, oldF.IsNullable(), newF.IsNullable(), where, "nullable")
+			c.addFlag(name, mayBeAbsent(oldStg, oldF), mayBeAbsent(newStg, newF), where, "optional")
+			if oldI, newI := oldStg.FieldImplicit(oldF), newStg.FieldImplicit(newF); oldI != nil && newI != nil && oldI != newI {
+				// The data still matches either way, but it means something different when the field is absent.
+				c.add(name, false, false, "%s: implicit value changed from %s to %s", where, dslImplicit(oldI), dslImplicit(newI))
+			}
+		}
+		for _, oldF := range removed {
+			if newF := newT.Field(oldF.Name()); newF != nil && !matched[newF.Name()] {
+				matched[newF.Name()] = true
+				c.add(name, false, false, "field %q: key changed from %q to %q", oldF.Name(), oldStg.GetFieldKey(oldF), newStg.GetFieldKey(*newF))
+				continue
+			}
+			c.add(name, false, mayBeAbsent(oldStg, oldF), "field %q removed", oldF.Name())
+		}
+		for _, newF := range newT.Fields() {
+			if !matched[newF.Name()] {
+				c.add(name, mayBeAbsent(newStg, newF), false, "field %q added", newF.Name())
+			}
+		}
+	case schema.StructRepresentation_Tuple:
+		c.diffPositional(name, oldT, newT)
+	case schema.StructRepresentation_Stringjoin:
+		newStg := newT.RepresentationStrategy().(schema.StructRepresentation_Stringjoin)
+		if oldStg.GetDelim() != newStg.GetDelim() {
+			c.add(name, false, false, "join delimiter changed from %q to %q", oldStg.GetDelim(), newStg.GetDelim())
+		}
+		c.diffPositional(name, oldT, newT)
+	default:
+		if !reflect.DeepEqual(oldStg, newT.RepresentationStrategy()) {
+			c.addFits(name, oldT, newT, "%s representation changed", reprStrategyName(oldStg))
+		}
+	}
+}
+
+// diffPositional compares the fields of structs whose representations put the fields in order (like tuple).
+func (c *compatChecker) diffPositional(name string, oldT, newT *schema.TypeStruct) {
+	oldFields, newFields := oldT.Fields(), newT.Fields()
+	for i := 0; i < len(oldFields) || i < len(newFields); i++ {
+		switch {
+		case i >= len(newFields):
+			c.add(name, false, oldFields[i].IsOptional(), "field %d (%q) removed", i, oldFields[i].Name())
+		case i >= len(oldFields):
+			c.add(name, newFields[i].IsOptional(), false, "field %d (%q) added", i, newFields[i].Name())
+		default:
+			where := fmt.Sprintf("field %d (%q)", i, oldFields[i].Name())
+			if oldFields[i].Name() != newFields[i].Name() {
+				c.add(name, true, true, "%s renamed to %q", where, newFields[i].Name())
+				where = fmt.Sprintf("field %d (%q)", i, newFields[i].Name())
+			}
+			c.addTypeRef(name, oldFields[i].Type(), newFields[i].Type(), where)
+			c.addFlag(name, oldFields[i].IsNullable(), newFields[i].IsNullable(), where, "nullable")
+			c.addFlag(name, oldFields[i].IsOptional(), newFields[i].IsOptional(), where, "optional")
+		}
+	}
+}
+
+func (c *compatChecker) diffUnion(name string, oldT, newT *schema.TypeUnion) {
+	if reflect.TypeOf(oldT.RepresentationStrategy()) != reflect.TypeOf(newT.RepresentationStrategy()) {
+		c.addFits(name, oldT, newT, "representation changed from %s to %s", reprStrategyName(oldT.RepresentationStrategy()), reprStrategyName(newT.RepresentationStrategy()))
+		return
+	}
+	_, ok1 := unionMembersByDiscriminant(oldT)
+	newMembers, ok2 := unionMembersByDiscriminant(newT)
+	if !ok1 || !ok2 {
+		if !reflect.DeepEqual(oldT.RepresentationStrategy(), newT.RepresentationStrategy()) {
+			c.addFits(name, oldT, newT, "%s representation changed", reprStrategyName(oldT.RepresentationStrategy()))
+		}
+		return
+	}
+	discriminant := "key"
+	if isKindedUnion(oldT) {
+		discriminant = "kind"
+	}
+	// Match members up by their discriminants; then a member whose discriminant changed is one with the same type left over on both sides.
+	var removed []schema.Type
+	matched := map[schema.TypeName]bool{}
+	for _, oldM := range oldT.Members() {
+		d := unionDiscriminant(oldT, oldM)
+		newM, ok := newMembers[d]
+		if !ok {
+			removed = append(removed, oldM)
+			continue
+		}
+		matched[newM.Name()] = true
+		c.addTypeRef(name, oldM, newM, fmt.Sprintf("member for %s %s", discriminant, d))
+	}
+	for _, oldM := range removed {
+		if unionHasMember(newT, oldM.Name()) && !matched[oldM.Name()] {
+			matched[oldM.Name()] = true
+			c.add(name, false, false, "member %s: %s changed from %s to %s", oldM.Name(), discriminant, unionDiscriminant(oldT, oldM), unionDiscriminant(newT, newT.TypeSystem().TypeByName(string(oldM.Name()))))
+			continue
+		}
+		c.add(name, false, true, "member %s (%s %s) removed", oldM.Name(), discriminant, unionDiscriminant(oldT, oldM))
+	}
+	for _, newM := range newT.Members() {
+		if !matched[newM.Name()] {
+			c.add(name, true, false, "member %s (%s %s) added", newM.Name(), discriminant, unionDiscriminant(newT, newM))
+		}
+	}
+}
+
+func unionHasMember(t *schema.TypeUnion, name schema.TypeName) bool {
+	for _, m := range t.Members() {
+		if m.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *compatChecker) diffEnum(name string, oldT, newT *schema.TypeEnum) {
+	if reflect.TypeOf(oldT.RepresentationStrategy()) != reflect.TypeOf(newT.RepresentationStrategy()) {
+		c.addFits(name, oldT, newT, "representation changed from %s to %s", reprStrategyName(oldT.RepresentationStrategy()), reprStrategyName(newT.RepresentationStrategy()))
+		return
+	}
+	// Match members up by their values; then a member whose value changed is one with the same name left over on both sides.
+	oldValues, newValues := enumValues(oldT), enumValues(newT)
+	newByValue := map[string]string{}
+	for _, m := range newT.Members() {
+		newByValue[newValues[m]] = m
+	}
+	var removed []string
+	matched := map[string]bool{}
+	for _, m := range oldT.Members() {
+		newM, ok := newByValue[oldValues[m]]
+		if !ok {
+			removed = append(removed, m)
+			continue
+		}
+		matched[newM] = true
+		if newM != m {
+			c.add(name, true, true, "member %s renamed to %s (its value is still %s)", m, newM, oldValues[m])
+		}
+	}
+	for _, m := range removed {
+		if v, ok := newValues[m]; ok && !matched[m] {
+			matched[m] = true
+			c.add(name, false, false, "member %s: value changed from %s to %s", m, oldValues[m], v)
+			continue
+		}
+		c.add(name, false, true, "member %s (%s) removed", m, oldValues[m])
+	}
+	for _, m := range newT.Members() {
+		if !matched[m] {
+			c.add(name, true, false, "member %s (%s) added", m, newValues[m])
+		}
+	}
+}
+
+// enumValues returns the representation of each member of an enum, quoted if it's a string.
+func enumValues(t *schema.TypeEnum) map[string]string {
+	values := map[string]string{}
+	for _, m := range t.Members() {
+		switch stg := t.RepresentationStrategy().(type) {
+		case schema.EnumRepresentation_String:
+			if s, ok := stg[m]; ok {
+				values[m] = fmt.Sprintf("%q", s)
+			} else {
+				values[m] = fmt.Sprintf("%q", m)
+			}
+		case schema.EnumRepresentation_Int:
+			values[m] = fmt.Sprintf("%d", stg[m])
+		}
+	}
+	return values
+}
+
+// unionDiscriminant returns what tells a union member apart in the representation: its key, prefix, or kind.
+func unionDiscriminant(t *schema.TypeUnion, member schema.Type) string {
+	switch stg := t.RepresentationStrategy().(type) {
+	case schema.UnionRepresentation_Keyed:
+		return fmt.Sprintf("%q", stg.GetDiscriminant(member))
+	case schema.UnionRepresentation_Stringprefix:
+		return fmt.Sprintf("%q", stg.GetDiscriminant(member))
+	case schema.UnionRepresentation_Kinded:
+		return member.RepresentationBehavior().String()
+	default:
+		return ""
+	}
+}
+
+// unionMembersByDiscriminant returns the members of a union by their discriminants, or false if the union's representation doesn't have discriminants we know how to get.
+func unionMembersByDiscriminant(t *schema.TypeUnion) (map[string]schema.Type, bool) {
+	switch t.RepresentationStrategy().(type) {
+	case schema.UnionRepresentation_Keyed, schema.UnionRepresentation_Stringprefix, schema.UnionRepresentation_Kinded:
+	default:
+		return nil, false
+	}
+	result := map[string]schema.Type{}
+	for _, m := range t.Members() {
+		result[unionDiscriminant(t, m)] = m
+	}
+	return result, true
+}
+
+func dslImplicit(v schema.ImplicitValue) string {
+	switch v := v.(type) {
+	case schema.ImplicitValue_String:
+		return fmt.Sprintf("%q", string(v))
+	case schema.ImplicitValue_EmptyList:
+		return "[]"
+	case schema.ImplicitValue_EmptyMap:
+		return "{}"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// fits returns true if all data that matches one type (from) also matches another (to).
+//
+// Types that refer to themselves (directly or not) are handled by assuming they fit while the check is in progress.
+func (c *compatChecker) fits(from, to schema.Type) bool {
+	key := [2]schema.Type{from, to}
+	if v, ok := c.fitsMemo[key]; ok {
+		return v
+	}
+	c.fitsMemo[key] = true
+	v := c.fits0(from, to)
+	c.fitsMemo[key] = v
+	return v
+}
+
+func (c *compatChecker) fits0(from, to schema.Type) bool {
+	if _, ok := to.(*schema.TypeAny); ok {
+		return true
+	}
+	if _, ok := from.(*schema.TypeAny); ok {
+		return false
+	}
+	// A kinded union's data is the data of one of its members; so if each of them fits, so does the union.
+	if fromU, ok := from.(*schema.TypeUnion); ok {
+		if _, ok := fromU.RepresentationStrategy().(schema.UnionRepresentation_Kinded); ok {
+			if toU, ok := to.(*schema.TypeUnion); !ok || !isKindedUnion(toU) {
+				for _, m := range fromU.Members() {
+					if !c.fits(m, to) {
+						return false
+					}
+				}
+				return true
+			}
+		}
+	}
+
+	switch to := to.(type) {
+	case *schema.TypeBool, *schema.TypeInt, *schema.TypeFloat, *schema.TypeString, *schema.TypeBytes:
+		return from.RepresentationBehavior() == to.RepresentationBehavior()
+	case *schema.TypeLink:
+		from, ok := from.(*schema.TypeLink)
+		if !ok {
+			return false
+		}
+		// Any link is data for any link type; but if both say what they link to, that had better fit too.
+		if from.HasReferencedType() && to.HasReferencedType() {
+			return c.fits(from.ReferencedType(), to.ReferencedType())
+		}
+		return true
+	case *schema.TypeList:
+		switch from := from.(type) {
+		case *schema.TypeList:
+			return c.fits(from.ValueType(), to.ValueType()) && (!from.ValueIsNullable() || to.ValueIsNullable())
+		case *schema.TypeStruct:
+			if _, ok := from.RepresentationStrategy().(schema.StructRepresentation_Tuple); !ok {
+				return false
+			}
+			for _, f := range from.Fields() {
+				if !c.fits(f.Type(), to.ValueType()) || (f.IsNullable() && !to.ValueIsNullable()) {
+					return false
+				}
+			}
+			return true
+		}
+		return false
+	case *schema.TypeMap:
+		switch from := from.(type) {
+		case *schema.TypeMap:
+			return c.fits(from.KeyType(), to.KeyType()) && c.fits(from.ValueType(), to.ValueType()) && (!from.ValueIsNullable() || to.ValueIsNullable())
+		case *schema.TypeStruct:
+			if _, ok := from.RepresentationStrategy().(schema.StructRepresentation_Map); !ok {
+				return false
+			}
+			if _, ok := to.KeyType().(*schema.TypeString); !ok {
+				return false
+			}
+			for _, f := range from.Fields() {
+				if !c.fits(f.Type(), to.ValueType()) || (f.IsNullable() && !to.ValueIsNullable()) {
+					return false
+				}
+			}
+			return true
+		}
+		return false
+	case *schema.TypeStruct:
+		from, ok := from.(*schema.TypeStruct)
+		return ok && c.structFits(from, to)
+	case *schema.TypeUnion:
+		return c.unionFits(from, to)
+	case *schema.TypeEnum:
+		from, ok := from.(*schema.TypeEnum)
+		if !ok || reflect.TypeOf(from.RepresentationStrategy()) != reflect.TypeOf(to.RepresentationStrategy()) {
+			return false
+		}
+		toValues := map[string]bool{}
+		for _, v := range enumValues(to) {
+			toValues[v] = true
+		}
+		for _, v := range enumValues(from) {
+			if !toValues[v] {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+func isKindedUnion(t *schema.TypeUnion) bool {
+	_, ok := t.RepresentationStrategy().(schema.UnionRepresentation_Kinded)
+	return ok
+}
+
+func (c *compatChecker) structFits(from, to *schema.TypeStruct) bool {
+	if reflect.TypeOf(from.RepresentationStrategy()) != reflect.TypeOf(to.RepresentationStrategy()) {
+		return false
+	}
+	switch toStg := to.RepresentationStrategy().(type) {
+	case schema.StructRepresentation_Map:
+		fromStg := from.RepresentationStrategy().(schema.StructRepresentation_Map)
+		toByKey := map[string]schema.StructField{}
+		for _, f := range to.Fields() {
+			toByKey[toStg.GetFieldKey(f)] = f
+		}
+		matched := map[string]bool{}
+		for _, f := range from.Fields() {
+			key := fromStg.GetFieldKey(f)
+			g, ok := toByKey[key]
+			if !ok {
+				return false // The key could be present, and wouldn't be accepted.
+			}
+			matched[key] = true
+			fromAbsent := f.IsOptional() || fromStg.FieldImplicit(f) != nil
+			toAbsent := g.IsOptional() || toStg.FieldImplicit(g) != nil
+			if !c.fits(f.Type(), g.Type()) || (f.IsNullable() && !g.IsNullable()) || (fromAbsent && !toAbsent) {
+				return false
+			}
+		}
+		for key, g := range toByKey {
+			if !matched[key] && !g.IsOptional() && toStg.FieldImplicit(g) == nil {
+				return false // The key would always be missing.
+			}
+		}
+		return true
+	case schema.StructRepresentation_Tuple, schema.StructRepresentation_Stringjoin:
+		if fromStg, ok := from.RepresentationStrategy().(schema.StructRepresentation_Stringjoin); ok && fromStg.GetDelim() != toStg.(schema.StructRepresentation_Stringjoin).GetDelim() {
+			return false
+		}
+		fromFields, toFields := from.Fields(), to.Fields()
+		if len(fromFields) > len(toFields) {
+			return false
+		}
+		for i, g := range toFields {
+			if i >= len(fromFields) {
+				if !g.IsOptional() {
+					return false
+				}
+				continue
+			}
+			f := fromFields[i]
+			if !c.fits(f.Type(), g.Type()) || (f.IsNullable() && !g.IsNullable()) || (f.IsOptional() && !g.IsOptional()) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(from.RepresentationStrategy(), toStg) && reflect.DeepEqual(from.Fields(), to.Fields())
+	}
+}
+
+func (c *compatChecker) unionFits(from schema.Type, to *schema.TypeUnion) bool {
+	toMembers, ok := unionMembersByDiscriminant(to)
+	if !ok {
+		return from.Name() == to.Name() && reflect.DeepEqual(from, to)
+	}
+	if isKindedUnion(to) {
+		// Data of any type fits a kinded union, if there's a member for its kind, and it fits that.
+		if fromU, ok := from.(*schema.TypeUnion); ok && isKindedUnion(fromU) {
+			for _, m := range fromU.Members() {
+				toM, ok := toMembers[m.RepresentationBehavior().String()]
+				if !ok || !c.fits(m, toM) {
+					return false
+				}
+			}
+			return true
+		}
+		toM, ok := toMembers[from.RepresentationBehavior().String()]
+		return ok && c.fits(from, toM)
+	}
+	fromU, ok := from.(*schema.TypeUnion)
+	if !ok || reflect.TypeOf(fromU.RepresentationStrategy()) != reflect.TypeOf(to.RepresentationStrategy()) {
+		return false
+	}
+	if fromStg, ok := fromU.RepresentationStrategy().(schema.UnionRepresentation_Stringprefix); ok && fromStg.GetDelim() != to.RepresentationStrategy().(schema.UnionRepresentation_Stringprefix).GetDelim() {
+		return false
+	}
+	for _, m := range fromU.Members() {
+		toM, ok := toMembers[unionDiscriminant(fromU, m)]
+		if !ok || !c.fits(m, toM) {
+			return false
+		}
+	}
+	return true
+}
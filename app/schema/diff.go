@@ -0,0 +1,126 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is how many unchanged lines are shown around each change in a unified diff.
+const diffContext = 3
+
+// unifiedDiff returns a unified diff (in the style of `diff -u`) between two texts, or "" if they're the same.
+//
+// It finds the longest common subsequence of lines, so it takes time proportional to the product of the lengths of the texts;
+// that's fine for generated code, but not something to use on huge files.
+func unifiedDiff(oldName, newName string, oldText, newText []byte) string {
+	a, b := splitLines(string(oldText)), splitLines(string(newText))
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	// Walk it to get the edits: ' ' for a line in both, '-' for a line only in a, '+' for one only in b.
+	type edit struct {
+		op   byte
+		line string
+		i, j int // The line numbers in a and b (zero-based) that this edit is at.
+	}
+	var edits []edit
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i], i, j})
+			i, j = i+1, j+1
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{'-', a[i], i, j})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j], i, j})
+			j++
+		}
+	}
+
+	// Group the edits into hunks: runs of changes, with context around them, merged where they'd overlap.
+	var sb strings.Builder
+	for start := 0; start < len(edits); {
+		if edits[start].op == ' ' {
+			start++
+			continue
+		}
+		lo := start - diffContext
+		if lo < 0 {
+			lo = 0
+		}
+		hi := start
+		for unchanged := 0; hi < len(edits) && unchanged <= 2*diffContext; hi++ {
+			if edits[hi].op == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		// hi is now just past too many unchanged lines (or at the end); trim it back to the context after the last change.
+		for hi > lo && edits[hi-1].op == ' ' {
+			hi--
+		}
+		changesEnd := hi
+		if hi += diffContext; hi > len(edits) {
+			hi = len(edits)
+		}
+
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+		}
+		oldCount, newCount := 0, 0
+		for _, e := range edits[lo:hi] {
+			if e.op != '+' {
+				oldCount++
+			}
+			if e.op != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(edits[lo].i, oldCount), hunkRange(edits[lo].j, newCount))
+		for _, e := range edits[lo:hi] {
+			sb.WriteByte(e.op)
+			sb.WriteString(e.line)
+			sb.WriteByte('\n')
+		}
+		start = changesEnd
+	}
+	return sb.String()
+}
+
+// hunkRange formats the start and length of one side of a hunk, the way diff does:
+// line numbers start at one, and an empty range is given as the line before it.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// splitLines splits text into lines, without their line breaks.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
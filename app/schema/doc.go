@@ -0,0 +1,625 @@
+package schema
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/schema"
+	schemadmt "github.com/ipld/go-ipld-prime/schema/dmt"
+
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+// DocConfig holds the options for RenderDoc.
+type DocConfig struct {
+	// Format is either "markdown" or "html".
+	Format string
+
+	// Title is the heading for the whole document.  If empty, "Schema" is used.
+	Title string
+
+	// Source is the DSL document the schema came from, if any.
+	// Comments in it are carried through: comments above a type (or on its line) describe the type,
+	// and comments above a field or member (or on its line) describe that.
+	Source []byte
+}
+
+// RenderDoc writes human-readable documentation for a schema.
+//
+// There's a section for each type (in the order the DMT declares them), saying what kind of type it is,
+// how it's represented, what fields or members it has, which other types refer to it, and an example of its data in dag-json.
+// Types are cross-linked wherever they're mentioned.
+// (Types from the prelude, and types that were defined inline, don't get sections of their own.)
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- if the format isn't known.
+func RenderDoc(w io.Writer, dmt *schemadmt.Schema, ts *schema.TypeSystem, cfg DocConfig) error {
+	title := cfg.Title
+	if title == "" {
+		title = "Schema"
+	}
+	var comments *dslComments
+	if cfg.Source != nil {
+		comments = scanDSLComments(cfg.Source)
+	}
+	d := &docGen{comments: comments, referencedBy: map[schema.TypeName][]string{}}
+	for _, name := range dmt.Types.Keys {
+		for _, ref := range d.typeRefs(ts.TypeByName(name)) {
+			if !containsString(d.referencedBy[ref], name) {
+				d.referencedBy[ref] = append(d.referencedBy[ref], name)
+			}
+		}
+	}
+	page := docPage{Title: title}
+	for _, name := range dmt.Types.Keys {
+		page.Types = append(page.Types, d.typeDoc(ts.TypeByName(name)))
+	}
+
+	switch cfg.Format {
+	case "markdown":
+		return docMarkdownTemplate.Execute(w, page)
+	case "html":
+		return docHTMLTemplate.Execute(w, page)
+	default:
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "format argument not recognized: %q is not a supported format (supported: markdown, html)", cfg.Format)
+	}
+}
+
+type docPage struct {
+	Title string
+	Types []docType
+}
+
+type docType struct {
+	Name         string
+	Description  []string // Paragraphs.
+	Article      string   // "A" or "An", for the kind.
+	Kind         string
+	Repr         string
+	Definition   docRef // For types that don't have fields or members: what they are, in DSL terms.
+	Fields       []docField
+	Members      []docMember
+	ReferencedBy []docRef
+	Example      string // In dag-json.  Empty if there's no way to make one.
+}
+
+type docField struct {
+	Name        string
+	Type        docRef
+	Modifiers   string // "optional", "nullable", or both.
+	Notes       string // Representation details, like renames and implicits.
+	Description string
+}
+
+type docMember struct {
+	Name         docRef
+	Discriminant string
+	Description  string
+}
+
+// docRef is some text that mentions types, split up so the mentions can be made into links.
+type docRef []docRefPart
+
+type docRefPart struct {
+	Text   string
+	Anchor string // If this part is the name of a type with a section, the anchor of that section.
+}
+
+// docAnchor returns the anchor for a type's section: its name, lowercased, which is also what markdown renderers do with headings.
+func docAnchor(name string) string {
+	return strings.ToLower(name)
+}
+
+type docGen struct {
+	comments     *dslComments
+	referencedBy map[schema.TypeName][]string
+	exampleStack map[schema.TypeName]bool
+}
+
+func (d *docGen) typeDoc(t schema.Type) docType {
+	name := string(t.Name())
+	doc := docType{
+		Name:        name,
+		Description: d.description(name),
+		Article:     "A",
+		Kind:        strings.ToLower(t.TypeKind().String()),
+		Repr:        strings.ToLower(t.TypeKind().String()),
+	}
+	// The article goes by how the kind sounds, not how it's spelt ("a union", not "an union"), so the kinds that take "an" are just listed.
+	switch t.TypeKind() {
+	case schema.TypeKind_Int, schema.TypeKind_Enum, schema.TypeKind_Any:
+		doc.Article = "An"
+	}
+	switch t := t.(type) {
+	case *schema.TypeStruct:
+		doc.Repr = reprStrategyName(t.RepresentationStrategy())
+		switch stg := t.RepresentationStrategy().(type) {
+		case schema.StructRepresentation_Stringjoin:
+			doc.Repr += " (joined with " + strconv.Quote(stg.GetDelim()) + ")"
+		}
+		for _, f := range t.Fields() {
+			doc.Fields = append(doc.Fields, d.fieldDoc(t, f))
+		}
+	case *schema.TypeUnion:
+		doc.Repr = reprStrategyName(t.RepresentationStrategy())
+		switch stg := t.RepresentationStrategy().(type) {
+		case schema.UnionRepresentation_Stringprefix:
+			doc.Repr += " (prefixes end with " + strconv.Quote(stg.GetDelim()) + ")"
+		}
+		for _, m := range t.Members() {
+			doc.Members = append(doc.Members, docMember{
+				Name:         d.ref(m),
+				Discriminant: unionDiscriminant(t, m),
+				Description:  d.inlineDescription(name + "|" + string(m.Name())),
+			})
+		}
+	case *schema.TypeEnum:
+		doc.Repr = reprStrategyName(t.RepresentationStrategy())
+		values := enumValues(t)
+		for _, m := range t.Members() {
+			doc.Members = append(doc.Members, docMember{
+				Name:         docRef{{Text: m}},
+				Discriminant: values[m],
+				Description:  d.inlineDescription(name + "|" + m),
+			})
+		}
+	case *schema.TypeMap:
+		doc.Definition = d.inlineRef(t)
+	case *schema.TypeList:
+		doc.Definition = d.inlineRef(t)
+	case *schema.TypeLink:
+		doc.Definition = d.inlineRef(t)
+	}
+	for _, by := range d.referencedBy[t.Name()] {
+		doc.ReferencedBy = append(doc.ReferencedBy, docRef{{Text: by, Anchor: docAnchor(by)}})
+	}
+
+	d.exampleStack = map[schema.TypeName]bool{}
+	if n, ok := d.example(t, name); ok {
+		var buf bytes.Buffer
+		if err := dagjson.Encode(n, &buf); err == nil {
+			doc.Example = buf.String()
+		}
+	}
+	return doc
+}
+
+func (d *docGen) fieldDoc(t *schema.TypeStruct, f schema.StructField) docField {
+	doc := docField{
+		Name:        f.Name(),
+		Type:        d.ref(f.Type()),
+		Description: d.inlineDescription(string(t.Name()) + "." + f.Name()),
+	}
+	var modifiers []string
+	if f.IsOptional() {
+		modifiers = append(modifiers, "optional")
+	}
+	if f.IsNullable() {
+		modifiers = append(modifiers, "nullable")
+	}
+	doc.Modifiers = strings.Join(modifiers, " ")
+	if stg, ok := t.RepresentationStrategy().(schema.StructRepresentation_Map); ok {
+		var notes []string
+		if stg.FieldHasRename(f) {
+			notes = append(notes, "key "+strconv.Quote(stg.GetFieldKey(f)))
+		}
+		if implicit := stg.FieldImplicit(f); implicit != nil {
+			notes = append(notes, "implicit "+dslImplicit(implicit))
+		}
+		doc.Notes = strings.Join(notes, ", ")
+	}
+	return doc
+}
+
+// description returns the paragraphs of the comments for an anchor (see dslComments): the ones above it, then the one on its line.
+func (d *docGen) description(anchor string) []string {
+	if d.comments == nil {
+		return nil
+	}
+	lines := append([]string{}, d.comments.before[anchor]...)
+	if trailing, ok := d.comments.trailing[anchor]; ok {
+		lines = append(lines, trailing)
+	}
+	var paragraphs []string
+	var current []string
+	for _, l := range append(lines, "") {
+		text := strings.TrimSpace(strings.TrimPrefix(l, "#"))
+		if text != "" {
+			current = append(current, text)
+			continue
+		}
+		if len(current) > 0 {
+			paragraphs = append(paragraphs, strings.Join(current, " "))
+			current = nil
+		}
+	}
+	return paragraphs
+}
+
+// inlineDescription is description, all on one line (for table cells).
+func (d *docGen) inlineDescription(anchor string) string {
+	return strings.Join(d.description(anchor), " ")
+}
+
+// ref describes a reference to a type: its name, or if it's an inline type, what it'd look like in the DSL.
+func (d *docGen) ref(t schema.Type) docRef {
+	if isInlineTypeName(string(t.Name())) {
+		return d.inlineRef(t)
+	}
+	if IsPreludeType(t) {
+		return docRef{{Text: string(t.Name())}}
+	}
+	return docRef{{Text: string(t.Name()), Anchor: docAnchor(string(t.Name()))}}
+}
+
+// inlineRef describes a map, list, or link type the way the DSL would write it.
+func (d *docGen) inlineRef(t schema.Type) docRef {
+	nullable := func(b bool) string {
+		if b {
+			return "nullable "
+		}
+		return ""
+	}
+	switch t := t.(type) {
+	case *schema.TypeMap:
+		r := docRef{{Text: "{"}}
+		r = append(r, d.ref(t.KeyType())...)
+		r = append(r, docRefPart{Text: ":" + nullable(t.ValueIsNullable())})
+		r = append(r, d.ref(t.ValueType())...)
+		return append(r, docRefPart{Text: "}"})
+	case *schema.TypeList:
+		r := docRef{{Text: "[" + nullable(t.ValueIsNullable())}}
+		r = append(r, d.ref(t.ValueType())...)
+		return append(r, docRefPart{Text: "]"})
+	case *schema.TypeLink:
+		if !t.HasReferencedType() {
+			return docRef{{Text: "&Any"}}
+		}
+		return append(docRef{{Text: "&"}}, d.ref(t.ReferencedType())...)
+	default:
+		return d.ref(t)
+	}
+}
+
+// typeRefs returns the names of the types (with sections of their own) that a type refers to.  Inline types are looked through.
+func (d *docGen) typeRefs(t schema.Type) []schema.TypeName {
+	var direct []schema.Type
+	switch t := t.(type) {
+	case *schema.TypeStruct:
+		for _, f := range t.Fields() {
+			direct = append(direct, f.Type())
+		}
+	case *schema.TypeUnion:
+		direct = append(direct, t.Members()...)
+	case *schema.TypeMap:
+		direct = append(direct, t.KeyType(), t.ValueType())
+	case *schema.TypeList:
+		direct = append(direct, t.ValueType())
+	case *schema.TypeLink:
+		if t.HasReferencedType() {
+			direct = append(direct, t.ReferencedType())
+		}
+	}
+	var result []schema.TypeName
+	for _, r := range direct {
+		switch {
+		case IsPreludeType(r):
+		case isInlineTypeName(string(r.Name())):
+			result = append(result, d.typeRefs(r)...)
+		default:
+			result = append(result, r.Name())
+		}
+	}
+	return result
+}
+
+// docExampleLink is the link used in examples: the identity CID of an empty raw block.
+var docExampleLink = func() datamodel.Link {
+	c, err := cid.Decode("bafkqaaa")
+	if err != nil {
+		panic(err)
+	}
+	return cidlink.Link{Cid: c}
+}()
+
+// example makes some data that matches a type (in its representation).
+// Strings are filled in with the hint, which is the name of whatever the string is for.
+// It returns false if there's no way to make an example, which can happen for types that have to contain themselves.
+func (d *docGen) example(t schema.Type, hint string) (datamodel.Node, bool) {
+	if d.exampleStack[t.Name()] {
+		return nil, false
+	}
+	d.exampleStack[t.Name()] = true
+	defer delete(d.exampleStack, t.Name())
+
+	switch t := t.(type) {
+	case *schema.TypeBool:
+		return basicnode.NewBool(true), true
+	case *schema.TypeInt:
+		return basicnode.NewInt(0), true
+	case *schema.TypeFloat:
+		return basicnode.NewFloat(0.5), true
+	case *schema.TypeString:
+		return basicnode.NewString(hint), true
+	case *schema.TypeBytes:
+		return basicnode.NewBytes([]byte(hint)), true
+	case *schema.TypeLink:
+		return basicnode.NewLink(docExampleLink), true
+	case *schema.TypeAny:
+		return datamodel.Null, true
+	case *schema.TypeEnum:
+		members := t.Members()
+		switch stg := t.RepresentationStrategy().(type) {
+		case schema.EnumRepresentation_Int:
+			return basicnode.NewInt(int64(stg[members[0]])), true
+		case schema.EnumRepresentation_String:
+			if s, ok := stg[members[0]]; ok {
+				return basicnode.NewString(s), true
+			}
+		}
+		return basicnode.NewString(members[0]), true
+	case *schema.TypeList:
+		value, ok := d.example(t.ValueType(), hint)
+		return d.build(qp.List(-1, func(la datamodel.ListAssembler) {
+			if ok {
+				qp.ListEntry(la, qp.Node(value))
+			}
+		}))
+	case *schema.TypeMap:
+		// Keys are always strings in the representation, so the key type's example will be one.
+		key, ok1 := d.example(t.KeyType(), "key")
+		value, ok2 := d.example(t.ValueType(), "value")
+		return d.build(qp.Map(-1, func(ma datamodel.MapAssembler) {
+			if ok1 && ok2 {
+				keyStr, _ := key.AsString()
+				qp.MapEntry(ma, keyStr, qp.Node(value))
+			}
+		}))
+	case *schema.TypeStruct:
+		return d.structExample(t)
+	case *schema.TypeUnion:
+		return d.unionExample(t, hint)
+	default:
+		return nil, false
+	}
+}
+
+func (d *docGen) structExample(t *schema.TypeStruct) (datamodel.Node, bool) {
+	// Work out the fields first; then each strategy arranges them.
+	type entry struct {
+		key   string
+		value datamodel.Node
+	}
+	var entries []entry
+	for _, f := range t.Fields() {
+		value, ok := d.example(f.Type(), f.Name())
+		switch {
+		case ok:
+		case f.IsNullable():
+			value = datamodel.Null
+		case f.IsOptional():
+			continue
+		default:
+			return nil, false
+		}
+		key := f.Name()
+		if stg, ok := t.RepresentationStrategy().(schema.StructRepresentation_Map); ok {
+			key = stg.GetFieldKey(f)
+		}
+		entries = append(entries, entry{key, value})
+	}
+	switch stg := t.RepresentationStrategy().(type) {
+	case schema.StructRepresentation_Map:
+		return d.build(qp.Map(int64(len(entries)), func(ma datamodel.MapAssembler) {
+			for _, e := range entries {
+				qp.MapEntry(ma, e.key, qp.Node(e.value))
+			}
+		}))
+	case schema.StructRepresentation_Tuple:
+		return d.build(qp.List(int64(len(entries)), func(la datamodel.ListAssembler) {
+			for _, e := range entries {
+				qp.ListEntry(la, qp.Node(e.value))
+			}
+		}))
+	case schema.StructRepresentation_Stringjoin:
+		var parts []string
+		for _, e := range entries {
+			s, err := e.value.AsString()
+			if err != nil {
+				return nil, false
+			}
+			parts = append(parts, s)
+		}
+		return basicnode.NewString(strings.Join(parts, stg.GetDelim())), true
+	default:
+		return nil, false
+	}
+}
+
+func (d *docGen) unionExample(t *schema.TypeUnion, hint string) (datamodel.Node, bool) {
+	// The first member that can have an example is used.
+	for _, m := range t.Members() {
+		value, ok := d.example(m, hint)
+		if !ok {
+			continue
+		}
+		switch stg := t.RepresentationStrategy().(type) {
+		case schema.UnionRepresentation_Kinded:
+			return value, true
+		case schema.UnionRepresentation_Keyed:
+			return d.build(qp.Map(1, func(ma datamodel.MapAssembler) {
+				qp.MapEntry(ma, stg.GetDiscriminant(m), qp.Node(value))
+			}))
+		case schema.UnionRepresentation_Stringprefix:
+			s, err := value.AsString()
+			if err != nil {
+				return nil, false
+			}
+			return basicnode.NewString(stg.GetDiscriminant(m) + stg.GetDelim() + s), true
+		default:
+			return nil, false // Other strategies don't say enough (through the schema package) to make data for them.
+		}
+	}
+	return nil, false
+}
+
+// build assembles a node; it's always possible, but returns true too, so example can return it directly.
+func (d *docGen) build(a qp.Assemble) (datamodel.Node, bool) {
+	nb := basicnode.Prototype.Any.NewBuilder()
+	a(nb)
+	return nb.Build(), true
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+var docTemplateFuncs = template.FuncMap{
+	"mdref": func(r docRef) string {
+		var sb strings.Builder
+		for _, p := range r {
+			text := strings.NewReplacer("|", `\|`, "[", `\[`, "]", `\]`, "*", `\*`, "_", `\_`).Replace(p.Text)
+			if p.Anchor != "" {
+				sb.WriteString("[" + text + "](#" + p.Anchor + ")")
+			} else {
+				sb.WriteString(text)
+			}
+		}
+		return sb.String()
+	},
+	"mdcell": func(s string) string {
+		return strings.ReplaceAll(s, "|", `\|`)
+	},
+	"anchor": docAnchor,
+}
+
+var docMarkdownTemplate = template.Must(template.New("markdown").Funcs(docTemplateFuncs).Parse(`# {{.Title}}
+{{range .Types}}
+- [{{.Name}}](#{{anchor .Name}}){{end}}
+{{range .Types}}
+## {{.Name}}
+{{range .Description}}
+{{.}}
+{{end}}
+{{.Article}} **{{.Kind}}**{{if ne .Kind .Repr}}, represented as **{{.Repr}}**{{end}}.
+{{- if .Definition}}
+
+Definition: {{mdref .Definition}}
+{{- end}}
+{{- if .Fields}}
+
+| Field | Type | Representation | Description |
+|-------|------|----------------|-------------|
+{{- range .Fields}}
+| {{.Name}} | {{if .Modifiers}}{{.Modifiers}} {{end}}{{mdref .Type}} | {{mdcell .Notes}} | {{mdcell .Description}} |
+{{- end}}
+{{- end}}
+{{- if .Members}}
+
+| Member | Representation | Description |
+|--------|----------------|-------------|
+{{- range .Members}}
+| {{mdref .Name}} | {{mdcell .Discriminant}} | {{mdcell .Description}} |
+{{- end}}
+{{- end}}
+{{- if .ReferencedBy}}
+
+Referenced by: {{range $i, $r := .ReferencedBy}}{{if $i}}, {{end}}{{mdref $r}}{{end}}
+{{- end}}
+{{- if .Example}}
+
+Example (dag-json):
+
+` + "```json" + `
+{{.Example}}
+` + "```" + `
+{{- end}}
+{{end}}`))
+
+var docHTMLTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(htmltemplate.FuncMap{
+	"ref": func(r docRef) htmltemplate.HTML {
+		var sb strings.Builder
+		for _, p := range r {
+			text := htmltemplate.HTMLEscapeString(p.Text)
+			if p.Anchor != "" {
+				sb.WriteString(`<a href="#` + htmltemplate.HTMLEscapeString(p.Anchor) + `">` + text + `</a>`)
+			} else {
+				sb.WriteString(text)
+			}
+		}
+		return htmltemplate.HTML(sb.String())
+	},
+	"anchor": docAnchor,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: auto; padding: 1em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+pre { background: #f4f4f4; padding: 0.6em; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<ul>
+{{- range .Types}}
+<li><a href="#{{anchor .Name}}">{{.Name}}</a></li>
+{{- end}}
+</ul>
+{{- range .Types}}
+<section id="{{anchor .Name}}">
+<h2>{{.Name}}</h2>
+{{- range .Description}}
+<p>{{.}}</p>
+{{- end}}
+<p>{{.Article}} <strong>{{.Kind}}</strong>{{if ne .Kind .Repr}}, represented as <strong>{{.Repr}}</strong>{{end}}.</p>
+{{- if .Definition}}
+<p>Definition: <code>{{ref .Definition}}</code></p>
+{{- end}}
+{{- if .Fields}}
+<table>
+<tr><th>Field</th><th>Type</th><th>Representation</th><th>Description</th></tr>
+{{- range .Fields}}
+<tr><td>{{.Name}}</td><td>{{if .Modifiers}}{{.Modifiers}} {{end}}{{ref .Type}}</td><td>{{.Notes}}</td><td>{{.Description}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .Members}}
+<table>
+<tr><th>Member</th><th>Representation</th><th>Description</th></tr>
+{{- range .Members}}
+<tr><td>{{ref .Name}}</td><td>{{.Discriminant}}</td><td>{{.Description}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .ReferencedBy}}
+<p>Referenced by: {{range $i, $r := .ReferencedBy}}{{if $i}}, {{end}}{{ref $r}}{{end}}</p>
+{{- end}}
+{{- if .Example}}
+<p>Example (dag-json):</p>
+<pre><code>{{.Example}}</code></pre>
+{{- end}}
+</section>
+{{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,588 @@
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	schemadmt "github.com/ipld/go-ipld-prime/schema/dmt"
+
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+// PrintDSL writes a schema DMT out in the schema DSL.
+//
+// Types are written in the order the DMT lists them, separated by blank lines.
+// Representation strategies are only written out when they're not the default for the kind of type (e.g. "representation map" is left implied for structs),
+// and renames and implicits are written alongside the fields they belong to.
+//
+// The DMT doesn't need to be valid (it isn't compiled), but it does need to be complete enough to say everything the DSL needs to say.
+//
+// Errors:
+//
+//   - schema-dsl-print-failed -- if the DMT contains something that can't be written in the DSL, or is missing something the DSL needs.
+func PrintDSL(w io.Writer, dmt *schemadmt.Schema) error {
+	p := &dslPrinter{}
+	if err := p.schema(dmt); err != nil {
+		return err
+	}
+	_, err := w.Write(p.Bytes())
+	return err
+}
+
+// FormatDSL parses a schema DSL document, and writes it back out the way PrintDSL would.
+//
+// Comments are kept.  Each one stays attached to the declaration (type, field, or member) it was written above or alongside;
+// comments in places that don't belong to a declaration (like inside a representation block) are moved to just after the type they were in.
+//
+// Errors:
+//
+//   - schema-dsl-parse-failed -- if the DSL document didn't parse.
+//   - schema-dsl-print-failed -- if the parsed schema can't be written back out.
+func FormatDSL(inputName string, src []byte) ([]byte, error) {
+	dmt, err := DSLParse(inputName, bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	p := &dslPrinter{comments: scanDSLComments(src)}
+	if err := p.schema(dmt); err != nil {
+		return nil, err
+	}
+	return p.Bytes(), nil
+}
+
+type dslPrinter struct {
+	codeBuf
+	comments *dslComments // Comments to put back in, if formatting a document.  May be nil.
+}
+
+func (p *dslPrinter) schema(dmt *schemadmt.Schema) error {
+	for i, name := range dmt.Types.Keys {
+		if i > 0 {
+			p.line("")
+		}
+		p.commentsBefore(name, "")
+		if err := p.typeDefn(name, dmt.Types.Values[name]); err != nil {
+			return err
+		}
+		p.commentsBefore(name+"~", "")
+	}
+	// Anything not printed yet goes at the end, so that nothing is lost.
+	for _, anchor := range p.comments.unused() {
+		if p.Len() > 0 {
+			p.line("")
+		}
+		p.commentsBefore(anchor, "")
+		if c := p.trailing(anchor); c != "" {
+			p.line("%s", c[1:])
+		}
+	}
+	return nil
+}
+
+func (p *dslPrinter) typeDefn(name string, defn schemadmt.TypeDefn) error {
+	switch {
+	case defn.TypeDefnBool != nil:
+		p.line("type %s bool%s", name, p.trailing(name))
+	case defn.TypeDefnString != nil:
+		p.line("type %s string%s", name, p.trailing(name))
+	case defn.TypeDefnBytes != nil:
+		p.line("type %s bytes%s", name, p.trailing(name))
+	case defn.TypeDefnInt != nil:
+		p.line("type %s int%s", name, p.trailing(name))
+	case defn.TypeDefnFloat != nil:
+		p.line("type %s float%s", name, p.trailing(name))
+	case defn.TypeDefnAny != nil:
+		p.line("type %s any%s", name, p.trailing(name))
+	case defn.TypeDefnLink != nil:
+		p.line("type %s %s%s", name, dslLink(defn.TypeDefnLink), p.trailing(name))
+	case defn.TypeDefnCopy != nil:
+		p.line("type %s = %s%s", name, defn.TypeDefnCopy.FromType, p.trailing(name))
+	case defn.TypeDefnUnit != nil:
+		p.line("type %s unit representation %s%s", name, defn.TypeDefnUnit.Representation, p.trailing(name))
+	case defn.TypeDefnMap != nil:
+		return p.mapDefn(name, defn.TypeDefnMap)
+	case defn.TypeDefnList != nil:
+		p.line("type %s %s%s", name, dslList(defn.TypeDefnList), p.trailing(name))
+	case defn.TypeDefnStruct != nil:
+		return p.structDefn(name, defn.TypeDefnStruct)
+	case defn.TypeDefnEnum != nil:
+		return p.enumDefn(name, defn.TypeDefnEnum)
+	case defn.TypeDefnUnion != nil:
+		return p.unionDefn(name, defn.TypeDefnUnion)
+	default:
+		return ipldtoolerr.Newf(ErrCode_DSLPrintFailed, "type %s has no definition", name)
+	}
+	return nil
+}
+
+func (p *dslPrinter) mapDefn(name string, defn *schemadmt.TypeDefnMap) error {
+	switch repr := defn.Representation; {
+	case repr == nil || repr.MapRepresentation_Map != nil:
+		p.line("type %s %s%s", name, dslMap(defn), p.trailing(name))
+	case repr.MapRepresentation_Listpairs != nil:
+		p.line("type %s %s representation listpairs%s", name, dslMap(defn), p.trailing(name))
+	case repr.MapRepresentation_Stringpairs != nil:
+		p.line("type %s %s representation stringpairs {%s", name, dslMap(defn), p.trailing(name))
+		p.line("\tinnerDelim %s", strconv.Quote(repr.MapRepresentation_Stringpairs.InnerDelim))
+		p.line("\tentryDelim %s", strconv.Quote(repr.MapRepresentation_Stringpairs.EntryDelim))
+		p.line("}")
+	default:
+		return ipldtoolerr.Newf(ErrCode_DSLPrintFailed, "map %s has no representation strategy", name)
+	}
+	return nil
+}
+
+func (p *dslPrinter) structDefn(name string, defn *schemadmt.TypeDefnStruct) error {
+	// Renames and implicits are written with the fields, so gather them up first.
+	var details map[string]schemadmt.StructRepresentation_Map_FieldDetails
+	if repr := defn.Representation.StructRepresentation_Map; repr != nil && repr.Fields != nil {
+		details = repr.Fields.Values
+	}
+
+	if len(defn.Fields.Keys) == 0 && !p.comments.has(name+"}") {
+		p.line("type %s struct {}%s%s", name, p.reprSuffix(name, dslStructRepr(defn.Representation)), p.trailing(name))
+		p.structReprBlock(defn.Representation)
+		return nil
+	}
+	p.line("type %s struct {%s", name, p.trailing(name))
+	for _, fieldName := range defn.Fields.Keys {
+		field := defn.Fields.Values[fieldName]
+		var sb strings.Builder
+		sb.WriteString(fieldName)
+		if field.Optional != nil && *field.Optional {
+			sb.WriteString(" optional")
+		}
+		if field.Nullable != nil && *field.Nullable {
+			sb.WriteString(" nullable")
+		}
+		sb.WriteString(" ")
+		sb.WriteString(dslTypeRef(field.Type))
+		if d, ok := details[fieldName]; ok && (d.Rename != nil || d.Implicit != nil) {
+			var parts []string
+			if d.Rename != nil {
+				parts = append(parts, "rename "+strconv.Quote(*d.Rename))
+			}
+			if d.Implicit != nil {
+				lit, err := dslScalar(d.Implicit)
+				if err != nil {
+					return ipldtoolerr.Newf(ErrCode_DSLPrintFailed, "struct %s: field %s: %s", name, fieldName, err)
+				}
+				parts = append(parts, "implicit "+lit)
+			}
+			sb.WriteString(" (" + strings.Join(parts, " ") + ")")
+		}
+		anchor := name + "." + fieldName
+		p.commentsBefore(anchor, "\t")
+		p.line("\t%s%s", sb.String(), p.trailing(anchor))
+	}
+	p.commentsBefore(name+"}", "\t")
+	p.line("}%s", p.reprSuffix(name, dslStructRepr(defn.Representation)))
+	p.structReprBlock(defn.Representation)
+	return nil
+}
+
+// dslStructRepr returns what goes after "representation" for a struct, or "" if it's the default.
+// Strategies with parameters end with " {", and their parameters are written by structReprBlock.
+func dslStructRepr(repr schemadmt.StructRepresentation) string {
+	switch {
+	case repr.StructRepresentation_Tuple != nil && repr.StructRepresentation_Tuple.FieldOrder != nil:
+		return "tuple {"
+	case repr.StructRepresentation_Tuple != nil:
+		return "tuple"
+	case repr.StructRepresentation_Stringpairs != nil:
+		return "stringpairs {"
+	case repr.StructRepresentation_Stringjoin != nil:
+		return "stringjoin {"
+	case repr.StructRepresentation_Listpairs != nil:
+		return "listpairs"
+	default:
+		return ""
+	}
+}
+
+func (p *dslPrinter) structReprBlock(repr schemadmt.StructRepresentation) {
+	switch {
+	case repr.StructRepresentation_Tuple != nil && repr.StructRepresentation_Tuple.FieldOrder != nil:
+		p.line("\tfieldOrder %s", dslStringList(*repr.StructRepresentation_Tuple.FieldOrder))
+		p.line("}")
+	case repr.StructRepresentation_Stringpairs != nil:
+		p.line("\tinnerDelim %s", strconv.Quote(repr.StructRepresentation_Stringpairs.InnerDelim))
+		p.line("\tentryDelim %s", strconv.Quote(repr.StructRepresentation_Stringpairs.EntryDelim))
+		p.line("}")
+	case repr.StructRepresentation_Stringjoin != nil:
+		p.line("\tjoin %s", strconv.Quote(repr.StructRepresentation_Stringjoin.Join))
+		if fo := repr.StructRepresentation_Stringjoin.FieldOrder; fo != nil {
+			p.line("\tfieldOrder %s", dslStringList(*fo))
+		}
+		p.line("}")
+	}
+}
+
+func (p *dslPrinter) enumDefn(name string, defn *schemadmt.TypeDefnEnum) error {
+	p.line("type %s enum {%s", name, p.trailing(name))
+	repr := defn.Representation
+	for _, member := range defn.Members {
+		value := ""
+		switch {
+		case repr.EnumRepresentation_Int != nil:
+			i, ok := repr.EnumRepresentation_Int.Values[member]
+			if !ok {
+				return ipldtoolerr.Newf(ErrCode_DSLPrintFailed, "enum %s: member %s has no int value in the representation", name, member)
+			}
+			value = fmt.Sprintf(" (%q)", strconv.Itoa(i))
+		case repr.EnumRepresentation_String != nil:
+			if s, ok := repr.EnumRepresentation_String.Values[member]; ok && s != member {
+				value = fmt.Sprintf(" (%s)", strconv.Quote(s))
+			}
+		}
+		anchor := name + "|" + member
+		p.commentsBefore(anchor, "\t")
+		p.line("\t| %s%s%s", member, value, p.trailing(anchor))
+	}
+	p.commentsBefore(name+"}", "\t")
+	reprName := ""
+	if repr.EnumRepresentation_Int != nil {
+		reprName = "int"
+	}
+	p.line("}%s", p.reprSuffix(name, reprName))
+	return nil
+}
+
+func (p *dslPrinter) unionDefn(name string, defn *schemadmt.TypeDefnUnion) error {
+	// Work out the strategy, and what to write after each member (which is found by looking the member up in the representation).
+	var reprName string
+	keys := map[string]string{} // Member (as written) to what's written after it.
+	addKeys := func(table map[string]schemadmt.UnionMember, quote bool) {
+		for k, m := range table {
+			if quote {
+				k = strconv.Quote(k)
+			}
+			keys[dslUnionMember(m)] = k
+		}
+	}
+	addNameKeys := func(table map[string]string) {
+		for k, m := range table {
+			keys[m] = strconv.Quote(k)
+		}
+	}
+	var block []string
+	repr := defn.Representation
+	switch {
+	case repr.UnionRepresentation_Kinded != nil:
+		reprName = "kinded"
+		addKeys(repr.UnionRepresentation_Kinded.Values, false)
+	case repr.UnionRepresentation_Keyed != nil:
+		reprName = "keyed"
+		addKeys(repr.UnionRepresentation_Keyed.Values, true)
+	case repr.UnionRepresentation_Inline != nil:
+		reprName = "inline {"
+		addNameKeys(repr.UnionRepresentation_Inline.DiscriminantTable.Values)
+		block = append(block, "discriminantKey "+strconv.Quote(repr.UnionRepresentation_Inline.DiscriminantKey))
+	case repr.UnionRepresentation_StringPrefix != nil:
+		reprName = "stringprefix"
+		addNameKeys(repr.UnionRepresentation_StringPrefix.Prefixes.Values)
+	case repr.UnionRepresentation_BytesPrefix != nil:
+		reprName = "bytesprefix"
+		addNameKeys(repr.UnionRepresentation_BytesPrefix.Prefixes.Values)
+	case repr.UnionRepresentation_Envelope != nil:
+		// The DMT's discriminant table for envelopes holds type definitions rather than member names, so there's no way to tell which member each discriminant is for.
+		return ipldtoolerr.Newf(ErrCode_DSLPrintFailed, "union %s: envelope representations can't be printed", name)
+	default:
+		return ipldtoolerr.Newf(ErrCode_DSLPrintFailed, "union %s has no representation strategy", name)
+	}
+
+	p.line("type %s union {%s", name, p.trailing(name))
+	for _, m := range defn.Members {
+		member := dslUnionMember(m)
+		key, ok := keys[member]
+		if !ok {
+			return ipldtoolerr.Newf(ErrCode_DSLPrintFailed, "union %s: member %s isn't in the representation", name, member)
+		}
+		anchor := name + "|" + member
+		p.commentsBefore(anchor, "\t")
+		p.line("\t| %s %s%s", member, key, p.trailing(anchor))
+	}
+	p.commentsBefore(name+"}", "\t")
+	p.line("}%s", p.reprSuffix(name, reprName))
+	if len(block) > 0 {
+		for _, l := range block {
+			p.line("\t%s", l)
+		}
+		p.line("}")
+	}
+	return nil
+}
+
+// reprSuffix returns the end of the line that closes a type: the representation strategy (if any), and any comment on that line.
+func (p *dslPrinter) reprSuffix(name string, reprName string) string {
+	s := ""
+	if reprName != "" {
+		s = " representation " + reprName
+	}
+	return s + p.trailing(name+"}")
+}
+
+func dslTypeRef(t schemadmt.TypeNameOrInlineDefn) string {
+	switch {
+	case t.TypeName != nil:
+		return *t.TypeName
+	case t.InlineDefn != nil && t.InlineDefn.TypeDefnMap != nil:
+		return dslMap(t.InlineDefn.TypeDefnMap)
+	case t.InlineDefn != nil && t.InlineDefn.TypeDefnList != nil:
+		return dslList(t.InlineDefn.TypeDefnList)
+	case t.InlineDefn != nil && t.InlineDefn.TypeDefnLink != nil:
+		return dslLink(t.InlineDefn.TypeDefnLink)
+	default:
+		return "Any"
+	}
+}
+
+func dslMap(defn *schemadmt.TypeDefnMap) string {
+	nullable := ""
+	if defn.ValueNullable != nil && *defn.ValueNullable {
+		nullable = "nullable "
+	}
+	return "{" + defn.KeyType + ":" + nullable + dslTypeRef(defn.ValueType) + "}"
+}
+
+func dslList(defn *schemadmt.TypeDefnList) string {
+	nullable := ""
+	if defn.ValueNullable != nil && *defn.ValueNullable {
+		nullable = "nullable "
+	}
+	return "[" + nullable + dslTypeRef(defn.ValueType) + "]"
+}
+
+func dslLink(defn *schemadmt.TypeDefnLink) string {
+	if defn.ExpectedType == nil {
+		return "link"
+	}
+	return "&" + *defn.ExpectedType
+}
+
+func dslUnionMember(m schemadmt.UnionMember) string {
+	switch {
+	case m.TypeName != nil:
+		return *m.TypeName
+	case m.UnionMemberInlineDefn != nil && m.UnionMemberInlineDefn.TypeDefnLink != nil:
+		return dslLink(m.UnionMemberInlineDefn.TypeDefnLink)
+	default:
+		return "Any"
+	}
+}
+
+func dslStringList(l []string) string {
+	quoted := make([]string, len(l))
+	for i, s := range l {
+		quoted[i] = strconv.Quote(s)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+func dslScalar(v *schemadmt.AnyScalar) (string, error) {
+	switch {
+	case v.String != nil:
+		return strconv.Quote(*v.String), nil
+	case v.Int != nil:
+		return strconv.Itoa(*v.Int), nil
+	case v.Bool != nil:
+		return strconv.FormatBool(*v.Bool), nil
+	case v.Float != nil:
+		return strconv.FormatFloat(*v.Float, 'g', -1, 64), nil
+	case v.Bytes != nil:
+		return "", fmt.Errorf("bytes can't be written as an implicit value in the DSL")
+	default:
+		return "", fmt.Errorf("implicit value is empty")
+	}
+}
+
+// dslComments holds the comments from a DSL document, keyed by the declarations they're attached to.
+// Comments are removed as they're printed.
+//
+// The keys ("anchors") are:
+// the type name, for a type's declaration line;
+// "Type.field", for a struct field;
+// "Type|Member", for a union or enum member;
+// "Type}", for the line that closes a type's body;
+// and "Type~", for comments from a type that didn't belong to any of those (these are printed after the type).
+// Comments after the last type are anchored at "".
+type dslComments struct {
+	order    []string            // Anchors, in the order their comments appeared.
+	before   map[string][]string // Whole-line comments above an anchor.  Blank lines between comments are kept as "".
+	trailing map[string]string   // The comment at the end of an anchor's line.
+}
+
+var (
+	dslTypeLine      = regexp.MustCompile(`^type\s+(\w+)`)
+	dslMemberLine    = regexp.MustCompile(`^\|\s*(&?\w+)`)
+	dslFieldLine     = regexp.MustCompile(`^(\w+)`)
+	dslRepresentWord = regexp.MustCompile(`\brepresentation\b`)
+)
+
+func scanDSLComments(src []byte) *dslComments {
+	c := &dslComments{
+		before:   map[string][]string{},
+		trailing: map[string]string{},
+	}
+	var pending []string
+	cur := ""
+	depth := 0
+	inRepr := false
+	for _, raw := range strings.Split(string(src), "\n") {
+		code, comment := splitDSLComment(raw)
+		code = strings.TrimSpace(code)
+		if code == "" {
+			switch {
+			case comment != "":
+				pending = append(pending, comment)
+			case len(pending) > 0 && pending[len(pending)-1] != "":
+				pending = append(pending, "")
+			}
+			continue
+		}
+
+		anchor := cur + "~"
+		if depth == 0 {
+			if m := dslTypeLine.FindStringSubmatch(code); m != nil {
+				cur = m[1]
+				anchor = cur
+				inRepr = dslRepresentWord.MatchString(code[len(m[0]):])
+			}
+		} else if depth == 1 && !inRepr {
+			if m := dslMemberLine.FindStringSubmatch(code); m != nil {
+				anchor = cur + "|" + m[1]
+			} else if strings.HasPrefix(code, "}") {
+				anchor = cur + "}"
+				inRepr = dslRepresentWord.MatchString(code)
+			} else if m := dslFieldLine.FindStringSubmatch(code); m != nil {
+				anchor = cur + "." + m[1]
+			}
+		}
+		if len(pending) > 0 {
+			c.add(anchor)
+			c.before[anchor] = append(c.before[anchor], pending...)
+			pending = nil
+		}
+		if comment != "" {
+			c.add(anchor)
+			if strings.HasSuffix(anchor, "~") {
+				c.before[anchor] = append(c.before[anchor], comment)
+			} else {
+				c.trailing[anchor] = comment
+			}
+		}
+		depth += dslBraceDelta(code)
+	}
+	for len(pending) > 0 && pending[len(pending)-1] == "" {
+		pending = pending[:len(pending)-1]
+	}
+	if len(pending) > 0 {
+		c.add("")
+		c.before[""] = pending
+	}
+	return c
+}
+
+func (c *dslComments) add(anchor string) {
+	if _, ok := c.before[anchor]; ok {
+		return
+	}
+	if _, ok := c.trailing[anchor]; ok {
+		return
+	}
+	c.order = append(c.order, anchor)
+}
+
+func (c *dslComments) has(anchor string) bool {
+	if c == nil {
+		return false
+	}
+	_, ok1 := c.before[anchor]
+	_, ok2 := c.trailing[anchor]
+	return ok1 || ok2
+}
+
+// unused returns the anchors which still have comments that haven't been printed.
+func (c *dslComments) unused() []string {
+	if c == nil {
+		return nil
+	}
+	var result []string
+	for _, anchor := range c.order {
+		if c.has(anchor) {
+			result = append(result, anchor)
+		}
+	}
+	return result
+}
+
+func (p *dslPrinter) commentsBefore(anchor string, indent string) {
+	if p.comments == nil {
+		return
+	}
+	lines, ok := p.comments.before[anchor]
+	if !ok {
+		return
+	}
+	delete(p.comments.before, anchor)
+	for _, l := range lines {
+		if l == "" {
+			p.line("")
+		} else {
+			p.line("%s%s", indent, l)
+		}
+	}
+}
+
+// trailing returns the comment for the end of an anchor's line (with a space in front of it), or "" if there isn't one.
+func (p *dslPrinter) trailing(anchor string) string {
+	if p.comments == nil {
+		return ""
+	}
+	c, ok := p.comments.trailing[anchor]
+	if !ok {
+		return ""
+	}
+	delete(p.comments.trailing, anchor)
+	return " " + c
+}
+
+// splitDSLComment splits a line into its code and its comment (if any), ignoring "#" inside quoted strings.
+func splitDSLComment(line string) (code string, comment string) {
+	inQuote := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"':
+			inQuote = !inQuote
+		case '#':
+			if !inQuote {
+				return line[:i], strings.TrimRight(line[i:], " \t\r")
+			}
+		}
+	}
+	return line, ""
+}
+
+func dslBraceDelta(code string) int {
+	delta := 0
+	inQuote := false
+	for i := 0; i < len(code); i++ {
+		switch code[i] {
+		case '"':
+			inQuote = !inQuote
+		case '{':
+			if !inQuote {
+				delta++
+			}
+		case '}':
+			if !inQuote {
+				delta--
+			}
+		}
+	}
+	return delta
+}
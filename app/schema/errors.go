@@ -4,4 +4,19 @@ const (
 	ErrCode_SchemaDSLParseFailed = "schema-dsl-parse-failed"
 	ErrCode_SchemaParseFailed    = "scheam-parse-failed"
 	ErrCode_SchemaCompileFailed  = "schema-compile-failed"
+	ErrCode_ReprPathFailed       = "schema-repr-path-failed"
+	ErrCode_ReprPathAmbiguous    = "schema-repr-path-ambiguous"
+	ErrCode_CodegenUnsupported   = "schema-codegen-unsupported"
+	ErrCode_CodegenStale         = "schema-codegen-stale"
+	ErrCode_JSONSchemaInvalid    = "schema-jsonschema-invalid"
+	ErrCode_DSLPrintFailed       = "schema-dsl-print-failed"
+	ErrCode_DSLUnformatted       = "schema-dsl-unformatted"
+	ErrCode_SchemaCompatBreaking = "schema-compat-breaking"
+	ErrCode_TransformFailed      = "schema-transform-failed"
+)
+
+// Warning codes, for problems that conversions to or from other schema languages can carry on past.
+const (
+	WarnCode_Lossy       = "schema-convert-lossy"       // Something's been described more loosely (or strictly) than it was.
+	WarnCode_Unsupported = "schema-convert-unsupported" // Something couldn't be described at all.
 )
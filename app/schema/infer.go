@@ -0,0 +1,538 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	schemadmt "github.com/ipld/go-ipld-prime/schema/dmt"
+
+	"github.com/ipld/go-ipldtool/app/shared"
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+// DefaultMaxStructKeys is the number of distinct keys beyond which Inferrer decides a map is a map, rather than a struct.
+const DefaultMaxStructKeys = 20
+
+// Inferrer works out a schema that describes some sample data.
+//
+// Each sample is given to Observe, and then Schema produces a schema that all of them match.
+// Maps become structs, with fields that are optional if some of the samples didn't have them,
+// unless there are more distinct keys than MaxStructKeys (or none at all), in which case they become map types.
+// Anything that's null in some samples becomes nullable.
+// Positions where the samples disagree about the kind of data become kinded unions.
+//
+// Types are named after where they were found: the samples themselves are RootType,
+// and the type for a field is named after the type that has the field, followed by the field name.
+type Inferrer struct {
+	// RootType is the name of the type that the samples themselves are.  If empty, "Root" is used.
+	RootType string
+
+	// MaxStructKeys is the most distinct keys a map can have (across all the samples) and still be a struct.
+	// If zero, DefaultMaxStructKeys is used.
+	MaxStructKeys int
+
+	// LinkSystem, if set, is used to load the blocks that links point to, so that they can be inferred too;
+	// links then become typed links.
+	// A linked block that looks like one of the blocks that led to it (it's the same kind, and if it's a map, has the same keys)
+	// is assumed to be the same type, so recursive structures (like linked lists) come out as recursive types.
+	// If not set, links are left untyped.
+	LinkSystem *linking.LinkSystem
+
+	root    *inferShape
+	visited map[inferVisit]bool
+}
+
+// inferShape accumulates everything seen at one position in the samples.
+type inferShape struct {
+	nulls int              // How many times null was seen.
+	kinds []datamodel.Kind // The kinds seen (other than null), in the order they were first seen.
+
+	maps    int                    // How many maps were seen.
+	keys    []string               // Every key seen in those maps, in the order they were first seen.
+	present map[string]int         // How many of the maps had each key.
+	fields  map[string]*inferShape // The values seen for each key.
+
+	items *inferShape // For lists: everything seen in them.
+
+	targets *inferShape // For links, if they're being followed: the blocks they point to.
+}
+
+type inferVisit struct {
+	link  string
+	shape *inferShape
+}
+
+// Observe adds a sample.
+//
+// Errors:
+//
+//   - ipldtool-error-load-failed -- if following links, and a block can't be loaded.
+func (x *Inferrer) Observe(n datamodel.Node) error {
+	if x.root == nil {
+		x.root = &inferShape{}
+		x.visited = map[inferVisit]bool{}
+	}
+	return x.observe(x.root, n, []*inferShape{x.root})
+}
+
+// observe adds what's seen in n to shape s.  The blocks is the shapes of the blocks that led to this one, starting from the root.
+func (x *Inferrer) observe(s *inferShape, n datamodel.Node, blocks []*inferShape) error {
+	kind := n.Kind()
+	if kind == datamodel.Kind_Null {
+		s.nulls++
+		return nil
+	}
+	s.addKind(kind)
+	switch kind {
+	case datamodel.Kind_Map:
+		// Record all the keys before looking at any of the values, so that this map is complete enough to compare linked blocks to.
+		s.maps++
+		if s.fields == nil {
+			s.present = map[string]int{}
+			s.fields = map[string]*inferShape{}
+		}
+		var keys []string
+		var values []datamodel.Node
+		for itr := n.MapIterator(); !itr.Done(); {
+			k, v, err := itr.Next()
+			if err != nil {
+				return ipldtoolerr.Newf(shared.ErrCode_DataInvalid, "could not read map: %s", err)
+			}
+			ks, err := k.AsString()
+			if err != nil {
+				return ipldtoolerr.Newf(shared.ErrCode_DataInvalid, "could not read map key: %s", err)
+			}
+			if _, seen := s.fields[ks]; !seen {
+				s.keys = append(s.keys, ks)
+				s.fields[ks] = &inferShape{}
+			}
+			s.present[ks]++
+			keys = append(keys, ks)
+			values = append(values, v)
+		}
+		for i, k := range keys {
+			if err := x.observe(s.fields[k], values[i], blocks); err != nil {
+				return err
+			}
+		}
+	case datamodel.Kind_List:
+		if s.items == nil {
+			s.items = &inferShape{}
+		}
+		for itr := n.ListIterator(); !itr.Done(); {
+			_, v, err := itr.Next()
+			if err != nil {
+				return ipldtoolerr.Newf(shared.ErrCode_DataInvalid, "could not read list: %s", err)
+			}
+			if err := x.observe(s.items, v, blocks); err != nil {
+				return err
+			}
+		}
+	case datamodel.Kind_Link:
+		if x.LinkSystem == nil {
+			return nil
+		}
+		lnk, _ := n.AsLink()
+		lctx := linking.LinkContext{Ctx: context.Background()}
+		np, err := shared.ChoosePrototype(lnk, lctx)
+		if err != nil {
+			return err
+		}
+		target, err := x.LinkSystem.Load(lctx, lnk, np)
+		if err != nil {
+			return ipldtoolerr.Newf(shared.ErrCode_LoadFailed, "could not load %s: %s", lnk, err)
+		}
+		if s.targets == nil {
+			for i := len(blocks) - 1; i >= 0 && s.targets == nil; i-- {
+				if blocks[i].looksLike(target) {
+					s.targets = blocks[i]
+				}
+			}
+			if s.targets == nil {
+				s.targets = &inferShape{}
+			}
+		}
+		visit := inferVisit{lnk.Binary(), s.targets}
+		if x.visited[visit] {
+			return nil
+		}
+		x.visited[visit] = true
+		return x.observe(s.targets, target, append(blocks, s.targets))
+	}
+	return nil
+}
+
+func (s *inferShape) addKind(kind datamodel.Kind) {
+	for _, k := range s.kinds {
+		if k == kind {
+			return
+		}
+	}
+	s.kinds = append(s.kinds, kind)
+}
+
+// looksLike returns true if n is a kind that's been seen here, and if it's a map, it has the keys that the maps here have (and none that they don't).
+func (s *inferShape) looksLike(n datamodel.Node) bool {
+	found := false
+	for _, k := range s.kinds {
+		found = found || k == n.Kind()
+	}
+	if !found || n.Kind() != datamodel.Kind_Map {
+		return found
+	}
+	required := 0
+	for _, k := range s.keys {
+		if s.present[k] == s.maps {
+			required++
+		}
+	}
+	for itr := n.MapIterator(); !itr.Done(); {
+		k, _, err := itr.Next()
+		if err != nil {
+			return false
+		}
+		ks, _ := k.AsString()
+		count, ok := s.present[ks]
+		if !ok {
+			return false
+		}
+		if count == s.maps {
+			required--
+		}
+	}
+	return required == 0
+}
+
+// Schema returns a schema that describes all of the samples seen so far.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- if no samples have been seen, or RootType is the name of a prelude type.
+//   - schema-compile-failed -- if the inferred schema isn't valid (which would be a bug).
+func (x *Inferrer) Schema() (*schemadmt.Schema, error) {
+	if x.root == nil {
+		return nil, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "cannot infer a schema without any samples")
+	}
+	e := &inferEmitter{
+		Inferrer: x,
+		dmt:      &schemadmt.Schema{Types: schemadmt.Map__TypeName__TypeDefn{Values: map[string]schemadmt.TypeDefn{}}},
+		names:    map[inferNameKey]string{},
+		merged:   map[[2]*inferShape]*inferShape{},
+	}
+	rootName := x.RootType
+	if rootName == "" {
+		rootName = "Root"
+	}
+	if _, prelude := preludeTypes[rootName]; prelude {
+		return nil, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "cannot name the root type %s: that's the name of a type in the prelude", rootName)
+	}
+	if name := e.typeName(x.root, rootName); name != rootName {
+		// The samples are all of some prelude type; but the root should still have a name of its own.
+		defn := schemadmt.TypeDefn{TypeDefnAny: &schemadmt.TypeDefnAny{}}
+		if len(x.root.kinds) == 1 {
+			defn = inferScalarDefn(x.root.kinds[0])
+		}
+		e.define(rootName, defn)
+	}
+	if _, err := SchemaCompile(e.dmt); err != nil {
+		return nil, err
+	}
+	return e.dmt, nil
+}
+
+// inferEmitter turns shapes into type definitions.
+type inferEmitter struct {
+	*Inferrer
+	dmt    *schemadmt.Schema
+	names  map[inferNameKey]string        // The types defined so far, for each shape (and what was made of it).
+	merged map[[2]*inferShape]*inferShape // Shapes merged so far (see merge).
+}
+
+type inferNameKey struct {
+	shape *inferShape
+	what  string // "struct", "union", "link", or the kind that an alias was made for.
+}
+
+// typeName returns the name of a type for a shape, defining it (with a name based on the one suggested) if need be.
+func (e *inferEmitter) typeName(s *inferShape, name string) string {
+	switch len(s.kinds) {
+	case 0:
+		return "Any"
+	case 1:
+		return e.typeNameForKind(s, s.kinds[0], name)
+	default:
+		return e.union(s, name)
+	}
+}
+
+// typeNameForKind is typeName for just one of the kinds seen in a shape.
+func (e *inferEmitter) typeNameForKind(s *inferShape, kind datamodel.Kind, name string) string {
+	switch {
+	case kind == datamodel.Kind_Link && s.targets != nil:
+		return e.named(inferNameKey{s, "link"}, name+"Link", func(string) schemadmt.TypeDefn {
+			target := e.typeName(s.targets, name+"Block")
+			return schemadmt.TypeDefn{TypeDefnLink: &schemadmt.TypeDefnLink{ExpectedType: &target}}
+		})
+	case kind == datamodel.Kind_Map && !e.isMapType(s):
+		return e.named(inferNameKey{s, "struct"}, name, func(name string) schemadmt.TypeDefn {
+			return schemadmt.TypeDefn{TypeDefnStruct: e.structDefn(s, name)}
+		})
+	case kind == datamodel.Kind_Map || kind == datamodel.Kind_List:
+		return e.named(inferNameKey{s, kind.String()}, name, func(name string) schemadmt.TypeDefn {
+			ref := e.refForKind(s, kind, name)
+			return schemadmt.TypeDefn{TypeDefnMap: ref.InlineDefn.TypeDefnMap, TypeDefnList: ref.InlineDefn.TypeDefnList}
+		})
+	default:
+		return inferScalarName(kind)
+	}
+}
+
+// ref is like typeName, but lists and maps are described inline, rather than getting names of their own.
+func (e *inferEmitter) ref(s *inferShape, name string) schemadmt.TypeNameOrInlineDefn {
+	if len(s.kinds) == 1 {
+		return e.refForKind(s, s.kinds[0], name)
+	}
+	typeName := e.typeName(s, name)
+	return schemadmt.TypeNameOrInlineDefn{TypeName: &typeName}
+}
+
+func (e *inferEmitter) refForKind(s *inferShape, kind datamodel.Kind, name string) schemadmt.TypeNameOrInlineDefn {
+	switch {
+	case kind == datamodel.Kind_List:
+		items := s.items
+		if items == nil {
+			items = &inferShape{}
+		}
+		return schemadmt.TypeNameOrInlineDefn{InlineDefn: &schemadmt.InlineDefn{TypeDefnList: &schemadmt.TypeDefnList{
+			ValueType:     e.ref(items, name+"Item"),
+			ValueNullable: boolPtrIfTrue(items.nulls > 0 && len(items.kinds) > 0),
+		}}}
+	case kind == datamodel.Kind_Map && e.isMapType(s):
+		values := &inferShape{}
+		for _, k := range s.keys {
+			values = e.merge(values, s.fields[k])
+		}
+		return schemadmt.TypeNameOrInlineDefn{InlineDefn: &schemadmt.InlineDefn{TypeDefnMap: &schemadmt.TypeDefnMap{
+			KeyType:       "String",
+			ValueType:     e.ref(values, name+"Value"),
+			ValueNullable: boolPtrIfTrue(values.nulls > 0 && len(values.kinds) > 0),
+		}}}
+	default:
+		typeName := e.typeNameForKind(s, kind, name)
+		return schemadmt.TypeNameOrInlineDefn{TypeName: &typeName}
+	}
+}
+
+func (e *inferEmitter) union(s *inferShape, name string) string {
+	return e.named(inferNameKey{s, "union"}, name, func(name string) schemadmt.TypeDefn {
+		defn := &schemadmt.TypeDefnUnion{}
+		kinded := &schemadmt.UnionRepresentation_Kinded{Values: map[string]schemadmt.UnionMember{}}
+		for _, kind := range s.kinds {
+			memberName := name + inferKindSuffix(kind)
+			if kind != datamodel.Kind_Map && kind != datamodel.Kind_List && kind != datamodel.Kind_Link {
+				memberName = inferScalarName(kind)
+			}
+			member := e.typeNameForKind(s, kind, memberName)
+			defn.Members = append(defn.Members, schemadmt.UnionMember{TypeName: &member})
+			kinded.Keys = append(kinded.Keys, kind.String())
+			kinded.Values[kind.String()] = schemadmt.UnionMember{TypeName: &member}
+		}
+		defn.Representation.UnionRepresentation_Kinded = kinded
+		return schemadmt.TypeDefn{TypeDefnUnion: defn}
+	})
+}
+
+func (e *inferEmitter) structDefn(s *inferShape, name string) *schemadmt.TypeDefnStruct {
+	defn := &schemadmt.TypeDefnStruct{
+		Fields:         schemadmt.Map__FieldName__StructField{Values: map[string]schemadmt.StructField{}},
+		Representation: schemadmt.StructRepresentation{StructRepresentation_Map: &schemadmt.StructRepresentation_Map{}},
+	}
+	renames := &schemadmt.Map__FieldName__StructRepresentation_Map_FieldDetails{Values: map[string]schemadmt.StructRepresentation_Map_FieldDetails{}}
+	for _, k := range s.keys {
+		f := s.fields[k]
+		fieldName := inferFieldName(k)
+		defn.Fields.Keys = append(defn.Fields.Keys, fieldName)
+		defn.Fields.Values[fieldName] = schemadmt.StructField{
+			Type:     e.ref(f, name+pascal(fieldName)),
+			Optional: boolPtrIfTrue(s.present[k] < s.maps),
+			Nullable: boolPtrIfTrue(f.nulls > 0 && len(f.kinds) > 0),
+		}
+		if fieldName != k {
+			key := k
+			renames.Keys = append(renames.Keys, fieldName)
+			renames.Values[fieldName] = schemadmt.StructRepresentation_Map_FieldDetails{Rename: &key}
+		}
+	}
+	if len(renames.Keys) > 0 {
+		defn.Representation.StructRepresentation_Map.Fields = renames
+	}
+	return defn
+}
+
+// isMapType returns true if the maps seen in a shape should be a map type, rather than a struct:
+// because there are too many keys, or none at all, or keys that can't be told apart once they're made into field names.
+func (e *inferEmitter) isMapType(s *inferShape) bool {
+	max := e.MaxStructKeys
+	if max == 0 {
+		max = DefaultMaxStructKeys
+	}
+	if len(s.keys) == 0 || len(s.keys) > max {
+		return true
+	}
+	fieldNames := map[string]bool{}
+	for _, k := range s.keys {
+		fieldName := inferFieldName(k)
+		if fieldNames[fieldName] {
+			return true
+		}
+		fieldNames[fieldName] = true
+	}
+	return false
+}
+
+// merge returns a shape that has everything seen in both a and b.  Neither is modified.
+//
+// The blocks that links point to are merged too.  Since those can form cycles, merges are remembered.
+func (e *inferEmitter) merge(a, b *inferShape) *inferShape {
+	if a == nil {
+		return b
+	}
+	if b == nil || a == b {
+		return a
+	}
+	key := [2]*inferShape{a, b}
+	if m, ok := e.merged[key]; ok {
+		return m
+	}
+	m := &inferShape{}
+	e.merged[key] = m
+	for _, s := range []*inferShape{a, b} {
+		m.nulls += s.nulls
+		for _, k := range s.kinds {
+			m.addKind(k)
+		}
+		m.maps += s.maps
+		for _, k := range s.keys {
+			if m.fields == nil {
+				m.present = map[string]int{}
+				m.fields = map[string]*inferShape{}
+			}
+			if _, seen := m.fields[k]; !seen {
+				m.keys = append(m.keys, k)
+			}
+			m.present[k] += s.present[k]
+		}
+	}
+	for _, k := range m.keys {
+		m.fields[k] = e.merge(a.fields[k], b.fields[k])
+	}
+	m.items = e.merge(a.items, b.items)
+	m.targets = e.merge(a.targets, b.targets)
+	return m
+}
+
+// named returns the name of the type that's been defined for key, or if there isn't one yet, defines it, with a name based on the one suggested.
+// The name is settled before the definition is built, so that definitions can refer to themselves.
+func (e *inferEmitter) named(key inferNameKey, name string, build func(name string) schemadmt.TypeDefn) string {
+	if existing, ok := e.names[key]; ok {
+		return existing
+	}
+	name = e.define(name, schemadmt.TypeDefn{})
+	e.names[key] = name
+	e.dmt.Types.Values[name] = build(name)
+	return name
+}
+
+// define adds a type definition, with a name based on the one suggested, and returns the name it was given.
+func (e *inferEmitter) define(name string, defn schemadmt.TypeDefn) string {
+	unique := name
+	for i := 2; ; i++ {
+		_, taken := e.dmt.Types.Values[unique]
+		_, prelude := preludeTypes[unique]
+		if !taken && !prelude {
+			break
+		}
+		unique = fmt.Sprintf("%s%d", name, i)
+	}
+	e.dmt.Types.Keys = append(e.dmt.Types.Keys, unique)
+	e.dmt.Types.Values[unique] = defn
+	return unique
+}
+
+func inferScalarName(kind datamodel.Kind) string {
+	switch kind {
+	case datamodel.Kind_Bool:
+		return "Bool"
+	case datamodel.Kind_Int:
+		return "Int"
+	case datamodel.Kind_Float:
+		return "Float"
+	case datamodel.Kind_String:
+		return "String"
+	case datamodel.Kind_Bytes:
+		return "Bytes"
+	case datamodel.Kind_Link:
+		return "Link"
+	default:
+		return "Any"
+	}
+}
+
+func inferScalarDefn(kind datamodel.Kind) schemadmt.TypeDefn {
+	switch kind {
+	case datamodel.Kind_Bool:
+		return schemadmt.TypeDefn{TypeDefnBool: &schemadmt.TypeDefnBool{}}
+	case datamodel.Kind_Int:
+		return schemadmt.TypeDefn{TypeDefnInt: &schemadmt.TypeDefnInt{}}
+	case datamodel.Kind_Float:
+		return schemadmt.TypeDefn{TypeDefnFloat: &schemadmt.TypeDefnFloat{}}
+	case datamodel.Kind_String:
+		return schemadmt.TypeDefn{TypeDefnString: &schemadmt.TypeDefnString{}}
+	case datamodel.Kind_Bytes:
+		return schemadmt.TypeDefn{TypeDefnBytes: &schemadmt.TypeDefnBytes{}}
+	case datamodel.Kind_Link:
+		return schemadmt.TypeDefn{TypeDefnLink: &schemadmt.TypeDefnLink{}}
+	default:
+		return schemadmt.TypeDefn{TypeDefnAny: &schemadmt.TypeDefnAny{}}
+	}
+}
+
+func inferKindSuffix(kind datamodel.Kind) string {
+	switch kind {
+	case datamodel.Kind_Map:
+		return "Map"
+	case datamodel.Kind_List:
+		return "List"
+	default:
+		return "Link"
+	}
+}
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// inferFieldName turns a map key into a field name: keys that aren't already identifiers are camel-cased, dropping anything that can't be in one.
+func inferFieldName(key string) string {
+	if identifierPattern.MatchString(key) {
+		return key
+	}
+	parts := strings.FieldsFunc(key, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+	var sb strings.Builder
+	for i, part := range parts {
+		if i == 0 {
+			sb.WriteString(strings.ToLower(part[:1]) + part[1:])
+		} else {
+			sb.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	name := sb.String()
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "f" + name
+	}
+	return name
+}
@@ -0,0 +1,303 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/schema"
+
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+// Warning describes something that couldn't be carried over faithfully when converting a schema to or from another format.
+// Conversions carry on past these, doing the best they can; it's up to the caller whether to report them or to give up.
+type Warning struct {
+	Code     string // One of the WarnCode_* constants.
+	TypeName string // The type the problem was found in.
+	Message  string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: type %s: %s", w.Code, w.TypeName, w.Message)
+}
+
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// ExportJSONSchema produces a JSON Schema (draft 2020-12) document which describes the serial form of the types in the TypeSystem.
+// It describes their representations, since that's what a JSON Schema validator will see, and uses dag-json's conventions for links and bytes.
+//
+// Each type declared in the schema gets an entry in "$defs".
+// If a root type is named, the document also refers to it with "$ref", so that the document as a whole validates data of that type.
+//
+// Some things can't be expressed in JSON Schema (for example, the structure inside a stringjoin representation).
+// These are described as loosely as necessary, and reported as warnings.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- if the root type isn't in the TypeSystem.
+func ExportJSONSchema(ts *schema.TypeSystem, rootType string) (datamodel.Node, []Warning, error) {
+	if rootType != "" && ts.TypeByName(rootType) == nil {
+		return nil, nil, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "type argument not recognized: there's no type named %q in the schema", rootType)
+	}
+	x := &jsonSchemaExporter{}
+	doc := newJSONObj().
+		set("$schema", jsonSchemaDialect)
+	if rootType != "" {
+		doc.set("$ref", "#/$defs/"+rootType)
+	}
+	defs := newJSONObj()
+	for _, name := range ts.Names() {
+		t := ts.TypeByName(name)
+		if IsPreludeType(t) {
+			continue
+		}
+		defs.set(name, x.defn(t))
+	}
+	doc.set("$defs", defs)
+	return doc.node(), x.warnings, nil
+}
+
+type jsonSchemaExporter struct {
+	warnings []Warning
+}
+
+func (x *jsonSchemaExporter) warn(code string, t schema.Type, format string, args ...interface{}) {
+	x.warnings = append(x.warnings, Warning{code, t.Name(), fmt.Sprintf(format, args...)})
+}
+
+// ref returns a schema for a reference to a type: prelude types are written out in place, and others refer to their entry in "$defs".
+func (x *jsonSchemaExporter) ref(t schema.Type, nullable bool) *jsonObj {
+	var o *jsonObj
+	if IsPreludeType(t) {
+		o = x.defn(t)
+	} else {
+		o = newJSONObj().set("$ref", "#/$defs/"+t.Name())
+	}
+	if nullable {
+		return newJSONObj().set("anyOf", []interface{}{o, newJSONObj().set("type", "null")})
+	}
+	return o
+}
+
+func (x *jsonSchemaExporter) defn(t schema.Type) *jsonObj {
+	switch t := t.(type) {
+	case *schema.TypeBool:
+		return newJSONObj().set("type", "boolean")
+	case *schema.TypeInt:
+		return newJSONObj().set("type", "integer")
+	case *schema.TypeFloat:
+		return newJSONObj().set("type", "number")
+	case *schema.TypeString:
+		return newJSONObj().set("type", "string")
+	case *schema.TypeBytes:
+		// dag-json bytes: {"/": {"bytes": "<base64>"}}
+		return newJSONObj().
+			set("type", "object").
+			set("properties", newJSONObj().set("/", newJSONObj().
+				set("type", "object").
+				set("properties", newJSONObj().set("bytes", newJSONObj().set("type", "string").set("contentEncoding", "base64"))).
+				set("required", []interface{}{"bytes"}).
+				set("additionalProperties", false))).
+			set("required", []interface{}{"/"}).
+			set("additionalProperties", false)
+	case *schema.TypeLink:
+		// dag-json links: {"/": "<CID>"}
+		o := newJSONObj()
+		if t.HasReferencedType() {
+			o.set("description", "A link to "+t.ReferencedType().Name()+".")
+		}
+		return o.
+			set("type", "object").
+			set("properties", newJSONObj().set("/", newJSONObj().set("type", "string"))).
+			set("required", []interface{}{"/"}).
+			set("additionalProperties", false)
+	case *schema.TypeAny:
+		return newJSONObj()
+	case *schema.TypeMap:
+		o := newJSONObj().set("type", "object")
+		if !IsPreludeType(t.KeyType()) {
+			o.set("propertyNames", x.ref(t.KeyType(), false))
+		}
+		return o.set("additionalProperties", x.ref(t.ValueType(), t.ValueIsNullable()))
+	case *schema.TypeList:
+		return newJSONObj().
+			set("type", "array").
+			set("items", x.ref(t.ValueType(), t.ValueIsNullable()))
+	case *schema.TypeStruct:
+		return x.structDefn(t)
+	case *schema.TypeEnum:
+		var vals []interface{}
+		switch stg := t.RepresentationStrategy().(type) {
+		case schema.EnumRepresentation_String:
+			for _, m := range t.Members() {
+				if s, ok := stg[m]; ok {
+					vals = append(vals, s)
+				} else {
+					vals = append(vals, m)
+				}
+			}
+		case schema.EnumRepresentation_Int:
+			for _, m := range t.Members() {
+				vals = append(vals, stg[m])
+			}
+		}
+		return newJSONObj().set("enum", vals)
+	case *schema.TypeUnion:
+		return x.unionDefn(t)
+	default:
+		x.warn(WarnCode_Unsupported, t, "types of kind %s can't be described; allowing anything", t.TypeKind())
+		return newJSONObj()
+	}
+}
+
+func (x *jsonSchemaExporter) structDefn(t *schema.TypeStruct) *jsonObj {
+	switch stg := t.RepresentationStrategy().(type) {
+	case schema.StructRepresentation_Map:
+		props := newJSONObj()
+		var required []interface{}
+		for _, f := range t.Fields() {
+			key := stg.GetFieldKey(f)
+			prop := x.ref(f.Type(), f.IsNullable())
+			switch implicit := stg.FieldImplicit(f); {
+			case implicit != nil:
+				prop.set("default", implicitJSONValue(implicit))
+			case !f.IsOptional():
+				required = append(required, key)
+			}
+			props.set(key, prop)
+		}
+		o := newJSONObj().
+			set("type", "object").
+			set("properties", props)
+		if len(required) > 0 {
+			o.set("required", required)
+		}
+		return o.set("additionalProperties", false)
+	case schema.StructRepresentation_Tuple:
+		var items []interface{}
+		required := 0
+		for i, f := range t.Fields() {
+			items = append(items, x.ref(f.Type(), f.IsNullable()))
+			if !f.IsOptional() {
+				required = i + 1
+			}
+		}
+		return newJSONObj().
+			set("type", "array").
+			set("prefixItems", items).
+			set("items", false).
+			set("minItems", required).
+			set("maxItems", len(items))
+	default:
+		x.warn(WarnCode_Lossy, t, "the fields inside a %s representation can't be described; only checking that it's a string", reprStrategyName(stg))
+		return newJSONObj().set("type", "string")
+	}
+}
+
+func (x *jsonSchemaExporter) unionDefn(t *schema.TypeUnion) *jsonObj {
+	var alts []interface{}
+	switch stg := t.RepresentationStrategy().(type) {
+	case schema.UnionRepresentation_Keyed:
+		for _, m := range t.Members() {
+			key := stg.GetDiscriminant(m)
+			alts = append(alts, newJSONObj().
+				set("type", "object").
+				set("properties", newJSONObj().set(key, x.ref(m, false))).
+				set("required", []interface{}{key}).
+				set("additionalProperties", false))
+		}
+		return newJSONObj().set("oneOf", alts)
+	case schema.UnionRepresentation_Kinded:
+		// Not oneOf, because in JSON Schema, "number" also matches integers.
+		for _, m := range t.Members() {
+			alts = append(alts, x.ref(m, false))
+		}
+		return newJSONObj().set("anyOf", alts)
+	case schema.UnionRepresentation_Stringprefix:
+		x.warn(WarnCode_Lossy, t, "the members inside a stringprefix representation can't be described; only checking the prefixes")
+		for _, m := range t.Members() {
+			alts = append(alts, newJSONObj().
+				set("type", "string").
+				set("pattern", "^"+regexp.QuoteMeta(stg.GetDiscriminant(m)+stg.GetDelim())))
+		}
+		return newJSONObj().set("anyOf", alts)
+	default:
+		x.warn(WarnCode_Unsupported, t, "unions with %s representations can't be described; allowing anything", reprStrategyName(stg))
+		return newJSONObj()
+	}
+}
+
+func implicitJSONValue(v schema.ImplicitValue) interface{} {
+	switch v := v.(type) {
+	case schema.ImplicitValue_String:
+		return string(v)
+	case schema.ImplicitValue_Int:
+		return int(v)
+	case schema.ImplicitValue_Bool:
+		return bool(v)
+	case schema.ImplicitValue_EmptyList:
+		return []interface{}{}
+	case schema.ImplicitValue_EmptyMap:
+		return newJSONObj()
+	default:
+		panic(fmt.Errorf("unreachable: unknown implicit value %T", v))
+	}
+}
+
+// jsonObj is a JSON object under construction.  It keeps its keys in the order they're set.
+//
+// Values may be strings, ints, bools, []interface{}, or more *jsonObj.
+type jsonObj struct {
+	keys []string
+	vals map[string]interface{}
+}
+
+func newJSONObj() *jsonObj {
+	return &jsonObj{vals: map[string]interface{}{}}
+}
+
+func (o *jsonObj) set(k string, v interface{}) *jsonObj {
+	if _, exists := o.vals[k]; !exists {
+		o.keys = append(o.keys, k)
+	}
+	o.vals[k] = v
+	return o
+}
+
+func (o *jsonObj) node() datamodel.Node {
+	n, err := qp.BuildMap(basicnode.Prototype.Any, int64(len(o.keys)), o.assembleEntries)
+	if err != nil {
+		panic(err) // Only possible if we've put something unsupported in, which would be a bug.
+	}
+	return n
+}
+
+func (o *jsonObj) assembleEntries(ma datamodel.MapAssembler) {
+	for _, k := range o.keys {
+		qp.MapEntry(ma, k, assembleJSONValue(o.vals[k]))
+	}
+}
+
+func assembleJSONValue(v interface{}) qp.Assemble {
+	switch v := v.(type) {
+	case string:
+		return qp.String(v)
+	case int:
+		return qp.Int(int64(v))
+	case bool:
+		return qp.Bool(v)
+	case []interface{}:
+		return qp.List(int64(len(v)), func(la datamodel.ListAssembler) {
+			for _, x := range v {
+				qp.ListEntry(la, assembleJSONValue(x))
+			}
+		})
+	case *jsonObj:
+		return qp.Map(int64(len(v.keys)), v.assembleEntries)
+	default:
+		panic(fmt.Errorf("unsupported value in jsonObj: %T", v))
+	}
+}
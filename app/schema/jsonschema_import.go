@@ -0,0 +1,912 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	schemadmt "github.com/ipld/go-ipld-prime/schema/dmt"
+
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+// ImportJSONSchema produces a schema DMT from a JSON Schema document, as best it can.
+//
+// Each entry in "$defs" (or "definitions") becomes a type of the same name.
+// If the document itself describes something (rather than just holding definitions), that becomes a type too,
+// named after the document's "title", or "Root" if it has none.
+// Objects with "properties" become structs; objects with only "additionalProperties" become maps;
+// arrays with "prefixItems" become structs with tuple representations, and other arrays become lists;
+// "enum" becomes an enum; and "oneOf" or "anyOf" become keyed unions (if every alternative is an object with one required property)
+// or kinded unions (if every alternative is a different kind).
+// Inline schemas which need a type of their own are given one, named after where they were found.
+// Objects in the shape dag-json uses for links and bytes become links and bytes.
+//
+// JSON Schema can say many things that IPLD Schemas can't (like "pattern", or "minimum"), and vice versa.
+// Anything that can't be carried over is reported as a warning, and dropped (or, if necessary, described as Any).
+//
+// The result isn't checked for validity; use SchemaCompile for that.
+//
+// Errors:
+//
+//   - schema-jsonschema-invalid -- if the document isn't a JSON Schema at all.
+func ImportJSONSchema(doc datamodel.Node) (*schemadmt.Schema, []Warning, error) {
+	if doc.Kind() != datamodel.Kind_Map {
+		return nil, nil, ipldtoolerr.Newf(ErrCode_JSONSchemaInvalid, "a JSON Schema document must be an object, not a %s", doc.Kind())
+	}
+	im := &jsonSchemaImporter{
+		out:   &schemadmt.Schema{Types: schemadmt.Map__TypeName__TypeDefn{Values: map[string]schemadmt.TypeDefn{}}},
+		refs:  map[string]datamodel.Node{},
+		names: map[string]string{},
+		taken: map[string]bool{},
+	}
+	for name := range preludeTypes {
+		im.taken[name] = true
+	}
+
+	// Name all the definitions first, so references can be resolved no matter what order they're in.
+	type def struct {
+		name string
+		n    datamodel.Node
+	}
+	var defs []def
+	for _, container := range []string{"$defs", "definitions"} {
+		defsNode := jsLookup(doc, container)
+		if defsNode == nil || defsNode.Kind() != datamodel.Kind_Map {
+			continue
+		}
+		for itr := defsNode.MapIterator(); !itr.Done(); {
+			k, v, err := itr.Next()
+			if err != nil {
+				return nil, nil, ipldtoolerr.Newf(ErrCode_JSONSchemaInvalid, "could not read %s: %s", container, err)
+			}
+			key, _ := k.AsString()
+			ref := "#/" + container + "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+			name := im.claimName(key)
+			im.refs[ref] = v
+			im.names[ref] = name
+			defs = append(defs, def{name, v})
+		}
+	}
+	for _, d := range defs {
+		im.define(d.name, d.n)
+	}
+
+	// If the document describes something itself, that's a type too.
+	describesSomething := false
+	for itr := doc.MapIterator(); !itr.Done(); {
+		k, _, _ := itr.Next()
+		switch key, _ := k.AsString(); key {
+		case "$schema", "$id", "$defs", "definitions", "$ref", "title", "description", "$comment":
+		default:
+			describesSomething = true
+		}
+	}
+	if describesSomething {
+		name := "Root"
+		if title, err := jsLookupString(doc, "title"); err == nil {
+			name = title
+		}
+		im.define(im.claimName(name), doc)
+	}
+
+	im.finishKindedUnions()
+	return im.out, im.warnings, nil
+}
+
+type jsonSchemaImporter struct {
+	out      *schemadmt.Schema
+	warnings []Warning
+	refs     map[string]datamodel.Node // The targets of "$ref"s, by ref.
+	names    map[string]string         // The type names given to the targets of "$ref"s, by ref.
+	taken    map[string]bool           // Type names that have been used.
+	aliasing map[string]bool           // Refs that are being followed as aliases right now (to catch cycles).
+	kinded   []string                  // Names of kinded unions, whose members need checking once all types are known.
+}
+
+func (im *jsonSchemaImporter) warn(code string, typeName string, format string, args ...interface{}) {
+	im.warnings = append(im.warnings, Warning{code, typeName, fmt.Sprintf(format, args...)})
+}
+
+// warnAt is warn, but for a problem somewhere inside the type, described by where.
+func (im *jsonSchemaImporter) warnAt(code string, typeName string, where string, format string, args ...interface{}) {
+	if where != "" {
+		format = where + ": " + format
+	}
+	im.warn(code, typeName, format, args...)
+}
+
+var nonTypeNameChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// claimName turns a string into a type name that's not been used yet.
+func (im *jsonSchemaImporter) claimName(s string) string {
+	base := nonTypeNameChars.ReplaceAllString(s, "_")
+	if base == "" || !(base[0] >= 'A' && base[0] <= 'Z' || base[0] >= 'a' && base[0] <= 'z') {
+		base = "T" + base
+	}
+	name := base
+	for i := 2; im.taken[name]; i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	im.taken[name] = true
+	return name
+}
+
+// define adds a type to the output.  Its name is reserved in the type list first, so that types are listed before any types made from parts of them.
+func (im *jsonSchemaImporter) define(name string, n datamodel.Node) {
+	im.out.Types.Keys = append(im.out.Types.Keys, name)
+	im.out.Types.Values[name] = im.defn(name, n)
+}
+
+var jsonSchemaAnyDefn = schemadmt.TypeDefn{TypeDefnAny: &schemadmt.TypeDefnAny{}}
+
+func (im *jsonSchemaImporter) defn(name string, n datamodel.Node) schemadmt.TypeDefn {
+	switch n.Kind() {
+	case datamodel.Kind_Bool:
+		if b, _ := n.AsBool(); !b {
+			im.warn(WarnCode_Unsupported, name, "a schema of false (which matches nothing) can't be expressed; allowing anything")
+		}
+		return jsonSchemaAnyDefn
+	case datamodel.Kind_Map:
+		// continue below
+	default:
+		im.warn(WarnCode_Unsupported, name, "a schema must be an object or a boolean, not a %s; allowing anything", n.Kind())
+		return jsonSchemaAnyDefn
+	}
+
+	switch {
+	case jsLookup(n, "$ref") != nil:
+		im.checkKeywords(name, n, "$ref")
+		ref, _ := jsLookupString(n, "$ref")
+		target, ok := im.refs[ref]
+		if !ok {
+			im.warn(WarnCode_Unsupported, name, "reference %q can't be resolved (only references to \"#/$defs/...\" are supported); allowing anything", ref)
+			return jsonSchemaAnyDefn
+		}
+		// IPLD Schemas don't have aliases, so this becomes a copy of the target.
+		if im.aliasing == nil {
+			im.aliasing = map[string]bool{}
+		}
+		if im.aliasing[ref] {
+			im.warn(WarnCode_Unsupported, name, "reference %q is part of a cycle of references; allowing anything", ref)
+			return jsonSchemaAnyDefn
+		}
+		im.aliasing[ref] = true
+		defer delete(im.aliasing, ref)
+		return im.defn(name, target)
+	case jsLookup(n, "enum") != nil || jsLookup(n, "const") != nil:
+		return im.enumDefn(name, n)
+	case jsLookup(n, "oneOf") != nil:
+		return im.unionDefn(name, n, "oneOf")
+	case jsLookup(n, "anyOf") != nil:
+		return im.unionDefn(name, n, "anyOf")
+	}
+
+	typ, nullable, multi := im.typeKeyword(name, n)
+	if nullable {
+		im.warn(WarnCode_Lossy, name, "named types can't be nullable in IPLD Schemas (only their uses can); null has been dropped")
+	}
+	if multi != nil {
+		// Several types are allowed: that's a kinded union of the prelude types.
+		im.checkKeywords(name, n, "type")
+		return im.kindedUnionDefn(name, multi)
+	}
+	switch {
+	case typ == "object" || (typ == "" && (jsLookup(n, "properties") != nil || jsLookup(n, "additionalProperties") != nil)):
+		switch {
+		case isDagJSONLinkShape(n):
+			im.checkKeywords(name, n, "type", "properties", "required", "additionalProperties")
+			return schemadmt.TypeDefn{TypeDefnLink: &schemadmt.TypeDefnLink{}}
+		case isDagJSONBytesShape(n):
+			im.checkKeywords(name, n, "type", "properties", "required", "additionalProperties")
+			return schemadmt.TypeDefn{TypeDefnBytes: &schemadmt.TypeDefnBytes{}}
+		case jsLookup(n, "properties") != nil:
+			return im.structDefn(name, n)
+		case jsLookup(n, "additionalProperties") != nil && jsLookup(n, "additionalProperties").Kind() == datamodel.Kind_Bool:
+			if b, _ := jsLookup(n, "additionalProperties").AsBool(); !b {
+				return im.structDefn(name, n) // An object with no properties allowed: a struct with no fields.
+			}
+		}
+		return im.mapDefn(name, n)
+	case typ == "array" || (typ == "" && (jsLookup(n, "items") != nil || jsLookup(n, "prefixItems") != nil)):
+		if jsLookup(n, "prefixItems") != nil {
+			return im.tupleDefn(name, n)
+		}
+		im.checkKeywords(name, n, "type", "items")
+		valueType, valueNullable := im.fieldType(name, "Item", "list values", jsLookup(n, "items"))
+		return schemadmt.TypeDefn{TypeDefnList: &schemadmt.TypeDefnList{
+			ValueType:     schemadmt.TypeNameOrInlineDefn{TypeName: &valueType},
+			ValueNullable: boolPtrIfTrue(valueNullable),
+		}}
+	case typ == "string":
+		im.checkKeywords(name, n, "type")
+		return schemadmt.TypeDefn{TypeDefnString: &schemadmt.TypeDefnString{}}
+	case typ == "integer":
+		im.checkKeywords(name, n, "type")
+		return schemadmt.TypeDefn{TypeDefnInt: &schemadmt.TypeDefnInt{}}
+	case typ == "number":
+		im.checkKeywords(name, n, "type")
+		return schemadmt.TypeDefn{TypeDefnFloat: &schemadmt.TypeDefnFloat{}}
+	case typ == "boolean":
+		im.checkKeywords(name, n, "type")
+		return schemadmt.TypeDefn{TypeDefnBool: &schemadmt.TypeDefnBool{}}
+	case typ == "null":
+		im.warn(WarnCode_Unsupported, name, "a type that's only null can't be expressed; allowing anything")
+		return jsonSchemaAnyDefn
+	default:
+		im.checkKeywords(name, n, "type")
+		return jsonSchemaAnyDefn
+	}
+}
+
+// typeKeyword reads the "type" keyword.
+// If it's a list of types, null is picked out, and if there's still more than one type left, the prelude types for them are returned.
+func (im *jsonSchemaImporter) typeKeyword(name string, n datamodel.Node) (typ string, nullable bool, multi []string) {
+	t := jsLookup(n, "type")
+	if t == nil {
+		return "", false, nil
+	}
+	if s, err := t.AsString(); err == nil {
+		return s, false, nil
+	}
+	var types []string
+	for itr := t.ListIterator(); itr != nil && !itr.Done(); {
+		_, v, err := itr.Next()
+		if err != nil {
+			break
+		}
+		s, _ := v.AsString()
+		if s == "null" {
+			nullable = true
+			continue
+		}
+		types = append(types, s)
+	}
+	switch len(types) {
+	case 0:
+		return "null", false, nil
+	case 1:
+		return types[0], nullable, nil
+	}
+	for _, s := range types {
+		prelude := jsonSchemaTypeToPrelude(s)
+		if prelude == "" {
+			im.warn(WarnCode_Unsupported, name, "the type %q can't be part of a list of types; allowing anything", s)
+			return "", nullable, nil
+		}
+		multi = append(multi, prelude)
+	}
+	return "", nullable, multi
+}
+
+func jsonSchemaTypeToPrelude(s string) string {
+	switch s {
+	case "string":
+		return "String"
+	case "integer":
+		return "Int"
+	case "number":
+		return "Float"
+	case "boolean":
+		return "Bool"
+	case "object":
+		return "Map"
+	case "array":
+		return "List"
+	default:
+		return ""
+	}
+}
+
+// fieldType returns the name of a type to use for a schema found inside another one (e.g. a property).
+// Prelude types and references are used directly where possible; otherwise, a new type is made, named by the owner's name plus the suffix.
+// Problems with schemas that don't get a type of their own are reported as being in the owner, at the place described by where (e.g. `field "id"`).
+// Nullable schemas (like {"type": ["string", "null"]}) are unwrapped, since IPLD Schemas put nullability on the use of a type rather than the type.
+func (im *jsonSchemaImporter) fieldType(owner, suffix, where string, n datamodel.Node) (typeName string, nullable bool) {
+	if n == nil || n.Kind() == datamodel.Kind_Bool || (n.Kind() == datamodel.Kind_Map && n.Length() == 0) {
+		if n != nil && n.Kind() == datamodel.Kind_Bool {
+			if b, _ := n.AsBool(); !b {
+				im.warnAt(WarnCode_Unsupported, owner, where, "a schema of false (which matches nothing) can't be expressed; allowing anything")
+			}
+		}
+		return "Any", false
+	}
+	if n.Kind() != datamodel.Kind_Map {
+		im.warnAt(WarnCode_Unsupported, owner, where, "a schema must be an object or a boolean, not a %s; allowing anything", n.Kind())
+		return "Any", false
+	}
+
+	// References can be used directly.
+	if ref, err := jsLookupString(n, "$ref"); err == nil {
+		im.checkKeywordsAt(owner, where, n, "$ref")
+		if target, ok := im.names[ref]; ok {
+			return target, false
+		}
+		im.warnAt(WarnCode_Unsupported, owner, where, "reference %q can't be resolved (only references to \"#/$defs/...\" are supported); allowing anything", ref)
+		return "Any", false
+	}
+
+	// Nullable things are usually written as a oneOf or anyOf with null as one of the alternatives.
+	for _, kw := range []string{"oneOf", "anyOf"} {
+		alts := jsLookup(n, kw)
+		if alts == nil || alts.Kind() != datamodel.Kind_List || alts.Length() != 2 {
+			continue
+		}
+		a, _ := alts.LookupByIndex(0)
+		b, _ := alts.LookupByIndex(1)
+		switch {
+		case isJSONSchemaNull(a):
+			im.checkKeywordsAt(owner, where, n, kw)
+			typeName, _ := im.fieldType(owner, suffix, where, b)
+			return typeName, true
+		case isJSONSchemaNull(b):
+			im.checkKeywordsAt(owner, where, n, kw)
+			typeName, _ := im.fieldType(owner, suffix, where, a)
+			return typeName, true
+		}
+	}
+
+	// Plain scalars, links, and bytes are prelude types.
+	typ, nullable, multi := im.typeKeyword(owner, n)
+	if multi == nil && jsLookup(n, "enum") == nil && jsLookup(n, "const") == nil {
+		switch {
+		case typ == "object" && isDagJSONLinkShape(n):
+			im.checkKeywordsAt(owner, where, n, "type", "properties", "required", "additionalProperties")
+			return "Link", nullable
+		case typ == "object" && isDagJSONBytesShape(n):
+			im.checkKeywordsAt(owner, where, n, "type", "properties", "required", "additionalProperties")
+			return "Bytes", nullable
+		case typ == "string", typ == "integer", typ == "number", typ == "boolean":
+			im.checkKeywordsAt(owner, where, n, "type")
+			return jsonSchemaTypeToPrelude(typ), nullable
+		}
+	}
+
+	// Anything else needs a type of its own.
+	// (If it was nullable, that's dealt with here, so the new type doesn't also report it.)
+	if nullable {
+		n = withoutNullType(n)
+	}
+	name := im.claimName(owner + suffix)
+	im.define(name, n)
+	return name, nullable
+}
+
+func (im *jsonSchemaImporter) structDefn(name string, n datamodel.Node) schemadmt.TypeDefn {
+	im.checkKeywords(name, n, "type", "properties", "required", "additionalProperties")
+	required := map[string]bool{}
+	if req := jsLookup(n, "required"); req != nil && req.Kind() == datamodel.Kind_List {
+		for itr := req.ListIterator(); !itr.Done(); {
+			_, v, err := itr.Next()
+			if err != nil {
+				break
+			}
+			s, _ := v.AsString()
+			required[s] = true
+		}
+	}
+	if ap := jsLookup(n, "additionalProperties"); ap == nil || !(ap.Kind() == datamodel.Kind_Bool && !mustBool(ap)) {
+		im.warn(WarnCode_Lossy, name, "extra properties are allowed, but IPLD structs can't have them; they'll be rejected")
+	}
+
+	defn := &schemadmt.TypeDefnStruct{
+		Fields: schemadmt.Map__FieldName__StructField{Values: map[string]schemadmt.StructField{}},
+	}
+	details := schemadmt.Map__FieldName__StructRepresentation_Map_FieldDetails{Values: map[string]schemadmt.StructRepresentation_Map_FieldDetails{}}
+	fieldNames := map[string]bool{}
+	if props := jsLookup(n, "properties"); props != nil && props.Kind() == datamodel.Kind_Map {
+		for itr := props.MapIterator(); !itr.Done(); {
+			k, v, err := itr.Next()
+			if err != nil {
+				break
+			}
+			key, _ := k.AsString()
+
+			// Field names need to be identifiers; if the property name isn't one, rename it.
+			fieldName := key
+			var detail schemadmt.StructRepresentation_Map_FieldDetails
+			if !jsIdentifier.MatchString(key) || strings.Contains(key, "$") || fieldNames[key] {
+				fieldName = nonTypeNameChars.ReplaceAllString(key, "_")
+				if fieldName == "" || fieldName[0] >= '0' && fieldName[0] <= '9' {
+					fieldName = "f" + fieldName
+				}
+				for base, i := fieldName, 2; fieldNames[fieldName]; i++ {
+					fieldName = fmt.Sprintf("%s%d", base, i)
+				}
+				rename := key
+				detail.Rename = &rename
+			}
+			fieldNames[fieldName] = true
+
+			typeName, nullable := im.fieldType(name, pascal(fieldName), fmt.Sprintf("field %q", fieldName), v)
+			field := schemadmt.StructField{
+				Type:     schemadmt.TypeNameOrInlineDefn{TypeName: &typeName},
+				Nullable: boolPtrIfTrue(nullable),
+			}
+			if !required[key] {
+				// A default value for an optional property is what IPLD calls an implicit.
+				if implicit := jsonSchemaImplicit(v); implicit != nil {
+					detail.Implicit = implicit
+				} else {
+					field.Optional = boolPtrIfTrue(true)
+				}
+			}
+			defn.Fields.Keys = append(defn.Fields.Keys, fieldName)
+			defn.Fields.Values[fieldName] = field
+			if detail.Rename != nil || detail.Implicit != nil {
+				details.Keys = append(details.Keys, fieldName)
+				details.Values[fieldName] = detail
+			}
+		}
+	}
+	for k := range required {
+		if _, ok := defn.Fields.Values[k]; !ok && !hasRename(details, k) {
+			im.warn(WarnCode_Lossy, name, "property %q is required, but isn't described; it's been dropped", k)
+		}
+	}
+	defn.Representation.StructRepresentation_Map = &schemadmt.StructRepresentation_Map{}
+	if len(details.Keys) > 0 {
+		defn.Representation.StructRepresentation_Map.Fields = &details
+	}
+	return schemadmt.TypeDefn{TypeDefnStruct: defn}
+}
+
+func hasRename(details schemadmt.Map__FieldName__StructRepresentation_Map_FieldDetails, key string) bool {
+	for _, d := range details.Values {
+		if d.Rename != nil && *d.Rename == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (im *jsonSchemaImporter) tupleDefn(name string, n datamodel.Node) schemadmt.TypeDefn {
+	im.checkKeywords(name, n, "type", "prefixItems", "items", "minItems", "maxItems")
+	if items := jsLookup(n, "items"); items == nil || !(items.Kind() == datamodel.Kind_Bool && !mustBool(items)) {
+		im.warn(WarnCode_Lossy, name, "extra items are allowed after the prefixItems, but IPLD tuples can't have them; they'll be rejected")
+	}
+	prefixItems := jsLookup(n, "prefixItems")
+	minItems := prefixItems.Length()
+	if m := jsLookup(n, "minItems"); m != nil {
+		if i, err := m.AsInt(); err == nil && i < minItems {
+			minItems = i
+		}
+	}
+	defn := &schemadmt.TypeDefnStruct{
+		Fields: schemadmt.Map__FieldName__StructField{Values: map[string]schemadmt.StructField{}},
+		Representation: schemadmt.StructRepresentation{
+			StructRepresentation_Tuple: &schemadmt.StructRepresentation_Tuple{},
+		},
+	}
+	for itr := prefixItems.ListIterator(); itr != nil && !itr.Done(); {
+		i, v, err := itr.Next()
+		if err != nil {
+			break
+		}
+		fieldName := fmt.Sprintf("field%d", i)
+		typeName, nullable := im.fieldType(name, pascal(fieldName), fmt.Sprintf("field %q", fieldName), v)
+		defn.Fields.Keys = append(defn.Fields.Keys, fieldName)
+		defn.Fields.Values[fieldName] = schemadmt.StructField{
+			Type:     schemadmt.TypeNameOrInlineDefn{TypeName: &typeName},
+			Optional: boolPtrIfTrue(i >= minItems),
+			Nullable: boolPtrIfTrue(nullable),
+		}
+	}
+	return schemadmt.TypeDefn{TypeDefnStruct: defn}
+}
+
+func (im *jsonSchemaImporter) mapDefn(name string, n datamodel.Node) schemadmt.TypeDefn {
+	im.checkKeywords(name, n, "type", "additionalProperties", "propertyNames")
+	keyType := "String"
+	if pn := jsLookup(n, "propertyNames"); pn != nil {
+		if kt, _ := im.fieldType(name, "Key", "map keys", pn); kt != "Any" {
+			keyType = kt
+		}
+	}
+	valueType, valueNullable := im.fieldType(name, "Value", "map values", jsLookup(n, "additionalProperties"))
+	return schemadmt.TypeDefn{TypeDefnMap: &schemadmt.TypeDefnMap{
+		KeyType:       keyType,
+		ValueType:     schemadmt.TypeNameOrInlineDefn{TypeName: &valueType},
+		ValueNullable: boolPtrIfTrue(valueNullable),
+	}}
+}
+
+func (im *jsonSchemaImporter) enumDefn(name string, n datamodel.Node) schemadmt.TypeDefn {
+	im.checkKeywords(name, n, "type", "enum", "const")
+	var vals []datamodel.Node
+	if c := jsLookup(n, "const"); c != nil {
+		vals = append(vals, c)
+	}
+	if e := jsLookup(n, "enum"); e != nil && e.Kind() == datamodel.Kind_List {
+		for itr := e.ListIterator(); !itr.Done(); {
+			_, v, err := itr.Next()
+			if err != nil {
+				break
+			}
+			vals = append(vals, v)
+		}
+	}
+	defn := &schemadmt.TypeDefnEnum{}
+	switch vals[0].Kind() {
+	case datamodel.Kind_String:
+		repr := &schemadmt.EnumRepresentation_String{Values: map[string]string{}}
+		taken := map[string]bool{}
+		for _, v := range vals {
+			s, err := v.AsString()
+			if err != nil {
+				im.warn(WarnCode_Unsupported, name, "enums must have values that are all strings or all integers; allowing anything")
+				return jsonSchemaAnyDefn
+			}
+			member := s
+			if !jsIdentifier.MatchString(s) || strings.Contains(s, "$") || taken[s] {
+				member = nonTypeNameChars.ReplaceAllString(s, "_")
+				if member == "" || member[0] >= '0' && member[0] <= '9' {
+					member = "V" + member
+				}
+				for base, i := member, 2; taken[member]; i++ {
+					member = fmt.Sprintf("%s%d", base, i)
+				}
+				repr.Keys = append(repr.Keys, member)
+				repr.Values[member] = s
+			}
+			taken[member] = true
+			defn.Members = append(defn.Members, member)
+		}
+		defn.Representation.EnumRepresentation_String = repr
+	case datamodel.Kind_Int:
+		repr := &schemadmt.EnumRepresentation_Int{Values: map[string]int{}}
+		for _, v := range vals {
+			i, err := v.AsInt()
+			if err != nil {
+				im.warn(WarnCode_Unsupported, name, "enums must have values that are all strings or all integers; allowing anything")
+				return jsonSchemaAnyDefn
+			}
+			member := fmt.Sprintf("V%d", i)
+			if i < 0 {
+				member = fmt.Sprintf("Vneg%d", -i)
+			}
+			repr.Keys = append(repr.Keys, member)
+			repr.Values[member] = int(i)
+			defn.Members = append(defn.Members, member)
+		}
+		defn.Representation.EnumRepresentation_Int = repr
+	default:
+		im.warn(WarnCode_Unsupported, name, "enums must have values that are all strings or all integers; allowing anything")
+		return jsonSchemaAnyDefn
+	}
+	return schemadmt.TypeDefn{TypeDefnEnum: defn}
+}
+
+func (im *jsonSchemaImporter) unionDefn(name string, n datamodel.Node, keyword string) schemadmt.TypeDefn {
+	im.checkKeywords(name, n, keyword)
+	var alts []datamodel.Node
+	if l := jsLookup(n, keyword); l != nil && l.Kind() == datamodel.Kind_List {
+		for itr := l.ListIterator(); !itr.Done(); {
+			_, v, err := itr.Next()
+			if err != nil {
+				break
+			}
+			if isJSONSchemaNull(v) {
+				im.warn(WarnCode_Lossy, name, "named types can't be nullable in IPLD Schemas (only their uses can); null has been dropped")
+				continue
+			}
+			alts = append(alts, v)
+		}
+	}
+	switch len(alts) {
+	case 0:
+		im.warn(WarnCode_Unsupported, name, "%s has no alternatives that can be expressed; allowing anything", keyword)
+		return jsonSchemaAnyDefn
+	case 1:
+		return im.defn(name, alts[0])
+	}
+
+	// If every alternative is an object with exactly one property, which is required, that's a keyed union.
+	keys := make([]string, len(alts))
+	keyed := true
+	for i, alt := range alts {
+		props := jsLookup(alt, "properties")
+		req, _ := jsLookupSingleString(alt, "required")
+		if props == nil || props.Length() != 1 || req == "" || jsLookup(props, req) == nil {
+			keyed = false
+			break
+		}
+		keys[i] = req
+	}
+	if keyed {
+		defn := &schemadmt.TypeDefnUnion{}
+		repr := &schemadmt.UnionRepresentation_Keyed{Values: map[string]schemadmt.UnionMember{}}
+		seen := map[string]bool{}
+		for i, alt := range alts {
+			memberType, nullable := im.fieldType(name, pascal(keys[i]), fmt.Sprintf("member %q", keys[i]), jsLookup(jsLookup(alt, "properties"), keys[i]))
+			if nullable || seen[memberType] {
+				im.warn(WarnCode_Unsupported, name, "the alternatives of a union must all be different types, and not nullable; allowing anything")
+				return jsonSchemaAnyDefn
+			}
+			seen[memberType] = true
+			mt := memberType
+			defn.Members = append(defn.Members, schemadmt.UnionMember{TypeName: &mt})
+			repr.Keys = append(repr.Keys, keys[i])
+			repr.Values[keys[i]] = schemadmt.UnionMember{TypeName: &mt}
+		}
+		defn.Representation.UnionRepresentation_Keyed = repr
+		return schemadmt.TypeDefn{TypeDefnUnion: defn}
+	}
+
+	// Otherwise, it'd better be a kinded union.
+	var members []string
+	for i, alt := range alts {
+		memberType, nullable := im.fieldType(name, fmt.Sprintf("Option%d", i+1), fmt.Sprintf("alternative %d", i+1), alt)
+		if nullable {
+			im.warn(WarnCode_Unsupported, name, "the alternatives of a union can't be nullable; allowing anything")
+			return jsonSchemaAnyDefn
+		}
+		members = append(members, memberType)
+	}
+	return im.kindedUnionDefn(name, members)
+}
+
+// kindedUnionDefn makes a kinded union.  The kinds of the members aren't filled in until finishKindedUnions, since the member types might not have been defined yet.
+func (im *jsonSchemaImporter) kindedUnionDefn(name string, members []string) schemadmt.TypeDefn {
+	defn := &schemadmt.TypeDefnUnion{}
+	for _, m := range members {
+		m := m
+		defn.Members = append(defn.Members, schemadmt.UnionMember{TypeName: &m})
+	}
+	defn.Representation.UnionRepresentation_Kinded = &schemadmt.UnionRepresentation_Kinded{Values: map[string]schemadmt.UnionMember{}}
+	im.kinded = append(im.kinded, name)
+	return schemadmt.TypeDefn{TypeDefnUnion: defn}
+}
+
+func (im *jsonSchemaImporter) finishKindedUnions() {
+	for _, name := range im.kinded {
+		defn := im.out.Types.Values[name].TypeDefnUnion
+		if defn == nil {
+			continue // Already replaced.
+		}
+		repr := defn.Representation.UnionRepresentation_Kinded
+		ok := true
+		for _, m := range defn.Members {
+			kind := im.reprKind(*m.TypeName)
+			if kind == "" {
+				im.warn(WarnCode_Unsupported, name, "the alternatives of a union must each be a different kind of data, and %s could be any kind; allowing anything", *m.TypeName)
+				ok = false
+				break
+			}
+			if _, exists := repr.Values[kind]; exists {
+				im.warn(WarnCode_Unsupported, name, "the alternatives of a union must each be a different kind of data, and more than one is a %s; allowing anything", kind)
+				ok = false
+				break
+			}
+			repr.Keys = append(repr.Keys, kind)
+			repr.Values[kind] = m
+		}
+		if !ok {
+			im.out.Types.Values[name] = jsonSchemaAnyDefn
+		}
+	}
+}
+
+// reprKind returns the data model kind that a type's representation has (as it's written in a kinded union), or "" if it isn't just one kind.
+func (im *jsonSchemaImporter) reprKind(typeName string) string {
+	switch typeName {
+	case "Bool":
+		return "bool"
+	case "Int":
+		return "int"
+	case "Float":
+		return "float"
+	case "String":
+		return "string"
+	case "Bytes":
+		return "bytes"
+	case "Link":
+		return "link"
+	case "Map":
+		return "map"
+	case "List":
+		return "list"
+	case "Any":
+		return ""
+	}
+	defn := im.out.Types.Values[typeName]
+	switch {
+	case defn.TypeDefnBool != nil:
+		return "bool"
+	case defn.TypeDefnInt != nil:
+		return "int"
+	case defn.TypeDefnFloat != nil:
+		return "float"
+	case defn.TypeDefnString != nil:
+		return "string"
+	case defn.TypeDefnBytes != nil:
+		return "bytes"
+	case defn.TypeDefnLink != nil:
+		return "link"
+	case defn.TypeDefnMap != nil:
+		return "map"
+	case defn.TypeDefnList != nil:
+		return "list"
+	case defn.TypeDefnStruct != nil && defn.TypeDefnStruct.Representation.StructRepresentation_Tuple != nil:
+		return "list"
+	case defn.TypeDefnStruct != nil:
+		return "map"
+	case defn.TypeDefnEnum != nil && defn.TypeDefnEnum.Representation.EnumRepresentation_Int != nil:
+		return "int"
+	case defn.TypeDefnEnum != nil:
+		return "string"
+	case defn.TypeDefnUnion != nil && defn.TypeDefnUnion.Representation.UnionRepresentation_Keyed != nil:
+		return "map"
+	default:
+		return ""
+	}
+}
+
+// jsonSchemaAnnotations are keywords which don't affect what's valid, so there's nothing lost by dropping them.
+var jsonSchemaAnnotations = map[string]bool{
+	"$schema": true, "$id": true, "$defs": true, "definitions": true, "$comment": true, "$anchor": true,
+	"title": true, "description": true, "examples": true, "default": true,
+	"deprecated": true, "readOnly": true, "writeOnly": true,
+	"contentEncoding": true, "contentMediaType": true,
+}
+
+// checkKeywords warns about any keywords in a schema that aren't annotations, and aren't in the list of keywords that have been handled.
+func (im *jsonSchemaImporter) checkKeywords(name string, n datamodel.Node, handled ...string) {
+	im.checkKeywordsAt(name, "", n, handled...)
+}
+
+// checkKeywordsAt is checkKeywords, for a schema somewhere inside the type, described by where.
+func (im *jsonSchemaImporter) checkKeywordsAt(name string, where string, n datamodel.Node, handled ...string) {
+	for itr := n.MapIterator(); !itr.Done(); {
+		k, _, err := itr.Next()
+		if err != nil {
+			return
+		}
+		key, _ := k.AsString()
+		if jsonSchemaAnnotations[key] {
+			continue
+		}
+		isHandled := false
+		for _, h := range handled {
+			if key == h {
+				isHandled = true
+				break
+			}
+		}
+		if !isHandled {
+			im.warnAt(WarnCode_Lossy, name, where, "the %q keyword can't be expressed in an IPLD Schema; it's been dropped", key)
+		}
+	}
+}
+
+// isDagJSONLinkShape returns true if the schema describes {"/": "<string>"}, which is how dag-json writes links.
+func isDagJSONLinkShape(n datamodel.Node) bool {
+	slash := jsLookup(jsLookup(n, "properties"), "/")
+	if slash == nil || jsLookup(n, "properties").Length() != 1 {
+		return false
+	}
+	typ, _ := jsLookupString(slash, "type")
+	return typ == "string"
+}
+
+// isDagJSONBytesShape returns true if the schema describes {"/": {"bytes": "<string>"}}, which is how dag-json writes bytes.
+func isDagJSONBytesShape(n datamodel.Node) bool {
+	slash := jsLookup(jsLookup(n, "properties"), "/")
+	if slash == nil || jsLookup(n, "properties").Length() != 1 {
+		return false
+	}
+	bytes := jsLookup(jsLookup(slash, "properties"), "bytes")
+	if bytes == nil {
+		return false
+	}
+	typ, _ := jsLookupString(bytes, "type")
+	return typ == "string"
+}
+
+func isJSONSchemaNull(n datamodel.Node) bool {
+	typ, err := jsLookupString(n, "type")
+	return err == nil && typ == "null" && n.Length() == 1
+}
+
+// withoutNullType returns a copy of a schema, with "null" removed from its list of types.
+func withoutNullType(n datamodel.Node) datamodel.Node {
+	nb := n.Prototype().NewBuilder()
+	ma, _ := nb.BeginMap(n.Length())
+	for itr := n.MapIterator(); !itr.Done(); {
+		k, v, _ := itr.Next()
+		key, _ := k.AsString()
+		if key == "type" && v.Kind() == datamodel.Kind_List {
+			lb := v.Prototype().NewBuilder()
+			la, _ := lb.BeginList(v.Length())
+			for itr := v.ListIterator(); !itr.Done(); {
+				_, t, _ := itr.Next()
+				if s, _ := t.AsString(); s != "null" {
+					la.AssembleValue().AssignNode(t)
+				}
+			}
+			la.Finish()
+			v = lb.Build()
+		}
+		ma.AssembleKey().AssignString(key)
+		ma.AssembleValue().AssignNode(v)
+	}
+	ma.Finish()
+	return nb.Build()
+}
+
+// jsonSchemaImplicit returns the "default" of a property schema as an implicit value, if it's a kind that implicits can be.
+func jsonSchemaImplicit(n datamodel.Node) *schemadmt.AnyScalar {
+	d := jsLookup(n, "default")
+	if d == nil {
+		return nil
+	}
+	switch d.Kind() {
+	case datamodel.Kind_String:
+		s, _ := d.AsString()
+		return &schemadmt.AnyScalar{String: &s}
+	case datamodel.Kind_Int:
+		i, _ := d.AsInt()
+		i2 := int(i)
+		return &schemadmt.AnyScalar{Int: &i2}
+	case datamodel.Kind_Bool:
+		b, _ := d.AsBool()
+		return &schemadmt.AnyScalar{Bool: &b}
+	default:
+		return nil
+	}
+}
+
+// jsLookup returns the value for a key in a map node, or nil if the node isn't a map or doesn't have the key.
+func jsLookup(n datamodel.Node, key string) datamodel.Node {
+	if n == nil || n.Kind() != datamodel.Kind_Map {
+		return nil
+	}
+	v, err := n.LookupByString(key)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+func jsLookupString(n datamodel.Node, key string) (string, error) {
+	v := jsLookup(n, key)
+	if v == nil {
+		return "", fmt.Errorf("no %q", key)
+	}
+	return v.AsString()
+}
+
+// jsLookupSingleString returns the only string in a list, like the "required" list of an object with one property.
+func jsLookupSingleString(n datamodel.Node, key string) (string, error) {
+	v := jsLookup(n, key)
+	if v == nil || v.Kind() != datamodel.Kind_List || v.Length() != 1 {
+		return "", fmt.Errorf("no single %q", key)
+	}
+	first, err := v.LookupByIndex(0)
+	if err != nil {
+		return "", err
+	}
+	return first.AsString()
+}
+
+func mustBool(n datamodel.Node) bool {
+	b, _ := n.AsBool()
+	return b
+}
+
+func boolPtrIfTrue(b bool) *bool {
+	if !b {
+		return nil
+	}
+	return &b
+}
+
+// pascal turns a name like "line_items" into "LineItems", for making type names out of field names.
+func pascal(s string) string {
+	var sb strings.Builder
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == '_' || r == '-' }) {
+		sb.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return sb.String()
+}
@@ -0,0 +1,138 @@
+package schema
+
+import (
+	"io"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/node/bindnode"
+	"github.com/ipld/go-ipld-prime/schema"
+
+	"github.com/ipld/go-ipldtool/app/shared"
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+// DataSchema is what the "--schema", "--type", and "--schema-lens" flags say about how to handle data:
+// which type it should match (if any), and whether it should be seen in its typed view or as its representation.
+// Commands that read data and can apply a schema to it (read, and shell) share these flags, and use ParseDataSchemaArgs for them.
+type DataSchema struct {
+	// Type is the type the data should match at its root, or nil if no schema was given.
+	Type schema.Type
+
+	// Lens is "typed" or "representation" if there's a schema, and empty if not.
+	Lens string
+}
+
+// ParseDataSchemaArgs loads the schema named by the "--schema" flag, finds the type named by the "--type" flag in it,
+// and reads the "--schema-lens" flag.
+// If there's no schema, those flags (and any others named in needSchema, which only make sense with a schema too) are refused.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- if the flags don't make sense together, or the type isn't in the schema.
+//   - ipldtool-error-io -- if the schema file can't be opened.
+//   - schema-dsl-parse-failed -- if the schema document didn't parse.
+//   - schema-compile-failed -- if the schema was parsed, but was logically invalid.
+func ParseDataSchemaArgs(args *cli.Context, needSchema ...string) (DataSchema, error) {
+	if !args.IsSet("schema") {
+		flags := append(append([]string{"type"}, needSchema...), "schema-lens")
+		for _, flag := range flags {
+			if args.IsSet(flag) {
+				return DataSchema{}, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "the %s arguments can only be used together with a schema", joinAnd(flags))
+			}
+		}
+		return DataSchema{}, nil
+	}
+	if !args.IsSet("type") {
+		return DataSchema{}, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "the type argument is required when using a schema")
+	}
+	lens, err := ParseLensArg(args, "schema-lens")
+	if err != nil {
+		return DataSchema{}, err
+	}
+	dmt, err := DSLParseFile(args.String("schema"))
+	if err != nil {
+		return DataSchema{}, err
+	}
+	ts, err := SchemaCompile(dmt)
+	if err != nil {
+		return DataSchema{}, err
+	}
+	typ := ts.TypeByName(args.String("type"))
+	if typ == nil {
+		return DataSchema{}, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "type argument not recognized: there's no type named %q in the schema", args.String("type"))
+	}
+	return DataSchema{Type: typ, Lens: lens}, nil
+}
+
+// ParseLensArg returns the value of a flag that says whether to use the typed view of data or its representation
+// (like "--schema-lens", or read's "--path-mode"), defaulting to "typed".
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- if the value is neither "typed" nor "representation".
+func ParseLensArg(args *cli.Context, flagName string) (string, error) {
+	switch v := args.String(flagName); v {
+	case "":
+		return "typed", nil
+	case "typed", "representation":
+		return v, nil
+	default:
+		return "", ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "%s argument not recognized: must be either \"typed\" or \"representation\"", flagName)
+	}
+}
+
+// Decode decodes data with the codec: as the type, if there's a schema; or else with the codec's Prototype, if it has one; or else as basicnodes.
+//
+// Errors:
+//
+//   - ipldtool-error-data-invalid -- if the data couldn't be decoded, or doesn't match the type.
+func (ds DataSchema) Decode(r io.Reader, inputCodec shared.CodecInfo) (_ datamodel.Node, err error) {
+	var np datamodel.NodePrototype = basicnode.Prototype.Any
+	switch {
+	case ds.Type != nil:
+		np = bindnode.Prototype(nil, ds.Type).Representation()
+	case inputCodec.Prototype != nil:
+		np = inputCodec.Prototype
+	}
+	// bindnode still panics for some kinds of mismatched data, rather than returning errors.
+	defer func() {
+		if r := recover(); r != nil {
+			err = ipldtoolerr.Newf(shared.ErrCode_DataInvalid, "data does not match the schema: %v", r)
+		}
+	}()
+	n, err := ipld.DecodeStreamingUsingPrototype(r, inputCodec.Decoder, np)
+	if err != nil {
+		if ds.Type != nil {
+			return nil, ipldtoolerr.Newf(shared.ErrCode_DataInvalid, "data does not match the schema: %s", err)
+		}
+		return nil, ipldtoolerr.Newf(shared.ErrCode_DataInvalid, "could not decode input as %s: %s", inputCodec.Name, err)
+	}
+	return n, nil
+}
+
+// LensView returns a node the way a lens says it should be seen:
+// if the lens is "representation", typed nodes are swapped for their representation.
+// Nodes from ADLs are left as they are, since their representation is the substrate they were built from, not a view of the same data.
+func LensView(n datamodel.Node, lens string) datamodel.Node {
+	if tn, ok := n.(schema.TypedNode); ok && lens == "representation" && !shared.IsADLNode(n) {
+		return tn.Representation()
+	}
+	return n
+}
+
+// joinAnd joins words into a list, like "a, b, and c" (or "a and b").
+func joinAnd(words []string) string {
+	switch len(words) {
+	case 1:
+		return words[0]
+	case 2:
+		return words[0] + " and " + words[1]
+	default:
+		return strings.Join(words[:len(words)-1], ", ") + ", and " + words[len(words)-1]
+	}
+}
@@ -0,0 +1,181 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	"github.com/ipld/go-ipld-prime/node/bindnode"
+	"github.com/ipld/go-ipld-prime/schema"
+
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+// ReprPathLift follows a path through the representation of typed data,
+// and returns the node reached in its typed form.
+//
+// It works by keeping track of the type at each step:
+// each path segment is interpreted according to the representation strategy of the type it's applied to
+// (so, for example, a segment applied to a struct with a map representation is matched against the field keys, including any renames,
+// and a segment applied to a struct with a tuple representation is a field index).
+// Kinded unions are transparent, as they are in the representation; keyed unions take a segment for the member's discriminant.
+//
+// Links are followed as they're encountered (as with regular pathing), loading them with the LinkSystem,
+// but only if the link type states what type it points to; otherwise, there's no way to know the type of the data beyond it.
+//
+// Errors:
+//
+//   - schema-repr-path-failed -- if the path doesn't exist in the data, or a link can't be loaded.
+//   - schema-repr-path-ambiguous -- if the path reaches a position which has no type of its own
+//     (e.g. inside a representation like stringjoin, which is a single string, or beyond a link with no declared target type).
+func ReprPathLift(n schema.TypedNode, p datamodel.Path, lsys *linking.LinkSystem) (schema.TypedNode, error) {
+	cur := n
+	for i, seg := range p.Segments() {
+		next, err := ReprLookup(cur, p.Truncate(i), seg)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case next.IsAbsent():
+			return nil, ipldtoolerr.Newf(ErrCode_ReprPathFailed, "at %q: there's no value here", p.Truncate(i+1))
+		case next.IsNull() && i+1 < p.Len():
+			return nil, ipldtoolerr.Newf(ErrCode_ReprPathFailed, "at %q: the value here is null, so the path can't continue", p.Truncate(i+1))
+		case next.IsNull():
+			return nil, ipldtoolerr.Newf(ErrCode_ReprPathAmbiguous, "at %q: the value here is null, which has no type of its own", p.Truncate(i+1))
+		}
+		cur = next.(schema.TypedNode)
+
+		// Dereference any links, like regular pathing would.
+		for cur.Type().TypeKind() == schema.TypeKind_Link {
+			cur, err = loadTypedLink(cur, p.Truncate(i+1), lsys)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return cur, nil
+}
+
+// ReprLookup takes one step of a path through the representation of typed data, the same way ReprPathLift does,
+// and returns the value reached in its typed form.
+// The path given is where the node is, and is only used in error messages.
+//
+// Links aren't followed: if the value reached is a link, the link is what's returned.
+// The value reached may also be null or absent (which have no type of their own), so the caller should check for those.
+//
+// Errors:
+//
+//   - schema-repr-path-failed -- if the segment doesn't exist in the data.
+//   - schema-repr-path-ambiguous -- if the node has no typed positions inside it (e.g. it's a struct with a stringjoin representation).
+func ReprLookup(n schema.TypedNode, at datamodel.Path, seg datamodel.PathSegment) (datamodel.Node, error) {
+	cur := n
+	for {
+		var next datamodel.Node
+		var err error
+		switch t := cur.Type().(type) {
+		case *schema.TypeStruct:
+			switch stg := t.RepresentationStrategy().(type) {
+			case schema.StructRepresentation_Map:
+				var field *schema.StructField
+				for _, f := range t.Fields() {
+					if stg.GetFieldKey(f) == seg.String() {
+						field = &f
+						break
+					}
+				}
+				if field == nil {
+					return nil, ipldtoolerr.Newf(ErrCode_ReprPathFailed, "at %q: type %s has no field with the key %q in its representation", at, t.Name(), seg)
+				}
+				next, err = cur.LookupByString(field.Name())
+			case schema.StructRepresentation_Tuple:
+				idx, err2 := seg.Index()
+				if err2 != nil || idx < 0 || idx >= int64(len(t.Fields())) {
+					return nil, ipldtoolerr.Newf(ErrCode_ReprPathFailed, "at %q: type %s is represented as a tuple of %d fields; %q is not an index in it", at, t.Name(), len(t.Fields()), seg)
+				}
+				next, err = cur.LookupByString(t.Fields()[idx].Name())
+			default:
+				return nil, ipldtoolerr.Newf(ErrCode_ReprPathAmbiguous, "at %q: type %s has a %s representation, which has no typed positions inside it", at, t.Name(), reprStrategyName(stg))
+			}
+		case *schema.TypeMap, *schema.TypeList:
+			next, err = cur.LookupBySegment(seg)
+		case *schema.TypeUnion:
+			_, member, err2 := cur.MapIterator().Next()
+			if err2 != nil {
+				return nil, ipldtoolerr.Newf(ErrCode_ReprPathFailed, "at %q: could not get the member of union %s: %s", at, t.Name(), err2)
+			}
+			switch stg := t.RepresentationStrategy().(type) {
+			case schema.UnionRepresentation_Kinded:
+				// Kinded unions don't take up a segment of their own: the representation is the member's representation.
+				cur = member.(schema.TypedNode)
+				continue
+			case schema.UnionRepresentation_Keyed:
+				if key := stg.GetDiscriminant(member.(schema.TypedNode).Type()); key != seg.String() {
+					return nil, ipldtoolerr.Newf(ErrCode_ReprPathFailed, "at %q: union %s has the key %q in this data, not %q", at, t.Name(), key, seg)
+				}
+				next = member
+			default:
+				return nil, ipldtoolerr.Newf(ErrCode_ReprPathAmbiguous, "at %q: union %s has a %s representation, which has no typed positions inside it", at, t.Name(), reprStrategyName(stg))
+			}
+		default:
+			return nil, ipldtoolerr.Newf(ErrCode_ReprPathFailed, "at %q: cannot path into type %s (it's of kind %s)", at, cur.Type().Name(), cur.Type().TypeKind())
+		}
+		if err != nil {
+			return nil, ipldtoolerr.Newf(ErrCode_ReprPathFailed, "at %q: %s", at, err)
+		}
+		return next, nil
+	}
+}
+
+func loadTypedLink(n schema.TypedNode, at datamodel.Path, lsys *linking.LinkSystem) (_ schema.TypedNode, err error) {
+	t := n.Type().(*schema.TypeLink)
+	if !t.HasReferencedType() {
+		return nil, ipldtoolerr.Newf(ErrCode_ReprPathAmbiguous, "at %q: link type %s doesn't say what type it points to, so the data beyond it can't be typed", at, t.Name())
+	}
+	lnk, err := n.AsLink()
+	if err != nil {
+		return nil, ipldtoolerr.Newf(ErrCode_ReprPathFailed, "at %q: %s", at, err)
+	}
+	// bindnode still panics for some kinds of mismatched data, rather than returning errors.
+	defer func() {
+		if r := recover(); r != nil {
+			err = ipldtoolerr.Newf(ErrCode_ReprPathFailed, "at %q: data at %s does not match type %s: %v", at, lnk, t.ReferencedType().Name(), r)
+		}
+	}()
+	np := bindnode.Prototype(nil, t.ReferencedType()).Representation()
+	loaded, err := lsys.Load(linking.LinkContext{Ctx: context.Background(), LinkPath: at}, lnk, np)
+	if err != nil {
+		return nil, ipldtoolerr.Newf(ErrCode_ReprPathFailed, "at %q: could not load %s as type %s: %s", at, lnk, t.ReferencedType().Name(), err)
+	}
+	return loaded.(schema.TypedNode), nil
+}
+
+// reprStrategyName returns the DSL keyword for a representation strategy, for use in messages.
+func reprStrategyName(stg interface{}) string {
+	switch stg.(type) {
+	case schema.StructRepresentation_Map:
+		return "map"
+	case schema.StructRepresentation_Tuple:
+		return "tuple"
+	case schema.StructRepresentation_Stringjoin:
+		return "stringjoin"
+	case schema.StructRepresentation_StringPairs:
+		return "stringpairs"
+	case schema.UnionRepresentation_Envelope:
+		return "envelope"
+	case schema.UnionRepresentation_Inline:
+		return "inline"
+	case schema.UnionRepresentation_Stringprefix:
+		return "stringprefix"
+	case schema.UnionRepresentation_Keyed:
+		return "keyed"
+	case schema.UnionRepresentation_Kinded:
+		return "kinded"
+	case schema.EnumRepresentation_String:
+		return "string"
+	case schema.EnumRepresentation_Int:
+		return "int"
+	default:
+		return fmt.Sprintf("%T", stg)
+	}
+}
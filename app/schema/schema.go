@@ -1,24 +1,29 @@
 package schema
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"fmt"
-	"go/format"
+	"io"
 	"os"
-	"path"
 	"path/filepath"
-	"text/template"
+	"strings"
 
 	"github.com/urfave/cli/v2"
 
 	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec"
+	"github.com/ipld/go-ipld-prime/codec/json"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
 	"github.com/ipld/go-ipld-prime/node/bindnode"
 	"github.com/ipld/go-ipld-prime/schema"
 	schemadmt "github.com/ipld/go-ipld-prime/schema/dmt"
-	schemadsl "github.com/ipld/go-ipld-prime/schema/dsl"
-	gengo "github.com/ipld/go-ipld-prime/schema/gen/go"
 
 	"github.com/ipld/go-ipldtool/app/shared"
+	"github.com/ipld/go-ipldtool/app/workspace"
 	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
 )
 
@@ -45,21 +50,56 @@ var Cmd_Schema = &cli.Command{
 			},
 		},
 		Action: Action_SchemaParse,
+	}, {
+		Name:      "print",
+		Usage:     "Print a schema DMT document in the schema DSL.",
+		ArgsUsage: "<dmt-file-or-cid-or-dash>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "input",
+				Usage: `Defines what codec the DMT should be parsed with.  If not given, it's determined by the CID (if the DMT is loaded from storage), or guessed.  Valid arguments are codecs, specified as the word "codec:" followed by a multicodec name, or "codec:0x" followed by a multicodec indicator number in hexidecimal.`,
+			},
+		},
+		Action: Action_SchemaPrint,
+	}, {
+		Name:      "fmt",
+		Usage:     "Reformat schema DSL documents, printing the result (or rewriting the files, or checking them).",
+		ArgsUsage: "<schema-file-or-dash>...",
+		Description: `Each document is parsed, and printed back out in the same form "ipld schema print" uses.  Comments are kept.
+
+By default the result is printed.  With "--write", files are rewritten in place instead.
+With "--check", nothing is printed or rewritten; instead, the names of any files that aren't already formatted are listed, and the command exits nonzero if there are any.`,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "check",
+				Usage: `Check whether the documents are already formatted, listing those that aren't, and exiting nonzero if any aren't.`,
+			},
+			&cli.BoolFlag{
+				Name:  "write",
+				Usage: `Rewrite the files in place, rather than printing the result.`,
+			},
+		},
+		Action: Action_SchemaFmt,
 	}, {
 		Name:  "compile",
 		Usage: "Compile a schema DMT document, exiting nonzero and reporting errors if anything is logically invalid.",
 	}, {
-		Name:  "codegen",
-		Usage: "Generate code for working with IPLD schemas",
+		Name:      "codegen",
+		Usage:     "Generate code for working with IPLD schemas",
+		ArgsUsage: "<schema-file-or-dash-or-CID>",
+		Description: `The schema can be a DSL document (given as a filename, or "-" for stdin), or the CID of a schema DMT in storage.
+
+The generated files are written into the output directory, unless "--output=-" is used, in which case they're written to stdout as a tar archive instead.
+With "--check" or "--diff", nothing is written; instead, the files in the output directory are compared with what would be generated, and the command fails if they differ.  "--diff" also prints a unified diff of what would change.`,
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:     "generator",
-				Usage:    "Generator to be used for creating the code. Currently supports (go-gengo, go-bindnode)",
+				Usage:    "Generator to be used for creating the code. Currently supports (go-gengo, go-bindnode, typescript, rust-serde)",
 				Required: true,
 			},
 			&cli.PathFlag{
 				Name:  "output",
-				Usage: "Directory where the codegen files should be output to",
+				Usage: "Directory where the codegen files should be output to, or \"-\" to write them to stdout as a tar archive",
 				Value: "ipldsch",
 			},
 			&cli.StringFlag{
@@ -67,10 +107,204 @@ var Cmd_Schema = &cli.Command{
 				Usage: "Package name for generated files",
 				Value: "ipldsch",
 			},
+			&cli.StringSliceFlag{
+				Name:  "go-type",
+				Usage: `(go-bindnode) Use a different Go type for a schema type, written as "SchemaType:GoType".  A plain name renames the declared Go type; a qualified one (like "cid.Cid") uses an existing type, whose package must be imported with --go-import.  Can be used more than once.`,
+			},
+			&cli.StringFlag{
+				Name:        "go-optional",
+				Usage:       `(go-bindnode) How optional struct fields are written: "pointer" or "value".  (bindnode currently requires pointers, so "value" is refused for schemas that have any optional fields.)`,
+				DefaultText: "pointer",
+			},
+			&cli.StringSliceFlag{
+				Name:  "go-import",
+				Usage: `(go-bindnode) An extra Go package to import, as an import path, or "name:path".  Can be used more than once.`,
+			},
+			&cli.BoolFlag{
+				Name:  "check",
+				Usage: "Don't write anything; instead, fail if the files in the output directory aren't exactly what would be generated.  Useful for checking that generated code is up to date.",
+			},
+			&cli.BoolFlag{
+				Name:  "diff",
+				Usage: "Like --check, but also print a unified diff from the files in the output directory to what would be generated.",
+			},
 		},
 		Action: Action_GoCodegen,
+	}, {
+		Name:      "export",
+		Usage:     "Convert a schema DSL document into another schema language.",
+		ArgsUsage: "<schema-file-or-dash>",
+		Description: `Warnings are printed (to stderr) for anything the other schema language can't express, but the conversion carries on regardless.
+
+Formats:
+
+   jsonschema -- JSON Schema, draft 2020-12.  Every type becomes an entry in "$defs", and the document refers to the type named by --type, if any.
+      Representations are what's described (since that's what a JSON Schema validator will see), with links and bytes in the form dag-json uses for them.`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "format",
+				Usage:    "Schema language to convert to. Currently supports (jsonschema)",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "type",
+				Usage: "Name of the type that the document as a whole should describe.",
+			},
+			&cli.StringFlag{
+				Name:        "output",
+				Usage:       `Defines what format the document should be produced in.  Valid arguments are codecs, specified as the word "codec:" followed by a multicodec name, or "codec:0x" followed by a multicodec indicator number in hexidecimal.`,
+				DefaultText: "codec:json",
+			},
+		},
+		Action: Action_SchemaExport,
+	}, {
+		Name:      "import",
+		Usage:     "Convert a document in another schema language into the DMT form, as best as possible.",
+		ArgsUsage: "<file-or-dash>",
+		Description: `Warnings are printed (to stderr) for anything that can't be expressed in an IPLD Schema, but the conversion carries on regardless, and the result is compiled to make sure it's valid.
+
+Formats:
+
+   jsonschema -- JSON Schema.  Entries in "$defs" (or "definitions") become types of the same name, and if the document itself describes something, that becomes a type too (named by its "title", or "Root").
+      Inline schemas that need a type of their own get one, named after where they were found.`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "from",
+				Usage:    "Schema language to convert from. Currently supports (jsonschema)",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:        "output",
+				Usage:       `Defines what format the DMT should be produced in.  Valid arguments are codecs, specified as the word "codec:" followed by a multicodec name, or "codec:0x" followed by a multicodec indicator number in hexidecimal.`,
+				DefaultText: "codec:json",
+			},
+		},
+		Action: Action_SchemaImport,
+	}, {
+		Name:      "compat",
+		Usage:     "Compare two versions of a schema, and report whether data still works across each change.",
+		ArgsUsage: "<old> <new>",
+		Description: `Each schema can be a DSL document (a filename, or "-" for stdin), or the CID of a schema DMT in storage.
+
+Every change is reported with whether it's compatible in each direction:
+"oldDataNewSchema" is whether data that matched the old schema still matches the new one;
+"newDataOldSchema" is whether data that matches the new schema would have matched the old one.
+Compatibility is about data, so it's representations that are compared: renaming a struct field is fine if its key stays the same, for example.
+
+The command exits with an error if any change breaks the kind of compatibility named by --require:
+
+   backward -- old data must still be readable with the new schema.  (The default.)
+   forward -- new data must be readable with the old schema.
+   full -- both.
+   none -- only report; never fail.`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "require",
+				Usage:       "Which direction of compatibility is required: (backward|forward|full|none)",
+				DefaultText: "backward",
+			},
+			&cli.StringFlag{
+				Name:        "output",
+				Usage:       `Defines what format the report should be produced in.  Valid arguments are codecs, specified as the word "codec:" followed by a multicodec name, or "codec:0x" followed by a multicodec indicator number in hexidecimal.`,
+				DefaultText: "codec:json",
+			},
+		},
+		Action: Action_SchemaCompat,
+	}, {
+		Name:      "transform",
+		Usage:     "Apply well-known transforms to a schema, producing the DMT form of the result, emitted in JSON by default.",
+		ArgsUsage: "<schema>",
+		Description: `The schema can be a DSL document (a filename, or "-" for stdin), or the CID of a schema DMT in storage.
+
+Transforms are applied in the order they're listed below (regardless of the order the flags are given in), and the schema is compiled after each one, to make sure it's still valid.
+So, for example, --prune-unreachable-from should use the names that any --rename-type flags give.`,
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:  "rename-type",
+				Usage: "Rename a type (and update everything that refers to it).  Given as \"Old:New\".  Can be used more than once.",
+			},
+			&cli.BoolFlag{
+				Name:  "strip-renames",
+				Usage: "Remove all renames from struct fields, so each field's key in the data becomes its name.",
+			},
+			&cli.BoolFlag{
+				Name:  "default-representations",
+				Usage: "Replace every representation with the default for its kind of type (and keyed, using member names, for unions).",
+			},
+			&cli.StringSliceFlag{
+				Name:  "prune-unreachable-from",
+				Usage: "Remove every type that can't be reached from this type.  Can be used more than once, to keep everything reachable from any of them.",
+			},
+			&cli.StringFlag{
+				Name:        "output",
+				Usage:       `Defines what format the DMT should be produced in.  Valid arguments are codecs, specified as the word "codec:" followed by a multicodec name, or "codec:0x" followed by a multicodec indicator number in hexidecimal.`,
+				DefaultText: "codec:json",
+			},
+		},
+		Action: Action_SchemaTransform,
+	}, {
+		Name:      "infer",
+		Usage:     "Work out a schema that describes some sample data, printing it in the DSL by default.",
+		ArgsUsage: "<sample>...",
+		Description: `Each sample can be a CID (to load from storage), a filename, or "-" for stdin.  All of the samples are described by the one schema.
+
+Maps become structs (with optional fields, for keys that only some samples have), unless they have more distinct keys than --max-struct-keys, in which case they become maps.
+Anything that's null in some samples becomes nullable, and anything that's different kinds in different samples becomes a kinded union.
+Types are named after where they were found: the samples are the type named by --type, and the type of a field is named after the type that has the field, followed by the field name.
+
+With --follow-links, the blocks that links point to are loaded from storage, and described too, so links become typed links.
+A block that looks like one of the blocks that led to it (the same kind, and if it's a map, the same keys) is assumed to be the same type, so that things like linked lists come out as recursive types.`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "input",
+				Usage: `Defines what format the samples should be expected to be in.  Only relevant if they're from files or stdin; if a sample is given by CID, that already implies a codec.  Valid arguments must start with "codec:" followed by a multicodec name, or "codec:0x" followed by a multicodec indicator number in hexidecimal.`,
+			},
+			&cli.StringFlag{
+				Name:        "type",
+				Usage:       "Name for the type of the samples themselves.",
+				DefaultText: "Root",
+			},
+			&cli.IntFlag{
+				Name:        "max-struct-keys",
+				Usage:       "The most distinct keys a map can have (across all the samples) and still be a struct.",
+				DefaultText: fmt.Sprint(DefaultMaxStructKeys),
+			},
+			&cli.BoolFlag{
+				Name:  "follow-links",
+				Usage: "Load the blocks that links point to from storage, and describe them too.",
+			},
+			&cli.StringFlag{
+				Name:        "output",
+				Usage:       `Defines what format the schema should be produced in.  Valid arguments are "dsl", or the word "codec:" followed by a multicodec name, or "codec:0x" followed by a multicodec indicator number in hexidecimal (which produce the DMT form).`,
+				DefaultText: "dsl",
+			},
+		},
+		Action: Action_SchemaInfer,
+	}, {
+		Name:      "doc",
+		Usage:     "Generate human-readable documentation for a schema, in Markdown or HTML.",
+		ArgsUsage: "<schema>",
+		Description: `The schema can be a DSL document (a filename, or "-" for stdin), or the CID of a schema DMT in storage.
+
+There's a section for each type, saying what kind of type it is, how it's represented, what fields or members it has, which other types refer to it, and an example of its data in dag-json.
+Types are cross-linked wherever they're mentioned.
+
+If the schema is a DSL document, its comments are carried through: comments above a type (or on the same line) describe the type,
+and comments above a field or member (or on the same line) describe that.`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "format",
+				Usage:       "Format of the documentation: (markdown|html)",
+				DefaultText: "markdown",
+			},
+			&cli.StringFlag{
+				Name:        "title",
+				Usage:       "Heading for the whole document.",
+				DefaultText: "Schema",
+			},
+		},
+		Action: Action_SchemaDoc,
 	}},
-	// Someday: it may be neat to have a handful of well-known transforms, like: strip all rename directives, or make all representations default, etc.
 }
 
 // Action_SchemaParse is the function that implements the `ipld schema parse` subcommand's behaviors.
@@ -91,10 +325,13 @@ func Action_SchemaParse(args *cli.Context) error {
 	}
 
 	// Let's get some data!
-	inputReader, _, err := shared.ParseDataSourceArg(sourceArg)
+	inputReader, link, err := shared.ParseDataSourceArg(sourceArg)
 	if err != nil {
 		return err
 	}
+	if link != nil {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'schema parse' command needs a filename or \"-\" as its argument; DSL documents can't be loaded by CID")
+	}
 
 	// Parse!
 	dmt, err := DSLParse(sourceArg, inputReader)
@@ -124,145 +361,646 @@ func Action_SchemaParse(args *cli.Context) error {
 	return ipld.EncodeStreaming(args.App.Writer, dmtn, encoder)
 }
 
-func Action_GoCodegen(args *cli.Context) error {
-	if args.NArg() != 1 {
-		return fmt.Errorf("invalid number of arguments")
+// Action_SchemaPrint is the function that implements the `ipld schema print` subcommand's behaviors.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- for incomprehensible or invalid arguments.
+//   - ipldtool-error-load-failed -- if the DMT is given by CID, and can't be loaded from storage.
+//   - ipldtool-error-codec-unknown -- if the codec for the DMT can't be determined.
+//   - ipldtool-error-data-invalid -- if the data isn't a schema DMT.
+//   - schema-dsl-print-failed -- if the DMT contains something that can't be written in the DSL.
+func Action_SchemaPrint(args *cli.Context) error {
+	// Parse positional args.
+	var sourceArg string
+	switch args.Args().Len() {
+	case 1:
+		sourceArg = args.Args().Get(0)
+	default:
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'schema print' command needs exactly one positional argument")
 	}
 
-	schemaFilePath := args.Args().First()
-	s, err := schemadsl.ParseFile(schemaFilePath)
+	// Let's get some data!  If it's a CID, that means loading it from storage.
+	reader, link, err := shared.ParseDataSourceArg(sourceArg)
 	if err != nil {
 		return err
 	}
+	if link != nil {
+		if reader, err = loadStored(link); err != nil {
+			return err
+		}
+	}
 
-	var ts schema.TypeSystem
-	ts.Init()
-	if err := schemadmt.Compile(&ts, s); err != nil {
+	// Determine the codec: the flag wins, then the CID, then guessing.
+	var inputCodec shared.CodecInfo
+	switch {
+	case args.IsSet("input"):
+		inputCodec, err = shared.ParseDecoderArg(args.String("input"), "input")
+	case link != nil:
+		inputCodec, err = linkDecoder(link)
+	default:
+		inputCodec, err = shared.SniffCodec(reader)
+	}
+	if err != nil {
 		return err
 	}
 
-	generator := args.Path("generator")
-	outputDir := args.Path("output")
-	pkgName := args.String("package")
+	dmt, err := decodeDMT(reader, inputCodec)
+	if err != nil {
+		return err
+	}
+	return PrintDSL(args.App.Writer, dmt)
+}
 
-	switch generator {
-	case "go-gengo":
-		if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
-			return err
+// Action_SchemaFmt is the function that implements the `ipld schema fmt` subcommand's behaviors.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- for incomprehensible or invalid arguments.
+//   - ipldtool-error-io -- if a file can't be read or written.
+//   - schema-dsl-parse-failed -- if a DSL document didn't parse.
+//   - schema-dsl-unformatted -- if checking, and any of the documents aren't formatted.
+func Action_SchemaFmt(args *cli.Context) error {
+	if args.Args().Len() < 1 {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'schema fmt' command needs at least one positional argument")
+	}
+	if args.Bool("check") && args.Bool("write") {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "the check and write arguments can't be used together")
+	}
+
+	var unformatted []string
+	for _, sourceArg := range args.Args().Slice() {
+		var src []byte
+		var err error
+		switch {
+		case sourceArg == "-" && args.Bool("write"):
+			return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "can't rewrite standard input in place")
+		case sourceArg == "-":
+			src, err = io.ReadAll(os.Stdin)
+		default:
+			src, err = os.ReadFile(sourceArg)
+		}
+		if err != nil {
+			return ipldtoolerr.Newf("ipldtool-error-io", "could not read %s: %s", sourceArg, err)
 		}
-		a := gengo.AdjunctCfg{}
-		gengo.Generate(outputDir, pkgName, ts, &a)
-	case "go-bindnode":
-		if err := generateGoBindnode(schemaFilePath, outputDir, pkgName, &ts); err != nil {
+		formatted, err := FormatDSL(sourceArg, src)
+		if err != nil {
 			return err
 		}
+		switch {
+		case args.Bool("check"):
+			if !bytes.Equal(src, formatted) {
+				fmt.Fprintln(args.App.Writer, sourceArg)
+				unformatted = append(unformatted, sourceArg)
+			}
+		case args.Bool("write"):
+			if bytes.Equal(src, formatted) {
+				continue
+			}
+			if err := os.WriteFile(sourceArg, formatted, 0644); err != nil {
+				return ipldtoolerr.Newf("ipldtool-error-io", "could not write %s: %s", sourceArg, err)
+			}
+		default:
+			if _, err := args.App.Writer.Write(formatted); err != nil {
+				return err
+			}
+		}
+	}
+	if len(unformatted) > 0 {
+		return ipldtoolerr.Newf(ErrCode_DSLUnformatted, "%d of %d documents are not formatted", len(unformatted), args.Args().Len())
+	}
+	return nil
+}
+
+// Action_SchemaExport is the function that implements the `ipld schema export` subcommand's behaviors.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- for incomprehensible or invalid arguments.
+//   - schema-dsl-parse-failed -- if the DSL document didn't parse.
+//   - schema-compile-failed -- if the schema was parsed, but was logically invalid.
+func Action_SchemaExport(args *cli.Context) error {
+	// Parse positional args.
+	var sourceArg string
+	switch args.Args().Len() {
+	case 1:
+		sourceArg = args.Args().Get(0)
 	default:
-		return fmt.Errorf("unsupported generator: %s", generator)
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'schema export' command needs exactly one positional argument")
+	}
+	if format := args.String("format"); format != "jsonschema" {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "format argument not recognized: %q is not a supported format (supported: jsonschema)", format)
+	}
+	encoder, err := shared.ParseEncoderArg(args.String("output"), "codec:json", "output")
+	if err != nil {
+		return err
 	}
 
-	return nil
+	// Load the schema.
+	inputReader, link, err := shared.ParseDataSourceArg(sourceArg)
+	if err != nil {
+		return err
+	}
+	if link != nil {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'schema export' command needs a filename or \"-\" as its argument; DSL documents can't be loaded by CID")
+	}
+	dmt, err := DSLParse(sourceArg, inputReader)
+	if err != nil {
+		return err
+	}
+	ts, err := SchemaCompile(dmt)
+	if err != nil {
+		return err
+	}
+
+	// Convert, and report anything that didn't make it.
+	doc, warnings, err := ExportJSONSchema(ts, args.String("type"))
+	if err != nil {
+		return err
+	}
+	printWarnings(args, warnings)
+	return ipld.EncodeStreaming(args.App.Writer, doc, encoder)
 }
 
-func generateGoBindnode(schemaFilePath, outputDir, pkgName string, ts *schema.TypeSystem) error {
-	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+// Action_SchemaImport is the function that implements the `ipld schema import` subcommand's behaviors.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- for incomprehensible or invalid arguments.
+//   - ipldtool-error-data-invalid -- if the document isn't JSON.
+//   - schema-jsonschema-invalid -- if the document isn't a JSON Schema.
+//   - schema-compile-failed -- if the result of the conversion isn't a valid schema.
+func Action_SchemaImport(args *cli.Context) error {
+	// Parse positional args.
+	var sourceArg string
+	switch args.Args().Len() {
+	case 1:
+		sourceArg = args.Args().Get(0)
+	default:
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'schema import' command needs exactly one positional argument")
+	}
+	if from := args.String("from"); from != "jsonschema" {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "from argument not recognized: %q is not a supported format (supported: jsonschema)", from)
+	}
+	encoder, err := shared.ParseEncoderArg(args.String("output"), "codec:json", "output")
+	if err != nil {
+		return err
+	}
+
+	// Load the document.  It's plain JSON (not dag-json): JSON Schemas are full of objects with "/" keys that aren't links.
+	inputReader, link, err := shared.ParseDataSourceArg(sourceArg)
+	if err != nil {
 		return err
 	}
+	if link != nil {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'schema import' command needs a filename or \"-\" as its argument")
+	}
+	doc, err := ipld.DecodeStreaming(inputReader, json.Decode)
+	if err != nil {
+		return ipldtoolerr.Newf(shared.ErrCode_DataInvalid, "could not parse the document as JSON: %s", err)
+	}
 
-	// generate the basic Go types in types.go
-	f, err := os.Create(filepath.Join(outputDir, "types.go"))
+	// Convert, report anything that didn't make it, and make sure what's left makes sense.
+	dmt, warnings, err := ImportJSONSchema(doc)
 	if err != nil {
 		return err
 	}
+	printWarnings(args, warnings)
+	if _, err := SchemaCompile(dmt); err != nil {
+		return err
+	}
+	return ipld.EncodeStreaming(args.App.Writer, bindnode.Wrap(dmt, schemadmt.Type.Schema.Type()), encoder)
+}
 
-	if _, err := fmt.Fprintf(f, "package %s\n\n", pkgName); err != nil {
+// Action_SchemaCompat is the function that implements the `ipld schema compat` subcommand's behaviors.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- for incomprehensible or invalid arguments.
+//   - ipldtool-error-load-failed -- if a DMT is given by CID, and can't be loaded from storage.
+//   - ipldtool-error-data-invalid -- if data given by CID isn't a schema DMT.
+//   - schema-dsl-parse-failed -- if a DSL document didn't parse.
+//   - schema-compile-failed -- if a schema was parsed, but was logically invalid.
+//   - schema-compat-breaking -- if any of the changes break the required compatibility.
+func Action_SchemaCompat(args *cli.Context) error {
+	// Parse positional args.
+	if args.Args().Len() != 2 {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'schema compat' command needs exactly two positional arguments")
+	}
+	oldArg, newArg := args.Args().Get(0), args.Args().Get(1)
+	if oldArg == "-" && newArg == "-" {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "only one of the schemas can come from stdin")
+	}
+	var requireBackward, requireForward bool
+	switch require := args.String("require"); require {
+	case "", "backward":
+		requireBackward = true
+	case "forward":
+		requireForward = true
+	case "full":
+		requireBackward, requireForward = true, true
+	case "none":
+	default:
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "require argument not recognized: %q is not one of backward, forward, full, or none", require)
+	}
+	encoder, err := shared.ParseEncoderArg(args.String("output"), "codec:json", "output")
+	if err != nil {
 		return err
 	}
 
-	if err := bindnode.ProduceGoTypes(f, ts); err != nil {
+	// Load both schemas.
+	oldTS, err := loadSchemaArg(oldArg)
+	if err != nil {
+		return err
+	}
+	newTS, err := loadSchemaArg(newArg)
+	if err != nil {
 		return err
 	}
 
-	if err := f.Close(); err != nil {
+	// Compare, report, and fail if anything broke that mattered.
+	report := CompareSchemas(oldTS, newTS)
+	if err := ipld.EncodeStreaming(args.App.Writer, report.Node(), encoder); err != nil {
 		return err
 	}
+	if breaking := report.Breaking(requireBackward, requireForward); len(breaking) > 0 {
+		return ipldtoolerr.Newf(ErrCode_SchemaCompatBreaking, "%d of %d changes are breaking", len(breaking), len(report.Changes))
+	}
+	return nil
+}
 
-	// generate schema prototypes in schema.go
-	outSchemaFile := path.Base(schemaFilePath)
-	if err := copyFile(path.Join(outputDir, outSchemaFile), schemaFilePath); err != nil {
+// Action_SchemaTransform is the function that implements the `ipld schema transform` subcommand's behaviors.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- for incomprehensible or invalid arguments.
+//   - ipldtool-error-load-failed -- if the DMT is given by CID, and can't be loaded from storage.
+//   - ipldtool-error-data-invalid -- if data given by CID isn't a schema DMT.
+//   - schema-dsl-parse-failed -- if the DSL document didn't parse.
+//   - schema-transform-failed -- if a transform couldn't be applied.
+//   - schema-compile-failed -- if the schema was logically invalid, either to begin with or after a transform.
+func Action_SchemaTransform(args *cli.Context) error {
+	// Parse positional args.
+	var sourceArg string
+	switch args.Args().Len() {
+	case 1:
+		sourceArg = args.Args().Get(0)
+	default:
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'schema transform' command needs exactly one positional argument")
+	}
+	encoder, err := shared.ParseEncoderArg(args.String("output"), "codec:json", "output")
+	if err != nil {
 		return err
 	}
 
-	type tmplfillIn struct {
-		PkgName         string
-		SchemaEmbedPath string
-		TypeNames       []string
+	// Gather up the transforms, in the order they're applied.
+	var transforms []Transform
+	for _, rename := range args.StringSlice("rename-type") {
+		oldName, newName, ok := strings.Cut(rename, ":")
+		if !ok || oldName == "" || newName == "" {
+			return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "rename-type argument not recognized: %q should be of the form \"Old:New\"", rename)
+		}
+		transforms = append(transforms, RenameType(oldName, newName))
+	}
+	if args.Bool("strip-renames") {
+		transforms = append(transforms, StripRenames)
+	}
+	if args.Bool("default-representations") {
+		transforms = append(transforms, DefaultRepresentations)
+	}
+	if roots := args.StringSlice("prune-unreachable-from"); len(roots) > 0 {
+		transforms = append(transforms, PruneUnreachable(roots...))
 	}
 
-	tmpl, err := template.New("schematypegen").Parse(`
-package {{.PkgName}}
+	// Load, transform, and print.
+	dmt, err := loadDMTArg(sourceArg)
+	if err != nil {
+		return err
+	}
+	if _, err := TransformSchema(dmt, transforms...); err != nil {
+		return err
+	}
+	return ipld.EncodeStreaming(args.App.Writer, bindnode.Wrap(dmt, schemadmt.Type.Schema.Type()), encoder)
+}
 
-import (
-	_ "embed"
-	
-	"github.com/ipld/go-ipld-prime"
-	"github.com/ipld/go-ipld-prime/node/bindnode"
-	"github.com/ipld/go-ipld-prime/schema"
-)
+// Action_SchemaInfer is the function that implements the `ipld schema infer` subcommand's behaviors.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- for incomprehensible or invalid arguments.
+//   - ipldtool-error-load-failed -- if a sample is given by CID, or links are being followed, and a block can't be loaded from storage.
+//   - ipldtool-error-codec-unknown -- if the codec for a sample can't be determined.
+//   - ipldtool-error-data-invalid -- if a sample can't be decoded.
+func Action_SchemaInfer(args *cli.Context) error {
+	// Parse positional args, and check all the flags before starting work.
+	if args.Args().Len() < 1 {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'schema infer' command needs at least one positional argument")
+	}
+	stdinUsed := false
+	for _, sourceArg := range args.Args().Slice() {
+		if sourceArg == "-" && stdinUsed {
+			return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "only one of the samples can come from stdin")
+		}
+		stdinUsed = stdinUsed || sourceArg == "-"
+	}
+	if args.Int("max-struct-keys") < 0 {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "max-struct-keys argument can't be negative")
+	}
+	var encoder codec.Encoder
+	if output := args.String("output"); output != "" && output != "dsl" {
+		var err error
+		if encoder, err = shared.ParseEncoderArg(output, "", "output"); err != nil {
+			return err
+		}
+	}
+	var inputCodec shared.CodecInfo
+	if args.IsSet("input") {
+		var err error
+		if inputCodec, err = shared.ParseDecoderArg(args.String("input"), "input"); err != nil {
+			return err
+		}
+	}
 
-//go:embed {{.SchemaEmbedPath}}
-var embeddedSchema []byte
+	inferrer := &Inferrer{
+		RootType:      args.String("type"),
+		MaxStructKeys: args.Int("max-struct-keys"),
+	}
+	if args.Bool("follow-links") {
+		store := &workspace.LazyStorage{}
+		defer store.Close()
+		lsys := cidlink.DefaultLinkSystem()
+		lsys.SetReadStorage(store)
+		inferrer.LinkSystem = &lsys
+	}
 
-var Prototypes schemaSlab
+	// Read each sample.  The codec is from the flag if there is one, then the CID, then guessing.
+	for _, sourceArg := range args.Args().Slice() {
+		reader, link, err := shared.ParseDataSourceArg(sourceArg)
+		if err != nil {
+			return err
+		}
+		sampleCodec := inputCodec
+		if link != nil {
+			if reader, err = loadStored(link); err != nil {
+				return err
+			}
+		}
+		switch {
+		case args.IsSet("input"):
+		case link != nil:
+			sampleCodec, err = linkDecoder(link)
+		default:
+			sampleCodec, err = shared.SniffCodec(reader)
+		}
+		if err != nil {
+			return err
+		}
+		var np datamodel.NodePrototype = basicnode.Prototype.Any
+		if sampleCodec.Prototype != nil {
+			np = sampleCodec.Prototype
+		}
+		n, err := ipld.DecodeStreamingUsingPrototype(reader, sampleCodec.Decoder, np)
+		if err != nil {
+			return ipldtoolerr.Newf(shared.ErrCode_DataInvalid, "could not decode %s: %s", sourceArg, err)
+		}
+		if err := inferrer.Observe(n); err != nil {
+			return err
+		}
+	}
 
-type schemaSlab struct {
-{{range .TypeNames}}
-{{.}}	schema.TypedPrototype{{end}}
+	// Produce the schema.
+	dmt, err := inferrer.Schema()
+	if err != nil {
+		return err
+	}
+	if encoder == nil {
+		return PrintDSL(args.App.Writer, dmt)
+	}
+	return ipld.EncodeStreaming(args.App.Writer, bindnode.Wrap(dmt, schemadmt.Type.Schema.Type()), encoder)
 }
 
-func init() {
-	ts, err := ipld.LoadSchemaBytes(embeddedSchema)
+// Action_SchemaDoc is the function that implements the `ipld schema doc` subcommand's behaviors.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- for incomprehensible or invalid arguments.
+//   - ipldtool-error-io -- if the DSL document can't be read.
+//   - ipldtool-error-load-failed -- if the DMT is given by CID, and can't be loaded from storage.
+//   - ipldtool-error-data-invalid -- if data given by CID isn't a schema DMT.
+//   - schema-dsl-parse-failed -- if the DSL document didn't parse.
+//   - schema-compile-failed -- if the schema was logically invalid.
+func Action_SchemaDoc(args *cli.Context) error {
+	// Parse positional args.
+	var sourceArg string
+	switch args.Args().Len() {
+	case 1:
+		sourceArg = args.Args().Get(0)
+	default:
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'schema doc' command needs exactly one positional argument")
+	}
+	cfg := DocConfig{Format: args.String("format"), Title: args.String("title")}
+	switch cfg.Format {
+	case "":
+		cfg.Format = "markdown"
+	case "markdown", "html":
+	default:
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "format argument not recognized: %q is not a supported format (supported: markdown, html)", cfg.Format)
+	}
+
+	// Load the schema.  If it's a DSL document, hang on to the source too, for its comments.
+	dmt, source, err := loadDMTArgWithSource(sourceArg)
 	if err != nil {
-		panic(err)
+		return err
 	}
-{{range .TypeNames}}
+	cfg.Source = source
+	ts, err := SchemaCompile(dmt)
+	if err != nil {
+		return err
+	}
+	return RenderDoc(args.App.Writer, dmt, ts, cfg)
+}
 
-	Prototypes.{{.}} = bindnode.Prototype(
-		(*{{.}})(nil),
-		ts.TypeByName("{{.}}"),
-	){{end}}
+// loadStored loads the raw data for a link from the workspace's storage.
+func loadStored(link datamodel.Link) (*bufio.Reader, error) {
+	store := &workspace.LazyStorage{}
+	defer store.Close()
+	bs, err := store.Get(context.Background(), link.Binary())
+	if err != nil {
+		return nil, ipldtoolerr.Newf(shared.ErrCode_LoadFailed, "could not load %s: %s", link, err)
+	}
+	return bufio.NewReader(bytes.NewReader(bs)), nil
 }
-`)
+
+// linkDecoder returns the codec that a link says its data is in, if we can decode it.
+func linkDecoder(link datamodel.Link) (shared.CodecInfo, error) {
+	codec, known := shared.LookupCodec(link.(cidlink.Link).Prefix().Codec)
+	if !known || codec.Decoder == nil {
+		return codec, ipldtoolerr.Newf(shared.ErrCode_CodecUnknown, "%s is in codec %s, which has no decoder available", link, codec.Name)
+	}
+	return codec, nil
+}
+
+// decodeDMT decodes data straight into the DMT's Go types.
+func decodeDMT(reader io.Reader, codec shared.CodecInfo) (*schemadmt.Schema, error) {
+	n, err := ipld.DecodeStreamingUsingPrototype(reader, codec.Decoder, schemadmt.Type.Schema.Representation())
 	if err != nil {
-		return err
+		return nil, ipldtoolerr.Newf(shared.ErrCode_DataInvalid, "data is not a schema DMT: %s", err)
 	}
+	return bindnode.Unwrap(n).(*schemadmt.Schema), nil
+}
 
-	buf := new(bytes.Buffer)
-	fill := &tmplfillIn{
-		PkgName:         pkgName,
-		SchemaEmbedPath: outSchemaFile,
-		TypeNames:       ts.Names()[6:len(ts.Names())], // Skip basic types
+// parseSchemaSourceArg is shared.ParseDataSourceArg, but also takes plain filenames that don't start with "./" or "/",
+// since schema commands have always taken a DSL file that way.
+// Anything that's not "-", and doesn't parse as a CID, is treated as a filename.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- if the arg isn't a CID, and can't be opened as a file either.
+func parseSchemaSourceArg(sourceArg string) (*bufio.Reader, datamodel.Link, error) {
+	reader, link, err := shared.ParseDataSourceArg(sourceArg)
+	if err == nil || sourceArg == "-" || shared.StringIsPathish(sourceArg) {
+		return reader, link, err
+	}
+	f, openErr := os.Open(sourceArg)
+	if openErr != nil {
+		return nil, nil, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "arg is not a valid CID, and cannot be opened as a filename either: %s", openErr)
 	}
+	return bufio.NewReader(f), nil, nil
+}
 
-	if err := tmpl.Execute(buf, fill); err != nil {
-		return err
+// loadDMTArg loads a schema DMT, given either a DSL document (as a filename or "-"), or the CID of a DMT in storage.
+func loadDMTArg(sourceArg string) (*schemadmt.Schema, error) {
+	reader, link, err := parseSchemaSourceArg(sourceArg)
+	if err != nil {
+		return nil, err
 	}
+	if link == nil {
+		return DSLParse(sourceArg, reader)
+	}
+	if reader, err = loadStored(link); err != nil {
+		return nil, err
+	}
+	codec, err := linkDecoder(link)
+	if err != nil {
+		return nil, err
+	}
+	return decodeDMT(reader, codec)
+}
 
-	formattedSrc, err := format.Source(buf.Bytes())
+// loadDMTArgWithSource is loadDMTArg, but also returns the DSL document, if that's what the schema was loaded from (and nil otherwise).
+func loadDMTArgWithSource(sourceArg string) (*schemadmt.Schema, []byte, error) {
+	reader, link, err := parseSchemaSourceArg(sourceArg)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	if link != nil {
+		dmt, err := loadDMTArg(sourceArg)
+		return dmt, nil, err
+	}
+	source, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, nil, ipldtoolerr.Newf("ipldtool-error-io", "could not read %s: %s", sourceArg, err)
+	}
+	dmt, err := DSLParse(sourceArg, bytes.NewReader(source))
+	if err != nil {
+		return nil, nil, err
 	}
+	return dmt, source, nil
+}
+
+// loadSchemaArg loads and compiles a schema, given either a DSL document (as a filename or "-"), or the CID of a DMT in storage.
+func loadSchemaArg(sourceArg string) (*schema.TypeSystem, error) {
+	dmt, err := loadDMTArg(sourceArg)
+	if err != nil {
+		return nil, err
+	}
+	return SchemaCompile(dmt)
+}
 
-	return os.WriteFile(filepath.Join(outputDir, "schema.go"), formattedSrc, 0666)
+func printWarnings(args *cli.Context, warnings []Warning) {
+	for _, w := range warnings {
+		fmt.Fprintf(args.App.ErrWriter, "warning: %s\n", w)
+	}
 }
 
-func copyFile(targetFile, sourceFile string) error {
-	input, err := os.ReadFile(sourceFile)
+// Action_GoCodegen is the function that implements the `ipld schema codegen` subcommand's behaviors.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- for incomprehensible or invalid arguments.
+//   - ipldtool-error-load-failed -- if the DMT is given by CID, and can't be loaded from storage.
+//   - ipldtool-error-data-invalid -- if data given by CID isn't a schema DMT.
+//   - schema-dsl-parse-failed -- if the DSL document didn't parse.
+//   - schema-compile-failed -- if the schema was parsed, but was logically invalid.
+//   - schema-dsl-print-failed -- if a schema given by CID is needed as a DSL document (for go-bindnode), and can't be written as one.
+//   - schema-codegen-unsupported -- if the schema uses something the generator can't handle.
+//   - schema-codegen-stale -- if checking or diffing, and the files in the output directory aren't what would be generated.
+func Action_GoCodegen(args *cli.Context) error {
+	// Parse positional args.
+	var sourceArg string
+	switch args.Args().Len() {
+	case 1:
+		sourceArg = args.Args().Get(0)
+	default:
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'schema codegen' command needs exactly one positional argument")
+	}
+	outputDir := args.Path("output")
+	if outputDir == "-" && (args.Bool("check") || args.Bool("diff")) {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "the check and diff arguments need an output directory to compare with")
+	}
+	cfg := GeneratorConfig{
+		Generator:   args.String("generator"),
+		PackageName: args.String("package"),
+		GoBindnode: GoBindnodeConfig{
+			TypeNames:      map[string]string{},
+			OptionalFields: args.String("go-optional"),
+			Imports:        args.StringSlice("go-import"),
+		},
+	}
+	for _, mapping := range args.StringSlice("go-type") {
+		schemaName, goName, ok := strings.Cut(mapping, ":")
+		if !ok || schemaName == "" || goName == "" {
+			return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "go-type argument not recognized: %q should be of the form \"SchemaType:GoType\"", mapping)
+		}
+		cfg.GoBindnode.TypeNames[schemaName] = goName
+	}
+
+	// Load the schema, keeping the document too, since some generators put a copy of it next to the code.
+	//  If the schema came from storage, there's no document, so one's printed from the DMT.
+	dmt, source, err := loadDMTArgWithSource(sourceArg)
 	if err != nil {
 		return err
 	}
-	err = os.WriteFile(targetFile, input, 0644)
+	cfg.SchemaFileName = "schema.ipldsch"
+	if source != nil && sourceArg != "-" {
+		cfg.SchemaFileName = filepath.Base(sourceArg)
+	}
+	if source == nil {
+		var buf bytes.Buffer
+		if err := PrintDSL(&buf, dmt); err != nil {
+			return err
+		}
+		source = buf.Bytes()
+	}
+	cfg.SchemaSource = source
+	ts, err := SchemaCompile(dmt)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	// Generate, and then write, or compare.
+	files, err := Generate(ts, cfg)
+	if err != nil {
+		return err
+	}
+	switch {
+	case args.Bool("diff"):
+		return checkGeneratedFiles(args.App.Writer, outputDir, files)
+	case args.Bool("check"):
+		return checkGeneratedFiles(nil, outputDir, files)
+	case outputDir == "-":
+		return writeGeneratedTar(args.App.Writer, files)
+	default:
+		return writeGeneratedFiles(outputDir, files)
+	}
 }
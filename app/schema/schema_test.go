@@ -13,3 +13,10 @@ func TestSchema(t *testing.T) {
 	}
 	testutil.TestExecSpec(t, "../../docs/schema.md")
 }
+
+func TestValidate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+	testutil.TestExecSpec(t, "../../docs/validate.md")
+}
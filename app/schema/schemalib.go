@@ -2,6 +2,7 @@ package schema
 
 import (
 	"io"
+	"os"
 
 	"github.com/ipld/go-ipld-prime/schema"
 	schemadmt "github.com/ipld/go-ipld-prime/schema/dmt"
@@ -28,6 +29,21 @@ func DSLParse(inputName string, input io.Reader) (*schemadmt.Schema, error) {
 	return dmt, nil
 }
 
+// DSLParseFile is DSLParse, but opens the file for you.
+//
+// Errors:
+//
+//   - ipldtool-error-io -- if the file can't be opened.
+//   - schema-dsl-parse-failed -- if the DSL document didn't parse.
+func DSLParseFile(filename string) (*schemadmt.Schema, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, ipldtoolerr.Newf("ipldtool-error-io", "could not open schema file: %s", err)
+	}
+	defer f.Close()
+	return DSLParse(filename, f)
+}
+
 // DSLParse is just the `schemadmt.Compile` feature, but wrapped in error tagging.
 //
 // Errors:
@@ -46,3 +62,26 @@ func SchemaCompile(dmt *schemadmt.Schema) (*schema.TypeSystem, error) {
 	}
 	return &ts, nil
 }
+
+// preludeTypes holds the names of the types which schemadmt.Compile puts into every TypeSystem,
+// whether or not the schema declares them.
+// It's worked out by compiling an empty schema, so it keeps up with whatever the compiler does.
+var preludeTypes = func() map[string]struct{} {
+	var ts schema.TypeSystem
+	ts.Init()
+	if err := schemadmt.Compile(&ts, &schemadmt.Schema{}); err != nil {
+		panic(err)
+	}
+	m := make(map[string]struct{}, len(ts.Names()))
+	for _, name := range ts.Names() {
+		m[name] = struct{}{}
+	}
+	return m
+}()
+
+// IsPreludeType returns true if the type is one of the ones that every compiled schema contains
+// (like "String" and "Int"), rather than one that was declared in the schema.
+func IsPreludeType(t schema.Type) bool {
+	_, ok := preludeTypes[t.Name()]
+	return ok
+}
@@ -0,0 +1,248 @@
+package schema
+
+import (
+	"github.com/ipld/go-ipld-prime/schema"
+	schemadmt "github.com/ipld/go-ipld-prime/schema/dmt"
+
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+// Transform is a change to a schema, made to its DMT in place.
+//
+// Transforms don't need to leave the DMT valid themselves; TransformSchema checks that after each one.
+type Transform func(dmt *schemadmt.Schema) error
+
+// TransformSchema applies transforms to a schema DMT, in order, and compiles the result after each one to make sure it's still valid.
+//
+// Errors:
+//
+//   - schema-transform-failed -- if a transform couldn't be applied.
+//   - schema-compile-failed -- if a transform left the schema logically invalid.
+func TransformSchema(dmt *schemadmt.Schema, transforms ...Transform) (*schema.TypeSystem, error) {
+	ts, err := SchemaCompile(dmt)
+	if err != nil {
+		return nil, err
+	}
+	for _, transform := range transforms {
+		if err := transform(dmt); err != nil {
+			return nil, err
+		}
+		if ts, err = SchemaCompile(dmt); err != nil {
+			return nil, err
+		}
+	}
+	return ts, nil
+}
+
+// StripRenames removes all the renames from struct fields, so each field's key in the data becomes its name.
+// Implicit values are left as they are.
+func StripRenames(dmt *schemadmt.Schema) error {
+	for _, name := range dmt.Types.Keys {
+		defn := dmt.Types.Values[name].TypeDefnStruct
+		if defn == nil || defn.Representation.StructRepresentation_Map == nil || defn.Representation.StructRepresentation_Map.Fields == nil {
+			continue
+		}
+		details := defn.Representation.StructRepresentation_Map.Fields
+		keys := details.Keys[:0]
+		for _, fieldName := range details.Keys {
+			d := details.Values[fieldName]
+			d.Rename = nil
+			if d.Implicit == nil {
+				delete(details.Values, fieldName)
+				continue
+			}
+			details.Values[fieldName] = d
+			keys = append(keys, fieldName)
+		}
+		details.Keys = keys
+		if len(keys) == 0 {
+			defn.Representation.StructRepresentation_Map.Fields = nil
+		}
+	}
+	return nil
+}
+
+// DefaultRepresentations replaces every representation strategy with the default for its kind of type:
+// map for structs and maps, list for lists, and string (with each member's name as its value) for enums.
+// Renames and implicits go too, so fields that had implicit values become required.
+//
+// Unions have no default strategy, so they become keyed, with each member's name as its key.
+func DefaultRepresentations(dmt *schemadmt.Schema) error {
+	for _, name := range dmt.Types.Keys {
+		defn := dmt.Types.Values[name]
+		switch {
+		case defn.TypeDefnStruct != nil:
+			defn.TypeDefnStruct.Representation = schemadmt.StructRepresentation{StructRepresentation_Map: &schemadmt.StructRepresentation_Map{}}
+		case defn.TypeDefnMap != nil:
+			defn.TypeDefnMap.Representation = nil
+		case defn.TypeDefnList != nil:
+			defn.TypeDefnList.Representation = nil
+		case defn.TypeDefnEnum != nil:
+			defn.TypeDefnEnum.Representation = schemadmt.EnumRepresentation{EnumRepresentation_String: &schemadmt.EnumRepresentation_String{Values: map[string]string{}}}
+		case defn.TypeDefnUnion != nil:
+			keyed := &schemadmt.UnionRepresentation_Keyed{Values: map[string]schemadmt.UnionMember{}}
+			for _, m := range defn.TypeDefnUnion.Members {
+				key := dslUnionMember(m)
+				keyed.Keys = append(keyed.Keys, key)
+				keyed.Values[key] = m
+			}
+			defn.TypeDefnUnion.Representation = schemadmt.UnionRepresentation{UnionRepresentation_Keyed: keyed}
+		}
+	}
+	return nil
+}
+
+// RenameType returns a Transform that renames a type, and updates everything that refers to it.
+//
+// Errors:
+//
+//   - schema-transform-failed -- if there's no type by the old name, or there's already a type by the new name.
+func RenameType(oldName, newName string) Transform {
+	return func(dmt *schemadmt.Schema) error {
+		defn, ok := dmt.Types.Values[oldName]
+		if !ok {
+			return ipldtoolerr.Newf(ErrCode_TransformFailed, "cannot rename type %s: there's no type by that name", oldName)
+		}
+		if _, exists := dmt.Types.Values[newName]; exists {
+			return ipldtoolerr.Newf(ErrCode_TransformFailed, "cannot rename type %s to %s: there's already a type by that name", oldName, newName)
+		}
+		delete(dmt.Types.Values, oldName)
+		dmt.Types.Values[newName] = defn
+		for i, name := range dmt.Types.Keys {
+			if name == oldName {
+				dmt.Types.Keys[i] = newName
+			}
+		}
+		for _, name := range dmt.Types.Keys {
+			forEachTypeRef(dmt.Types.Values[name], func(ref *string) {
+				if *ref == oldName {
+					*ref = newName
+				}
+			})
+		}
+		return nil
+	}
+}
+
+// PruneUnreachable returns a Transform that removes every type which can't be reached from any of the given root types.
+//
+// Errors:
+//
+//   - schema-transform-failed -- if one of the roots isn't a type in the schema.
+func PruneUnreachable(roots ...string) Transform {
+	return func(dmt *schemadmt.Schema) error {
+		reachable := map[string]bool{}
+		var visit func(name string)
+		visit = func(name string) {
+			defn, ok := dmt.Types.Values[name]
+			if !ok || reachable[name] {
+				return // Either it's been seen already, or it's something from the prelude.
+			}
+			reachable[name] = true
+			forEachTypeRef(defn, func(ref *string) { visit(*ref) })
+		}
+		for _, root := range roots {
+			if _, ok := dmt.Types.Values[root]; !ok {
+				return ipldtoolerr.Newf(ErrCode_TransformFailed, "cannot prune from type %s: there's no type by that name", root)
+			}
+			visit(root)
+		}
+
+		keys := dmt.Types.Keys[:0]
+		for _, name := range dmt.Types.Keys {
+			if reachable[name] {
+				keys = append(keys, name)
+			} else {
+				delete(dmt.Types.Values, name)
+			}
+		}
+		dmt.Types.Keys = keys
+		return nil
+	}
+}
+
+// forEachTypeRef calls fn with a pointer to every type name that a type definition refers to, so they can be read or changed.
+func forEachTypeRef(defn schemadmt.TypeDefn, fn func(ref *string)) {
+	switch {
+	case defn.TypeDefnMap != nil:
+		forEachTypeRefInMap(defn.TypeDefnMap, fn)
+	case defn.TypeDefnList != nil:
+		forEachTypeRefInList(defn.TypeDefnList, fn)
+	case defn.TypeDefnLink != nil:
+		forEachTypeRefInLink(defn.TypeDefnLink, fn)
+	case defn.TypeDefnStruct != nil:
+		for _, fieldName := range defn.TypeDefnStruct.Fields.Keys {
+			forEachTypeRefInRef(defn.TypeDefnStruct.Fields.Values[fieldName].Type, fn)
+		}
+	case defn.TypeDefnUnion != nil:
+		for i := range defn.TypeDefnUnion.Members {
+			forEachTypeRefInUnionMember(&defn.TypeDefnUnion.Members[i], fn)
+		}
+		repr := defn.TypeDefnUnion.Representation
+		switch {
+		case repr.UnionRepresentation_Kinded != nil:
+			forEachTypeRefInUnionTable(repr.UnionRepresentation_Kinded.Values, fn)
+		case repr.UnionRepresentation_Keyed != nil:
+			forEachTypeRefInUnionTable(repr.UnionRepresentation_Keyed.Values, fn)
+		case repr.UnionRepresentation_Inline != nil:
+			forEachTypeRefInNameTable(repr.UnionRepresentation_Inline.DiscriminantTable.Values, fn)
+		case repr.UnionRepresentation_StringPrefix != nil:
+			forEachTypeRefInNameTable(repr.UnionRepresentation_StringPrefix.Prefixes.Values, fn)
+		case repr.UnionRepresentation_BytesPrefix != nil:
+			forEachTypeRefInNameTable(repr.UnionRepresentation_BytesPrefix.Prefixes.Values, fn)
+		}
+	case defn.TypeDefnCopy != nil:
+		fn(&defn.TypeDefnCopy.FromType)
+	}
+}
+
+func forEachTypeRefInRef(ref schemadmt.TypeNameOrInlineDefn, fn func(ref *string)) {
+	switch {
+	case ref.TypeName != nil:
+		fn(ref.TypeName)
+	case ref.InlineDefn != nil && ref.InlineDefn.TypeDefnMap != nil:
+		forEachTypeRefInMap(ref.InlineDefn.TypeDefnMap, fn)
+	case ref.InlineDefn != nil && ref.InlineDefn.TypeDefnList != nil:
+		forEachTypeRefInList(ref.InlineDefn.TypeDefnList, fn)
+	case ref.InlineDefn != nil && ref.InlineDefn.TypeDefnLink != nil:
+		forEachTypeRefInLink(ref.InlineDefn.TypeDefnLink, fn)
+	}
+}
+
+func forEachTypeRefInMap(defn *schemadmt.TypeDefnMap, fn func(ref *string)) {
+	fn(&defn.KeyType)
+	forEachTypeRefInRef(defn.ValueType, fn)
+}
+
+func forEachTypeRefInList(defn *schemadmt.TypeDefnList, fn func(ref *string)) {
+	forEachTypeRefInRef(defn.ValueType, fn)
+}
+
+func forEachTypeRefInLink(defn *schemadmt.TypeDefnLink, fn func(ref *string)) {
+	if defn.ExpectedType != nil {
+		fn(defn.ExpectedType)
+	}
+}
+
+func forEachTypeRefInUnionMember(m *schemadmt.UnionMember, fn func(ref *string)) {
+	switch {
+	case m.TypeName != nil:
+		fn(m.TypeName)
+	case m.UnionMemberInlineDefn != nil && m.UnionMemberInlineDefn.TypeDefnLink != nil:
+		forEachTypeRefInLink(m.UnionMemberInlineDefn.TypeDefnLink, fn)
+	}
+}
+
+func forEachTypeRefInUnionTable(table map[string]schemadmt.UnionMember, fn func(ref *string)) {
+	for k, m := range table {
+		forEachTypeRefInUnionMember(&m, fn)
+		table[k] = m
+	}
+}
+
+func forEachTypeRefInNameTable(table map[string]string, fn func(ref *string)) {
+	for k, name := range table {
+		fn(&name)
+		table[k] = name
+	}
+}
@@ -0,0 +1,356 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/schema"
+
+	"github.com/ipld/go-ipldtool/app/shared"
+)
+
+// ValidationProblem is one place where data doesn't match a schema.
+type ValidationProblem struct {
+	Path     datamodel.Path // Where the problem is.  If links were followed to get there, the path goes through them.
+	TypeName string         // The type the data there was expected to match.
+	Expected string         // What was expected -- usually a kind, but sometimes something more specific, like a key.
+	Actual   string         // What was found instead.
+}
+
+func (p ValidationProblem) String() string {
+	return fmt.Sprintf("at %q (%s): expected %s, got %s", p.Path.String(), p.TypeName, p.Expected, p.Actual)
+}
+
+// Validator checks data against a schema, without building any typed nodes,
+// so that it can report every problem it finds, and where each one is -- not just the first.
+//
+// A Validator keeps no state between calls to Validate, and is safe to use from several goroutines at once.
+type Validator struct {
+	// LinkSystem is used to load the blocks that links point to, if set.
+	// Each link whose type says what it points to is loaded, and the data it points to is validated against that type too.
+	// If nil, links are only checked for being links.
+	LinkSystem *linking.LinkSystem
+}
+
+// Validate checks that data matches a type, returning all the problems found.  No problems means the data is valid.
+//
+// Data which is in the representation of a type is what's expected (which is what comes out of decoding it with a codec).
+// One leniency is allowed: ints are accepted where floats are expected,
+// because some codecs (dag-json, for one) encode floats that have no fractional part as ints.
+func (v *Validator) Validate(n datamodel.Node, t schema.Type) []ValidationProblem {
+	w := &validationWalk{lsys: v.LinkSystem, visited: map[validationVisit]struct{}{}}
+	w.check(n, t, datamodel.Path{})
+	return w.problems
+}
+
+// validationVisit is a block that's been validated against a type already,
+// so that data linking to itself (or sharing blocks) isn't checked again (and again, forever).
+type validationVisit struct {
+	link     string
+	typeName schema.TypeName
+}
+
+type validationWalk struct {
+	lsys     *linking.LinkSystem
+	visited  map[validationVisit]struct{}
+	problems []ValidationProblem
+}
+
+func (w *validationWalk) add(at datamodel.Path, t schema.Type, expected string, actual string) {
+	w.problems = append(w.problems, ValidationProblem{at, string(t.Name()), expected, actual})
+}
+
+// expectKind checks the kind of the data, and adds a problem if it's wrong.
+func (w *validationWalk) expectKind(n datamodel.Node, t schema.Type, at datamodel.Path, kind datamodel.Kind) bool {
+	if n.Kind() == kind {
+		return true
+	}
+	w.add(at, t, kind.String(), n.Kind().String())
+	return false
+}
+
+// checkMaybe is check, for places which can be null if the schema says so.
+func (w *validationWalk) checkMaybe(n datamodel.Node, t schema.Type, nullable bool, at datamodel.Path) {
+	if nullable && n.IsNull() {
+		return
+	}
+	w.check(n, t, at)
+}
+
+func (w *validationWalk) check(n datamodel.Node, t schema.Type, at datamodel.Path) {
+	switch t := t.(type) {
+	case *schema.TypeAny:
+		// Anything goes.
+	case *schema.TypeBool, *schema.TypeString, *schema.TypeBytes, *schema.TypeInt:
+		w.expectKind(n, t, at, t.RepresentationBehavior())
+	case *schema.TypeFloat:
+		if n.Kind() != datamodel.Kind_Int {
+			w.expectKind(n, t, at, datamodel.Kind_Float)
+		}
+	case *schema.TypeEnum:
+		w.checkEnum(n, t, at)
+	case *schema.TypeList:
+		if !w.expectKind(n, t, at, datamodel.Kind_List) {
+			return
+		}
+		for itr := n.ListIterator(); !itr.Done(); {
+			i, v, err := itr.Next()
+			if err != nil {
+				w.add(at, t, "a readable list", err.Error())
+				return
+			}
+			w.checkMaybe(v, t.ValueType(), t.ValueIsNullable(), at.AppendSegmentInt(i))
+		}
+	case *schema.TypeMap:
+		if !w.expectKind(n, t, at, datamodel.Kind_Map) {
+			return
+		}
+		for itr := n.MapIterator(); !itr.Done(); {
+			k, v, err := itr.Next()
+			if err != nil {
+				w.add(at, t, "a readable map", err.Error())
+				return
+			}
+			ks, _ := k.AsString()
+			w.check(k, t.KeyType(), at.AppendSegmentString(ks))
+			w.checkMaybe(v, t.ValueType(), t.ValueIsNullable(), at.AppendSegmentString(ks))
+		}
+	case *schema.TypeLink:
+		if !w.expectKind(n, t, at, datamodel.Kind_Link) || w.lsys == nil || !t.HasReferencedType() {
+			return
+		}
+		w.checkLinked(n, t, at)
+	case *schema.TypeStruct:
+		w.checkStruct(n, t, at)
+	case *schema.TypeUnion:
+		w.checkUnion(n, t, at)
+	default:
+		w.add(at, t, "a type that can be validated", fmt.Sprintf("a %T", t))
+	}
+}
+
+func (w *validationWalk) checkEnum(n datamodel.Node, t *schema.TypeEnum, at datamodel.Path) {
+	var kind datamodel.Kind
+	switch t.RepresentationStrategy().(type) {
+	case schema.EnumRepresentation_String:
+		kind = datamodel.Kind_String
+	case schema.EnumRepresentation_Int:
+		kind = datamodel.Kind_Int
+	}
+	if !w.expectKind(n, t, at, kind) {
+		return
+	}
+	var actual string
+	if kind == datamodel.Kind_String {
+		s, _ := n.AsString()
+		actual = fmt.Sprintf("%q", s)
+	} else {
+		i, _ := n.AsInt()
+		actual = fmt.Sprintf("%d", i)
+	}
+	values := enumValues(t)
+	expected := make([]string, 0, len(values))
+	for _, m := range t.Members() {
+		if values[m] == actual {
+			return
+		}
+		expected = append(expected, values[m])
+	}
+	w.add(at, t, "one of "+strings.Join(expected, ", "), actual)
+}
+
+func (w *validationWalk) checkLinked(n datamodel.Node, t *schema.TypeLink, at datamodel.Path) {
+	link, _ := n.AsLink()
+	visit := validationVisit{link.String(), t.ReferencedType().Name()}
+	if _, done := w.visited[visit]; done {
+		return
+	}
+	w.visited[visit] = struct{}{}
+	np, err := shared.ChoosePrototype(link, linking.LinkContext{})
+	if err != nil {
+		w.add(at, t, "a link that can be loaded", err.Error())
+		return
+	}
+	target, err := w.lsys.Load(linking.LinkContext{Ctx: context.Background(), LinkPath: at}, link, np)
+	if err != nil {
+		w.add(at, t, "a link that can be loaded", fmt.Sprintf("%s (%s)", link, err))
+		return
+	}
+	w.check(target, t.ReferencedType(), at)
+}
+
+func (w *validationWalk) checkStruct(n datamodel.Node, t *schema.TypeStruct, at datamodel.Path) {
+	switch stg := t.RepresentationStrategy().(type) {
+	case schema.StructRepresentation_Map:
+		if !w.expectKind(n, t, at, datamodel.Kind_Map) {
+			return
+		}
+		known := map[string]struct{}{}
+		for _, f := range t.Fields() {
+			key := stg.GetFieldKey(f)
+			known[key] = struct{}{}
+			v, err := n.LookupByString(key)
+			if err != nil || v.IsAbsent() {
+				if !f.IsOptional() && stg.FieldImplicit(f) == nil {
+					w.add(at, t, fmt.Sprintf("key %q", key), "no such key")
+				}
+				continue
+			}
+			w.checkMaybe(v, f.Type(), f.IsNullable(), at.AppendSegmentString(key))
+		}
+		for itr := n.MapIterator(); !itr.Done(); {
+			k, _, err := itr.Next()
+			if err != nil {
+				w.add(at, t, "a readable map", err.Error())
+				return
+			}
+			ks, _ := k.AsString()
+			if _, ok := known[ks]; !ok {
+				w.add(at, t, "only the keys "+quotedKeys(known), fmt.Sprintf("key %q", ks))
+			}
+		}
+	case schema.StructRepresentation_Tuple:
+		if !w.expectKind(n, t, at, datamodel.Kind_List) {
+			return
+		}
+		fields := t.Fields()
+		required := len(fields)
+		for required > 0 && fields[required-1].IsOptional() {
+			required--
+		}
+		if l := int(n.Length()); l < required || l > len(fields) {
+			expected := fmt.Sprintf("%d entries", len(fields))
+			if required < len(fields) {
+				expected = fmt.Sprintf("%d to %d entries", required, len(fields))
+			}
+			w.add(at, t, expected, fmt.Sprintf("%d", l))
+			return
+		}
+		for i := int64(0); i < n.Length(); i++ {
+			v, _ := n.LookupByIndex(i)
+			f := fields[i]
+			w.checkMaybe(v, f.Type(), f.IsNullable(), at.AppendSegmentInt(i))
+		}
+	case schema.StructRepresentation_Stringjoin:
+		if !w.expectKind(n, t, at, datamodel.Kind_String) {
+			return
+		}
+		s, _ := n.AsString()
+		parts := strings.Split(s, stg.GetDelim())
+		if len(parts) != len(t.Fields()) {
+			w.add(at, t, fmt.Sprintf("%d parts joined by %q", len(t.Fields()), stg.GetDelim()), fmt.Sprintf("%d", len(parts)))
+			return
+		}
+		for i, f := range t.Fields() {
+			w.check(basicnode.NewString(parts[i]), f.Type(), at)
+		}
+	default:
+		w.add(at, t, "a struct representation that can be validated", reprStrategyName(stg))
+	}
+}
+
+func (w *validationWalk) checkUnion(n datamodel.Node, t *schema.TypeUnion, at datamodel.Path) {
+	switch stg := t.RepresentationStrategy().(type) {
+	case schema.UnionRepresentation_Kinded:
+		member := stg.GetMember(n.Kind())
+		if member == "" {
+			kinds := make([]string, 0, len(t.Members()))
+			for _, m := range t.Members() {
+				kinds = append(kinds, m.RepresentationBehavior().String())
+			}
+			w.add(at, t, "one of "+strings.Join(kinds, ", "), n.Kind().String())
+			return
+		}
+		w.check(n, t.TypeSystem().TypeByName(string(member)), at)
+	case schema.UnionRepresentation_Keyed:
+		if !w.expectKind(n, t, at, datamodel.Kind_Map) {
+			return
+		}
+		members, _ := unionMembersByDiscriminant(t)
+		if n.Length() != 1 {
+			w.add(at, t, "one key, which is one of "+quotedKeys(members), fmt.Sprintf("%d keys", n.Length()))
+			return
+		}
+		k, v, _ := n.MapIterator().Next()
+		ks, _ := k.AsString()
+		member, ok := members[fmt.Sprintf("%q", ks)]
+		if !ok {
+			w.add(at, t, "one of the keys "+quotedKeys(members), fmt.Sprintf("key %q", ks))
+			return
+		}
+		w.check(v, member, at.AppendSegmentString(ks))
+	case schema.UnionRepresentation_Stringprefix:
+		if !w.expectKind(n, t, at, datamodel.Kind_String) {
+			return
+		}
+		s, _ := n.AsString()
+		for _, m := range t.Members() {
+			prefix := stg.GetDiscriminant(m) + stg.GetDelim()
+			if strings.HasPrefix(s, prefix) {
+				w.check(basicnode.NewString(strings.TrimPrefix(s, prefix)), m, at)
+				return
+			}
+		}
+		members, _ := unionMembersByDiscriminant(t)
+		w.add(at, t, "a string starting with one of "+quotedKeys(members), fmt.Sprintf("%q", s))
+	default:
+		w.add(at, t, "a union representation that can be validated", reprStrategyName(stg))
+	}
+}
+
+// quotedKeys lists the keys of a map, sorted, and quoted (unless they already are).
+func quotedKeys[V any](m map[string]V) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		if !strings.HasPrefix(k, `"`) {
+			k = fmt.Sprintf("%q", k)
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ", ")
+}
+
+// ValidateAll validates many pieces of data concurrently, calling report with each one's result.
+// The load function is called (from several goroutines at once) to get each piece of data, by its index.
+//
+// Results are reported in order, each as soon as it and all those before it are done,
+// so that they can be streamed out as they come; report is never called concurrently.
+// At most parallelism pieces of data are loaded or checked at once.
+func (v *Validator) ValidateAll(count int, parallelism int, t schema.Type, load func(i int) (datamodel.Node, error), report func(i int, problems []ValidationProblem, err error)) {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	type result struct {
+		problems []ValidationProblem
+		err      error
+	}
+	results := make([]chan result, count)
+	for i := range results {
+		results[i] = make(chan result, 1)
+	}
+	sem := make(chan struct{}, parallelism)
+	go func() {
+		for i := 0; i < count; i++ {
+			sem <- struct{}{}
+			go func(i int) {
+				defer func() { <-sem }()
+				n, err := load(i)
+				if err != nil {
+					results[i] <- result{err: err}
+					return
+				}
+				results[i] <- result{problems: v.Validate(n, t)}
+			}(i)
+		}
+	}()
+	for i := range results {
+		r := <-results[i]
+		report(i, r.problems, r.err)
+	}
+}
@@ -0,0 +1,276 @@
+package schema
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+
+	"github.com/ipld/go-ipldtool/app/shared"
+	"github.com/ipld/go-ipldtool/app/workspace"
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+var Cmd_Validate = &cli.Command{
+	Name:     "validate",
+	Category: "Advanced",
+	Usage:    "Check whether many documents match a schema, printing a result for each one.",
+	UsageText: `Validate checks documents against a type in a schema, and reports every place where each one doesn't match.` + "\n" +
+		"\n" +
+		`   ### Synopsis` + "\n" +
+		"\n" +
+		`   ipld [...global args...] validate --schema=<filename> --type=<typename> [--follow-links]` + "\n" +
+		`           [--input="codec:"<multicodec-name-or-hex>] [--output=<"text"|"codec:"<multicodec-name-or-hex>>] [--parallel=<n>]` + "\n" +
+		`           <CID|filename|"-">...` + "\n" +
+		"\n" +
+		`   Each positional argument is a document to check: a CID to load from storage, a filename (which must start with "./" or "/"), or "-" for stdin.` + "\n" +
+		`   Documents are checked concurrently, but the results are printed in the same order as the arguments, each one as soon as it (and all those before it) are done.` + "\n" +
+		"\n" +
+		`   Each problem found says where it is (as a data model path), what type was expected there, and what was expected versus what was found -- usually, which kind of data.` + "\n" +
+		"\n" +
+		`   With "--follow-links", every link whose type in the schema says what type it points to is loaded from storage, and the block it points to is checked against that type too.  Paths to problems found in linked blocks go through the links.` + "\n" +
+		"\n" +
+		`   The default output is one line per document, followed by one indented line per problem.  With "--output=codec:<name>", each result is instead printed as a map, one per line.` + "\n" +
+		"\n" +
+		`   The command fails if any document didn't match the schema, or couldn't be loaded at all.`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "schema",
+			Usage:    `Names a file containing the schema (in the schema DSL) to check the documents against.`,
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "type",
+			Usage:    `Names the type in the schema that each document should match at its root.`,
+			Required: true,
+		},
+		&cli.BoolFlag{
+			Name:  "follow-links",
+			Usage: `Load the blocks that links point to, and check them against the types the schema says they should be.`,
+		},
+		&cli.StringFlag{
+			Name:  "input",
+			Usage: `Defines what format documents from files or stdin are in.  If not set, the codec will be guessed, for each document.  Valid arguments must start with "codec:" followed by a multicodec name, or "codec:0x" followed by a multicodec indicator number in hexidecimal.`,
+		},
+		&cli.StringFlag{
+			Name:        "output",
+			Usage:       `Defines the format of the results.  Valid arguments are "text", or the word "codec:" followed by a multicodec name, or "codec:0x" followed by a multicodec indicator number in hexidecimal.`,
+			DefaultText: "text",
+		},
+		&cli.IntFlag{
+			Name:        "parallel",
+			Usage:       `How many documents to check at once.`,
+			DefaultText: "the number of CPUs",
+		},
+	},
+	Action: Action_Validate,
+}
+
+// Action_Validate is the function that implements the `ipld validate` command's behaviors.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- for incomprehensible or invalid arguments.
+//   - schema-dsl-parse-failed -- if the schema document didn't parse.
+//   - schema-compile-failed -- if the schema was parsed, but was logically invalid.
+//   - ipldtool-error-io -- if any of the documents couldn't be loaded.
+//   - ipldtool-error-data-invalid -- if any of the documents couldn't be decoded, or didn't match the schema (and all of them could be loaded).
+func Action_Validate(args *cli.Context) error {
+	// Check all the args before starting work.
+	if args.Args().Len() < 1 {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "validate command needs at least one positional argument")
+	}
+	stdinUsed := false
+	for _, sourceArg := range args.Args().Slice() {
+		if sourceArg == "-" && stdinUsed {
+			return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "only one of the documents can come from stdin")
+		}
+		stdinUsed = stdinUsed || sourceArg == "-"
+	}
+	var encoder codec.Encoder
+	if output := args.String("output"); output != "" && output != "text" {
+		var err error
+		if encoder, err = shared.ParseEncoderArg(output, "", "output"); err != nil {
+			return err
+		}
+	}
+	var inputCodec shared.CodecInfo
+	if args.IsSet("input") {
+		var err error
+		if inputCodec, err = shared.ParseDecoderArg(args.String("input"), "input"); err != nil {
+			return err
+		}
+	}
+	parallelism := runtime.NumCPU()
+	if args.IsSet("parallel") {
+		if parallelism = args.Int("parallel"); parallelism < 1 {
+			return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "parallel argument must be at least 1")
+		}
+	}
+
+	// Load the schema, and find the type.
+	dmt, err := DSLParseFile(args.String("schema"))
+	if err != nil {
+		return err
+	}
+	ts, err := SchemaCompile(dmt)
+	if err != nil {
+		return err
+	}
+	typ := ts.TypeByName(args.String("type"))
+	if typ == nil {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "type argument not recognized: there's no type named %q in the schema", args.String("type"))
+	}
+
+	// Storage is only opened if something's given by CID, or links are followed.
+	store := &workspace.LazyStorage{}
+	defer store.Close()
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.SetReadStorage(store)
+	validator := &Validator{}
+	if args.Bool("follow-links") {
+		validator.LinkSystem = &lsys
+	}
+
+	// Check everything, and print results as they come.
+	sources := args.Args().Slice()
+	load := func(i int) (datamodel.Node, error) {
+		return loadDocument(sources[i], inputCodec, &lsys)
+	}
+	// Documents that couldn't be loaded, or couldn't be decoded, are counted apart from those that really didn't match.
+	var unloadable, undecodable, mismatched int
+	var writeErr error
+	validator.ValidateAll(len(sources), parallelism, typ, load, func(i int, problems []ValidationProblem, err error) {
+		switch e, coded := err.(*ipldtoolerr.Error); {
+		case err == nil && len(problems) > 0:
+			mismatched++
+		case coded && (e.Code() == shared.ErrCode_DataInvalid || e.Code() == shared.ErrCode_CodecUnknown):
+			undecodable++
+		case err != nil:
+			unloadable++
+		}
+		if writeErr != nil {
+			return
+		}
+		if encoder != nil {
+			if writeErr = ipld.EncodeStreaming(args.App.Writer, validationResultNode(sources[i], problems, err), encoder); writeErr == nil {
+				_, writeErr = args.App.Writer.Write([]byte{'\n'})
+			}
+			return
+		}
+		switch {
+		case err != nil:
+			_, writeErr = fmt.Fprintf(args.App.Writer, "%s: error: %s\n", sources[i], err)
+		case len(problems) == 0:
+			_, writeErr = fmt.Fprintf(args.App.Writer, "%s: ok\n", sources[i])
+		default:
+			_, writeErr = fmt.Fprintf(args.App.Writer, "%s: invalid\n", sources[i])
+			for _, p := range problems {
+				if writeErr == nil {
+					_, writeErr = fmt.Fprintf(args.App.Writer, "\t%s\n", p)
+				}
+			}
+		}
+	})
+	if writeErr != nil {
+		return writeErr
+	}
+	return validateSummaryError(len(sources), unloadable, undecodable, mismatched)
+}
+
+// validateSummaryError returns the error the validate command ends with, if any documents failed, saying how many failed in each way
+// (like "2 of 5 documents could not be loaded, and 1 did not match the schema").
+// Its code is ipldtool-error-io if any documents couldn't be loaded, and ipldtool-error-data-invalid otherwise.
+func validateSummaryError(total, unloadable, undecodable, mismatched int) error {
+	var parts []string
+	for _, count := range []struct {
+		n    int
+		what string
+	}{
+		{unloadable, "could not be loaded"},
+		{undecodable, "could not be decoded"},
+		{mismatched, "did not match the schema"},
+	} {
+		switch {
+		case count.n == 0:
+		case len(parts) == 0:
+			parts = append(parts, fmt.Sprintf("%d of %d documents %s", count.n, total, count.what))
+		default:
+			parts = append(parts, fmt.Sprintf("%d %s", count.n, count.what))
+		}
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	msg := parts[len(parts)-1]
+	if len(parts) > 1 {
+		msg = strings.Join(parts[:len(parts)-1], ", ") + ", and " + msg
+	}
+	code := shared.ErrCode_DataInvalid
+	if unloadable > 0 {
+		code = "ipldtool-error-io"
+	}
+	return ipldtoolerr.Newf(code, "%s", msg)
+}
+
+// loadDocument loads and decodes one document, given by CID, filename, or "-".
+// The codec is the one given, if it's set; then the CID's; then a guess.
+func loadDocument(sourceArg string, inputCodec shared.CodecInfo, lsys *linking.LinkSystem) (datamodel.Node, error) {
+	reader, link, err := shared.ParseDataSourceArg(sourceArg)
+	if err != nil {
+		return nil, err
+	}
+	if link != nil {
+		if inputCodec.Decoder == nil {
+			if inputCodec, err = linkDecoder(link); err != nil {
+				return nil, err
+			}
+		}
+		bs, err := lsys.LoadRaw(linking.LinkContext{Ctx: context.Background()}, link)
+		if err != nil {
+			return nil, ipldtoolerr.Newf(shared.ErrCode_LoadFailed, "could not load %s: %s", link, err)
+		}
+		reader = bufio.NewReader(bytes.NewReader(bs))
+	} else if inputCodec.Decoder == nil {
+		if inputCodec, err = shared.SniffCodec(reader); err != nil {
+			return nil, err
+		}
+	}
+	var np datamodel.NodePrototype = basicnode.Prototype.Any
+	if inputCodec.Prototype != nil {
+		np = inputCodec.Prototype
+	}
+	n, err := ipld.DecodeStreamingUsingPrototype(reader, inputCodec.Decoder, np)
+	if err != nil {
+		return nil, ipldtoolerr.Newf(shared.ErrCode_DataInvalid, "could not decode %s: %s", sourceArg, err)
+	}
+	return n, nil
+}
+
+// validationResultNode returns the result of validating one document as data, for printing.
+func validationResultNode(source string, problems []ValidationProblem, err error) datamodel.Node {
+	result := newJSONObj().set("input", source)
+	if err != nil {
+		return result.set("valid", false).set("error", err.Error()).node()
+	}
+	list := []interface{}{}
+	for _, p := range problems {
+		list = append(list, newJSONObj().
+			set("path", p.Path.String()).
+			set("type", p.TypeName).
+			set("expected", p.Expected).
+			set("actual", p.Actual))
+	}
+	return result.set("valid", len(problems) == 0).set("problems", list).node()
+}
@@ -0,0 +1,135 @@
+package shared
+
+import (
+	"sort"
+
+	"github.com/ipfs/go-unixfsnode"
+	"github.com/ipfs/go-unixfsnode/data"
+	"github.com/ipfs/go-unixfsnode/directory"
+	"github.com/ipfs/go-unixfsnode/file"
+	"github.com/ipfs/go-unixfsnode/hamt"
+	dagpb "github.com/ipld/go-codec-dagpb"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	"github.com/ipld/go-ipld-prime/schema"
+)
+
+// adls holds the ADLs that can be requested by name.
+// As with codecs, there's no mutexing; registration should happen before app.Main.
+var adls = map[string]linking.NodeReifier{}
+
+func init() {
+	RegisterADL("unixfs", reifyUnixFS)
+	RegisterADL("unixfs-file", reifyUnixFSFile)
+	RegisterADL("unixfs-dir", reifyUnixFSDir)
+	RegisterADL("hamt", reifyHAMT)
+}
+
+// RegisterADL makes an ADL available to the tool under the given name.
+//
+// The reifier function has the same contract as a LinkSystem's NodeReifier:
+// it's given the data model node as loaded (and a LinkSystem, in case the ADL needs to load more blocks),
+// and returns the synthesized node.
+//
+// Reifiers are also applied to each block loaded while pathing,
+// so they should return any node they don't apply to unchanged, rather than erroring.
+// (This is the same convention the ADLs in the go-ipld-prime ecosystem follow.)
+//
+// Registering a name that's already known replaces the previous entry.
+func RegisterADL(name string, reifier linking.NodeReifier) {
+	if reifier == nil {
+		panic("not sensible to attempt to register a nil function")
+	}
+	adls[name] = reifier
+}
+
+// LookupADL returns the reifier function registered under the given name, or nil if there isn't one.
+func LookupADL(name string) linking.NodeReifier {
+	return adls[name]
+}
+
+// ListADLs returns the names of all registered ADLs, sorted.
+func ListADLs() []string {
+	names := make([]string, 0, len(adls))
+	for name := range adls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// The UnixFS ADLs all come from go-unixfsnode.
+//
+// "unixfs" recognizes any kind of UnixFS node:
+// files become bytes, and directories (whether plain or HAMT-sharded) become maps from names to links.
+// "unixfs-file", "unixfs-dir", and "hamt" do the same thing, but only for the one kind of node.
+//
+// go-unixfsnode expects the dag-pb nodes from go-codec-dagpb,
+// whereas we decode dag-pb with our own DagpbPrototype (because it prints better),
+// so these all start by converting to the former, if necessary.
+
+func reifyUnixFS(lnkCtx linking.LinkContext, n datamodel.Node, lsys *linking.LinkSystem) (datamodel.Node, error) {
+	pbn, ok := asGoDagpb(n)
+	if !ok {
+		return n, nil
+	}
+	return unixfsnode.Reify(lnkCtx, pbn, lsys)
+}
+
+func reifyUnixFSFile(lnkCtx linking.LinkContext, n datamodel.Node, lsys *linking.LinkSystem) (datamodel.Node, error) {
+	pbn, ufsData, ok := asUnixFS(n)
+	if !ok || (ufsData.FieldDataType().Int() != data.Data_File && ufsData.FieldDataType().Int() != data.Data_Raw) {
+		return n, nil
+	}
+	return file.NewUnixFSFile(lnkCtx.Ctx, pbn, lsys)
+}
+
+func reifyUnixFSDir(lnkCtx linking.LinkContext, n datamodel.Node, lsys *linking.LinkSystem) (datamodel.Node, error) {
+	pbn, ufsData, ok := asUnixFS(n)
+	if !ok {
+		return n, nil
+	}
+	switch ufsData.FieldDataType().Int() {
+	case data.Data_Directory:
+		return directory.NewUnixFSBasicDir(lnkCtx.Ctx, pbn, ufsData, lsys)
+	case data.Data_HAMTShard:
+		return hamt.NewUnixFSHAMTShard(lnkCtx.Ctx, pbn, ufsData, lsys)
+	}
+	return n, nil
+}
+
+func reifyHAMT(lnkCtx linking.LinkContext, n datamodel.Node, lsys *linking.LinkSystem) (datamodel.Node, error) {
+	pbn, ufsData, ok := asUnixFS(n)
+	if !ok || ufsData.FieldDataType().Int() != data.Data_HAMTShard {
+		return n, nil
+	}
+	return hamt.NewUnixFSHAMTShard(lnkCtx.Ctx, pbn, ufsData, lsys)
+}
+
+// asGoDagpb returns the node as a go-codec-dagpb PBNode, if it's dag-pb data at all.
+func asGoDagpb(n datamodel.Node) (dagpb.PBNode, bool) {
+	if pbn, ok := n.(dagpb.PBNode); ok {
+		return pbn, true
+	}
+	if tn, ok := n.(schema.TypedNode); !ok || tn.Type() != DagpbPrototype.Type() {
+		return nil, false
+	}
+	nb := dagpb.Type.PBNode.NewBuilder()
+	if err := nb.AssignNode(n); err != nil {
+		return nil, false
+	}
+	return nb.Build().(dagpb.PBNode), true
+}
+
+// asUnixFS returns the node as a go-codec-dagpb PBNode, and its decoded UnixFS data, if it's UnixFS at all.
+func asUnixFS(n datamodel.Node) (dagpb.PBNode, data.UnixFSData, bool) {
+	pbn, ok := asGoDagpb(n)
+	if !ok || !pbn.FieldData().Exists() {
+		return nil, nil, false
+	}
+	ufsData, err := data.DecodeUnixFSData(pbn.FieldData().Must().Bytes())
+	if err != nil {
+		return nil, nil, false
+	}
+	return pbn, ufsData, true
+}
@@ -2,17 +2,18 @@ package shared
 
 import (
 	"bufio"
+	"fmt"
 	"io"
 	"os"
 	"strings"
 
+	"github.com/ipfs/go-cid"
 	"github.com/ipld/go-ipld-prime/codec"
-	"github.com/ipld/go-ipld-prime/codec/cbor"
-	"github.com/ipld/go-ipld-prime/codec/dagcbor"
-	"github.com/ipld/go-ipld-prime/codec/dagjson"
-	"github.com/ipld/go-ipld-prime/codec/json"
 	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
 	"github.com/ipld/go-ipld-prime/printer"
+	"github.com/ipld/go-ipld-prime/schema"
 	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
 )
 
@@ -25,11 +26,12 @@ func StringIsPathish(x string) bool {
 }
 
 // ParseDataSourceArg returns a reader for data based on the argument,
-// and a Link if the argument was of that kind.
+// or a Link if the argument was of that kind.
+// (If it's a link, the reader is nil: the caller will need to load the data from storage.)
 //
 // Errors:
 //
-//   - ipldtool-error-invalid-args -- if the input arg can't be made into a readable stream.
+//   - ipldtool-error-invalid-args -- if the input arg can't be made into a readable stream, and isn't a CID either.
 func ParseDataSourceArg(inputArg string) (reader *bufio.Reader, link datamodel.Link, err error) {
 	switch {
 	case inputArg == "-": // stdin
@@ -41,20 +43,34 @@ func ParseDataSourceArg(inputArg string) (reader *bufio.Reader, link datamodel.L
 		}
 		reader = bufio.NewReader(f)
 	default: // hope this is a CID
-		panic("todo")
+		c, err := cid.Decode(inputArg)
+		if err != nil {
+			return nil, nil, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "arg is not a filename (those must start with \"./\" or \"/\"), and not a valid CID either: %s", err)
+		}
+		link = cidlink.Link{Cid: c}
 	}
 	return
 }
 
-// ParseDataSourceArg returns an IPLD encoder based on the argument string.
+// IsADLNode returns true if the node claims to be a schema.TypedNode, but has no type info.
+// This is typical of the nodes produced by ADLs.
+// The Representation of such a node is usually the substrate the ADL was built from,
+// so callers that want to encode what the ADL presents should encode the node itself rather than its Representation.
+func IsADLNode(n datamodel.Node) bool {
+	tn, ok := n.(schema.TypedNode)
+	return ok && tn.Type() == nil
+}
+
+// ParseEncoderArg returns an IPLD encoder based on the argument string.
 // It handles strings of the form "codec:{name}", "codec:0x{code}",
 // and the special string "debug".
+// Any codec with an encoder in the registry (see RegisterCodec) can be named.
 //
 // The argName parameter is used purely for error message formatting purposes.
 //
 // Errors:
 //
-//   - ipldtool-error-invalid-args -- if the input arg can't be made into a readable stream.
+//   - ipldtool-error-invalid-args -- if the argument doesn't state a codec, or the codec has no encoder available.
 func ParseEncoderArg(arg string, defalt string, argName string) (codec.Encoder, error) {
 	if arg == "" {
 		arg = defalt
@@ -62,30 +78,107 @@ func ParseEncoderArg(arg string, defalt string, argName string) (codec.Encoder,
 	switch arg {
 	case "debug":
 		return func(n datamodel.Node, wr io.Writer) error {
+			// ADLs tend to produce nodes which claim to be typed, but have no type info (go-unixfsnode's do, for example).
+			//  The printer would describe those as invalid; copy them to plain data model nodes instead, so they're printed as what they look like.
+			if IsADLNode(n) {
+				var err error
+				n, err = PlainCopy(n)
+				if err != nil {
+					return err
+				}
+			}
 			printer.Fprint(wr, n)
 			return nil
 		}, nil
 	default:
-		switch {
-		case strings.HasPrefix(arg, "codec:0x"):
-			panic("todo")
-		case strings.HasPrefix(arg, "codec:"):
-			// TODO: I thought there'd be a library somewhere with a lookup function from known names to codes.
-			// TODO: should probably use the go-ipld-prime multicodec registry, so it's easy for someone to build extended version of the tool?
-			switch arg[6:] {
-			case "json":
-				return json.Encode, nil
-			case "dag-json":
-				return dagjson.Encode, nil
-			case "cbor":
-				return cbor.Encode, nil
-			case "dag-cbor":
-				return dagcbor.Encode, nil
-			default:
-				return nil, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "%s argument not recognized: %q is not a supported codec name", argName, arg[6:])
+		code, err := ParseCodecArg(arg, argName)
+		if err != nil {
+			return nil, err
+		}
+		info, _ := LookupCodec(code)
+		if info.Encoder == nil {
+			return nil, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "%s argument not recognized: %q is not a supported codec for encoding", argName, info.Name)
+		}
+		return info.Encoder, nil
+	}
+}
+
+// PlainCopy rebuilds a node, recursively, out of basicnodes.
+// (datamodel.Copy isn't quite enough for this: the basicnode assemblers keep any child nodes they're given as-is.)
+// Lists are copied by looking up each index, rather than with a ListIterator, because bindnode doesn't have iterators for the representations of every type.
+func PlainCopy(n datamodel.Node) (datamodel.Node, error) {
+	switch n.Kind() {
+	case datamodel.Kind_Map:
+		nb := basicnode.Prototype.Map.NewBuilder()
+		ma, err := nb.BeginMap(n.Length())
+		if err != nil {
+			return nil, err
+		}
+		for itr := n.MapIterator(); !itr.Done(); {
+			k, v, err := itr.Next()
+			if err != nil {
+				return nil, err
 			}
-		default:
-			return nil, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "%s argument format not recognized", argName)
+			if k, err = PlainCopy(k); err != nil {
+				return nil, err
+			}
+			if v, err = PlainCopy(v); err != nil {
+				return nil, err
+			}
+			if err := ma.AssembleKey().AssignNode(k); err != nil {
+				return nil, err
+			}
+			if err := ma.AssembleValue().AssignNode(v); err != nil {
+				return nil, err
+			}
+		}
+		if err := ma.Finish(); err != nil {
+			return nil, err
+		}
+		return nb.Build(), nil
+	case datamodel.Kind_List:
+		nb := basicnode.Prototype.List.NewBuilder()
+		la, err := nb.BeginList(n.Length())
+		if err != nil {
+			return nil, err
 		}
+		for i := int64(0); i < n.Length(); i++ {
+			v, err := n.LookupByIndex(i)
+			if err != nil {
+				return nil, err
+			}
+			if v, err = PlainCopy(v); err != nil {
+				return nil, err
+			}
+			if err := la.AssembleValue().AssignNode(v); err != nil {
+				return nil, err
+			}
+		}
+		if err := la.Finish(); err != nil {
+			return nil, err
+		}
+		return nb.Build(), nil
+	case datamodel.Kind_Null:
+		return datamodel.Null, nil
+	case datamodel.Kind_Bool:
+		v, err := n.AsBool()
+		return basicnode.NewBool(v), err
+	case datamodel.Kind_Int:
+		v, err := n.AsInt()
+		return basicnode.NewInt(v), err
+	case datamodel.Kind_Float:
+		v, err := n.AsFloat()
+		return basicnode.NewFloat(v), err
+	case datamodel.Kind_String:
+		v, err := n.AsString()
+		return basicnode.NewString(v), err
+	case datamodel.Kind_Bytes:
+		v, err := n.AsBytes()
+		return basicnode.NewBytes(v), err
+	case datamodel.Kind_Link:
+		v, err := n.AsLink()
+		return basicnode.NewLink(v), err
+	default:
+		return nil, fmt.Errorf("cannot copy node of kind %s", n.Kind())
 	}
 }
@@ -0,0 +1,253 @@
+package shared
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	dagpb "github.com/ipld/go-codec-dagpb"
+	"github.com/ipld/go-ipld-prime/codec"
+	"github.com/ipld/go-ipld-prime/codec/cbor"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	"github.com/ipld/go-ipld-prime/codec/json"
+	"github.com/ipld/go-ipld-prime/codec/raw"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/multicodec"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	mc "github.com/multiformats/go-multicodec"
+
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+// CodecInfo describes a codec that the tool can use.
+//
+// The Encoder and Decoder functions are the ones kept in the go-ipld-prime multicodec registry;
+// either may be nil, if the codec only works in one direction.
+// LinkCapable states whether the codec can serialize links
+// (e.g. dag-json can, but plain json can't).
+// This isn't something that can be discovered from the functions themselves,
+// which is why we keep our own records about it.
+//
+// Prototype may be set if the codec only works with data of one particular shape
+// (e.g. dag-pb, which requires data matching its PBNode schema).
+// If set, decoding should use it, and data should be checked against it before encoding.
+// If nil, any data model node will do.
+type CodecInfo struct {
+	Name        string
+	Code        uint64
+	Encoder     codec.Encoder
+	Decoder     codec.Decoder
+	LinkCapable bool
+	Prototype   datamodel.NodePrototype
+}
+
+// codecInfos holds everything we know about codecs beyond what's in the go-ipld-prime multicodec registry.
+// Like that registry, there's no mutexing; registration should happen during init, or at least before app.Main.
+var codecInfos = map[uint64]CodecInfo{}
+
+// codecCodesByName indexes codecInfos by name, so looking a codec up by name always gives the same answer.
+var codecCodesByName = map[string]uint64{}
+
+func init() {
+	RegisterCodec(CodecInfo{Name: "raw", Code: 0x55, Encoder: raw.Encode, Decoder: raw.Decode, Prototype: basicnode.Prototype.Bytes})
+	RegisterCodec(CodecInfo{Name: "dag-pb", Code: 0x70, Encoder: dagpb.Encode, Decoder: dagpb.Decode, LinkCapable: true, Prototype: DagpbPrototype})
+	RegisterCodec(CodecInfo{Name: "json", Code: 0x0200, Encoder: json.Encode, Decoder: json.Decode})
+	RegisterCodec(CodecInfo{Name: "cbor", Code: 0x51, Encoder: cbor.Encode, Decoder: cbor.Decode})
+	RegisterCodec(CodecInfo{Name: "dag-json", Code: 0x0129, Encoder: dagjson.Encode, Decoder: dagjson.Decode, LinkCapable: true})
+	RegisterCodec(CodecInfo{Name: "dag-cbor", Code: 0x71, Encoder: dagcbor.Encode, Decoder: dagcbor.Decode, LinkCapable: true})
+}
+
+// Conform returns the node rebuilt using the codec's Prototype,
+// or the node unchanged if the codec doesn't have one.
+// Use this before encoding data that may not have come from the codec's Prototype in the first place;
+// it gives much better errors than the codec would.
+//
+// Errors:
+//
+//   - ipldtool-error-data-invalid -- if the data doesn't have the shape the codec requires.
+func (info CodecInfo) Conform(n datamodel.Node) (_ datamodel.Node, err error) {
+	if info.Prototype == nil {
+		return n, nil
+	}
+	// Some node implementations (bindnode, at least) still panic on some kinds of mismatched data, rather than returning errors.
+	//  Bring those back into line.
+	defer func() {
+		if r := recover(); r != nil {
+			err = ipldtoolerr.Newf(ErrCode_DataInvalid, "data does not have the shape required by %s: %v", info.Name, r)
+		}
+	}()
+	nb := info.Prototype.NewBuilder()
+	if err := nb.AssignNode(n); err != nil {
+		return nil, ipldtoolerr.Newf(ErrCode_DataInvalid, "data does not have the shape required by %s: %s", info.Name, err)
+	}
+	return nb.Build(), nil
+}
+
+// RegisterCodec makes a codec available to the tool.
+//
+// The encoder and decoder (whichever are non-nil) are put in the go-ipld-prime multicodec registry,
+// which means LinkSystems using that registry will also pick them up.
+// The name becomes usable in any "codec:{name}" argument.
+//
+// Registering a code that's already known replaces the previous entry.
+// Registering a name that's already known (for a different code) also replaces it:
+// the name refers to the codec registered with it most recently.
+func RegisterCodec(info CodecInfo) {
+	if info.Encoder != nil {
+		multicodec.RegisterEncoder(info.Code, info.Encoder)
+	}
+	if info.Decoder != nil {
+		multicodec.RegisterDecoder(info.Code, info.Decoder)
+	}
+	if old, ok := codecInfos[info.Code]; ok && codecCodesByName[old.Name] == info.Code {
+		delete(codecCodesByName, old.Name)
+	}
+	codecInfos[info.Code] = info
+	codecCodesByName[info.Name] = info.Code
+}
+
+// LookupCodec returns everything known about the codec with the given multicodec code.
+// The Encoder and Decoder fields are filled from the go-ipld-prime multicodec registry,
+// so codecs that were registered there directly (rather than through RegisterCodec) are also described,
+// with a name taken from the multicodec table.
+//
+// The boolean is false if there's neither an encoder nor a decoder for this code.
+func LookupCodec(code uint64) (CodecInfo, bool) {
+	info, known := codecInfos[code]
+	if !known {
+		info = CodecInfo{Name: mc.Code(code).String(), Code: code}
+	}
+	info.Encoder, _ = multicodec.LookupEncoder(code)
+	info.Decoder, _ = multicodec.LookupDecoder(code)
+	return info, info.Encoder != nil || info.Decoder != nil
+}
+
+// ChoosePrototype picks the NodePrototype to load a link's data with:
+// the Prototype of the link's codec, if it has one (see CodecInfo), or basicnode otherwise.
+// It can be used as a traversal.LinkTargetNodePrototypeChooser.
+func ChoosePrototype(lnk datamodel.Link, _ linking.LinkContext) (datamodel.NodePrototype, error) {
+	if cl, ok := lnk.(cidlink.Link); ok {
+		if info, _ := LookupCodec(cl.Prefix().Codec); info.Prototype != nil {
+			return info.Prototype, nil
+		}
+	}
+	return basicnode.Prototype.Any, nil
+}
+
+// ListCodecs returns a description of every codec that has an encoder or decoder available,
+// sorted by multicodec code.
+func ListCodecs() []CodecInfo {
+	seen := map[uint64]struct{}{}
+	for _, code := range multicodec.ListEncoders() {
+		seen[code] = struct{}{}
+	}
+	for _, code := range multicodec.ListDecoders() {
+		seen[code] = struct{}{}
+	}
+	codes := make([]uint64, 0, len(seen))
+	for code := range seen {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	infos := make([]CodecInfo, len(codes))
+	for i, code := range codes {
+		infos[i], _ = LookupCodec(code)
+	}
+	return infos
+}
+
+// ParseCodecArg returns the multicodec code stated by the argument string.
+// It handles strings of the form "codec:{name}" and "codec:0x{code}".
+// Names are looked up first among the registered codecs, and then in the multicodec table.
+//
+// The argName parameter is used purely for error message formatting purposes.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- if the argument isn't of a recognized form, or names no known codec.
+func ParseCodecArg(arg string, argName string) (uint64, error) {
+	switch {
+	case strings.HasPrefix(arg, "codec:0x"):
+		code, err := strconv.ParseUint(arg[8:], 16, 64)
+		if err != nil {
+			return 0, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "%s argument not recognized: %q is not a valid hexidecimal multicodec indicator", argName, arg[6:])
+		}
+		return code, nil
+	case strings.HasPrefix(arg, "codec:"):
+		name := arg[6:]
+		if code, ok := codecCodesByName[name]; ok {
+			return code, nil
+		}
+		var code mc.Code
+		if err := code.Set(name); err != nil {
+			return 0, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "%s argument not recognized: %q is not a known codec name", argName, name)
+		}
+		return uint64(code), nil
+	default:
+		return 0, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "%s argument format not recognized", argName)
+	}
+}
+
+// ParseDecoderArg returns the description of a codec to use for decoding, based on the argument string.
+// It handles strings of the form "codec:{name}" and "codec:0x{code}".
+// (The whole CodecInfo is returned, rather than just the decoder function,
+// because the caller will usually also need to check if the codec wants a specific Prototype.)
+//
+// The argName parameter is used purely for error message formatting purposes.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- if the argument doesn't state a codec, or the codec has no decoder available.
+func ParseDecoderArg(arg string, argName string) (CodecInfo, error) {
+	code, err := ParseCodecArg(arg, argName)
+	if err != nil {
+		return CodecInfo{}, err
+	}
+	info, _ := LookupCodec(code)
+	if info.Decoder == nil {
+		return CodecInfo{}, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "%s argument not recognized: %q is not a supported codec for decoding", argName, info.Name)
+	}
+	return info, nil
+}
+
+// SniffCodec peeks at the start of a stream and guesses what codec it's in.
+// The reader is not advanced.
+//
+// This heuristic is very simple, and may change over time:
+//
+//   - something that starts with "{" or "[" (after any whitespace) is assumed to be dag-json;
+//   - something that starts with a CBOR map or array header is assumed to be dag-cbor;
+//   - something that starts with a protobuf header for field 1 or 2 (the Data and Links fields) is assumed to be dag-pb.
+//
+// Errors:
+//
+//   - ipldtool-error-codec-unknown -- if the heuristic couldn't come up with any guess.
+//   - ipldtool-error-io -- if the stream can't be read.
+func SniffCodec(reader *bufio.Reader) (CodecInfo, error) {
+	peeked, err := reader.Peek(64)
+	if len(peeked) == 0 {
+		if err == nil || err == io.EOF {
+			return CodecInfo{}, ipldtoolerr.New(ErrCode_CodecUnknown, "can't guess a codec for empty input")
+		}
+		return CodecInfo{}, ipldtoolerr.Newf("ipldtool-error-io", "could not read input: %s", err)
+	}
+	trimmed := bytes.TrimLeft(peeked, " \t\r\n")
+	switch {
+	case len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '['):
+		info, _ := LookupCodec(0x0129)
+		return info, nil
+	case peeked[0] >= 0x80 && peeked[0] <= 0xbf: // CBOR major types 4 (array) and 5 (map).
+		info, _ := LookupCodec(0x71)
+		return info, nil
+	case peeked[0] == 0x0a || peeked[0] == 0x12: // Protobuf field 1 or 2, wire type 2 (length-delimited).
+		info, _ := LookupCodec(0x70)
+		return info, nil
+	}
+	return CodecInfo{}, ipldtoolerr.New(ErrCode_CodecUnknown, "no input codec specified by args, and gave up trying to guess one from the content")
+}
@@ -0,0 +1,48 @@
+package shared
+
+import (
+	"strings"
+
+	"github.com/ipld/go-ipld-prime/node/bindnode"
+	"github.com/ipld/go-ipld-prime/schema"
+	schemadmt "github.com/ipld/go-ipld-prime/schema/dmt"
+	schemadsl "github.com/ipld/go-ipld-prime/schema/dsl"
+)
+
+// dagpbSchema is the schema that dag-pb data must match, as given in the dag-pb spec.
+//
+// The go-codec-dagpb package has its own generated types for this,
+// but they don't carry the schema type info that the printer needs
+// (which makes debug output of dag-pb data rather unhelpful).
+// So we compile the schema ourselves, and use bindnode with it;
+// the dag-pb encoder and decoder are happy to work with any node of the right shape.
+const dagpbSchema = `
+type PBNode struct {
+	Links [PBLink]
+	Data optional Bytes
+}
+
+type PBLink struct {
+	Hash Link
+	Name optional String
+	Tsize optional Int
+}
+`
+
+// DagpbPrototype is a NodePrototype for the dag-pb PBNode type.
+// Data built with it is guaranteed to be encodable by dag-pb.
+//
+// (This is set up in a var initializer rather than an init func,
+// because the codec registry's init func needs it to already exist.)
+var DagpbPrototype = func() schema.TypedPrototype {
+	dmt, err := schemadsl.Parse("dag-pb", strings.NewReader(dagpbSchema))
+	if err != nil {
+		panic(err)
+	}
+	var ts schema.TypeSystem
+	ts.Init()
+	if err := schemadmt.Compile(&ts, dmt); err != nil {
+		panic(err)
+	}
+	return bindnode.Prototype(nil, ts.TypeByName("PBNode"))
+}()
@@ -0,0 +1,7 @@
+package shared
+
+const (
+	ErrCode_CodecUnknown = "ipldtool-error-codec-unknown"
+	ErrCode_DataInvalid  = "ipldtool-error-data-invalid"
+	ErrCode_LoadFailed   = "ipldtool-error-load-failed"
+)
@@ -0,0 +1,106 @@
+package shared
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/schema"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+)
+
+// WalkLinks calls fn for every link in a node, recursively (but not going into the blocks the links point to),
+// with the path to the link from the node.
+//
+// If sel is not nil, only the parts of the node that the selector explores are walked,
+// and fn is given the selector to carry on with in the block the link points to.
+// If sel is nil, everything is walked, and fn is given nil too.
+//
+// Map keys that aren't strings are put in the path as KeyString writes them.
+//
+// WalkLinks stops, and returns the error, as soon as fn returns one.
+// Selectors that ask for an ADL to be applied aren't supported, and get an error too.
+func WalkLinks(n datamodel.Node, sel selector.Selector, fn func(datamodel.Path, datamodel.Link, selector.Selector) error) error {
+	return walkLinks(n, datamodel.Path{}, sel, fn)
+}
+
+func walkLinks(n datamodel.Node, at datamodel.Path, sel selector.Selector, fn func(datamodel.Path, datamodel.Link, selector.Selector) error) error {
+	if _, ok := sel.(selector.Reifiable); ok {
+		return fmt.Errorf("selectors that apply ADLs are not supported here (at %q)", at)
+	}
+	// explore says how to carry on into a child: with the next selector, or not at all.
+	explore := func(seg datamodel.PathSegment) (selector.Selector, bool, error) {
+		if sel == nil {
+			return nil, true, nil
+		}
+		next, err := sel.Explore(n, seg)
+		return next, next != nil, err
+	}
+	switch n.Kind() {
+	case datamodel.Kind_Map:
+		for itr := n.MapIterator(); !itr.Done(); {
+			k, v, err := itr.Next()
+			if err != nil {
+				return err
+			}
+			if v.IsAbsent() {
+				continue
+			}
+			seg := datamodel.PathSegmentOfString(KeyString(k))
+			next, ok, err := explore(seg)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			if err := walkLinks(v, at.AppendSegment(seg), next, fn); err != nil {
+				return err
+			}
+		}
+	case datamodel.Kind_List:
+		// Entries are looked up by index, rather than using a ListIterator, because bindnode doesn't have iterators for the representations of every type.
+		for i := int64(0); i < n.Length(); i++ {
+			v, err := n.LookupByIndex(i)
+			if err != nil {
+				return err
+			}
+			seg := datamodel.PathSegmentOfInt(i)
+			next, ok, err := explore(seg)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			if err := walkLinks(v, at.AppendSegment(seg), next, fn); err != nil {
+				return err
+			}
+		}
+	case datamodel.Kind_Link:
+		lnk, err := n.AsLink()
+		if err != nil {
+			return err
+		}
+		return fn(at, lnk, sel)
+	}
+	return nil
+}
+
+// KeyString returns a map key as a string, for use in a path, or for printing.
+// Keys in the typed view of a map aren't always strings (they can be structs with a stringjoin representation, for example);
+// those are written the way their representation is, if that's a string, or else ints in decimal, and anything else as a description of its kind.
+func KeyString(k datamodel.Node) string {
+	if s, err := k.AsString(); err == nil {
+		return s
+	}
+	if tn, ok := k.(schema.TypedNode); ok && !IsADLNode(k) {
+		if s, err := tn.Representation().AsString(); err == nil {
+			return s
+		}
+	}
+	if i, err := k.AsInt(); err == nil {
+		return strconv.FormatInt(i, 10)
+	}
+	return fmt.Sprintf("(%s key)", k.Kind())
+}
@@ -0,0 +1,146 @@
+package shared
+
+import (
+	"context"
+	"encoding/base32"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	flatfs "github.com/ipfs/go-ds-flatfs"
+	"github.com/ipld/go-ipld-prime/storage"
+
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+// Storage is what a storage engine must provide:
+// the go-ipld-prime storage APIs for both reading and writing,
+// and a Close method, which will be called when a command is done with it.
+type Storage interface {
+	storage.ReadableStorage
+	storage.WritableStorage
+	io.Closer
+}
+
+// ListableStorage is a feature-detection interface, for storages that can list every key they hold.
+// Not every storage engine can do this; commands that need it should check for it, and say so if it's missing.
+type ListableStorage interface {
+	// Keys calls fn with every key in the storage, in no particular order, stopping if fn returns an error.
+	Keys(ctx context.Context, fn func(key string) error) error
+}
+
+// StorageOpener is the function a storage engine provides to open (or create, if necessary)
+// a storage rooted at the given directory.
+type StorageOpener func(dir string) (Storage, error)
+
+// storageEngines holds the storage engines that can be requested by name.
+// As with codecs, there's no mutexing; registration should happen before app.Main.
+var storageEngines = map[string]StorageOpener{}
+
+func init() {
+	RegisterStorageEngine("flatfs", openFlatfs)
+}
+
+// RegisterStorageEngine makes a storage engine available to the tool under the given name.
+//
+// Registering a name that's already known replaces the previous entry.
+func RegisterStorageEngine(name string, opener StorageOpener) {
+	if opener == nil {
+		panic("not sensible to attempt to register a nil function")
+	}
+	storageEngines[name] = opener
+}
+
+// ListStorageEngines returns the names of all registered storage engines, sorted.
+func ListStorageEngines() []string {
+	names := make([]string, 0, len(storageEngines))
+	for name := range storageEngines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OpenStorage opens a storage using the named engine.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- if there's no storage engine registered by that name.
+//   - ipldtool-error-io -- if the storage engine fails to open.
+func OpenStorage(engine string, dir string) (Storage, error) {
+	opener, exists := storageEngines[engine]
+	if !exists {
+		return nil, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "no storage engine named %q", engine)
+	}
+	store, err := opener(dir)
+	if err != nil {
+		return nil, ipldtoolerr.Newf("ipldtool-error-io", "could not open %s storage at %q: %s", engine, dir, err)
+	}
+	return store, nil
+}
+
+// flatfsStorage adapts a flatfs datastore to the go-ipld-prime storage APIs.
+//
+// Keys are escaped, because the flatfs datastore doesn't allow arbitrary keys.
+// (The escaping is the same as the go-ipld-prime dsadapter package would do, if configured the way we used to;
+// we don't use that package anymore only because it's lagging behind go-datastore's API changes.)
+type flatfsStorage struct {
+	ds *flatfs.Datastore
+}
+
+func (flatfsStorage) escape(raw string) datastore.Key {
+	return datastore.NewKey(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte(raw)))
+}
+
+func (s flatfsStorage) Has(ctx context.Context, key string) (bool, error) {
+	return s.ds.Has(ctx, s.escape(key))
+}
+
+func (s flatfsStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	return s.ds.Get(ctx, s.escape(key))
+}
+
+func (s flatfsStorage) Put(ctx context.Context, key string, content []byte) error {
+	return s.ds.Put(ctx, s.escape(key), content)
+}
+
+func (s flatfsStorage) Keys(ctx context.Context, fn func(key string) error) error {
+	results, err := s.ds.Query(ctx, query.Query{KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+	for result := range results.Next() {
+		if result.Error != nil {
+			return result.Error
+		}
+		raw, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimPrefix(result.Key, "/"))
+		if err != nil {
+			return err
+		}
+		if err := fn(string(raw)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s flatfsStorage) Close() error {
+	return s.ds.Close()
+}
+
+func openFlatfs(dir string) (Storage, error) {
+	// Create the datastore backend.
+	//  (This uses a bunch of legacy code and will probably be replaced someday.)
+	shardFn, err := flatfs.ParseShardFunc("/repo/flatfs/shard/v1/next-to-last/3")
+	if err != nil {
+		return nil, err
+	}
+	ds, err := flatfs.CreateOrOpen(dir, shardFn, false)
+	if err != nil {
+		return nil, err
+	}
+	return flatfsStorage{ds}, nil
+}
@@ -0,0 +1,100 @@
+package shared
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+// DecodeStream decodes documents from the reader, one after another, until it runs out of input,
+// calling fn with each one (and its index in the stream, counting from zero) as soon as it's decoded.
+// Each document is decoded by calling the decode function with a reader that starts at the beginning of the document.
+//
+// How documents are separated depends on the codec:
+// for json and dag-json, each line is a document (blank lines are skipped), as in "JSON lines";
+// for cbor and dag-cbor, documents simply follow one another, as in a CBOR sequence (RFC 8742).
+// Other codecs have no way to tell where one document ends and the next begins, so they can't be streamed.
+//
+// If decoding a document fails, or fn returns an error, DecodeStream stops, and returns the error, marked with the document's index
+// (by a "document" entry in its details, and at the start of its message).
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- if the codec can't be streamed.
+//   - ipldtool-error-data-invalid -- if the input couldn't be read.
+//   - any error returned by decode or fn.
+func DecodeStream(r *bufio.Reader, info CodecInfo, decode func(io.Reader) (datamodel.Node, error), fn func(int, datamodel.Node) error) error {
+	// next returns a reader for the next document, or nil, once the input is all used up.
+	var next func() (io.Reader, error)
+	switch info.Code {
+	case 0x0200, 0x0129: // json, dag-json
+		next = func() (io.Reader, error) {
+			for {
+				line, err := r.ReadBytes('\n')
+				if len(bytes.TrimSpace(line)) > 0 {
+					return bytes.NewReader(line), nil
+				}
+				if err == io.EOF {
+					return nil, nil
+				} else if err != nil {
+					return nil, ipldtoolerr.Newf(ErrCode_DataInvalid, "could not read input: %s", err)
+				}
+			}
+		}
+	case 0x51, 0x71: // cbor, dag-cbor
+		next = func() (io.Reader, error) {
+			// The decoder reads exactly as much as each document takes, so all that's needed is to check if there's anything left.
+			if _, err := r.Peek(1); err == io.EOF {
+				return nil, nil
+			} else if err != nil {
+				return nil, ipldtoolerr.Newf(ErrCode_DataInvalid, "could not read input: %s", err)
+			}
+			return r, nil
+		}
+	default:
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "input can't be streamed in %s: only json, dag-json, cbor, and dag-cbor can be", info.Name)
+	}
+
+	for i := 0; ; i++ {
+		doc, err := next()
+		if err != nil {
+			return inDocument(i, err)
+		}
+		if doc == nil {
+			return nil
+		}
+		n, err := decode(doc)
+		if err != nil {
+			return inDocument(i, err)
+		}
+		if err := fn(i, n); err != nil {
+			return inDocument(i, err)
+		}
+	}
+}
+
+// inDocument marks an error as having happened while working on the document at the given index in a stream (see DecodeStream).
+// Coded errors keep their code; the index is put in their details, and at the start of their message.
+func inDocument(i int, err error) error {
+	var e *ipldtoolerr.Error
+	if !errors.As(err, &e) {
+		return fmt.Errorf("document %d: %w", i, err)
+	}
+	details := map[string]string{"document": strconv.Itoa(i)}
+	for k, v := range e.TheDetails {
+		details[k] = v
+	}
+	return &ipldtoolerr.Error{
+		TheCode:    e.TheCode,
+		TheMessage: fmt.Sprintf("document %d: %s", i, e.TheMessage),
+		TheDetails: details,
+		TheCause:   e.TheCause,
+	}
+}
@@ -0,0 +1,5 @@
+package shell
+
+const (
+	ErrCode_PathFailed = "ipldtool-shell-path-failed"
+)
@@ -0,0 +1,556 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	"github.com/ipld/go-ipld-prime/node/bindnode"
+	"github.com/ipld/go-ipld-prime/schema"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+
+	toolschema "github.com/ipld/go-ipldtool/app/schema"
+	"github.com/ipld/go-ipldtool/app/shared"
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+// session is the state of one shell: where it is in the data, and the settings for how the data is shown.
+type session struct {
+	out  io.Writer
+	lsys linking.LinkSystem
+
+	// frames is the position: frames[0] is the root, and each one after it was reached by one path segment from the one before.
+	frames []frame
+
+	// outputArg and encoder are the output format, as set by the "--output" flag or the "output" command.
+	outputArg string
+	encoder   codec.Encoder
+
+	// lens is "typed" or "representation" if there's a schema, and empty if not.
+	lens string
+
+	// history is every block that's been loaded by CID, in order.
+	history []visit
+}
+
+// frame is one step of the position in the data.
+type frame struct {
+	seg  string         // The path segment that reached this frame from the one before (empty for the root).
+	node datamodel.Node // The data here.  If link is set, this is the block that was loaded, not the link itself.
+	link datamodel.Link // Set if the data here is a block that was loaded by following a link (or by CID, for the root).
+}
+
+// visit is an entry in the history.
+type visit struct {
+	link datamodel.Link
+	path string
+}
+
+// command is one of the things that can be done in the shell.
+type command struct {
+	name   string
+	args   string
+	usage  string
+	action func(s *session, args []string) error
+}
+
+var commands []command
+
+func init() {
+	// (This is set up here, rather than in the var declaration, because the help command refers to the list itself.)
+	commands = []command{
+		{"ls", "[<path>]", "List the entries in the map or list here (or at the path), with what's in each one.", (*session).cmdLs},
+		{"cd", "[<path>]", `Move to the path.  Paths are relative, unless they start with "/"; ".." goes up.  With no path, moves back to the root.`, (*session).cmdCd},
+		{"up", "[<n>]", "Move up one level (or n levels).", (*session).cmdUp},
+		{"pwd", "", "Print the path to here from the root.", (*session).cmdPwd},
+		{"cat", "[<path>]", "Print the data here (or at the path), in the output format.", (*session).cmdCat},
+		{"links", "[<path>]", "List the links in the data here (or at the path), with the path to each one.  Links inside linked blocks aren't included.", (*session).cmdLinks},
+		{"follow", "[<path>]", "Load the block that the link here (or at the path) points to, from storage, and move into it.", (*session).cmdFollow},
+		{"history", "", "List the blocks that have been loaded, in order, with the path each one was loaded at.", (*session).cmdHistory},
+		{"output", "[<format>]", `Set the output format to "debug" or "codec:<name>" (or print the current one).`, (*session).cmdOutput},
+		{"lens", "[typed|representation]", "When there's a schema, set whether data is shown and pathed in its typed view or its representation (or print the current setting).", (*session).cmdLens},
+		{"help", "", "Print this list of commands.", (*session).cmdHelp},
+		{"exit", "", "Leave the shell.", nil},
+	}
+}
+
+// run does one line of input.
+// It returns io.EOF if the line asks to leave the shell.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- if the command isn't known, or its arguments are wrong.
+//   - ipldtool-shell-path-failed -- if a path doesn't exist in the data.
+//   - ipldtool-error-load-failed -- if a link can't be loaded.
+//   - ipldtool-error-data-invalid -- if a loaded block doesn't match its type in the schema.
+func (s *session) run(line string) error {
+	words := strings.Fields(line)
+	if len(words) == 0 || strings.HasPrefix(words[0], "#") {
+		return nil
+	}
+	for _, cmd := range commands {
+		if cmd.name == words[0] {
+			if cmd.action == nil {
+				return io.EOF
+			}
+			return cmd.action(s, words[1:])
+		}
+	}
+	if words[0] == "quit" {
+		return io.EOF
+	}
+	return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "no command named %q (try \"help\")", words[0])
+}
+
+// prompt returns the prompt for the next line, which shows where we are.
+func (s *session) prompt() string {
+	return pathString(s.frames) + "> "
+}
+
+func (s *session) cmdLs(args []string) error {
+	n, err := s.nodeAt(args)
+	if err != nil {
+		return err
+	}
+	view := s.view(n)
+	tw := tabwriter.NewWriter(s.out, 0, 4, 2, ' ', 0)
+	switch view.Kind() {
+	case datamodel.Kind_Map:
+		for itr := view.MapIterator(); !itr.Done(); {
+			k, v, err := itr.Next()
+			if err != nil {
+				return err
+			}
+			if v.IsAbsent() {
+				continue
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", shared.KeyString(k), kindString(v), summary(v))
+		}
+	case datamodel.Kind_List:
+		err := eachListEntry(view, func(i int64, v datamodel.Node) error {
+			_, err := fmt.Fprintf(tw, "%d\t%s\t%s\n", i, kindString(v), summary(v))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	case datamodel.Kind_Link:
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "this is a link to %s; use \"follow\" to load it", summary(view))
+	default:
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "this is a %s, which has no entries to list", view.Kind())
+	}
+	return tw.Flush()
+}
+
+func (s *session) cmdCd(args []string) error {
+	if len(args) > 1 {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "cd takes at most one path")
+	}
+	path := "/"
+	if len(args) == 1 {
+		path = args[0]
+	}
+	frames, err := s.resolve(path)
+	if err != nil {
+		return err
+	}
+	s.frames = frames
+	return nil
+}
+
+func (s *session) cmdUp(args []string) error {
+	n := 1
+	if len(args) > 1 {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "up takes at most one argument")
+	}
+	if len(args) == 1 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 0 {
+			return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "up takes a number of levels, not %q", args[0])
+		}
+	}
+	if n >= len(s.frames) {
+		return ipldtoolerr.Newf(ErrCode_PathFailed, "can't go up %d levels from %s", n, pathString(s.frames))
+	}
+	s.frames = s.frames[:len(s.frames)-n]
+	return nil
+}
+
+func (s *session) cmdPwd(args []string) error {
+	if len(args) > 0 {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "pwd takes no arguments")
+	}
+	_, err := fmt.Fprintln(s.out, pathString(s.frames))
+	return err
+}
+
+func (s *session) cmdCat(args []string) error {
+	n, err := s.nodeAt(args)
+	if err != nil {
+		return err
+	}
+	// The same as the read command: the debug format gets the node as-is, so it can show type info; codecs get the representation.
+	//  The exception is that the debug format gets a plain copy of representation nodes, because the printer can't handle all of bindnode's.
+	switch {
+	case s.outputArg == "debug" && s.view(n) != n:
+		if n, err = shared.PlainCopy(s.view(n)); err == nil {
+			err = s.encoder(n, s.out)
+		}
+	case s.outputArg == "debug" || shared.IsADLNode(n):
+		err = s.encoder(n, s.out)
+	default:
+		err = ipld.EncodeStreaming(s.out, n, s.encoder)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = s.out.Write([]byte{'\n'})
+	return err
+}
+
+func (s *session) cmdLinks(args []string) error {
+	n, err := s.nodeAt(args)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(s.out, 0, 4, 2, ' ', 0)
+	err = shared.WalkLinks(s.view(n), nil, func(at datamodel.Path, lnk datamodel.Link, _ selector.Selector) error {
+		_, err := fmt.Fprintf(tw, "%s\t%s\n", at, lnk)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Flush()
+}
+
+func (s *session) cmdFollow(args []string) error {
+	if len(args) > 1 {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "follow takes at most one path")
+	}
+	frames := s.frames
+	if len(args) == 1 {
+		var err error
+		if frames, err = s.resolve(args[0]); err != nil {
+			return err
+		}
+	}
+	here := &frames[len(frames)-1]
+	if here.node.Kind() != datamodel.Kind_Link {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "there's no link at %s to follow (it's a %s)", pathString(frames), here.node.Kind())
+	}
+	lnk, err := here.node.AsLink()
+	if err != nil {
+		return err
+	}
+	n, err := s.load(lnk, frames)
+	if err != nil {
+		return err
+	}
+	here.node, here.link = n, lnk
+	s.frames = frames
+	s.history = append(s.history, visit{lnk, pathString(frames)})
+	return nil
+}
+
+func (s *session) cmdHistory(args []string) error {
+	if len(args) > 0 {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "history takes no arguments")
+	}
+	tw := tabwriter.NewWriter(s.out, 0, 4, 2, ' ', 0)
+	for _, v := range s.history {
+		fmt.Fprintf(tw, "%s\t%s\n", v.link, v.path)
+	}
+	return tw.Flush()
+}
+
+func (s *session) cmdOutput(args []string) error {
+	switch len(args) {
+	case 0:
+		_, err := fmt.Fprintln(s.out, s.outputArg)
+		return err
+	case 1:
+		encoder, err := shared.ParseEncoderArg(args[0], "debug", "output")
+		if err != nil {
+			return err
+		}
+		s.outputArg, s.encoder = args[0], encoder
+		return nil
+	default:
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "output takes at most one argument")
+	}
+}
+
+func (s *session) cmdLens(args []string) error {
+	if s.lens == "" {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "there's no schema in use, so there's no lens to set")
+	}
+	switch {
+	case len(args) == 0:
+		_, err := fmt.Fprintln(s.out, s.lens)
+		return err
+	case len(args) == 1 && (args[0] == "typed" || args[0] == "representation"):
+		s.lens = args[0]
+		return nil
+	default:
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "lens must be either \"typed\" or \"representation\"")
+	}
+}
+
+func (s *session) cmdHelp(args []string) error {
+	tw := tabwriter.NewWriter(s.out, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "%s %s\t%s\n", cmd.name, cmd.args, cmd.usage)
+	}
+	return tw.Flush()
+}
+
+// nodeAt returns the node here, or at the path in the args, if there's one.
+func (s *session) nodeAt(args []string) (datamodel.Node, error) {
+	switch len(args) {
+	case 0:
+		return s.frames[len(s.frames)-1].node, nil
+	case 1:
+		frames, err := s.resolve(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return frames[len(frames)-1].node, nil
+	default:
+		return nil, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "too many arguments: expected at most one path")
+	}
+}
+
+// resolve works out the position that a path leads to from here, without moving there.
+// Links aren't crossed: the path can end on a link, but can't go through one, because that needs a "follow".
+func (s *session) resolve(path string) ([]frame, error) {
+	frames := s.frames
+	if strings.HasPrefix(path, "/") {
+		frames = frames[:1]
+	}
+	// The frames are copied, so that following a link in the result doesn't change the current position.
+	frames = append([]frame(nil), frames...)
+	for _, seg := range strings.Split(path, "/") {
+		switch seg {
+		case "", ".":
+			continue
+		case "..":
+			if len(frames) == 1 {
+				return nil, ipldtoolerr.Newf(ErrCode_PathFailed, "can't go up from the root")
+			}
+			frames = frames[:len(frames)-1]
+			continue
+		}
+		n, err := s.step(frames[len(frames)-1].node, pathOf(frames), seg)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, frame{seg: seg, node: n})
+	}
+	return frames, nil
+}
+
+// step looks up one path segment in a node, the way the lens says to.
+func (s *session) step(n datamodel.Node, at datamodel.Path, seg string) (datamodel.Node, error) {
+	if n.Kind() == datamodel.Kind_Link {
+		return nil, ipldtoolerr.Newf(ErrCode_PathFailed, "at %q: there's a link here, which has to be followed before going into it", at)
+	}
+	var next datamodel.Node
+	var err error
+	if tn, ok := n.(schema.TypedNode); ok && s.lens == "representation" && !shared.IsADLNode(n) {
+		next, err = toolschema.ReprLookup(tn, at, datamodel.PathSegmentOfString(seg))
+		if err != nil {
+			return nil, err
+		}
+	} else if next, err = n.LookupBySegment(datamodel.PathSegmentOfString(seg)); errors.As(err, &datamodel.ErrNotExists{}) {
+		return nil, ipldtoolerr.Newf(ErrCode_PathFailed, "at %q: there's no %q here", at, seg)
+	} else if err != nil {
+		return nil, ipldtoolerr.Newf(ErrCode_PathFailed, "at %q: %s", at, err)
+	}
+	if next.IsAbsent() {
+		return nil, ipldtoolerr.Newf(ErrCode_PathFailed, "at %q: there's no value here", at.AppendSegmentString(seg))
+	}
+	return next, nil
+}
+
+// load loads the block a link points to, from the position given.
+// If the link is typed, and its type says what type it points to, the data is loaded as that type.
+func (s *session) load(lnk datamodel.Link, frames []frame) (_ datamodel.Node, err error) {
+	at := pathOf(frames)
+	np, err := shared.ChoosePrototype(lnk, linking.LinkContext{})
+	if err != nil {
+		return nil, err
+	}
+	if tn, ok := frames[len(frames)-1].node.(schema.TypedNode); ok && !shared.IsADLNode(tn) {
+		if t, ok := tn.Type().(*schema.TypeLink); ok && t.HasReferencedType() {
+			np = bindnode.Prototype(nil, t.ReferencedType()).Representation()
+		}
+	}
+	// bindnode still panics for some kinds of mismatched data, rather than returning errors.
+	defer func() {
+		if r := recover(); r != nil {
+			err = ipldtoolerr.Newf(shared.ErrCode_DataInvalid, "data at %s does not match the schema: %v", lnk, r)
+		}
+	}()
+	n, err := s.lsys.Load(linking.LinkContext{Ctx: context.Background(), LinkPath: at}, lnk, np)
+	if err != nil {
+		return nil, ipldtoolerr.Newf(shared.ErrCode_LoadFailed, "could not load %s: %s", lnk, err)
+	}
+	return n, nil
+}
+
+// view returns a node the way the lens says it should be seen: if the lens is "representation", typed nodes are swapped for their representation.
+func (s *session) view(n datamodel.Node) datamodel.Node {
+	return toolschema.LensView(n, s.lens)
+}
+
+// complete is the tab completion for the terminal: command names for the first word, and otherwise, paths.
+func (s *session) complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+	before := line[:pos]
+	wordStart := strings.LastIndexByte(before, ' ') + 1
+	word := before[wordStart:]
+	var candidates []string
+	if strings.TrimSpace(before[:wordStart]) == "" {
+		for _, cmd := range commands {
+			if strings.HasPrefix(cmd.name, word) {
+				candidates = append(candidates, cmd.name+" ")
+			}
+		}
+	} else {
+		dir, partial := "", word
+		if i := strings.LastIndexByte(word, '/'); i >= 0 {
+			dir, partial = word[:i+1], word[i+1:]
+		}
+		frames, err := s.resolve(dir)
+		if err != nil {
+			return "", 0, false
+		}
+		for _, key := range childKeys(s.view(frames[len(frames)-1].node)) {
+			if strings.HasPrefix(key, partial) {
+				candidates = append(candidates, dir+key)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return "", 0, false
+	}
+	completion := commonPrefix(candidates)
+	return before[:wordStart] + completion + line[pos:], wordStart + len(completion), true
+}
+
+// childKeys returns the map keys or list indexes in a node, sorted, for completion.
+func childKeys(n datamodel.Node) []string {
+	var keys []string
+	switch n.Kind() {
+	case datamodel.Kind_Map:
+		for itr := n.MapIterator(); !itr.Done(); {
+			k, v, err := itr.Next()
+			if err != nil {
+				break
+			}
+			if !v.IsAbsent() {
+				keys = append(keys, shared.KeyString(k))
+			}
+		}
+		sort.Strings(keys)
+	case datamodel.Kind_List:
+		for i := int64(0); i < n.Length(); i++ {
+			keys = append(keys, strconv.FormatInt(i, 10))
+		}
+	}
+	return keys
+}
+
+// commonPrefix returns the longest prefix that all the strings have.
+func commonPrefix(strs []string) string {
+	prefix := strs[0]
+	for _, s := range strs[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// eachListEntry calls fn for each entry in a list.
+// It looks the entries up by index, rather than using a ListIterator, because bindnode doesn't have iterators for the representations of every type.
+func eachListEntry(n datamodel.Node, fn func(int64, datamodel.Node) error) error {
+	for i := int64(0); i < n.Length(); i++ {
+		v, err := n.LookupByIndex(i)
+		if err != nil {
+			return err
+		}
+		if err := fn(i, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pathOf returns the path to a position.
+func pathOf(frames []frame) datamodel.Path {
+	segs := make([]datamodel.PathSegment, 0, len(frames)-1)
+	for _, f := range frames[1:] {
+		segs = append(segs, datamodel.PathSegmentOfString(f.seg))
+	}
+	return datamodel.NewPath(segs)
+}
+
+// pathString returns the path to a position, for showing: it always starts with "/".
+func pathString(frames []frame) string {
+	return "/" + pathOf(frames).String()
+}
+
+// kindString says what kind of thing a node is: its type name, if it's typed, or its kind, if not.
+func kindString(n datamodel.Node) string {
+	if tn, ok := n.(schema.TypedNode); ok && !shared.IsADLNode(n) {
+		return tn.Type().Name()
+	}
+	return n.Kind().String()
+}
+
+// summary describes what's in a node, briefly: the value, for scalars, or the size, for maps and lists.
+func summary(n datamodel.Node) string {
+	switch n.Kind() {
+	case datamodel.Kind_Map, datamodel.Kind_List:
+		if n.Length() == 1 {
+			return "1 entry"
+		}
+		return fmt.Sprintf("%d entries", n.Length())
+	case datamodel.Kind_String:
+		v, _ := n.AsString()
+		if len(v) > 40 {
+			v = v[:37] + "..."
+		}
+		return strconv.Quote(v)
+	case datamodel.Kind_Bytes:
+		v, _ := n.AsBytes()
+		return fmt.Sprintf("%d bytes", len(v))
+	case datamodel.Kind_Int:
+		v, _ := n.AsInt()
+		return strconv.FormatInt(v, 10)
+	case datamodel.Kind_Float:
+		v, _ := n.AsFloat()
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case datamodel.Kind_Bool:
+		v, _ := n.AsBool()
+		return strconv.FormatBool(v)
+	case datamodel.Kind_Link:
+		v, _ := n.AsLink()
+		return v.String()
+	default:
+		return ""
+	}
+}
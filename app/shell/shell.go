@@ -0,0 +1,214 @@
+package shell
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+
+	toolschema "github.com/ipld/go-ipldtool/app/schema"
+	"github.com/ipld/go-ipldtool/app/shared"
+	"github.com/ipld/go-ipldtool/app/workspace"
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+var Cmd_Shell = &cli.Command{
+	Name:     "shell",
+	Category: "Basic",
+	Usage:    "Explore data interactively: move around in it, look at parts of it, and follow links from it.",
+	UsageText: `Shell loads some data, and then reads commands for exploring it, one per line.` + "\n" +
+		"\n" +
+		`   ### Synopsis` + "\n" +
+		"\n" +
+		`   ipld [...global args...] shell [--input="codec:"<multicodec-name-or-hex>] [--output=<"debug"|"codec:"<multicodec-name-or-hex>>]` + "\n" +
+		`           [--schema=<filename> --type=<starting-typename> [--schema-lens=<"representation"|"typed">]]` + "\n" +
+		`           <CID|filename|"-">` + "\n" +
+		"\n" +
+		`   The data to start from is given the same way as for the read command: a CID to load from storage, a filename (which must start with "./" or "/"), or "-" for stdin.` + "\n" +
+		"\n" +
+		`   The shell keeps track of a current position in the data, like a current directory, and shows it in the prompt.` + "\n" +
+		`   Map keys and list indexes are like directories: "cd" moves around, "ls" lists what's at a position, and "cat" prints it.` + "\n" +
+		`   Links aren't crossed on their own: "links" lists them, and "follow" loads the block a link points to from the workspace storage, and moves into it.` + "\n" +
+		`   Every block that's loaded is remembered, and "history" lists them.  Use "help" to see all the commands.` + "\n" +
+		"\n" +
+		`   The output format and schema lens can be changed with the "output" and "lens" commands, as well as set to begin with by flags.` + "\n" +
+		"\n" +
+		`   When reading from a terminal, the usual line editing keys work, and tab completes command names, and paths (against the map keys and list indexes in the data).` + "\n" +
+		`   When the data comes from stdin, the commands are read from the terminal instead.` + "\n" +
+		`   Commands can also be piped in, one per line, for use in scripts; in that case, there's no prompt, and the shell stops at the first command that fails.`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:        "output",
+			Usage:       `Defines what format data should be printed in, to begin with.  Valid arguments are "debug", or the word "codec:" followed by a multicodec name, or "codec:0x" followed by a multicodec indicator number in hexidecimal.`,
+			DefaultText: "debug",
+		},
+		&cli.StringFlag{
+			Name:  "input",
+			Usage: `Defines what format the input should be expected to be in.  Only relevant in the input is from a file or stdin; if the data source is a CID, that already implies a codec.  Valid arguments must start with "codec:" followed by a multicodec name, or "codec:0x" followed by a multicodec indicator number in hexidecimal.`,
+		},
+		&cli.StringFlag{
+			Name:  "schema",
+			Usage: `Names a file containing a schema (in the schema DSL) to apply to the data.  The "--type" flag must also be used.`,
+		},
+		&cli.StringFlag{
+			Name:  "type",
+			Usage: `Names the type in the schema that the data should match at its root.`,
+		},
+		&cli.StringFlag{
+			Name:        "schema-lens",
+			Usage:       `When a schema is used, says whether data should be shown and pathed in its typed view, or its representation, to begin with.  Valid arguments are "typed" or "representation".`,
+			DefaultText: "typed",
+		},
+	},
+	Action: Action_Shell,
+}
+
+// Action_Shell is the function that implements the `ipld shell` command's behaviors.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- for incomprehensible or invalid arguments.
+//   - ipldtool-error-load-failed -- if the data can't be loaded from storage.
+//   - ipldtool-error-data-invalid -- if the data can't be decoded, or doesn't match the schema.
+//   - ipldtool-error-io -- if the schema file can't be opened.
+//   - schema-dsl-parse-failed -- if the schema document didn't parse.
+//   - schema-compile-failed -- if the schema was parsed, but was logically invalid.
+//   - any of the errors from the shell's commands -- if the commands aren't from a terminal, and one fails.
+func Action_Shell(args *cli.Context) error {
+	if args.Args().Len() != 1 {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "shell command needs exactly one positional argument")
+	}
+	sourceArg := args.Args().First()
+
+	s := &session{out: args.App.Writer, outputArg: "debug"}
+	if args.IsSet("output") {
+		s.outputArg = args.String("output")
+	}
+	var err error
+	if s.encoder, err = shared.ParseEncoderArg(s.outputArg, "debug", "output"); err != nil {
+		return err
+	}
+	var inputCodec shared.CodecInfo
+	if args.IsSet("input") {
+		if inputCodec, err = shared.ParseDecoderArg(args.String("input"), "input"); err != nil {
+			return err
+		}
+	}
+
+	// Was there a schema?  If so, the data is decoded as the type, and the lens is set.
+	ds, err := toolschema.ParseDataSchemaArgs(args)
+	if err != nil {
+		return err
+	}
+	s.lens = ds.Lens
+
+	// Storage is only opened if it's needed: if the data is given by CID, or a link is followed.
+	store := &workspace.LazyStorage{}
+	defer store.Close()
+	s.lsys = cidlink.DefaultLinkSystem()
+	s.lsys.SetReadStorage(store)
+
+	root, link, err := loadRoot(sourceArg, inputCodec, ds, &s.lsys)
+	if err != nil {
+		return err
+	}
+	s.frames = []frame{{node: root, link: link}}
+	if link != nil {
+		s.history = append(s.history, visit{link, "/"})
+	}
+
+	// Now, the commands.
+	//  If the data came from stdin, the commands can't; they're read from the terminal instead.
+	in := os.Stdin
+	if sourceArg == "-" {
+		if in, err = os.Open("/dev/tty"); err != nil {
+			return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "when the data comes from stdin, commands are read from the terminal, but there isn't one: %s", err)
+		}
+		defer in.Close()
+	}
+	if term.IsTerminal(int(in.Fd())) {
+		return interact(s, in)
+	}
+	lines := bufio.NewScanner(in)
+	for lines.Scan() {
+		if err := s.run(lines.Text()); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return lines.Err()
+}
+
+// interact runs the shell on a terminal: with a prompt, line editing, and tab completion.
+// Errors from commands are printed, and then it carries on.
+func interact(s *session, tty *os.File) error {
+	state, err := term.MakeRaw(int(tty.Fd()))
+	if err != nil {
+		return err
+	}
+	defer term.Restore(int(tty.Fd()), state)
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{tty, s.out}, s.prompt())
+	t.AutoCompleteCallback = s.complete
+	s.out = t // The terminal takes care of turning linebreaks into what a terminal in raw mode needs.
+	for {
+		line, err := t.ReadLine()
+		if err == io.EOF {
+			return nil
+		} else if err != nil && err != term.ErrPasteIndicator {
+			return err
+		}
+		if err := s.run(line); err == io.EOF {
+			return nil
+		} else if err != nil {
+			fmt.Fprintf(t, "error: %s\n", err)
+		}
+		t.SetPrompt(s.prompt())
+	}
+}
+
+// loadRoot loads the data the shell starts from, given by CID, filename, or "-".
+// The codec is the one given, if it's set; then the CID's; then a guess.
+// The data is decoded as the schema's type, if there is one.
+// If the data was given by CID, that's returned as a link.
+func loadRoot(sourceArg string, inputCodec shared.CodecInfo, ds toolschema.DataSchema, lsys *linking.LinkSystem) (datamodel.Node, datamodel.Link, error) {
+	reader, link, err := shared.ParseDataSourceArg(sourceArg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if link != nil {
+		if inputCodec.Decoder == nil {
+			var known bool
+			inputCodec, known = shared.LookupCodec(link.(cidlink.Link).Prefix().Codec)
+			if !known || inputCodec.Decoder == nil {
+				return nil, nil, ipldtoolerr.Newf(shared.ErrCode_CodecUnknown, "%s is in codec %s, which has no decoder available", link, inputCodec.Name)
+			}
+		}
+		bs, err := lsys.LoadRaw(linking.LinkContext{Ctx: context.Background()}, link)
+		if err != nil {
+			return nil, nil, ipldtoolerr.Newf(shared.ErrCode_LoadFailed, "could not load %s: %s", link, err)
+		}
+		reader = bufio.NewReader(bytes.NewReader(bs))
+	} else if inputCodec.Decoder == nil {
+		if inputCodec, err = shared.SniffCodec(reader); err != nil {
+			return nil, nil, err
+		}
+	}
+	n, err := ds.Decode(reader, inputCodec)
+	if err != nil {
+		return nil, nil, err
+	}
+	return n, link, nil
+}
@@ -0,0 +1,268 @@
+package stat
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/bits"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+
+	"github.com/ipld/go-ipldtool/app/shared"
+	"github.com/ipld/go-ipldtool/app/workspace"
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+var Cmd_Stat = &cli.Command{
+	Name:     "stat",
+	Category: "Advanced",
+	Usage:    "Report how big a DAG is (or everything in the workspace): blocks, bytes, codecs, depth, fan-out, duplicates, and missing blocks.",
+	UsageText: `Stat is for sizing up data that's spread across many blocks.` + "\n" +
+		"\n" +
+		`   ### Synopsis` + "\n" +
+		"\n" +
+		`   ipld [...global args...] stat [<CID>]` + "\n" +
+		`           [--output=<"text"|"codec:"<multicodec-name-or-hex>>]` + "\n" +
+		`           [--parallel=<n>]` + "\n" +
+		"\n" +
+		`   Starting from the block the CID points to, every link is followed, loading blocks from the workspace storage, and the whole DAG is measured.  Without a CID, every block in the workspace storage is measured instead.` + "\n" +
+		"\n" +
+		`   The report says:` + "\n" +
+		`     - blocks: how many different blocks there are, and how many bytes they take up altogether;` + "\n" +
+		`     - codecs: the same, for each codec;` + "\n" +
+		`     - links: how many links there are, in all the blocks;` + "\n" +
+		`     - duplicates: how many of those links point to a block that another link points to as well (each block is only counted once in the totals, no matter how many links point to it);` + "\n" +
+		`     - missing: how many different blocks are linked to, but aren't in the storage;` + "\n" +
+		`     - max depth: the most links there are in a row, from the root (or, without a CID, from any block);` + "\n" +
+		`     - fan-out: how many blocks have how many links in them, in buckets of powers of two.` + "\n" +
+		"\n" +
+		`   The report is printed as text, or, with "--output=codec:dag-json" (or any other codec), as a map.` + "\n" +
+		"\n" +
+		`   Blocks are loaded and decoded several at once; the "--parallel" flag says how many (by default, as many as there are CPUs).` + "\n",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:        "output",
+			Usage:       `Defines what format the report should be printed in.  Valid arguments are "text", or the word "codec:" followed by a multicodec name, or "codec:0x" followed by a multicodec indicator number in hexidecimal.`,
+			DefaultText: "text",
+		},
+		&cli.IntFlag{
+			Name:        "parallel",
+			Usage:       `How many blocks to load and decode at once.`,
+			DefaultText: "the number of CPUs",
+		},
+	},
+	Action: Action_Stat,
+}
+
+// Action_Stat is the function that implements the `ipld stat` command's behaviors.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- for incomprehensible or invalid arguments (or if there's no CID, and the storage can't list what's in it).
+//   - ipldtool-error-load-failed -- if the root block isn't in storage, or some block that is can't be loaded.
+//   - ipldtool-error-data-invalid -- if a block can't be decoded, or the storage holds something that isn't keyed by a CID.
+//   - ipldtool-error-io -- if there's no CID, and the storage can't be listed.
+//   - ipldtool-workspace-not-found -- if there's no workspace to load from.
+func Action_Stat(args *cli.Context) error {
+	// Parse positional args.
+	var root datamodel.Link
+	switch args.Args().Len() {
+	case 0:
+	case 1:
+		var err error
+		_, root, err = shared.ParseDataSourceArg(args.Args().Get(0))
+		if err != nil {
+			return err
+		}
+		if root == nil {
+			return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'stat' command needs a CID as its argument (or nothing, for the whole workspace), since it walks through storage")
+		}
+	default:
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'stat' command needs at most one positional argument")
+	}
+
+	// Parse the rest of the flags.
+	var encoder codec.Encoder
+	if arg := args.String("output"); arg != "" && arg != "text" {
+		var err error
+		encoder, err = shared.ParseEncoderArg(arg, "text", "output")
+		if err != nil {
+			return err
+		}
+	}
+	parallelism := runtime.NumCPU()
+	if args.IsSet("parallel") {
+		if parallelism = args.Int("parallel"); parallelism < 1 {
+			return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "parallel argument must be at least 1")
+		}
+	}
+
+	// Open the storage, and find out where to start.
+	store := &workspace.LazyStorage{}
+	defer store.Close()
+	ctx := context.Background()
+	var start []string
+	if root != nil {
+		has, err := store.Has(ctx, root.Binary())
+		if _, coded := err.(*ipldtoolerr.Error); coded {
+			return err // Errors from opening the storage already say what went wrong.
+		} else if err != nil {
+			return ipldtoolerr.Newf(shared.ErrCode_LoadFailed, "could not load %s: %s", root, err)
+		}
+		if !has {
+			return ipldtoolerr.Newf(shared.ErrCode_LoadFailed, "could not load %s: it's not in the storage", root)
+		}
+		start = []string{root.Binary()}
+	} else {
+		err := store.Keys(ctx, func(key string) error {
+			start = append(start, key)
+			return nil
+		})
+		if _, coded := err.(*ipldtoolerr.Error); coded {
+			return err
+		} else if err != nil {
+			return ipldtoolerr.Newf("ipldtool-error-io", "could not list the workspace storage: %s", err)
+		}
+	}
+
+	// Walk, and report.
+	w := newWalker(store, parallelism)
+	if err := w.walk(ctx, start); err != nil {
+		return err
+	}
+	report := w.report()
+	if encoder == nil {
+		report.printText(args.App.Writer)
+		return nil
+	}
+	return report.print(args.App.Writer, encoder)
+}
+
+// report is what stat says about the blocks it's walked.
+type report struct {
+	blocks     int64
+	bytes      int64
+	codecs     map[string]*codecReport
+	links      int64
+	duplicates int64
+	missing    int64
+	maxDepth   int
+	fanOut     map[int]int64 // Counts of blocks, by fanOutBucket.
+}
+
+type codecReport struct {
+	blocks int64
+	bytes  int64
+}
+
+// fanOutBucket says which bucket of the fan-out histogram a number of links goes in.
+// Bucket 0 is for no links, and bucket n is for between 2^(n-1) and 2^n-1 links.
+func fanOutBucket(links int) int {
+	return bits.Len(uint(links))
+}
+
+// fanOutLabel says what range of numbers of links a bucket is for.
+func fanOutLabel(bucket int) string {
+	if bucket < 2 {
+		return fmt.Sprintf("%d", bucket)
+	}
+	return fmt.Sprintf("%d-%d", 1<<(bucket-1), 1<<bucket-1)
+}
+
+// sortedCodecs returns the names of the codecs in the report, sorted.
+func (r *report) sortedCodecs() []string {
+	names := make([]string, 0, len(r.codecs))
+	for name := range r.codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortedBuckets returns the fan-out buckets in the report that have any blocks in them, in order.
+func (r *report) sortedBuckets() []int {
+	buckets := make([]int, 0, len(r.fanOut))
+	for bucket := range r.fanOut {
+		buckets = append(buckets, bucket)
+	}
+	sort.Ints(buckets)
+	return buckets
+}
+
+// printText prints the report as a table.
+func (r *report) printText(w io.Writer) {
+	plural := func(n int64, word string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, word)
+		}
+		return fmt.Sprintf("%d %ss", n, word)
+	}
+	// The headings of the nested sections have nothing in their second column, so tabwriter pads them with trailing spaces; those are trimmed off.
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "blocks:\t%s, %s\n", plural(r.blocks, "block"), plural(r.bytes, "byte"))
+	fmt.Fprintf(tw, "codecs:\t\n")
+	for _, name := range r.sortedCodecs() {
+		fmt.Fprintf(tw, "  %s:\t%s, %s\n", name, plural(r.codecs[name].blocks, "block"), plural(r.codecs[name].bytes, "byte"))
+	}
+	fmt.Fprintf(tw, "links:\t%d\n", r.links)
+	fmt.Fprintf(tw, "duplicates:\t%d\n", r.duplicates)
+	fmt.Fprintf(tw, "missing:\t%d\n", r.missing)
+	fmt.Fprintf(tw, "max depth:\t%d\n", r.maxDepth)
+	fmt.Fprintf(tw, "fan-out:\t\n")
+	for _, bucket := range r.sortedBuckets() {
+		label := fanOutLabel(bucket) + " links"
+		if bucket == 1 {
+			label = "1 link"
+		}
+		fmt.Fprintf(tw, "  %s:\t%s\n", label, plural(r.fanOut[bucket], "block"))
+	}
+	tw.Flush()
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+}
+
+// print prints the report as a map, using the given codec.
+func (r *report) print(w io.Writer, encoder codec.Encoder) error {
+	n, err := qp.BuildMap(basicnode.Prototype.Map, 8, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "blocks", qp.Int(r.blocks))
+		qp.MapEntry(ma, "bytes", qp.Int(r.bytes))
+		qp.MapEntry(ma, "codecs", qp.Map(int64(len(r.codecs)), func(ma datamodel.MapAssembler) {
+			for _, name := range r.sortedCodecs() {
+				qp.MapEntry(ma, name, qp.Map(2, func(ma datamodel.MapAssembler) {
+					qp.MapEntry(ma, "blocks", qp.Int(r.codecs[name].blocks))
+					qp.MapEntry(ma, "bytes", qp.Int(r.codecs[name].bytes))
+				}))
+			}
+		}))
+		qp.MapEntry(ma, "links", qp.Int(r.links))
+		qp.MapEntry(ma, "duplicates", qp.Int(r.duplicates))
+		qp.MapEntry(ma, "missing", qp.Int(r.missing))
+		qp.MapEntry(ma, "maxDepth", qp.Int(int64(r.maxDepth)))
+		qp.MapEntry(ma, "fanOut", qp.Map(int64(len(r.fanOut)), func(ma datamodel.MapAssembler) {
+			for _, bucket := range r.sortedBuckets() {
+				qp.MapEntry(ma, fanOutLabel(bucket), qp.Int(r.fanOut[bucket]))
+			}
+		}))
+	})
+	if err != nil {
+		return err
+	}
+	if err := ipld.EncodeStreaming(w, n, encoder); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w)
+	return err
+}
@@ -0,0 +1,231 @@
+package stat
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+
+	"github.com/ipld/go-ipldtool/app/shared"
+	"github.com/ipld/go-ipldtool/app/workspace"
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+// walker loads blocks, and the blocks they link to, with a fixed number of workers,
+// and keeps track of what it finds.
+//
+// Every block is only loaded once, no matter how many links point to it.
+// Work is shared out through a queue: a worker takes a block from it, loads it, and adds any blocks it links to that haven't been seen before.
+// The walk is done when the queue is empty and no worker is busy (because a busy worker might still add more).
+type walker struct {
+	store   *workspace.LazyStorage
+	workers int
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []string
+	pending int // Blocks in the queue, or being worked on.
+	err     error
+
+	blocks  map[string]*blockInfo // Every block that's been queued, by key (the binary form of its CID).
+	targets map[string]struct{}   // Every block that's been linked to.
+	links   int64
+}
+
+type blockInfo struct {
+	missing  bool
+	codec    string
+	size     int
+	links    int      // How many links are in the block.
+	children []string // The blocks this one links to (each only once).
+}
+
+func newWalker(store *workspace.LazyStorage, workers int) *walker {
+	w := &walker{
+		store:   store,
+		workers: workers,
+		blocks:  map[string]*blockInfo{},
+		targets: map[string]struct{}{},
+	}
+	w.cond = sync.NewCond(&w.mu)
+	return w
+}
+
+// walk loads all the blocks given, and everything they link to, recursively.
+// It returns the first error any worker hits, after all the workers have stopped.
+func (w *walker) walk(ctx context.Context, start []string) error {
+	for _, key := range start {
+		if _, seen := w.blocks[key]; !seen {
+			w.blocks[key] = &blockInfo{}
+			w.queue = append(w.queue, key)
+		}
+	}
+	w.pending = len(w.queue)
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.work(ctx)
+		}()
+	}
+	wg.Wait()
+	return w.err
+}
+
+// work is what each worker does: take a block from the queue, and handle it, until there's nothing left to do (or something's failed).
+func (w *walker) work(ctx context.Context) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for {
+		for len(w.queue) == 0 && w.pending > 0 && w.err == nil {
+			w.cond.Wait()
+		}
+		if w.pending == 0 || w.err != nil {
+			w.cond.Broadcast() // Wake up any other workers, so they can see it's over too.
+			return
+		}
+		key := w.queue[0]
+		w.queue = w.queue[1:]
+		info := w.blocks[key]
+
+		w.mu.Unlock()
+		children, err := w.load(ctx, key, info)
+		w.mu.Lock()
+
+		if err != nil {
+			if w.err == nil {
+				w.err = err
+			}
+			continue
+		}
+		info.links = len(children)
+		seen := map[string]struct{}{}
+		for _, child := range children {
+			w.links++
+			w.targets[child] = struct{}{}
+			if _, ok := seen[child]; ok {
+				continue
+			}
+			seen[child] = struct{}{}
+			info.children = append(info.children, child)
+			if _, ok := w.blocks[child]; !ok {
+				w.blocks[child] = &blockInfo{}
+				w.queue = append(w.queue, child)
+				w.pending++
+			}
+		}
+		w.pending--
+		w.cond.Broadcast()
+	}
+}
+
+// load loads a block, and fills in what's known about it, returning the blocks it links to (in the order the links are in the block, including repeats).
+// It's called without the walker's lock held: the info is only touched by the one worker loading it.
+func (w *walker) load(ctx context.Context, key string, info *blockInfo) ([]string, error) {
+	c, err := cid.Cast([]byte(key))
+	if err != nil {
+		return nil, ipldtoolerr.Newf(shared.ErrCode_DataInvalid, "the storage holds something that isn't keyed by a CID: %s", err)
+	}
+	lnk := cidlink.Link{Cid: c}
+	codecInfo, _ := shared.LookupCodec(c.Prefix().Codec)
+	info.codec = codecInfo.Name
+
+	has, err := w.store.Has(ctx, key)
+	if _, coded := err.(*ipldtoolerr.Error); coded {
+		return nil, err // Errors from opening the storage already say what went wrong.
+	} else if err != nil {
+		return nil, ipldtoolerr.Newf(shared.ErrCode_LoadFailed, "could not load %s: %s", lnk, err)
+	}
+	if !has {
+		info.missing = true
+		return nil, nil
+	}
+	raw, err := w.store.Get(ctx, key)
+	if _, coded := err.(*ipldtoolerr.Error); coded {
+		return nil, err
+	} else if err != nil {
+		return nil, ipldtoolerr.Newf(shared.ErrCode_LoadFailed, "could not load %s: %s", lnk, err)
+	}
+	info.size = len(raw)
+
+	// If there's no way to see inside the block, it's measured, but can't link to anything.
+	if codecInfo.Decoder == nil {
+		return nil, nil
+	}
+	np, err := shared.ChoosePrototype(lnk, linking.LinkContext{Ctx: ctx})
+	if err != nil {
+		return nil, err
+	}
+	n, err := ipld.DecodeUsingPrototype(raw, codecInfo.Decoder, np)
+	if err != nil {
+		return nil, ipldtoolerr.Newf(shared.ErrCode_DataInvalid, "could not decode %s as %s: %s", lnk, codecInfo.Name, err)
+	}
+	var children []string
+	err = shared.WalkLinks(n, nil, func(_ datamodel.Path, child datamodel.Link, _ selector.Selector) error {
+		children = append(children, child.Binary())
+		return nil
+	})
+	if err != nil {
+		return nil, ipldtoolerr.Newf(shared.ErrCode_DataInvalid, "could not walk the links in %s: %s", lnk, err)
+	}
+	return children, nil
+}
+
+// report totals up everything the walk found.
+func (w *walker) report() *report {
+	r := &report{
+		codecs:     map[string]*codecReport{},
+		fanOut:     map[int]int64{},
+		links:      w.links,
+		duplicates: w.links - int64(len(w.targets)),
+	}
+	for _, info := range w.blocks {
+		if info.missing {
+			r.missing++
+			continue
+		}
+		r.blocks++
+		r.bytes += int64(info.size)
+		cr := r.codecs[info.codec]
+		if cr == nil {
+			cr = &codecReport{}
+			r.codecs[info.codec] = cr
+		}
+		cr.blocks++
+		cr.bytes += int64(info.size)
+		r.fanOut[fanOutBucket(info.links)]++
+	}
+
+	// The max depth is the longest chain of links from any block.
+	//  (When walking from a root, that's always the chain from the root, since everything else is beneath it.)
+	//  Depths are remembered, so each block is only worked out once.
+	depths := map[string]int{}
+	var depth func(key string) int
+	depth = func(key string) int {
+		if d, ok := depths[key]; ok {
+			return d
+		}
+		d := 0
+		for _, child := range w.blocks[key].children {
+			if cd := depth(child) + 1; cd > d {
+				d = cd
+			}
+		}
+		depths[key] = d
+		return d
+	}
+	for key := range w.blocks {
+		if d := depth(key); d > r.maxDepth {
+			r.maxDepth = d
+		}
+	}
+	return r
+}
@@ -0,0 +1,6 @@
+package unixfs
+
+const (
+	ErrCode_UnixFSInvalid     = "ipldtool-error-unixfs-invalid"
+	ErrCode_UnixFSUnsupported = "ipldtool-error-unixfs-unsupported"
+)
@@ -0,0 +1,464 @@
+package unixfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ipfs/go-bitfield"
+	"github.com/ipfs/go-cid"
+	chunk "github.com/ipfs/go-ipfs-chunker"
+	"github.com/ipfs/go-unixfsnode/data"
+	"github.com/ipfs/go-unixfsnode/data/builder"
+	dagpb "github.com/ipld/go-codec-dagpb"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/spaolacci/murmur3"
+
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+const (
+	// DefaultChunker is the chunker spec used if none is given.  It's the same as go-ipfs's default.
+	DefaultChunker = "size-262144"
+
+	// DefaultShardThreshold is the estimated directory size (in bytes) at which directories switch to being HAMT-sharded.
+	// It's the same as go-ipfs's default.
+	DefaultShardThreshold = 256 * 1024
+
+	// linksPerBlock is the maximum number of children in one intermediate node of a file.
+	// It's the same as go-ipfs's default ("helpers.DefaultLinksPerBlock").
+	linksPerBlock = 174
+
+	// hamtFanout is the width of each HAMT shard; hamtHashMurmur3 is the multihash code for the hash function we use to place entries in them.
+	hamtFanout      = 256
+	hamtHashMurmur3 = 0x22
+)
+
+var (
+	rawPrefix   = cidlink.LinkPrototype{Prefix: cid.Prefix{Version: 1, Codec: 0x55, MhType: 0x12, MhLength: 32}}
+	dagpbPrefix = cidlink.LinkPrototype{Prefix: cid.Prefix{Version: 1, Codec: 0x70, MhType: 0x12, MhLength: 32}}
+)
+
+// Packer builds UnixFS (v1) DAGs out of files on the local filesystem, storing each block with the LinkSystem as it goes.
+//
+// The DAGs are built the same way go-ipfs builds them when given the "--cid-version=1" option
+// (which also implies raw leaves and sha2-256 hashing).
+// That means the same content should result in the same CIDs, given the same chunker spec.
+// Files use the balanced layout; directories use plain dag-pb directories,
+// switching to HAMT sharding when the directory would otherwise be too large.
+type Packer struct {
+	LinkSystem *linking.LinkSystem
+
+	// Chunker is a go-ipfs-chunker spec, e.g. "size-262144", or "rabin", or "rabin-{min}-{avg}-{max}".
+	// If empty, DefaultChunker is used.
+	Chunker string
+
+	// ShardThreshold is the estimated size at which directories become HAMT-sharded.
+	// The estimate is the sum of the lengths of each entry's name and CID, which is the same as go-ipfs uses.
+	// If zero, DefaultShardThreshold is used.
+	ShardThreshold int
+
+	// PreserveMode and PreserveMtime cause the UnixFS 1.5 metadata fields to be populated from the filesystem.
+	// Note that these change the resulting CIDs.
+	PreserveMode  bool
+	PreserveMtime bool
+}
+
+// packed describes a node that's been stored, with all the things its parent will need to know about it.
+type packed struct {
+	link     datamodel.Link
+	tsize    uint64 // the cumulative size of the serialized node and all its children; this is what goes in the "Tsize" of links to it.
+	filesize uint64 // for file content only: the size of the content bytes under this node.
+}
+
+// Pack builds a UnixFS DAG for the file or directory at the given path, and returns the link to the root of it.
+// Symlinks are stored as UnixFS symlinks, rather than followed.
+// Other special files (devices, sockets, etc) are rejected.
+//
+// Errors:
+//
+//   - ipldtool-error-io -- if the files can't be read, or the storage can't be written.
+//   - ipldtool-error-invalid-args -- if the chunker spec isn't valid.
+//   - ipldtool-error-unixfs-unsupported -- if there's a kind of file that UnixFS can't describe.
+func (p *Packer) Pack(path string) (datamodel.Link, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, ipldtoolerr.Newf("ipldtool-error-io", "could not stat %q: %s", path, err)
+	}
+	res, err := p.packPath(path, info)
+	if err != nil {
+		return nil, err
+	}
+	return res.link, nil
+}
+
+func (p *Packer) packPath(path string, info os.FileInfo) (packed, error) {
+	switch {
+	case info.Mode().IsRegular():
+		return p.packFile(path, info)
+	case info.IsDir():
+		return p.packDirectory(path, info)
+	case info.Mode()&os.ModeSymlink != 0:
+		return p.packSymlink(path)
+	default:
+		return packed{}, ipldtoolerr.Newf(ErrCode_UnixFSUnsupported, "cannot pack %q: UnixFS can't describe files of type %s", path, info.Mode().Type())
+	}
+}
+
+// metadata applies the UnixFS 1.5 metadata fields, if we were asked to preserve them.
+func (p *Packer) metadata(b *builder.Builder, info os.FileInfo) {
+	if p.PreserveMode {
+		mode := info.Mode().Perm()
+		if info.Mode()&os.ModeSetuid != 0 {
+			mode |= 04000
+		}
+		if info.Mode()&os.ModeSetgid != 0 {
+			mode |= 02000
+		}
+		if info.Mode()&os.ModeSticky != 0 {
+			mode |= 01000
+		}
+		builder.Permissions(b, int(mode))
+	}
+	if p.PreserveMtime {
+		builder.Mtime(b, func(tb builder.TimeBuilder) {
+			builder.Seconds(tb, info.ModTime().Unix())
+			if nsec := info.ModTime().Nanosecond(); nsec != 0 {
+				builder.FractionalNanoseconds(tb, int32(nsec))
+			}
+		})
+	}
+}
+
+func (p *Packer) wantsMetadata() bool {
+	return p.PreserveMode || p.PreserveMtime
+}
+
+// --- files ---
+
+// chunkStream wraps a Splitter so that we can tell if we're at the end before asking for the next chunk.
+// (This is how the balanced layout decides whether it needs to go another level deeper.)
+type chunkStream struct {
+	spl  chunk.Splitter
+	next []byte
+	err  error
+}
+
+func (cs *chunkStream) advance() {
+	cs.next, cs.err = cs.spl.NextBytes()
+}
+
+func (cs *chunkStream) done() bool {
+	return cs.err != nil
+}
+
+func (cs *chunkStream) pop() []byte {
+	b := cs.next
+	cs.advance()
+	return b
+}
+
+// fileNode is an intermediate node of a file, under construction.
+type fileNode struct {
+	children []packed
+}
+
+func (p *Packer) packFile(path string, info os.FileInfo) (packed, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return packed{}, ipldtoolerr.Newf("ipldtool-error-io", "could not open %q: %s", path, err)
+	}
+	defer f.Close()
+
+	chunker := p.Chunker
+	if chunker == "" {
+		chunker = DefaultChunker
+	}
+	spl, err := chunk.FromString(f, chunker)
+	if err != nil {
+		return packed{}, ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "invalid chunker spec %q: %s", chunker, err)
+	}
+	cs := &chunkStream{spl: spl}
+	cs.advance()
+
+	// The first leaf is the root, until we find out there's more than one.
+	//  (An empty file is a single empty leaf.)
+	leaf, err := p.storeLeaf(cs.pop())
+	if err != nil {
+		return packed{}, err
+	}
+	// Each time we run out of room, the old root becomes the first child of a new root one level deeper.
+	var root *fileNode
+	for depth := 1; !cs.done(); depth++ {
+		newRoot := &fileNode{}
+		if root == nil {
+			newRoot.children = append(newRoot.children, leaf)
+		} else {
+			child, err := p.storeFileNode(root, nil)
+			if err != nil {
+				return packed{}, err
+			}
+			newRoot.children = append(newRoot.children, child)
+		}
+		if err := p.fillFileNode(cs, newRoot, depth); err != nil {
+			return packed{}, err
+		}
+		root = newRoot
+	}
+	if cs.err != io.EOF {
+		return packed{}, ipldtoolerr.Newf("ipldtool-error-io", "could not read %q: %s", path, cs.err)
+	}
+
+	// If there's metadata, it has to go in a dag-pb node, so a raw leaf by itself won't do for the root.
+	if root == nil && p.wantsMetadata() {
+		root = &fileNode{children: []packed{leaf}}
+	}
+	if root == nil {
+		return leaf, nil
+	}
+	return p.storeFileNode(root, info)
+}
+
+// fillFileNode adds children to the node until either it's full or the content runs out.
+// At depth 1, the children are leaves; above that, the children are themselves filled intermediate nodes.
+func (p *Packer) fillFileNode(cs *chunkStream, n *fileNode, depth int) error {
+	for len(n.children) < linksPerBlock && !cs.done() {
+		var child packed
+		var err error
+		if depth == 1 {
+			child, err = p.storeLeaf(cs.pop())
+		} else {
+			sub := &fileNode{}
+			if err := p.fillFileNode(cs, sub, depth-1); err != nil {
+				return err
+			}
+			child, err = p.storeFileNode(sub, nil)
+		}
+		if err != nil {
+			return err
+		}
+		n.children = append(n.children, child)
+	}
+	return nil
+}
+
+func (p *Packer) storeLeaf(content []byte) (packed, error) {
+	if content == nil {
+		content = []byte{}
+	}
+	lnk, err := p.LinkSystem.Store(linking.LinkContext{Ctx: context.Background()}, rawPrefix, basicnode.NewBytes(content))
+	if err != nil {
+		return packed{}, ipldtoolerr.Newf("ipldtool-error-io", "could not store block: %s", err)
+	}
+	return packed{link: lnk, tsize: uint64(len(content)), filesize: uint64(len(content))}, nil
+}
+
+// storeFileNode stores an intermediate file node.  If info is non-nil, metadata will be attached (if we're preserving any).
+func (p *Packer) storeFileNode(n *fileNode, info os.FileInfo) (packed, error) {
+	var filesize uint64
+	blocksizes := make([]uint64, len(n.children))
+	links := make([]dirEntry, len(n.children))
+	for i, child := range n.children {
+		filesize += child.filesize
+		blocksizes[i] = child.filesize
+		links[i] = dirEntry{name: "", packed: child}
+	}
+	ufsData, err := builder.BuildUnixFS(func(b *builder.Builder) {
+		builder.DataType(b, data.Data_File)
+		builder.FileSize(b, filesize)
+		builder.BlockSizes(b, blocksizes)
+		if info != nil {
+			p.metadata(b, info)
+		}
+	})
+	if err != nil {
+		return packed{}, ipldtoolerr.Newf("ipldtool-error-io", "could not build unixfs data: %s", err)
+	}
+	res, err := p.storeDagpb(links, ufsData)
+	res.filesize = filesize
+	return res, err
+}
+
+// --- directories ---
+
+// dirEntry is a named child of a directory (or an unnamed child of a file node, in which case the name is empty).
+type dirEntry struct {
+	name string
+	packed
+}
+
+func (p *Packer) packDirectory(path string, info os.FileInfo) (packed, error) {
+	dirents, err := os.ReadDir(path)
+	if err != nil {
+		return packed{}, ipldtoolerr.Newf("ipldtool-error-io", "could not read directory %q: %s", path, err)
+	}
+	entries := make([]dirEntry, 0, len(dirents))
+	estimatedSize := 0
+	for _, dirent := range dirents {
+		childPath := filepath.Join(path, dirent.Name())
+		childInfo, err := os.Lstat(childPath)
+		if err != nil {
+			return packed{}, ipldtoolerr.Newf("ipldtool-error-io", "could not stat %q: %s", childPath, err)
+		}
+		child, err := p.packPath(childPath, childInfo)
+		if err != nil {
+			return packed{}, err
+		}
+		entries = append(entries, dirEntry{name: dirent.Name(), packed: child})
+		estimatedSize += len(dirent.Name()) + len(child.link.(cidlink.Link).Bytes())
+	}
+
+	threshold := p.ShardThreshold
+	if threshold == 0 {
+		threshold = DefaultShardThreshold
+	}
+	if estimatedSize >= threshold {
+		return p.packHAMT(entries, info)
+	}
+
+	ufsData, err := builder.BuildUnixFS(func(b *builder.Builder) {
+		builder.DataType(b, data.Data_Directory)
+		p.metadata(b, info)
+	})
+	if err != nil {
+		return packed{}, ipldtoolerr.Newf("ipldtool-error-io", "could not build unixfs data: %s", err)
+	}
+	return p.storeDagpb(entries, ufsData)
+}
+
+// hamtShard is one node of a HAMT-sharded directory, under construction.
+// Each slot holds either an entry, or another shard (if more than one entry landed in the same slot).
+type hamtShard struct {
+	slots [hamtFanout]*hamtSlot
+}
+
+type hamtSlot struct {
+	entry *dirEntry
+	hash  []byte
+	shard *hamtShard
+}
+
+func hamtHash(name string) []byte {
+	h := murmur3.New64()
+	h.Write([]byte(name))
+	return h.Sum(nil)
+}
+
+func (s *hamtShard) insert(entry *dirEntry, hash []byte, depth int) {
+	idx := hash[depth] // with a fanout of 256, each level consumes exactly one byte of the hash.
+	slot := s.slots[idx]
+	switch {
+	case slot == nil:
+		s.slots[idx] = &hamtSlot{entry: entry, hash: hash}
+	case slot.shard != nil:
+		slot.shard.insert(entry, hash, depth+1)
+	default:
+		// Collision: push both the existing entry and the new one down into a new shard.
+		sub := &hamtShard{}
+		sub.insert(slot.entry, slot.hash, depth+1)
+		sub.insert(entry, hash, depth+1)
+		s.slots[idx] = &hamtSlot{shard: sub}
+	}
+}
+
+func (p *Packer) packHAMT(entries []dirEntry, info os.FileInfo) (packed, error) {
+	root := &hamtShard{}
+	for i := range entries {
+		root.insert(&entries[i], hamtHash(entries[i].name), 0)
+	}
+	return p.storeHAMTShard(root, info)
+}
+
+func (p *Packer) storeHAMTShard(s *hamtShard, info os.FileInfo) (packed, error) {
+	bf := bitfield.NewBitfield(hamtFanout)
+	var links []dirEntry
+	for idx, slot := range s.slots {
+		if slot == nil {
+			continue
+		}
+		bf.SetBit(idx)
+		prefix := fmt.Sprintf("%02X", idx)
+		if slot.shard != nil {
+			child, err := p.storeHAMTShard(slot.shard, nil)
+			if err != nil {
+				return packed{}, err
+			}
+			links = append(links, dirEntry{name: prefix, packed: child})
+		} else {
+			links = append(links, dirEntry{name: prefix + slot.entry.name, packed: slot.entry.packed})
+		}
+	}
+	ufsData, err := builder.BuildUnixFS(func(b *builder.Builder) {
+		builder.DataType(b, data.Data_HAMTShard)
+		builder.Data(b, bf.Bytes())
+		builder.HashType(b, hamtHashMurmur3)
+		builder.Fanout(b, hamtFanout)
+		if info != nil {
+			p.metadata(b, info)
+		}
+	})
+	if err != nil {
+		return packed{}, ipldtoolerr.Newf("ipldtool-error-io", "could not build unixfs data: %s", err)
+	}
+	return p.storeDagpb(links, ufsData)
+}
+
+// --- symlinks ---
+
+func (p *Packer) packSymlink(path string) (packed, error) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return packed{}, ipldtoolerr.Newf("ipldtool-error-io", "could not read symlink %q: %s", path, err)
+	}
+	ufsData, err := builder.BuildUnixFS(func(b *builder.Builder) {
+		builder.DataType(b, data.Data_Symlink)
+		builder.Data(b, []byte(target))
+	})
+	if err != nil {
+		return packed{}, ipldtoolerr.Newf("ipldtool-error-io", "could not build unixfs data: %s", err)
+	}
+	return p.storeDagpb(nil, ufsData)
+}
+
+// --- common ---
+
+// storeDagpb assembles a dag-pb node from links and unixfs data, and stores it.
+// Links are sorted by name, as dag-pb requires.
+// The returned tsize is the size of the serialized node plus the tsizes of all the links.
+func (p *Packer) storeDagpb(links []dirEntry, ufsData data.UnixFSData) (packed, error) {
+	sort.SliceStable(links, func(i, j int) bool { return links[i].name < links[j].name })
+	tsize := uint64(0)
+	n, err := qp.BuildMap(dagpb.Type.PBNode, 2, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "Links", qp.List(int64(len(links)), func(la datamodel.ListAssembler) {
+			for _, l := range links {
+				tsize += l.tsize
+				qp.ListEntry(la, qp.Map(3, func(ma datamodel.MapAssembler) {
+					qp.MapEntry(ma, "Hash", qp.Link(l.link))
+					qp.MapEntry(ma, "Name", qp.String(l.name))
+					qp.MapEntry(ma, "Tsize", qp.Int(int64(l.tsize)))
+				}))
+			}
+		}))
+		qp.MapEntry(ma, "Data", qp.Bytes(data.EncodeUnixFSData(ufsData)))
+	})
+	if err != nil {
+		return packed{}, ipldtoolerr.Newf("ipldtool-error-io", "could not build dag-pb node: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := dagpb.Encode(n, &buf); err != nil {
+		return packed{}, ipldtoolerr.Newf("ipldtool-error-io", "could not encode dag-pb node: %s", err)
+	}
+	lnk, err := p.LinkSystem.Store(linking.LinkContext{Ctx: context.Background()}, dagpbPrefix, n)
+	if err != nil {
+		return packed{}, ipldtoolerr.Newf("ipldtool-error-io", "could not store block: %s", err)
+	}
+	return packed{link: lnk, tsize: uint64(buf.Len()) + tsize}, nil
+}
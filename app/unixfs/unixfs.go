@@ -0,0 +1,130 @@
+package unixfs
+
+import (
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/urfave/cli/v2"
+
+	"github.com/ipld/go-ipldtool/app/workspace"
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+var Cmd_Fs = &cli.Command{
+	Name:     "fs",
+	Category: "Filesystems",
+	Usage:    "Pack files and directories into UnixFS DAGs (the format IPFS uses), or unpack them again.",
+	Subcommands: []*cli.Command{{
+		Name:  "pack",
+		Usage: "Store a file or directory as UnixFS in the workspace storage, and print the CID of the root.",
+		UsageText: `ipld fs pack [--chunker=<spec>] [--shard-threshold=<bytes>] [--preserve-mode] [--preserve-mtime] <path>` + "\n" +
+			"\n" +
+			`   The DAG is built the same way go-ipfs builds it with "ipfs add --cid-version=1" (which also implies raw leaves),` + "\n" +
+			`   so the same content and chunker settings should produce the same CIDs.` + "\n" +
+			"\n" +
+			`   Files are chunked and laid out as balanced trees.` + "\n" +
+			`   Directories are stored as dag-pb directories, or as HAMT-sharded directories if they're large.` + "\n" +
+			`   Symlinks are stored as symlinks (not followed).`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "chunker",
+				Usage:       `How to split file content into blocks.  Either "size-<bytes>" for fixed-size chunks, or "rabin" or "rabin-<min>-<avg>-<max>" for content-defined chunks.  (These are the same as go-ipfs's chunker specs.)`,
+				DefaultText: DefaultChunker,
+			},
+			&cli.IntFlag{
+				Name:        "shard-threshold",
+				Usage:       `The estimated size (in bytes) at which a directory will be HAMT-sharded.  The estimate is the sum of the lengths of the names and CIDs of each entry.`,
+				DefaultText: fmt.Sprintf("%d", DefaultShardThreshold),
+			},
+			&cli.BoolFlag{
+				Name:  "preserve-mode",
+				Usage: `Record file permissions, using the UnixFS 1.5 metadata fields.  (This changes the resulting CIDs.)`,
+			},
+			&cli.BoolFlag{
+				Name:  "preserve-mtime",
+				Usage: `Record file modification times, using the UnixFS 1.5 metadata fields.  (This changes the resulting CIDs.)`,
+			},
+		},
+		Action: Action_FsPack,
+	}, {
+		Name:  "unpack",
+		Usage: "Write out a UnixFS file or directory from the workspace storage to the local filesystem.",
+		UsageText: `ipld fs unpack <CID> <path>` + "\n" +
+			"\n" +
+			`   Nothing may exist at the target path yet.` + "\n" +
+			`   Permissions and modification times are applied if the data contains UnixFS 1.5 metadata.`,
+		Action: Action_FsUnpack,
+	}},
+}
+
+// Action_FsPack is the 'ipld fs pack' command.
+// It prints the CID of the root of the new DAG.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- for incomprehensible or invalid arguments.
+//   - ipldtool-workspace-not-found -- if there's no workspace to store the data in.
+//   - ipldtool-error-io -- if the files can't be read, or the storage can't be opened or written.
+//   - ipldtool-error-unixfs-unsupported -- if there's a kind of file that UnixFS can't describe.
+func Action_FsPack(args *cli.Context) error {
+	if args.Args().Len() != 1 {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'fs pack' command needs exactly one positional argument")
+	}
+	if args.Int("shard-threshold") < 0 {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "shard-threshold argument must not be negative")
+	}
+
+	store, err := workspace.OpenStorage()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.SetWriteStorage(store)
+
+	packer := Packer{
+		LinkSystem:     &lsys,
+		Chunker:        args.String("chunker"),
+		ShardThreshold: args.Int("shard-threshold"),
+		PreserveMode:   args.Bool("preserve-mode"),
+		PreserveMtime:  args.Bool("preserve-mtime"),
+	}
+	lnk, err := packer.Pack(args.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(args.App.Writer, "%s\n", lnk)
+	return nil
+}
+
+// Action_FsUnpack is the 'ipld fs unpack' command.
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- for incomprehensible or invalid arguments.
+//   - ipldtool-workspace-not-found -- if there's no workspace to load the data from.
+//   - ipldtool-error-io -- if the target already exists, or files can't be written, or the storage can't be opened.
+//   - ipldtool-error-load-failed -- if a block can't be loaded (e.g. because it's not in storage).
+//   - ipldtool-error-unixfs-invalid -- if the data isn't valid UnixFS.
+//   - ipldtool-error-unixfs-unsupported -- if the data is a kind of UnixFS node we don't know how to write out.
+func Action_FsUnpack(args *cli.Context) error {
+	if args.Args().Len() != 2 {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "'fs unpack' command needs exactly two positional arguments")
+	}
+	c, err := cid.Decode(args.Args().Get(0))
+	if err != nil {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "%q is not a valid CID: %s", args.Args().Get(0), err)
+	}
+
+	store, err := workspace.OpenStorage()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.SetReadStorage(store)
+
+	unpacker := Unpacker{LinkSystem: &lsys}
+	return unpacker.Unpack(cidlink.Link{Cid: c}, args.Args().Get(1))
+}
@@ -0,0 +1,257 @@
+package unixfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-unixfsnode/data"
+	dagpb "github.com/ipld/go-codec-dagpb"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+
+	"github.com/ipld/go-ipldtool/app/shared"
+	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
+)
+
+// Unpacker writes UnixFS DAGs back out to the local filesystem, loading blocks with the LinkSystem as it goes.
+//
+// Files, directories (including HAMT-sharded ones), and symlinks are supported.
+// Any UnixFS 1.5 metadata (mode and mtime) found in the DAG is applied to the files it describes.
+type Unpacker struct {
+	LinkSystem *linking.LinkSystem
+}
+
+// Unpack writes out the file or directory that the link points to, at the given path.
+// Nothing may exist at the target path yet.
+//
+// Errors:
+//
+//   - ipldtool-error-io -- if the target already exists, or files can't be written.
+//   - ipldtool-error-load-failed -- if a block can't be loaded (e.g. because it's not in storage).
+//   - ipldtool-error-unixfs-invalid -- if the data isn't valid UnixFS.
+//   - ipldtool-error-unixfs-unsupported -- if the data is a kind of UnixFS node we don't know how to write out.
+func (u *Unpacker) Unpack(lnk datamodel.Link, target string) error {
+	if _, err := os.Lstat(target); err == nil {
+		return ipldtoolerr.Newf("ipldtool-error-io", "cannot unpack to %q: something already exists there", target)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return ipldtoolerr.Newf("ipldtool-error-io", "cannot unpack to %q: %s", target, err)
+	}
+	return u.unpack(lnk, target)
+}
+
+func (u *Unpacker) unpack(lnk datamodel.Link, target string) error {
+	// Raw blocks are always just file content.
+	if isRaw(lnk) {
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			return ipldtoolerr.Newf("ipldtool-error-io", "could not create %q: %s", target, err)
+		}
+		defer f.Close()
+		return u.writeFileContent(f, lnk)
+	}
+
+	pbn, ufsData, err := u.loadDagpb(lnk)
+	if err != nil {
+		return err
+	}
+	switch ufsData.FieldDataType().Int() {
+	case data.Data_File, data.Data_Raw:
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			return ipldtoolerr.Newf("ipldtool-error-io", "could not create %q: %s", target, err)
+		}
+		err = u.writeFileNode(f, pbn, ufsData)
+		if err2 := f.Close(); err == nil && err2 != nil {
+			err = ipldtoolerr.Newf("ipldtool-error-io", "could not write %q: %s", target, err2)
+		}
+		if err != nil {
+			return err
+		}
+	case data.Data_Directory:
+		if err := os.Mkdir(target, 0755); err != nil {
+			return ipldtoolerr.Newf("ipldtool-error-io", "could not create directory %q: %s", target, err)
+		}
+		itr := pbn.FieldLinks().Iterator()
+		for !itr.Done() {
+			_, pbl := itr.Next()
+			name := ""
+			if pbl.FieldName().Exists() {
+				name = pbl.FieldName().Must().String()
+			}
+			if err := u.unpackEntry(pbl.FieldHash().Link(), target, name); err != nil {
+				return err
+			}
+		}
+	case data.Data_HAMTShard:
+		if err := os.Mkdir(target, 0755); err != nil {
+			return ipldtoolerr.Newf("ipldtool-error-io", "could not create directory %q: %s", target, err)
+		}
+		if err := u.unpackHAMTShard(pbn, ufsData, target); err != nil {
+			return err
+		}
+	case data.Data_Symlink:
+		if !ufsData.FieldData().Exists() {
+			return ipldtoolerr.Newf(ErrCode_UnixFSInvalid, "symlink node %s has no target", lnk)
+		}
+		if err := os.Symlink(string(ufsData.FieldData().Must().Bytes()), target); err != nil {
+			return ipldtoolerr.Newf("ipldtool-error-io", "could not create symlink %q: %s", target, err)
+		}
+		return nil // Metadata is not applicable to symlinks.
+	default:
+		return ipldtoolerr.Newf(ErrCode_UnixFSUnsupported, "cannot unpack %s: UnixFS node type %d is not supported", lnk, ufsData.FieldDataType().Int())
+	}
+
+	// Apply metadata last: setting the mode might make the thing unwritable, and writing content would change the mtime.
+	if ufsData.FieldMode().Exists() {
+		if err := os.Chmod(target, unixPermsToFileMode(ufsData.Permissions())); err != nil {
+			return ipldtoolerr.Newf("ipldtool-error-io", "could not set mode of %q: %s", target, err)
+		}
+	}
+	if ufsData.FieldMtime().Exists() {
+		mtime := ufsData.FieldMtime().Must()
+		nsec := int64(0)
+		if mtime.FieldFractionalNanoseconds().Exists() {
+			nsec = mtime.FieldFractionalNanoseconds().Must().Int()
+		}
+		t := time.Unix(mtime.FieldSeconds().Int(), nsec)
+		if err := os.Chtimes(target, t, t); err != nil {
+			return ipldtoolerr.Newf("ipldtool-error-io", "could not set mtime of %q: %s", target, err)
+		}
+	}
+	return nil
+}
+
+// unpackEntry checks that a directory entry name is safe to use (e.g. that it can't escape the directory) and then unpacks it.
+func (u *Unpacker) unpackEntry(lnk datamodel.Link, dir string, name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\x00") || (filepath.Separator != '/' && strings.ContainsRune(name, filepath.Separator)) {
+		return ipldtoolerr.Newf(ErrCode_UnixFSInvalid, "directory entry name %q in %q is not usable as a filename", name, dir)
+	}
+	return u.unpack(lnk, filepath.Join(dir, name))
+}
+
+func (u *Unpacker) unpackHAMTShard(pbn dagpb.PBNode, ufsData data.UnixFSData, dir string) error {
+	if !ufsData.FieldFanout().Exists() {
+		return ipldtoolerr.Newf(ErrCode_UnixFSInvalid, "HAMT shard has no fanout")
+	}
+	// Link names start with the slot index, in hex, padded to the width needed for the largest index.
+	//  Names that are longer than that are entries; names that are exactly that long are further shards.
+	width := len(fmt.Sprintf("%X", ufsData.FieldFanout().Must().Int()-1))
+	itr := pbn.FieldLinks().Iterator()
+	for !itr.Done() {
+		_, pbl := itr.Next()
+		name := ""
+		if pbl.FieldName().Exists() {
+			name = pbl.FieldName().Must().String()
+		}
+		switch {
+		case len(name) > width:
+			if err := u.unpackEntry(pbl.FieldHash().Link(), dir, name[width:]); err != nil {
+				return err
+			}
+		case len(name) == width:
+			subPbn, subData, err := u.loadDagpb(pbl.FieldHash().Link())
+			if err != nil {
+				return err
+			}
+			if subData.FieldDataType().Int() != data.Data_HAMTShard {
+				return ipldtoolerr.Newf(ErrCode_UnixFSInvalid, "HAMT shard link %q does not point to another shard", name)
+			}
+			if err := u.unpackHAMTShard(subPbn, subData, dir); err != nil {
+				return err
+			}
+		default:
+			return ipldtoolerr.Newf(ErrCode_UnixFSInvalid, "HAMT shard link name %q is too short", name)
+		}
+	}
+	return nil
+}
+
+// writeFileContent writes the content of a file (or a part of one) to the writer, whether it's a raw block or a dag-pb node.
+func (u *Unpacker) writeFileContent(w io.Writer, lnk datamodel.Link) error {
+	if isRaw(lnk) {
+		n, err := u.LinkSystem.Load(linking.LinkContext{Ctx: context.Background()}, lnk, basicnode.Prototype.Bytes)
+		if err != nil {
+			return ipldtoolerr.Newf(shared.ErrCode_LoadFailed, "could not load %s: %s", lnk, err)
+		}
+		content, _ := n.AsBytes()
+		if _, err := w.Write(content); err != nil {
+			return ipldtoolerr.Newf("ipldtool-error-io", "could not write file content: %s", err)
+		}
+		return nil
+	}
+	pbn, ufsData, err := u.loadDagpb(lnk)
+	if err != nil {
+		return err
+	}
+	switch ufsData.FieldDataType().Int() {
+	case data.Data_File, data.Data_Raw:
+		return u.writeFileNode(w, pbn, ufsData)
+	default:
+		return ipldtoolerr.Newf(ErrCode_UnixFSInvalid, "file contains a link to %s, which is not file content", lnk)
+	}
+}
+
+// writeFileNode writes the data in the node itself (if any), and then the content of all its children, in order.
+func (u *Unpacker) writeFileNode(w io.Writer, pbn dagpb.PBNode, ufsData data.UnixFSData) error {
+	if ufsData.FieldData().Exists() {
+		if _, err := w.Write(ufsData.FieldData().Must().Bytes()); err != nil {
+			return ipldtoolerr.Newf("ipldtool-error-io", "could not write file content: %s", err)
+		}
+	}
+	itr := pbn.FieldLinks().Iterator()
+	for !itr.Done() {
+		_, pbl := itr.Next()
+		if err := u.writeFileContent(w, pbl.FieldHash().Link()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *Unpacker) loadDagpb(lnk datamodel.Link) (dagpb.PBNode, data.UnixFSData, error) {
+	if cl, ok := lnk.(cidlink.Link); ok && cl.Prefix().Codec != 0x70 {
+		return nil, nil, ipldtoolerr.Newf(ErrCode_UnixFSInvalid, "%s is not dag-pb or raw, so it can't be UnixFS", lnk)
+	}
+	n, err := u.LinkSystem.Load(linking.LinkContext{Ctx: context.Background()}, lnk, dagpb.Type.PBNode)
+	if err != nil {
+		return nil, nil, ipldtoolerr.Newf(shared.ErrCode_LoadFailed, "could not load %s: %s", lnk, err)
+	}
+	pbn := n.(dagpb.PBNode)
+	if !pbn.FieldData().Exists() {
+		return nil, nil, ipldtoolerr.Newf(ErrCode_UnixFSInvalid, "%s has no UnixFS data", lnk)
+	}
+	ufsData, err := data.DecodeUnixFSData(pbn.FieldData().Must().Bytes())
+	if err != nil {
+		return nil, nil, ipldtoolerr.Newf(ErrCode_UnixFSInvalid, "%s has invalid UnixFS data: %s", lnk, err)
+	}
+	return pbn, ufsData, nil
+}
+
+func isRaw(lnk datamodel.Link) bool {
+	cl, ok := lnk.(cidlink.Link)
+	return ok && cl.Prefix().Codec == 0x55
+}
+
+// unixPermsToFileMode converts the lower 12 bits of a unix mode into the equivalent os.FileMode.
+func unixPermsToFileMode(perms int) os.FileMode {
+	mode := os.FileMode(perms & 0777)
+	if perms&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if perms&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if perms&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
@@ -1,11 +1,14 @@
 package workspace
 
 import (
+	"context"
 	"errors"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sync"
 
+	"github.com/ipld/go-ipldtool/app/shared"
 	ipldtoolerr "github.com/ipld/go-ipldtool/errors"
 )
 
@@ -101,3 +104,94 @@ func FindFrom(startAt string) (string, error) {
 	// All options exhausted.  Report a not found.
 	return "", ipldtoolerr.Newf("ipldtool-workspace-not-found", "no workspace marker (an '.ipld' dir) found while searching up from %q", startAt)
 }
+
+// OpenStorage finds the nearest workspace (the same way as Find does), and opens its storage.
+// The storage is kept in a "storage" directory inside the '.ipld' directory, and is created if it doesn't exist yet.
+//
+// The caller should Close the storage when done with it.
+//
+// Errors:
+//
+//   - ipldtool-workspace-not-found -- if we tried everything and can't find a workspace.
+//   - ipldtool-error-no-cwd -- if the cwd can't be found!
+//   - ipldtool-error-io -- if there's an io error during the search, or opening the storage.
+func OpenStorage() (shared.Storage, error) {
+	workspaceDir, err := Find()
+	if err != nil {
+		return nil, err
+	}
+	return shared.OpenStorage("flatfs", filepath.Join(workspaceDir, MagicWorkspaceDirname, "storage"))
+}
+
+// LazyStorage is a Storage that doesn't find the workspace or open its storage until the first time it's used.
+// It's for commands which might need storage, but often won't
+// (e.g. read, which only needs storage if it's given a CID, or if pathing crosses links).
+// Those commands then only require a workspace when they actually use one.
+//
+// The zero value is ready to use.  Close is safe to call even if the storage was never opened.
+// It's safe to use from several goroutines at once, as long as the underlying storage is.
+type LazyStorage struct {
+	mu    sync.Mutex
+	store shared.Storage
+	err   error
+}
+
+func (s *LazyStorage) open() (shared.Storage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.store == nil && s.err == nil {
+		s.store, s.err = OpenStorage()
+	}
+	return s.store, s.err
+}
+
+func (s *LazyStorage) Has(ctx context.Context, key string) (bool, error) {
+	store, err := s.open()
+	if err != nil {
+		return false, err
+	}
+	return store.Has(ctx, key)
+}
+
+func (s *LazyStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	store, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	return store.Get(ctx, key)
+}
+
+func (s *LazyStorage) Put(ctx context.Context, key string, content []byte) error {
+	store, err := s.open()
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, key, content)
+}
+
+// Keys lists every key in the storage, if the storage engine can do that (see shared.ListableStorage).
+//
+// Errors:
+//
+//   - ipldtool-error-invalid-args -- if the storage engine can't list its keys.
+//   - any error from opening the storage (see OpenStorage).
+func (s *LazyStorage) Keys(ctx context.Context, fn func(key string) error) error {
+	store, err := s.open()
+	if err != nil {
+		return err
+	}
+	listable, ok := store.(shared.ListableStorage)
+	if !ok {
+		return ipldtoolerr.Newf(ipldtoolerr.ErrCode_InvalidArgs, "the workspace storage can't list what's in it")
+	}
+	return listable.Keys(ctx, fn)
+}
+
+func (s *LazyStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.store == nil {
+		return nil
+	}
+	return s.store.Close()
+}